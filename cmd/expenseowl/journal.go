@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/tanq16/expenseowl/internal/api"
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+const exportJournalUsage = `Usage: expenseowl export-%[1]s [-ledger ID] [-template TEMPLATE] [-balance ACCOUNT] [-o FILE]
+
+Writes all expenses of a ledger in the storage configured through STORAGE_* variables as
+a %[1]s journal, to stdout unless -o is given. Every expense is a transaction between
+the account of its category, named by TEMPLATE (default "%[2]s", where {type}
+is Expenses, or Income for positive amounts), and the balance account (default %[3]s).`
+
+func runExportJournal(format string, args []string) {
+	fs := flag.NewFlagSet("export-"+format, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, exportJournalUsage+"\n", format, api.DefaultAccountTemplate, api.DefaultBalanceAccount)
+	}
+	ledger := fs.String("ledger", "", "ledger to export, defaults to the default ledger")
+	template := fs.String("template", api.DefaultAccountTemplate, "account name of a category, with {type} and {category}")
+	balance := fs.String("balance", api.DefaultBalanceAccount, "account on the other side of every transaction")
+	output := fs.String("o", "", "file to write, defaults to stdout")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	root, err := storage.InitializeStorage()
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	defer root.Close()
+	if *ledger != "" {
+		if _, err := root.GetLedger(*ledger); err != nil {
+			log.Fatalf("Ledger %s does not exist", *ledger)
+		}
+	}
+	store, err := root.ForLedger(*ledger)
+	if err != nil {
+		log.Fatalf("Failed to open ledger: %v", err)
+	}
+	currency, err := store.GetCurrency()
+	if err != nil {
+		log.Fatalf("Failed to read currency: %v", err)
+	}
+	expenses, err := store.GetAllExpenses()
+	if err != nil {
+		log.Fatalf("Failed to read expenses: %v", err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			log.Fatalf("Failed to create %s: %v", *output, err)
+		}
+		defer file.Close()
+		w = file
+	}
+	opts := api.JournalOptions{Format: format, AccountTemplate: *template, BalanceAccount: *balance, Currency: currency}
+	if err := api.WriteJournal(w, expenses, opts); err != nil {
+		log.Fatalf("Failed to export %s journal: %v", format, err)
+	}
+	if *output != "" {
+		log.Printf("Exported %d expenses to %s\n", len(expenses), *output)
+	}
+}
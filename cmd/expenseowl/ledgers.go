@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+const ledgerUsage = `Usage: expenseowl ledger COMMAND [args]
+
+Manages the ledgers (books) of the storage configured through STORAGE_* variables.
+
+Commands:
+  list                         list ledgers
+  create ID [-name NAME]       create an empty ledger
+  rename ID NAME               change a ledger's display name
+  archive ID                   make a ledger read-only
+  unarchive ID                 make an archived ledger writable again
+  delete ID [-force]           delete an archived ledger and all of its data
+                               (-force also deletes a ledger that is not archived)`
+
+func runLedger(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, ledgerUsage)
+		os.Exit(2)
+	}
+	command, args := args[0], args[1:]
+	needsArgs := func(n int) []string {
+		if len(args) < n {
+			fmt.Fprintln(os.Stderr, ledgerUsage)
+			os.Exit(2)
+		}
+		return args
+	}
+
+	store, err := storage.InitializeStorage()
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	defer store.Close()
+
+	lookup := func(id string) storage.Ledger {
+		ledger, err := store.GetLedger(id)
+		if err != nil {
+			log.Fatalf("Ledger %s does not exist", id)
+		}
+		return ledger
+	}
+
+	switch command {
+	case "list":
+		ledgers, err := store.GetLedgers()
+		if err != nil {
+			log.Fatalf("Failed to list ledgers: %v", err)
+		}
+		for _, l := range ledgers {
+			state := "active"
+			if l.Archived {
+				state = "archived"
+			}
+			created := "-"
+			if !l.CreatedAt.IsZero() {
+				created = l.CreatedAt.Format(time.DateOnly)
+			}
+			fmt.Printf("%s\t%s\t%s\tcreated %s\n", l.ID, l.Name, state, created)
+		}
+
+	case "create":
+		id := needsArgs(1)[0]
+		fs := flag.NewFlagSet("ledger create", flag.ExitOnError)
+		name := fs.String("name", "", "display name, defaults to the ID")
+		fs.Parse(args[1:])
+		ledger := storage.Ledger{ID: id, Name: *name}
+		if ledger.Name == "" {
+			ledger.Name = id
+		}
+		if err := store.AddLedger(ledger); err != nil {
+			log.Fatalf("Failed to create ledger: %v", err)
+		}
+		log.Printf("Created ledger %s\n", id)
+
+	case "rename":
+		args := needsArgs(2)
+		ledger := lookup(args[0])
+		ledger.Name = args[1]
+		if err := store.UpdateLedger(ledger); err != nil {
+			log.Fatalf("Failed to rename ledger: %v", err)
+		}
+		log.Printf("Renamed ledger %s to %s\n", ledger.ID, ledger.Name)
+
+	case "archive", "unarchive":
+		ledger := lookup(needsArgs(1)[0])
+		ledger.Archived = command == "archive"
+		if err := store.UpdateLedger(ledger); err != nil {
+			log.Fatalf("Failed to %s ledger: %v", command, err)
+		}
+		log.Printf("Ledger %s is now %sd\n", ledger.ID, command)
+
+	case "delete":
+		id := needsArgs(1)[0]
+		fs := flag.NewFlagSet("ledger delete", flag.ExitOnError)
+		force := fs.Bool("force", false, "delete even if the ledger is not archived")
+		fs.Parse(args[1:])
+		if ledger := lookup(id); !ledger.Archived && !*force {
+			log.Fatalf("Ledger %s is not archived, archive it first or use -force", id)
+		}
+		if err := store.RemoveLedger(id); err != nil {
+			log.Fatalf("Failed to delete ledger: %v", err)
+		}
+		log.Printf("Deleted ledger %s and all of its data\n", id)
+
+	default:
+		fmt.Fprintln(os.Stderr, ledgerUsage)
+		os.Exit(2)
+	}
+}
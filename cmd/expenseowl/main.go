@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 
 	"github.com/tanq16/expenseowl/internal/api"
 	"github.com/tanq16/expenseowl/internal/storage"
@@ -14,12 +15,31 @@ import (
 var version = "dev"
 
 func runServer(port int) {
-	storage, err := storage.InitializeStorage()
+	store, err := storage.InitializeStorage()
 	if err != nil {
 		log.Fatalf("Failed to initialize storage: %v", err)
 	}
-	defer storage.Close()
-	handler := api.NewHandler(storage)
+	defer store.Close()
+	snapshotConfig := storage.SnapshotConfig{}
+	if err := snapshotConfig.SetSnapshotConfig(); err != nil {
+		log.Fatalf("Invalid backup config: %v", err)
+	}
+	var snapshots *storage.Snapshotter
+	if snapshotConfig.Enabled() {
+		if snapshots, err = storage.NewSnapshotter(store, snapshotConfig); err != nil {
+			log.Fatalf("Failed to initialize automatic backups: %v", err)
+		}
+		go snapshots.Run()
+	}
+	handler := api.NewHandler(store, snapshots)
+	authConfig := api.AuthConfig{}
+	if err := authConfig.SetAuthConfig(); err != nil {
+		log.Fatalf("Invalid authentication config: %v", err)
+	}
+	auth, err := api.NewAuthenticator(store, authConfig)
+	if err != nil {
+		log.Fatalf("Failed to initialize authentication: %v", err)
+	}
 
 	// Version Handler
 	http.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
@@ -61,11 +81,15 @@ func runServer(port int) {
 	// Config
 	http.HandleFunc("/config", handler.GetConfig)
 	http.HandleFunc("/categories", handler.GetCategories)
-	http.HandleFunc("/categories/edit", handler.UpdateCategories)
+	http.HandleFunc("/categories/edit", auth.RequireAdmin(handler.UpdateCategories))
+	http.HandleFunc("/categoryrules", handler.GetCategoryRules)
+	http.HandleFunc("/categoryrules/edit", auth.RequireAdmin(handler.UpdateCategoryRules))
+	http.HandleFunc("/categoryrules/apply", auth.RequireAdmin(handler.ApplyCategoryRules))
 	http.HandleFunc("/currency", handler.GetCurrency)
-	http.HandleFunc("/currency/edit", handler.UpdateCurrency)
+	http.HandleFunc("/currency/edit", auth.RequireAdmin(handler.UpdateCurrency))
 	http.HandleFunc("/startdate", handler.GetStartDate)
-	http.HandleFunc("/startdate/edit", handler.UpdateStartDate)
+	http.HandleFunc("/startdate/edit", auth.RequireAdmin(handler.UpdateStartDate))
+	http.HandleFunc("/ledgers", handler.GetLedgers)
 	// http.HandleFunc("/tags", handler.GetTags)
 	// http.HandleFunc("/tags/edit", handler.UpdateTags)
 
@@ -75,6 +99,18 @@ func runServer(port int) {
 	http.HandleFunc("/expense/edit", handler.EditExpense)               // PUT for edit
 	http.HandleFunc("/expense/delete", handler.DeleteExpense)           // DELETE for single
 	http.HandleFunc("/expenses/delete", handler.DeleteMultipleExpenses) // DELETE for multiple
+	http.HandleFunc("/reports/summary", handler.GetSummary)             // GET totals by group
+
+	// Duplicates
+	http.HandleFunc("/duplicates", handler.GetDuplicates)             // GET suspected clusters
+	http.HandleFunc("/duplicates/dismiss", handler.DismissDuplicates) // POST ids that are not duplicates
+	http.HandleFunc("/duplicates/merge", handler.MergeDuplicates)     // POST expense to keep and ones to remove
+
+	// Conversion Rates
+	http.HandleFunc("/rates", handler.GetConversionRates)                            // GET all, optionally ?from=&to=
+	http.HandleFunc("/rate", auth.RequireAdmin(handler.SaveConversionRate))          // PUT for add or update
+	http.HandleFunc("/rate/delete", auth.RequireAdmin(handler.DeleteConversionRate)) // DELETE
+	http.HandleFunc("/rates/convert", handler.ConvertAmounts)                        // POST amounts to convert
 
 	// Recurring Expenses
 	http.HandleFunc("/recurring-expense", handler.AddRecurringExpense)           // PUT for add
@@ -84,17 +120,115 @@ func runServer(port int) {
 
 	// Import/Export
 	http.HandleFunc("/export/csv", handler.ExportCSV)
+	http.HandleFunc("/export/qif", handler.ExportQIF)
+	http.HandleFunc("/export/backup", handler.ExportBackup)
+	http.HandleFunc("/export/ledger", handler.ExportLedger)
+	http.HandleFunc("/export/hledger", handler.ExportHledger)
+	http.HandleFunc("/export/beancount", handler.ExportBeancount)
+	http.HandleFunc("/export/xlsx", handler.ExportXLSX)
 	http.HandleFunc("/import/csv", handler.ImportCSV)
 	http.HandleFunc("/import/csvold", handler.ImportOldCSV)
+	http.HandleFunc("/import/rates", auth.RequireAdmin(handler.ImportRates))
+	http.HandleFunc("/import/ofx", handler.ImportOFX)
+	http.HandleFunc("/import/qif", handler.ImportQIF)
+	http.HandleFunc("/import/camt053", handler.ImportCAMT053)
+	http.HandleFunc("/import/mt940", handler.ImportMT940)
+	http.HandleFunc("/import/csv/suggest", handler.SuggestCSVProfile)
+	http.HandleFunc("/import/commit", handler.CommitImport)
+	http.HandleFunc("/import/backup", auth.RequireAdmin(handler.ImportBackup))
+	http.HandleFunc("/backups", handler.GetSnapshots)                               // GET automatic backups of the ledger
+	http.HandleFunc("/backups/download", handler.DownloadSnapshot)                  // GET by name
+	http.HandleFunc("/backups/restore", auth.RequireAdmin(handler.RestoreSnapshot)) // POST name, mode and conflict
+	http.HandleFunc("/csvprofiles", handler.GetCSVProfiles)
+	http.HandleFunc("/csvprofile", auth.RequireAdmin(handler.SaveCSVProfile))
+	http.HandleFunc("/csvprofile/delete", auth.RequireAdmin(handler.DeleteCSVProfile))
+
+	// Authentication (only when enabled)
+	if authConfig.Enabled() {
+		http.HandleFunc("/login", auth.ServeLogin)            // GET page, POST credentials
+		http.HandleFunc("/logout", auth.Logout)               // POST
+		http.HandleFunc("/auth/user", auth.GetCurrentUser)    // GET
+		http.HandleFunc("/auth/users", auth.GetUsernames)     // GET household members
+		http.HandleFunc("/tokens", auth.GetAPITokens)         // GET own API tokens
+		http.HandleFunc("/token", auth.AddAPIToken)           // PUT for add
+		http.HandleFunc("/token/delete", auth.DeleteAPIToken) // DELETE
+		log.Printf("Authentication enabled (%s mode)\n", authConfig.Mode)
+	}
 
 	log.Println("Starting server on port", port, "...")
-	if err := http.ListenAndServe(fmt.Sprint(":", port), nil); err != nil {
+	if err := http.ListenAndServe(fmt.Sprint(":", port), auth.Wrap(handler.WithLedger(http.DefaultServeMux))); err != nil {
 		log.Fatalf("Server failed to start: %v", err)
 	}
 }
 
+// reports pending or unexpected schema migrations, exiting non-zero on drift
+func runCheckMigrations() {
+	baseConfig := storage.SystemConfig{}
+	baseConfig.SetStorageConfig()
+	status, err := storage.CheckMigrations(baseConfig)
+	if err != nil {
+		log.Fatalf("Failed to check migrations: %v", err)
+	}
+	log.Printf("Applied migrations: %v\n", status.Applied)
+	for _, name := range status.Pending {
+		log.Printf("Pending migration: %s\n", name)
+	}
+	for _, version := range status.Unknown {
+		log.Printf("Unknown applied migration (database is newer than this binary): %d\n", version)
+	}
+	for _, name := range status.Modified {
+		log.Printf("Modified migration (applied SQL differs from embedded): %s\n", name)
+	}
+	if !status.InSync() {
+		os.Exit(1)
+	}
+	log.Println("Database schema is up to date")
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			runMigrate(os.Args[2:])
+			return
+		case "user":
+			runUser(os.Args[2:])
+			return
+		case "ledger":
+			runLedger(os.Args[2:])
+			return
+		case "import-rates":
+			runImportRates(os.Args[2:])
+			return
+		case "import-ofx":
+			runImportOFX(os.Args[2:])
+			return
+		case "import-qif":
+			runImportQIF(os.Args[2:])
+			return
+		case "import-camt053":
+			runImportCAMT053(os.Args[2:])
+			return
+		case "import-mt940":
+			runImportMT940(os.Args[2:])
+			return
+		case "export-ledger":
+			runExportJournal(api.JournalLedger, os.Args[2:])
+			return
+		case "export-hledger":
+			runExportJournal(api.JournalHledger, os.Args[2:])
+			return
+		case "export-beancount":
+			runExportJournal(api.JournalBeancount, os.Args[2:])
+			return
+		}
+	}
 	port := flag.Int("port", 8080, "Port to serve from")
+	checkMigrations := flag.Bool("check-migrations", false, "Report database schema drift without applying migrations, then exit")
 	flag.Parse()
+	if *checkMigrations {
+		runCheckMigrations()
+		return
+	}
 	runServer(*port)
 }
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// storageFlags registers the flags needed to open one storage backend under a prefix
+func storageFlags(fs *flag.FlagSet, prefix string, defaultType string) *storage.SystemConfig {
+	cfg := &storage.SystemConfig{}
+	fs.Func(prefix, "backend type: json, postgres or sqlite (default "+defaultType+")", func(v string) error {
+		switch storage.BackendType(v) {
+		case storage.BackendTypeJSON, storage.BackendTypePostgres, storage.BackendTypeSQLite:
+			cfg.StorageType = storage.BackendType(v)
+			return nil
+		}
+		return fmt.Errorf("unknown backend type: %s", v)
+	})
+	cfg.StorageType = storage.BackendType(defaultType)
+	fs.StringVar(&cfg.StorageURL, prefix+"-url", "data", "storage URL (directory, file path or SERVER/DB)")
+	fs.StringVar(&cfg.StorageUser, prefix+"-user", "", "Postgres user")
+	fs.StringVar(&cfg.StoragePass, prefix+"-pass", "", "Postgres password")
+	fs.StringVar(&cfg.StorageSSL, prefix+"-ssl", "disable", "Postgres sslmode")
+	return cfg
+}
+
+func runMigrate(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	src := storageFlags(fs, "from", "json")
+	dst := storageFlags(fs, "to", "postgres")
+	force := fs.Bool("force", false, "write into a non-empty destination, skipping IDs that already exist")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: expenseowl migrate -from TYPE -from-url URL -to TYPE -to-url URL [options]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if src.StorageType == dst.StorageType && src.StorageURL == dst.StorageURL {
+		log.Fatalf("Source and destination must differ")
+	}
+	// errors are returned so the stores are closed (checkpointing SQLite) before exiting
+	if err := migrate(*src, *dst, *force); err != nil {
+		log.Fatalf("Migration failed: %v", err)
+	}
+}
+
+func migrate(src, dst storage.SystemConfig, force bool) error {
+	srcStore, err := storage.InitializeStorageFromConfig(src)
+	if err != nil {
+		return fmt.Errorf("failed to open source storage: %v", err)
+	}
+	defer srcStore.Close()
+	dstStore, err := storage.InitializeStorageFromConfig(dst)
+	if err != nil {
+		return fmt.Errorf("failed to open destination storage: %v", err)
+	}
+	defer dstStore.Close()
+
+	log.Printf("Migrating from %s (%s) to %s (%s) ...\n", src.StorageType, src.StorageURL, dst.StorageType, dst.StorageURL)
+	report, err := storage.CopyStorage(srcStore, dstStore, force)
+	if report != nil {
+		log.Printf("Ledgers: %d copied\n", report.LedgersCopied)
+		log.Printf("Conversion rates: %d copied\n", report.RatesCopied)
+		log.Printf("Recurring expenses: %d copied, %d skipped\n", report.RecurringCopied, report.RecurringSkipped)
+		log.Printf("Expenses: %d copied, %d skipped\n", report.ExpensesCopied, report.ExpensesSkipped)
+		if report.IDsReassigned > 0 {
+			log.Printf("IDs reassigned: %d (used by another ledger in the destination)\n", report.IDsReassigned)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Verified %d expenses totalling %.2f in destination\n", report.SourceCount, report.DestinationSum)
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+const importRatesUsage = `Usage: expenseowl import-rates FILE
+
+Imports exchange rates into the storage configured through STORAGE_* variables. FILE is
+the ECB reference rate XML (eurofxref-hist.xml or eurofxref-daily.xml) or a CSV with
+date,from,to,rate rows; use - to read from stdin. Existing rates of the same pair and
+day are replaced.`
+
+func runImportRates(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, importRatesUsage)
+		os.Exit(2)
+	}
+	var input io.Reader = os.Stdin
+	if args[0] != "-" {
+		file, err := os.Open(args[0])
+		if err != nil {
+			log.Fatalf("Failed to open rate file: %v", err)
+		}
+		defer file.Close()
+		input = file
+	}
+
+	store, err := storage.InitializeStorage()
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	defer store.Close()
+
+	report, err := storage.ImportConversionRates(store, input)
+	if err != nil {
+		log.Fatalf("Failed to import rates: %v", err)
+	}
+	if report.Imported > 0 {
+		log.Printf("Imported %d %s rates from %s to %s\n", report.Imported, report.Format,
+			report.FirstDate.Format(time.DateOnly), report.LastDate.Format(time.DateOnly))
+	} else {
+		log.Println("No supported rates found")
+	}
+	if report.Skipped > 0 {
+		log.Printf("Skipped %d rates of unsupported currencies: %s\n", report.Skipped, strings.Join(report.Unsupported, ", "))
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/tanq16/expenseowl/internal/api"
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+const importOFXUsage = `Usage: expenseowl import-ofx [-ledger ID] [-owner USER] [-skip-invalid] FILE
+
+Imports the transactions of an OFX or QFX bank statement into the storage configured
+through STORAGE_* variables; use - to read from stdin. Transactions already imported
+are skipped, and categories are assigned through the ledger's category rules. A transaction
+that cannot be read cancels the import unless -skip-invalid is set.`
+
+const importQIFUsage = `Usage: expenseowl import-qif [-ledger ID] [-owner USER] [-subcategories MODE] [-day-first] [-skip-invalid] FILE
+
+Imports the transactions of a QIF file (e.g., from Quicken, GnuCash or Microsoft Money)
+into the storage configured through STORAGE_* variables; use - to read from stdin.
+Subcategories (Food:Groceries) are flattened by MODE: full (Food - Groceries, default),
+top (Food) or leaf (Groceries). Transactions without a category are assigned one through
+the ledger's category rules. A transaction that cannot be read cancels the import unless
+-skip-invalid is set.`
+
+const importCAMT053Usage = `Usage: expenseowl import-camt053 [-ledger ID] [-owner USER] [-skip-invalid] FILE
+
+Imports the booked entries of an ISO 20022 camt.053 bank statement into the storage
+configured through STORAGE_* variables; use - to read from stdin. Entries already imported
+are skipped, and categories are assigned through the ledger's category rules. An entry that
+cannot be read cancels the import unless -skip-invalid is set.`
+
+const importMT940Usage = `Usage: expenseowl import-mt940 [-ledger ID] [-owner USER] [-skip-invalid] FILE
+
+Imports the statement lines of a SWIFT MT940 bank statement into the storage configured
+through STORAGE_* variables; use - to read from stdin. Lines already imported are skipped,
+and categories are assigned through the ledger's category rules. A line that cannot be read
+cancels the import unless -skip-invalid is set.`
+
+// statementImport holds the options shared by the statement import commands
+type statementImport struct {
+	flags       *flag.FlagSet
+	ledger      *string
+	owner       *string
+	skipInvalid *bool
+}
+
+func newStatementImport(name, usage string) *statementImport {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintln(os.Stderr, usage) }
+	return &statementImport{
+		flags:       fs,
+		ledger:      fs.String("ledger", "", "ledger to import into, defaults to the default ledger"),
+		owner:       fs.String("owner", "", "user owning the imported expenses"),
+		skipInvalid: fs.Bool("skip-invalid", false, "import the valid transactions when some cannot be read"),
+	}
+}
+
+// open parses the arguments and opens the statement file, or stdin for -
+func (c *statementImport) open(args []string) io.ReadCloser {
+	c.flags.Parse(args)
+	if c.flags.NArg() != 1 {
+		c.flags.Usage()
+		os.Exit(2)
+	}
+	if c.flags.Arg(0) == "-" {
+		return os.Stdin
+	}
+	file, err := os.Open(c.flags.Arg(0))
+	if err != nil {
+		log.Fatalf("Failed to open statement: %v", err)
+	}
+	return file
+}
+
+// run stores the parsed entries in the chosen ledger
+func (c *statementImport) run(format string, entries []api.StatementEntry, entryErrors []string) {
+	root, err := storage.InitializeStorage()
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	defer root.Close()
+	if *c.owner != "" {
+		if _, err := root.GetUser(*c.owner); err != nil {
+			log.Fatalf("User %s does not exist", *c.owner)
+		}
+	}
+	if *c.ledger != "" {
+		ledger, err := root.GetLedger(*c.ledger)
+		if err != nil {
+			log.Fatalf("Ledger %s does not exist", *c.ledger)
+		}
+		if ledger.Archived {
+			log.Fatalf("Ledger %s is archived and read-only", *c.ledger)
+		}
+	}
+	store, err := root.ForLedger(*c.ledger)
+	if err != nil {
+		log.Fatalf("Failed to open ledger: %v", err)
+	}
+
+	report, err := api.ImportStatement(store, format, entries, entryErrors, *c.owner, *c.skipInvalid)
+	if err != nil {
+		for _, e := range report.Errors {
+			log.Printf("Invalid %s\n", e)
+		}
+		log.Fatalf("Failed to import statement, nothing was imported: %v", err)
+	}
+	for _, e := range report.Errors {
+		log.Printf("Skipped %s\n", e)
+	}
+	log.Printf("Imported %d of %d transactions, skipped %d\n", report.Imported, report.TotalProcessed, report.Skipped)
+	if len(report.NewCategories) > 0 {
+		log.Printf("Added categories: %v\n", report.NewCategories)
+	}
+}
+
+func runImportOFX(args []string) {
+	cmd := newStatementImport("import-ofx", importOFXUsage)
+	input := cmd.open(args)
+	defer input.Close()
+	entries, entryErrors, err := api.ParseOFX(input)
+	if err != nil {
+		log.Fatalf("Failed to read statement: %v", err)
+	}
+	cmd.run("ofx", entries, entryErrors)
+}
+
+func runImportCAMT053(args []string) {
+	cmd := newStatementImport("import-camt053", importCAMT053Usage)
+	input := cmd.open(args)
+	defer input.Close()
+	entries, entryErrors, err := api.ParseCAMT053(input)
+	if err != nil {
+		log.Fatalf("Failed to read statement: %v", err)
+	}
+	cmd.run("camt.053", entries, entryErrors)
+}
+
+func runImportMT940(args []string) {
+	cmd := newStatementImport("import-mt940", importMT940Usage)
+	input := cmd.open(args)
+	defer input.Close()
+	entries, entryErrors, err := api.ParseMT940(input)
+	if err != nil {
+		log.Fatalf("Failed to read statement: %v", err)
+	}
+	cmd.run("mt940", entries, entryErrors)
+}
+
+func runImportQIF(args []string) {
+	cmd := newStatementImport("import-qif", importQIFUsage)
+	subcategories := cmd.flags.String("subcategories", api.QIFSubcategoriesFull, "how to flatten subcategories: full, top or leaf")
+	dayFirst := cmd.flags.Bool("day-first", false, "dates are DD/MM instead of MM/DD")
+	input := cmd.open(args)
+	defer input.Close()
+	entries, entryErrors, err := api.ParseQIF(input, api.QIFOptions{Subcategories: *subcategories, DayFirst: *dayFirst})
+	if err != nil {
+		log.Fatalf("Failed to read QIF file: %v", err)
+	}
+	cmd.run("qif", entries, entryErrors)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+	"golang.org/x/term"
+)
+
+const userUsage = `Usage: expenseowl user COMMAND [args]
+
+Manages local users and API tokens of the storage configured through STORAGE_* variables.
+
+Commands:
+  list                         list users
+  add USERNAME                 add a user, reading the password from the terminal or stdin
+  passwd USERNAME              change a user's password
+  remove USERNAME              remove a user and revoke all of their tokens
+  tokens USERNAME              list a user's API tokens
+  token USERNAME [-name NAME] [-days N]
+                               create an API token (printed once, never stored)
+  revoke TOKEN_ID              revoke an API token or session`
+
+// reads a password without echo on a terminal, or a single line from piped stdin
+func readPassword(prompt string) (string, error) {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprint(os.Stderr, prompt)
+		password, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		return string(password), err
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func runUser(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, userUsage)
+		os.Exit(2)
+	}
+	command, args := args[0], args[1:]
+	needsArg := func() string {
+		if len(args) == 0 {
+			fmt.Fprintln(os.Stderr, userUsage)
+			os.Exit(2)
+		}
+		return args[0]
+	}
+
+	store, err := storage.InitializeStorage()
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	defer store.Close()
+
+	switch command {
+	case "list":
+		users, err := store.GetUsers()
+		if err != nil {
+			log.Fatalf("Failed to list users: %v", err)
+		}
+		for _, u := range users {
+			login := "password"
+			if u.PasswordHash == "" {
+				login = "proxy/tokens only"
+			}
+			fmt.Printf("%s\t%s\tcreated %s\n", u.Username, login, u.CreatedAt.Format(time.DateOnly))
+		}
+
+	case "add", "passwd":
+		username := needsArg()
+		if err := storage.ValidateUsername(username); err != nil {
+			log.Fatalf("Invalid username: %v", err)
+		}
+		_, lookupErr := store.GetUser(username)
+		if command == "add" && lookupErr == nil {
+			log.Fatalf("User %s already exists, use 'passwd' to change the password", username)
+		}
+		if command == "passwd" && lookupErr != nil {
+			log.Fatalf("User %s does not exist", username)
+		}
+		password, err := readPassword("Password: ")
+		if err != nil {
+			log.Fatalf("Failed to read password: %v", err)
+		}
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			confirm, err := readPassword("Repeat password: ")
+			if err != nil || confirm != password {
+				log.Fatalf("Passwords do not match")
+			}
+		}
+		user := storage.User{Username: username}
+		if err := user.SetPassword(password); err != nil {
+			log.Fatalf("Invalid password: %v", err)
+		}
+		if err := store.SaveUser(user); err != nil {
+			log.Fatalf("Failed to save user: %v", err)
+		}
+		log.Printf("Saved user %s\n", username)
+
+	case "remove":
+		username := needsArg()
+		if err := store.RemoveUser(username); err != nil {
+			log.Fatalf("Failed to remove user: %v", err)
+		}
+		log.Printf("Removed user %s and revoked their tokens\n", username)
+
+	case "tokens":
+		tokens, err := store.GetAuthTokens(needsArg())
+		if err != nil {
+			log.Fatalf("Failed to list tokens: %v", err)
+		}
+		for _, t := range tokens {
+			expires := "never expires"
+			if !t.ExpiresAt.IsZero() {
+				expires = "expires " + t.ExpiresAt.Format(time.DateOnly)
+			}
+			fmt.Printf("%s\t%s\t%s\tcreated %s\t%s\n", t.ID, t.Kind, t.Name, t.CreatedAt.Format(time.DateOnly), expires)
+		}
+
+	case "token":
+		username := needsArg()
+		fs := flag.NewFlagSet("user token", flag.ExitOnError)
+		name := fs.String("name", "cli", "label shown when listing tokens")
+		days := fs.Int("days", 0, "days until the token expires, 0 for never")
+		fs.Parse(args[1:])
+		if _, err := store.GetUser(username); err != nil {
+			log.Fatalf("User %s does not exist", username)
+		}
+		token, secret, err := storage.NewAuthToken(username, storage.TokenKindAPI, *name, time.Duration(*days)*24*time.Hour)
+		if err != nil {
+			log.Fatalf("Failed to create token: %v", err)
+		}
+		if err := store.AddAuthToken(token); err != nil {
+			log.Fatalf("Failed to save token: %v", err)
+		}
+		log.Printf("Created token %s for %s, it is shown only once:\n", token.ID, username)
+		fmt.Println(secret)
+
+	case "revoke":
+		id := needsArg()
+		if err := store.RemoveAuthToken(id); err != nil {
+			log.Fatalf("Failed to revoke token: %v", err)
+		}
+		log.Printf("Revoked token %s\n", id)
+
+	default:
+		fmt.Fprintln(os.Stderr, userUsage)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,553 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+	"github.com/tanq16/expenseowl/internal/web"
+)
+
+const (
+	AuthModeNone  = ""      // no authentication, the default
+	AuthModeLocal = "local" // local users with passwords and session cookies
+	AuthModeProxy = "proxy" // a trusted reverse proxy sends the user in a header
+)
+
+const sessionCookieName = "expenseowl_session"
+
+// config for the optional authentication layer
+type AuthConfig struct {
+	Mode           string
+	ProxyHeader    string
+	TrustedProxies []netip.Prefix
+	SessionTTL     time.Duration
+	AdminUser      string // created on startup when no users exist yet
+	AdminPassword  string
+	Admins         []string // may change shared settings; the first local user when empty
+	SecureCookies  bool     // also marks cookies Secure on plain HTTP requests
+}
+
+func (c *AuthConfig) Enabled() bool {
+	return c.Mode != AuthModeNone
+}
+
+func (c *AuthConfig) SetAuthConfig() error {
+	switch mode := os.Getenv("AUTH_MODE"); mode {
+	case "", "none":
+		c.Mode = AuthModeNone
+	case AuthModeLocal, AuthModeProxy:
+		c.Mode = mode
+	default:
+		return fmt.Errorf("invalid AUTH_MODE: %s (must be local, proxy or none)", mode)
+	}
+	c.ProxyHeader = os.Getenv("AUTH_PROXY_HEADER")
+	if c.ProxyHeader == "" {
+		c.ProxyHeader = "Remote-User"
+	}
+	for _, entry := range strings.Split(os.Getenv("AUTH_TRUSTED_PROXIES"), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(entry)
+			if addrErr != nil {
+				return fmt.Errorf("invalid AUTH_TRUSTED_PROXIES entry: %s", entry)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		c.TrustedProxies = append(c.TrustedProxies, prefix.Masked())
+	}
+	if c.Mode == AuthModeProxy && len(c.TrustedProxies) == 0 {
+		return fmt.Errorf("AUTH_TRUSTED_PROXIES is required with AUTH_MODE=proxy")
+	}
+	c.SessionTTL = 30 * 24 * time.Hour
+	if days := os.Getenv("AUTH_SESSION_DAYS"); days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid AUTH_SESSION_DAYS: %s", days)
+		}
+		c.SessionTTL = time.Duration(n) * 24 * time.Hour
+	}
+	c.AdminUser = os.Getenv("AUTH_ADMIN_USER")
+	c.AdminPassword = os.Getenv("AUTH_ADMIN_PASSWORD")
+	for _, admin := range strings.Split(os.Getenv("AUTH_ADMINS"), ",") {
+		if admin = strings.TrimSpace(admin); admin != "" {
+			c.Admins = append(c.Admins, admin)
+		}
+	}
+	if len(c.Admins) == 0 && c.AdminUser != "" {
+		c.Admins = []string{c.AdminUser}
+	}
+	// proxy users are created by their first request, so the first user is whoever came first
+	if c.Mode == AuthModeProxy && len(c.Admins) == 0 {
+		return fmt.Errorf("AUTH_ADMINS is required with AUTH_MODE=proxy")
+	}
+	switch secure := os.Getenv("AUTH_SECURE_COOKIE"); secure {
+	case "", "false":
+	case "true":
+		c.SecureCookies = true
+	default:
+		return fmt.Errorf("invalid AUTH_SECURE_COOKIE: %s (must be true or false)", secure)
+	}
+	return nil
+}
+
+// Authenticator guards every route when authentication is enabled
+type Authenticator struct {
+	storage storage.Storage
+	config  AuthConfig
+	known   sync.Map // proxy users that already have a local record
+}
+
+func NewAuthenticator(s storage.Storage, config AuthConfig) (*Authenticator, error) {
+	a := &Authenticator{storage: s, config: config}
+	if config.Mode != AuthModeLocal {
+		return a, nil
+	}
+	users, err := s.GetUsers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users: %v", err)
+	}
+	if len(users) > 0 {
+		return a, nil
+	}
+	if config.AdminUser == "" || config.AdminPassword == "" {
+		log.Println("Warning: authentication is enabled but no users exist, add one with 'expenseowl user add <name>'")
+		return a, nil
+	}
+	user := storage.User{Username: config.AdminUser}
+	if err := user.SetPassword(config.AdminPassword); err != nil {
+		return nil, err
+	}
+	if err := s.SaveUser(user); err != nil {
+		return nil, fmt.Errorf("failed to create initial user: %v", err)
+	}
+	log.Printf("Created initial user %s\n", user.Username)
+	return a, nil
+}
+
+type contextKey string
+
+const userContextKey contextKey = "user"
+
+// UserFromContext returns the authenticated user of a request, or "" without authentication
+func UserFromContext(ctx context.Context) string {
+	user, _ := ctx.Value(userContextKey).(string)
+	return user
+}
+
+// reachable without a login, so the login page can render
+var publicPaths = []string{"/login", "/version", "/style.css", "/fa.min.css", "/webfonts/", "/favicon.ico", "/manifest.json", "/sw.js", "/pwa/"}
+
+func isPublicPath(path string) bool {
+	for _, p := range publicPaths {
+		if path == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(path, p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Wrap returns next unchanged when authentication is off
+func (a *Authenticator) Wrap(next http.Handler) http.Handler {
+	if !a.config.Enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := a.authenticate(r)
+		if user != "" {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userContextKey, user)))
+			return
+		}
+		if isPublicPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if a.config.Mode == AuthModeLocal && r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+			http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="expenseowl"`)
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "Authentication required"})
+	})
+}
+
+// RequireAdmin limits a handler that changes data shared by the whole household (settings,
+// rules, conversion rates and restores) to admins; it is a no-op without authentication
+func (a *Authenticator) RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	if !a.config.Enabled() {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.isAdmin(UserFromContext(r.Context())) {
+			writeJSON(w, http.StatusForbidden, ErrorResponse{Error: "Only an admin can change shared settings"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// isAdmin checks AUTH_ADMINS, or else whether the user is the first one created (local mode
+// only, as proxy mode requires AUTH_ADMINS)
+func (a *Authenticator) isAdmin(username string) bool {
+	if username == "" {
+		return false
+	}
+	if len(a.config.Admins) > 0 {
+		return slices.Contains(a.config.Admins, username)
+	}
+	users, err := a.storage.GetUsers()
+	if err != nil {
+		log.Printf("API ERROR: Failed to list users for admin check: %v\n", err)
+		return false
+	}
+	var first *storage.User
+	for i, user := range users {
+		if first == nil || user.CreatedAt.Before(first.CreatedAt) ||
+			(user.CreatedAt.Equal(first.CreatedAt) && user.Username < first.Username) {
+			first = &users[i]
+		}
+	}
+	return first != nil && first.Username == username
+}
+
+// secureRequest reports whether the client reached us over HTTPS, directly or through a
+// trusted TLS-terminating proxy that sets X-Forwarded-Proto
+func (a *Authenticator) secureRequest(r *http.Request) bool {
+	if r.TLS != nil || a.config.SecureCookies {
+		return true
+	}
+	return strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") && a.fromTrustedProxy(r)
+}
+
+// authenticate resolves the user from a bearer token, the proxy header or a session cookie
+func (a *Authenticator) authenticate(r *http.Request) string {
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return a.tokenUser(strings.TrimSpace(bearer), storage.TokenKindAPI)
+	}
+	switch a.config.Mode {
+	case AuthModeProxy:
+		user := strings.TrimSpace(r.Header.Get(a.config.ProxyHeader))
+		if user == "" {
+			return ""
+		}
+		if !a.fromTrustedProxy(r) {
+			log.Printf("Warning: ignoring %s header from untrusted address %s\n", a.config.ProxyHeader, r.RemoteAddr)
+			return ""
+		}
+		if storage.ValidateUsername(user) != nil {
+			return ""
+		}
+		a.provisionProxyUser(user)
+		return user
+	case AuthModeLocal:
+		if cookie, err := r.Cookie(sessionCookieName); err == nil {
+			return a.tokenUser(cookie.Value, storage.TokenKindSession)
+		}
+	}
+	return ""
+}
+
+// provisionProxyUser records proxy users locally so others can share expenses with them
+func (a *Authenticator) provisionProxyUser(username string) {
+	if _, ok := a.known.Load(username); ok {
+		return
+	}
+	if _, err := a.storage.GetUser(username); err != nil {
+		if err := a.storage.SaveUser(storage.User{Username: username}); err != nil {
+			log.Printf("Warning: failed to record proxy user %s: %v\n", username, err)
+			return
+		}
+		log.Printf("Recorded proxy user %s\n", username)
+	}
+	a.known.Store(username, true)
+}
+
+func (a *Authenticator) tokenUser(secret, kind string) string {
+	if secret == "" {
+		return ""
+	}
+	token, err := a.storage.GetAuthTokenByHash(storage.HashAuthToken(secret))
+	if err != nil || token.Kind != kind || token.Expired() {
+		return ""
+	}
+	return token.Username
+}
+
+func (a *Authenticator) fromTrustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range a.config.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// compared against when a username does not exist, so timing does not reveal valid names
+var dummyUser = sync.OnceValue(func() storage.User {
+	u := storage.User{}
+	u.SetPassword("expenseowl-dummy-password")
+	return u
+})
+
+// only same-site absolute paths are followed after login
+func safeRedirect(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+func (a *Authenticator) ServeLogin(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if a.config.Mode != AuthModeLocal {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		if err := web.ServeTemplate(w, "login.html"); err != nil {
+			http.Error(w, "Failed to serve template", http.StatusInternalServerError)
+		}
+		return
+	case http.MethodPost:
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	if a.config.Mode != AuthModeLocal {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Password login is not enabled"})
+		return
+	}
+	var credentials struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Next     string `json:"next"`
+	}
+	isForm := !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+	if isForm {
+		credentials.Username = r.PostFormValue("username")
+		credentials.Password = r.PostFormValue("password")
+		credentials.Next = r.PostFormValue("next")
+	} else if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+
+	user, err := a.storage.GetUser(strings.TrimSpace(credentials.Username))
+	if err != nil {
+		dummy := dummyUser()
+		dummy.CheckPassword(credentials.Password)
+	}
+	if err != nil || !user.CheckPassword(credentials.Password) {
+		log.Printf("Failed login for user %q from %s\n", credentials.Username, r.RemoteAddr)
+		if isForm {
+			http.Redirect(w, r, "/login?error=1&next="+url.QueryEscape(credentials.Next), http.StatusSeeOther)
+			return
+		}
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "Invalid username or password"})
+		return
+	}
+
+	if err := a.storage.RemoveExpiredAuthTokens(); err != nil {
+		log.Printf("API ERROR: Failed to remove expired tokens: %v\n", err)
+	}
+	token, secret, err := storage.NewAuthToken(user.Username, storage.TokenKindSession, r.UserAgent(), a.config.SessionTTL)
+	if err == nil {
+		err = a.storage.AddAuthToken(token)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to create session"})
+		log.Printf("API ERROR: Failed to create session: %v\n", err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    secret,
+		Path:     "/",
+		Expires:  token.ExpiresAt,
+		HttpOnly: true,
+		Secure:   a.secureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	if isForm {
+		http.Redirect(w, r, safeRedirect(credentials.Next), http.StatusSeeOther)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success", "username": user.Username})
+}
+
+func (a *Authenticator) Logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		if token, err := a.storage.GetAuthTokenByHash(storage.HashAuthToken(cookie.Value)); err == nil {
+			if err := a.storage.RemoveAuthToken(token.ID); err != nil {
+				log.Printf("API ERROR: Failed to remove session: %v\n", err)
+			}
+		}
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookieName, Value: "", Path: "/", MaxAge: -1, HttpOnly: true, Secure: a.secureRequest(r)})
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+func (a *Authenticator) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	username := UserFromContext(r.Context())
+	writeJSON(w, http.StatusOK, map[string]any{"username": username, "mode": a.config.Mode, "admin": a.isAdmin(username)})
+}
+
+// GetUsernames lists the household members expenses can be shared with
+func (a *Authenticator) GetUsernames(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	users, err := a.storage.GetUsers()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to list users"})
+		log.Printf("API ERROR: Failed to list users: %v\n", err)
+		return
+	}
+	names := make([]string, 0, len(users))
+	for _, u := range users {
+		names = append(names, u.Username)
+	}
+	writeJSON(w, http.StatusOK, names)
+}
+
+// APITokenView is an API token as shown to its owner; the secret is only returned on creation
+type APITokenView struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	Token     string     `json:"token,omitempty"`
+}
+
+func apiTokenView(t storage.AuthToken) APITokenView {
+	view := APITokenView{ID: t.ID, Name: t.Name, CreatedAt: t.CreatedAt}
+	if !t.ExpiresAt.IsZero() {
+		view.ExpiresAt = &t.ExpiresAt
+	}
+	return view
+}
+
+func (a *Authenticator) GetAPITokens(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	tokens, err := a.storage.GetAuthTokens(UserFromContext(r.Context()))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve tokens"})
+		log.Printf("API ERROR: Failed to retrieve tokens: %v\n", err)
+		return
+	}
+	views := []APITokenView{}
+	for _, t := range tokens {
+		if t.Kind == storage.TokenKindAPI {
+			views = append(views, apiTokenView(t))
+		}
+	}
+	writeJSON(w, http.StatusOK, views)
+}
+
+func (a *Authenticator) AddAPIToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var request struct {
+		Name          string `json:"name"`
+		ExpiresInDays int    `json:"expiresInDays"` // 0 never expires
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	if storage.SanitizeString(request.Name) == "" || request.ExpiresInDays < 0 {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Token needs a name and a non-negative expiry"})
+		return
+	}
+	username := UserFromContext(r.Context())
+	// proxy users are normally recorded on their first request, this covers failures there
+	if _, err := a.storage.GetUser(username); err != nil {
+		if err := a.storage.SaveUser(storage.User{Username: username}); err != nil {
+			writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to create token"})
+			log.Printf("API ERROR: Failed to create user for token: %v\n", err)
+			return
+		}
+	}
+	token, secret, err := storage.NewAuthToken(username, storage.TokenKindAPI, request.Name, time.Duration(request.ExpiresInDays)*24*time.Hour)
+	if err == nil {
+		err = a.storage.AddAuthToken(token)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to create token"})
+		log.Printf("API ERROR: Failed to create token: %v\n", err)
+		return
+	}
+	view := apiTokenView(token)
+	view.Token = secret
+	writeJSON(w, http.StatusOK, view)
+}
+
+func (a *Authenticator) DeleteAPIToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "ID parameter is required"})
+		return
+	}
+	tokens, err := a.storage.GetAuthTokens(UserFromContext(r.Context()))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to revoke token"})
+		log.Printf("API ERROR: Failed to retrieve tokens: %v\n", err)
+		return
+	}
+	// users can only revoke their own tokens
+	for _, t := range tokens {
+		if t.ID == id {
+			if err := a.storage.RemoveAuthToken(id); err != nil {
+				writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to revoke token"})
+				log.Printf("API ERROR: Failed to revoke token: %v\n", err)
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+			return
+		}
+	}
+	writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Token not found"})
+}
@@ -0,0 +1,29 @@
+package api
+
+import "testing"
+
+func TestSetAuthConfigProxyAdmins(t *testing.T) {
+	tests := []struct {
+		name      string
+		admins    string
+		adminUser string
+		err       bool
+	}{
+		{"no admins", "", "", true},
+		{"AUTH_ADMINS", "alice, bob", "", false},
+		{"AUTH_ADMIN_USER", "", "carol", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AUTH_MODE", "proxy")
+			t.Setenv("AUTH_TRUSTED_PROXIES", "10.0.0.0/8")
+			t.Setenv("AUTH_ADMINS", tt.admins)
+			t.Setenv("AUTH_ADMIN_USER", tt.adminUser)
+			var config AuthConfig
+			err := config.SetAuthConfig()
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v, want error %v", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// exports the ledger as a versioned JSON backup, gzipped with ?gzip=true
+func (h *Handler) ExportBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	compress, _ := strconv.ParseBool(r.URL.Query().Get("gzip"))
+	backup, err := storage.NewBackup(h.store(r), UserFromContext(r.Context()))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to create backup"})
+		log.Printf("API ERROR: Failed to create backup: %v\n", err)
+		return
+	}
+	backup.Ledger = ledgerSelector(r)
+	if backup.Ledger == "" {
+		backup.Ledger = storage.DefaultLedgerID
+	}
+	name := fmt.Sprintf("expenseowl-backup-%s-%s.json", backup.Ledger, backup.CreatedAt.Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/json")
+	if compress {
+		name += ".gz"
+		w.Header().Set("Content-Type", "application/gzip")
+	}
+	w.Header().Set("Content-Disposition", "attachment; filename="+name)
+	if err := storage.WriteBackup(w, backup, compress); err != nil {
+		log.Printf("API ERROR: Failed to write backup: %v\n", err)
+		return
+	}
+	log.Printf("HTTP: Exported backup of %d expenses\n", len(backup.Expenses))
+}
+
+// restores a backup file into the ledger; mode is merge (default) or replace, conflict
+// decides what a merge does with expenses whose ID is stored: skip (default), overwrite or new,
+// and rates=true also adds the backup's conversion rates
+func (h *Handler) ImportBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Could not parse multipart form"})
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Error retrieving the file"})
+		return
+	}
+	defer file.Close()
+	opts := storage.RestoreOptions{
+		Mode:     strings.ToLower(r.FormValue("mode")),
+		Conflict: strings.ToLower(r.FormValue("conflict")),
+		User:     UserFromContext(r.Context()),
+		Rates:    r.FormValue("rates") == "true",
+	}
+	if opts.Mode == "" {
+		opts.Mode = storage.RestoreMerge
+	}
+	if err := opts.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	h.restoreBackup(w, r, file, opts)
+}
+
+// restoreBackup reads a backup and restores it into the request's ledger, writing the report
+func (h *Handler) restoreBackup(w http.ResponseWriter, r *http.Request, file io.Reader, opts storage.RestoreOptions) {
+	backup, err := storage.ReadBackup(file)
+	if err == nil {
+		err = backup.Validate()
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Invalid backup: %v", err)})
+		return
+	}
+	report, err := storage.RestoreBackup(h.store(r), backup, opts)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to restore backup, nothing was changed"})
+		log.Printf("API ERROR: Failed to restore backup: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+	log.Printf("HTTP: Restored backup with %d expenses\n", len(backup.Expenses))
+}
+
+// SnapshotList is the automatic backups of a ledger
+type SnapshotList struct {
+	Enabled   bool               `json:"enabled"`
+	Interval  string             `json:"interval,omitempty"`
+	Snapshots []storage.Snapshot `json:"snapshots"`
+}
+
+// lists the automatic backups of the ledger, newest first
+func (h *Handler) GetSnapshots(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	if h.snapshots == nil {
+		writeJSON(w, http.StatusOK, SnapshotList{Snapshots: []storage.Snapshot{}})
+		return
+	}
+	snapshots, err := h.snapshots.List(ledgerSelector(r))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to list backups"})
+		log.Printf("API ERROR: Failed to list snapshots: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, SnapshotList{Enabled: true, Interval: h.snapshots.Interval(), Snapshots: snapshots})
+}
+
+// openSnapshot opens the ledger's snapshot named in the request, writing the error otherwise
+func (h *Handler) openSnapshot(w http.ResponseWriter, r *http.Request, name string) (*os.File, bool) {
+	if h.snapshots == nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Automatic backups are not enabled"})
+		return nil, false
+	}
+	file, err := h.snapshots.Open(ledgerSelector(r), name)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Backup not found"})
+		return nil, false
+	}
+	return file, true
+}
+
+// downloads an automatic backup by name; with authentication, it only holds what the user can see
+func (h *Handler) DownloadSnapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	name := r.URL.Query().Get("name")
+	file, ok := h.openSnapshot(w, r, name)
+	if !ok {
+		return
+	}
+	defer file.Close()
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", "attachment; filename="+name)
+	user := UserFromContext(r.Context())
+	if user == "" {
+		if _, err := io.Copy(w, file); err != nil {
+			log.Printf("API ERROR: Failed to send snapshot: %v\n", err)
+		}
+		return
+	}
+	backup, err := storage.ReadBackup(file)
+	if err != nil {
+		w.Header().Del("Content-Disposition")
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to read backup"})
+		log.Printf("API ERROR: Failed to read snapshot %s: %v\n", name, err)
+		return
+	}
+	backup.KeepVisible(user)
+	if err := storage.WriteBackup(w, backup, true); err != nil {
+		log.Printf("API ERROR: Failed to write snapshot: %v\n", err)
+	}
+}
+
+// restores an automatic backup by name into the ledger, with the same modes as ImportBackup
+func (h *Handler) RestoreSnapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var payload struct {
+		Name     string `json:"name"`
+		Mode     string `json:"mode"`
+		Conflict string `json:"conflict"`
+		Rates    bool   `json:"rates"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	opts := storage.RestoreOptions{
+		Mode:     strings.ToLower(payload.Mode),
+		Conflict: strings.ToLower(payload.Conflict),
+		User:     UserFromContext(r.Context()),
+		Rates:    payload.Rates,
+	}
+	if opts.Mode == "" {
+		opts.Mode = storage.RestoreMerge
+	}
+	if err := opts.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	file, ok := h.openSnapshot(w, r, payload.Name)
+	if !ok {
+		return
+	}
+	defer file.Close()
+	h.restoreBackup(w, r, file, opts)
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// camt.053 is the ISO 20022 bank to customer statement; tags are matched without their
+// namespace, so the versions banks send (001.02 to 001.08) are all read the same way
+
+type camtAccount struct {
+	IBAN  string `xml:"Id>IBAN"`
+	Other string `xml:"Id>Othr>Id"`
+}
+
+type camtParty struct {
+	Name      string `xml:"Nm"`
+	PartyName string `xml:"Pty>Nm"` // 001.08 and later
+}
+
+func (p camtParty) name() string {
+	return strings.TrimSpace(firstNonEmpty(p.Name, p.PartyName))
+}
+
+type camtEntry struct {
+	Ref    string `xml:"NtryRef"`
+	Amount struct {
+		Value    string `xml:",chardata"`
+		Currency string `xml:"Ccy,attr"`
+	} `xml:"Amt"`
+	Indicator string `xml:"CdtDbtInd"`
+	Status    struct {
+		Value string `xml:",chardata"`
+		Code  string `xml:"Cd"` // 001.08 and later
+	} `xml:"Sts"`
+	BookingDate     string `xml:"BookgDt>Dt"`
+	BookingDateTime string `xml:"BookgDt>DtTm"`
+	ServicerRef     string `xml:"AcctSvcrRef"`
+	Details         []struct {
+		ServicerRef  string    `xml:"Refs>AcctSvcrRef"`
+		Creditor     camtParty `xml:"RltdPties>Cdtr"`
+		Debtor       camtParty `xml:"RltdPties>Dbtr"`
+		Unstructured []string  `xml:"RmtInf>Ustrd"`
+	} `xml:"NtryDtls>TxDtls"`
+	AdditionalInfo string `xml:"AddtlNtryInf"`
+}
+
+// firstNonEmpty returns the first value that is not blank
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// ParseCAMT053 reads the booked entries (Ntry) of a camt.053 statement; pending entries are
+// left out and entries that cannot be read are returned as errors
+func ParseCAMT053(r io.Reader) ([]StatementEntry, []string, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = decodeText // for the ISO-8859-1 files some banks send
+	var entries []StatementEntry
+	var entryErrors []string
+	ids := contentIDs{}
+	account := ""
+	sawStatement := false
+	index := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid camt.053 file: %v", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "Stmt":
+			sawStatement = true
+			account = ""
+		case "Acct":
+			var acct camtAccount
+			if err := decoder.DecodeElement(&acct, &start); err != nil {
+				return nil, nil, fmt.Errorf("invalid camt.053 account: %v", err)
+			}
+			account = strings.TrimSpace(firstNonEmpty(acct.IBAN, acct.Other))
+		case "Ntry":
+			index++
+			var ntry camtEntry
+			if err := decoder.DecodeElement(&ntry, &start); err != nil {
+				return nil, nil, fmt.Errorf("invalid camt.053 entry %d: %v", index, err)
+			}
+			status := strings.ToUpper(strings.TrimSpace(firstNonEmpty(ntry.Status.Code, ntry.Status.Value)))
+			if status != "" && status != "BOOK" {
+				continue
+			}
+			entry, err := camtStatementEntry(ntry, account, ids)
+			if err != nil {
+				entryErrors = append(entryErrors, fmt.Sprintf("entry %d: %v", index, err))
+				continue
+			}
+			entries = append(entries, entry)
+		}
+	}
+	if !sawStatement {
+		return nil, nil, fmt.Errorf("not a camt.053 file: missing Stmt element")
+	}
+	if len(entries) == 0 && len(entryErrors) == 0 {
+		return nil, nil, fmt.Errorf("no booked entries found in camt.053 file")
+	}
+	return entries, entryErrors, nil
+}
+
+func camtStatementEntry(ntry camtEntry, account string, ids contentIDs) (StatementEntry, error) {
+	amount, err := strconv.ParseFloat(strings.TrimSpace(ntry.Amount.Value), 64)
+	if err != nil {
+		return StatementEntry{}, fmt.Errorf("invalid amount %q", ntry.Amount.Value)
+	}
+	switch strings.TrimSpace(ntry.Indicator) {
+	case "DBIT":
+		amount = -amount
+	case "CRDT":
+	default:
+		return StatementEntry{}, fmt.Errorf("invalid credit/debit indicator %q", ntry.Indicator)
+	}
+	dateStr := strings.TrimSpace(firstNonEmpty(ntry.BookingDate, ntry.BookingDateTime))
+	if len(dateStr) < 10 {
+		return StatementEntry{}, fmt.Errorf("missing booking date")
+	}
+	date, err := time.Parse(time.DateOnly, dateStr[:10])
+	if err != nil {
+		return StatementEntry{}, fmt.Errorf("invalid booking date %q", dateStr)
+	}
+	currency := ""
+	if ntry.Amount.Currency != "" {
+		if currency, err = storage.ValidateCurrency(ntry.Amount.Currency); err != nil {
+			return StatementEntry{}, err
+		}
+	}
+
+	// the remittance information names the entry, then the other party or the bank's text
+	var remittance []string
+	var party, servicerRef string
+	for _, d := range ntry.Details {
+		for _, line := range d.Unstructured {
+			if line = strings.TrimSpace(line); line != "" {
+				remittance = append(remittance, line)
+			}
+		}
+		if party == "" {
+			if amount < 0 {
+				party = d.Creditor.name()
+			} else {
+				party = d.Debtor.name()
+			}
+		}
+		servicerRef = firstNonEmpty(servicerRef, d.ServicerRef)
+	}
+	name := firstNonEmpty(strings.Join(remittance, " "), party, ntry.AdditionalInfo)
+
+	ref := strings.TrimSpace(firstNonEmpty(ntry.ServicerRef, servicerRef, ntry.Ref))
+	externalID := "camt:" + account + ":" + ref
+	if ref == "" {
+		externalID = ids.next("camt:"+account+":", dateStr, ntry.Amount.Value, ntry.Indicator, name)
+	}
+	return StatementEntry{
+		ExternalID: externalID,
+		Name:       strings.TrimSpace(name),
+		Amount:     amount,
+		Currency:   currency,
+		Date:       date.UTC(),
+	}, nil
+}
+
+// imports booked entries from a camt.053 statement
+func (h *Handler) ImportCAMT053(w http.ResponseWriter, r *http.Request) {
+	h.importStatementFile(w, r, "camt.053", ParseCAMT053)
+}
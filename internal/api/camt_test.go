@@ -0,0 +1,128 @@
+package api
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const camtSample = `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02">
+  <BkToCstmrStmt>
+    <Stmt>
+      <Id>STMT-2025-03</Id>
+      <Acct><Id><IBAN>DE89370400440532013000</IBAN></Id></Acct>
+      <Ntry>
+        <Amt Ccy="EUR">42.50</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <Sts>BOOK</Sts>
+        <BookgDt><Dt>2025-03-03</Dt></BookgDt>
+        <AcctSvcrRef>REF-1</AcctSvcrRef>
+        <NtryDtls><TxDtls>
+          <RltdPties><Cdtr><Nm>Stadtwerke</Nm></Cdtr><Dbtr><Nm>Me</Nm></Dbtr></RltdPties>
+          <RmtInf><Ustrd>Power March</Ustrd><Ustrd>Customer 123</Ustrd></RmtInf>
+        </TxDtls></NtryDtls>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="EUR">2500.00</Amt>
+        <CdtDbtInd>CRDT</CdtDbtInd>
+        <Sts>BOOK</Sts>
+        <BookgDt><DtTm>2025-03-05T08:00:00</DtTm></BookgDt>
+        <NtryDtls><TxDtls>
+          <Refs><AcctSvcrRef>REF-2</AcctSvcrRef></Refs>
+          <RltdPties><Dbtr><Nm>Employer GmbH</Nm></Dbtr><Cdtr><Nm>Me</Nm></Cdtr></RltdPties>
+        </TxDtls></NtryDtls>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="EUR">10.00</Amt>
+        <CdtDbtInd>DBIT</CdtDbtInd>
+        <Sts>PDNG</Sts>
+        <BookgDt><Dt>2025-03-06</Dt></BookgDt>
+      </Ntry>
+      <Ntry>
+        <Amt Ccy="EUR">5.00</Amt>
+        <CdtDbtInd>XXXX</CdtDbtInd>
+        <Sts>BOOK</Sts>
+        <BookgDt><Dt>2025-03-06</Dt></BookgDt>
+      </Ntry>
+    </Stmt>
+  </BkToCstmrStmt>
+</Document>
+`
+
+// camt.053.001.08 nests the status and party names one level deeper; the entry has no
+// reference, so it gets one from its content
+const camtV8Sample = `<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.08">
+  <BkToCstmrStmt><Stmt>
+    <Acct><Id><Othr><Id>12345</Id></Othr></Id></Acct>
+    <Ntry>
+      <Amt Ccy="CHF">19.90</Amt>
+      <CdtDbtInd>DBIT</CdtDbtInd>
+      <Sts><Cd>BOOK</Cd></Sts>
+      <BookgDt><Dt>2025-04-01</Dt></BookgDt>
+      <NtryDtls><TxDtls>
+        <RltdPties><Cdtr><Pty><Nm>Telco AG</Nm></Pty></Cdtr></RltdPties>
+      </TxDtls></NtryDtls>
+      <AddtlNtryInf>Direct debit</AddtlNtryInf>
+    </Ntry>
+  </Stmt></BkToCstmrStmt>
+</Document>
+`
+
+func TestParseCAMT053(t *testing.T) {
+	day := func(month time.Month, d int) time.Time { return time.Date(2025, month, d, 0, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		name    string
+		input   string
+		entries []StatementEntry
+		errors  []string
+		err     bool
+	}{
+		{
+			name:  "debit and credit",
+			input: camtSample,
+			entries: []StatementEntry{
+				{ExternalID: "camt:DE89370400440532013000:REF-1", Name: "Power March Customer 123", Amount: -42.5, Currency: "eur", Date: day(3, 3)},
+				{ExternalID: "camt:DE89370400440532013000:REF-2", Name: "Employer GmbH", Amount: 2500, Currency: "eur", Date: day(3, 5)},
+			},
+			errors: []string{`entry 4: invalid credit/debit indicator "XXXX"`},
+		},
+		{
+			name:  "version 8",
+			input: camtV8Sample,
+			entries: []StatementEntry{
+				{ExternalID: contentIDs{}.next("camt:12345:", "2025-04-01", "19.90", "DBIT", "Telco AG"), Name: "Telco AG", Amount: -19.9, Currency: "chf", Date: day(4, 1)},
+			},
+		},
+		{
+			name:  "only pending entries",
+			input: `<Document><BkToCstmrStmt><Stmt><Ntry><Amt Ccy="EUR">1.00</Amt><CdtDbtInd>DBIT</CdtDbtInd><Sts>PDNG</Sts></Ntry></Stmt></BkToCstmrStmt></Document>`,
+			err:   true,
+		},
+		{
+			name:  "not a statement",
+			input: `<Document><BkToCstmrDbtCdtNtfctn/></Document>`,
+			err:   true,
+		},
+		{
+			name:  "invalid XML",
+			input: `<Document><Stmt><Ntry>`,
+			err:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, entryErrors, err := ParseCAMT053(strings.NewReader(tt.input))
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v, want error %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(entries, tt.entries) {
+				t.Errorf("entries = %+v, want %+v", entries, tt.entries)
+			}
+			if !reflect.DeepEqual(entryErrors, tt.errors) {
+				t.Errorf("errors = %q, want %q", entryErrors, tt.errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// RuleChange is a stored expense as the rules change it
+type RuleChange struct {
+	Before storage.Expense `json:"before"`
+	After  storage.Expense `json:"after"`
+}
+
+// RulesApplied reports which stored expenses the rules change, or changed
+type RulesApplied struct {
+	Preview       bool         `json:"preview"`
+	Checked       int          `json:"checked"` // expenses the user may change
+	Changed       int          `json:"changed"`
+	NewCategories []string     `json:"newCategories"` // categories of the rules that the ledger lacks
+	Changes       []RuleChange `json:"changes"`
+	Errors        []string     `json:"errors"` // expenses left unchanged because the rules make them invalid
+}
+
+// re-applies the rules to the user's stored expenses; a preview lists the changes without
+// storing them, and ids restrict the changes to those expenses, e.g., the ones picked from a preview
+func (h *Handler) ApplyCategoryRules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var payload struct {
+		Preview bool     `json:"preview"`
+		IDs     []string `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	store := h.store(r)
+	rules, err := store.GetCategoryRules()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to apply rules"})
+		log.Printf("API ERROR: Failed to read rules: %v\n", err)
+		return
+	}
+	categories, err := store.GetCategories()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to apply rules"})
+		log.Printf("API ERROR: Failed to read categories: %v\n", err)
+		return
+	}
+	expenses, err := h.visibleExpenses(r)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to apply rules"})
+		log.Printf("API ERROR: Failed to retrieve expenses: %v\n", err)
+		return
+	}
+
+	user := UserFromContext(r.Context())
+	engine := storage.NewRuleEngine(rules)
+	report := RulesApplied{Preview: payload.Preview, NewCategories: []string{}, Changes: []RuleChange{}, Errors: []string{}}
+	known := make(map[string]bool, len(categories))
+	for _, c := range categories {
+		known[strings.ToLower(c)] = true
+	}
+	selected := make(map[string]bool, len(payload.IDs))
+	for _, id := range payload.IDs {
+		selected[id] = true
+	}
+	var changed []storage.Expense
+	for _, expense := range expenses {
+		if !expense.EditableBy(user) {
+			continue
+		}
+		report.Checked++
+		if len(selected) > 0 && !selected[expense.ID] {
+			continue
+		}
+		after, matched := engine.Apply(expense, false)
+		if !matched || (after.Name == expense.Name && after.Category == expense.Category && after.Amount == expense.Amount && slices.Equal(after.Tags, expense.Tags)) {
+			continue
+		}
+		// rules can rename or recategorize the expense, so it is checked again
+		err := after.Validate()
+		if err == nil {
+			after.Category, err = storage.ValidateCategory(after.Category)
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("expense %s: %v", expense.ID, err))
+			continue
+		}
+		if key := strings.ToLower(after.Category); !known[key] {
+			known[key] = true
+			report.NewCategories = append(report.NewCategories, after.Category)
+		}
+		report.Changes = append(report.Changes, RuleChange{Before: expense, After: after})
+		changed = append(changed, after)
+	}
+	report.Changed = len(changed)
+	if payload.Preview {
+		writeJSON(w, http.StatusOK, report)
+		return
+	}
+	if err := store.UpdateMultipleExpenses(changed); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to apply rules"})
+		log.Printf("API ERROR: Failed to update expenses: %v\n", err)
+		return
+	}
+	if len(report.NewCategories) > 0 {
+		if err := store.UpdateCategories(append(categories, report.NewCategories...)); err != nil {
+			writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to apply rules"})
+			log.Printf("API ERROR: Failed to add new categories: %v\n", err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, report)
+	log.Printf("HTTP: Re-applied rules, changing %d of %d expenses\n", report.Changed, report.Checked)
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// characters of windows-1252 bytes 0x80 to 0x9f, where it differs from ISO-8859-1;
+// unused bytes keep their ISO-8859-1 control character
+var windows1252 = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8d, 'Ž', 0x8f,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9d, 'ž', 'Ÿ',
+}
+
+// decodeText returns a reader of UTF-8 text for files some banks still write in ISO-8859-1
+// or windows-1252; ISO-8859-1 bytes are the first 256 Unicode code points
+func decodeText(encoding string, input io.Reader) (io.Reader, error) {
+	var table *[32]rune
+	switch strings.ToLower(encoding) {
+	case "", "utf-8", "utf8":
+		return input, nil
+	case "iso-8859-1", "latin1", "latin-1":
+	case "windows-1252", "cp1252":
+		table = &windows1252
+	default:
+		return nil, fmt.Errorf("unsupported encoding: %s", encoding)
+	}
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	var decoded strings.Builder
+	decoded.Grow(len(data))
+	for _, b := range data {
+		if table != nil && b >= 0x80 && b <= 0x9f {
+			decoded.WriteRune(table[b-0x80])
+		} else {
+			decoded.WriteRune(rune(b))
+		}
+	}
+	return strings.NewReader(decoded.String()), nil
+}
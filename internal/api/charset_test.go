@@ -0,0 +1,41 @@
+package api
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDecodeText(t *testing.T) {
+	tests := []struct {
+		encoding string
+		input    string
+		want     string
+		err      bool
+	}{
+		{"", "Caf\xc3\xa9", "Café", false},
+		{"UTF-8", "Caf\xc3\xa9", "Café", false},
+		{"iso-8859-1", "Caf\xe9 M\xfcller", "Café Müller", false},
+		{"latin1", "\x80", "\u0080", false}, // a control character, not the euro sign
+		{"windows-1252", "\x80 5 \x96 \x93ok\x94", "€ 5 – “ok”", false},
+		{"CP1252", "\x81\xe9", "\u0081é", false}, // unused bytes keep their ISO-8859-1 character
+		{"utf-16", "", "", true},
+	}
+	for _, tt := range tests {
+		decoded, err := decodeText(tt.encoding, strings.NewReader(tt.input))
+		if tt.err {
+			if err == nil {
+				t.Errorf("decodeText(%q): expected an error", tt.encoding)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("decodeText(%q): %v", tt.encoding, err)
+			continue
+		}
+		got, _ := io.ReadAll(decoded)
+		if string(got) != tt.want {
+			t.Errorf("decodeText(%q, %q) = %q, want %q", tt.encoding, tt.input, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,683 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// csvProfileReader streams the rows of a bank CSV export read with a saved profile
+type csvProfileReader struct {
+	reader  *csv.Reader
+	profile storage.CSVProfile
+	header  []string // empty without one
+	index   map[string]int
+	ids     contentIDs
+	first   []string // the first data row, read ahead to reject files without any
+	line    int      // line of the first data row
+}
+
+func newCSVProfileReader(r io.Reader, profile storage.CSVProfile) (*csvProfileReader, error) {
+	decoded, err := decodeText(profile.Encoding, r)
+	if err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(decoded)
+	if bom, _ := reader.Peek(3); bytes.Equal(bom, []byte("\xef\xbb\xbf")) {
+		reader.Discard(3)
+	}
+	for range profile.SkipRows { // preambles are plain lines, often with other delimiters
+		if _, err := reader.ReadString('\n'); err != nil {
+			return nil, fmt.Errorf("file has fewer than %d lines to skip", profile.SkipRows)
+		}
+	}
+	csvReader := csv.NewReader(reader)
+	csvReader.Comma, _ = utf8.DecodeRuneInString(profile.Delimiter)
+	csvReader.FieldsPerRecord = -1
+	csvReader.LazyQuotes = true
+	c := &csvProfileReader{reader: csvReader, profile: profile, ids: contentIDs{}}
+	if !profile.NoHeader {
+		if c.header, err = csvReader.Read(); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("failed to read CSV file: %v", err)
+		}
+	}
+	columns := map[string]string{
+		"date": profile.Columns.Date, "name": profile.Columns.Name, "amount": profile.Columns.Amount,
+		"debit": profile.Columns.Debit, "credit": profile.Columns.Credit, "category": profile.Columns.Category,
+		"currency": profile.Columns.Currency, "reference": profile.Columns.Reference,
+	}
+	c.index = make(map[string]int, len(columns))
+	for field, ref := range columns {
+		if c.index[field], err = c.column(ref); err != nil {
+			return nil, fmt.Errorf("%s %v", field, err)
+		}
+	}
+	c.first, c.line, err = c.read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("no rows found in CSV file")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV file: %v", err)
+	}
+	return c, nil
+}
+
+// column finds a mapped column by header (ignoring case) or by number, -1 when not mapped
+func (c *csvProfileReader) column(ref string) (int, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return -1, nil
+	}
+	for i, h := range c.header {
+		if strings.EqualFold(strings.TrimSpace(h), ref) {
+			return i, nil
+		}
+	}
+	if n, err := strconv.Atoi(ref); err == nil && n >= 1 {
+		return n - 1, nil
+	}
+	return -1, fmt.Errorf("column not found: %s", ref)
+}
+
+// read returns the next data row and its line in the file, skipping blank rows
+func (c *csvProfileReader) read() ([]string, int, error) {
+	for {
+		record, err := c.reader.Read()
+		if err != nil {
+			return nil, 0, err
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		line, _ := c.reader.FieldPos(0)
+		return record, line + c.profile.SkipRows, nil
+	}
+}
+
+// parseCSVAmount reads amounts like 1.234,56, -1,234.56, (12.50), 12,50- and € 9.99
+func parseCSVAmount(value string, profile storage.CSVProfile) (float64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	negative := false
+	if strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+		negative = true
+	}
+	if strings.HasSuffix(value, "-") {
+		negative = true
+		value = strings.TrimSuffix(value, "-")
+	}
+	if profile.Thousands != "" {
+		value = strings.ReplaceAll(value, profile.Thousands, "")
+	}
+	var cleaned strings.Builder
+	for _, c := range value {
+		switch {
+		case unicode.IsDigit(c), c == '-', c == '+':
+			cleaned.WriteRune(c)
+		case string(c) == profile.Decimal:
+			cleaned.WriteRune('.')
+		}
+	}
+	amount, err := strconv.ParseFloat(cleaned.String(), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+	if negative {
+		amount = -amount
+	}
+	return amount, nil
+}
+
+func parseCSVDate(value string, profile storage.CSVProfile) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if profile.DateLayout == "" {
+		return parseDate(value)
+	}
+	layout := profile.GoDateLayout()
+	date, err := time.Parse(layout, value)
+	if err != nil && strings.ContainsAny(value, " T") && !strings.ContainsAny(layout, " T") {
+		// values with a time of day the layout leaves out
+		date, err = time.Parse(layout, strings.FieldsFunc(value, func(r rune) bool { return r == ' ' || r == 'T' })[0])
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q for layout %s", value, profile.DateLayout)
+	}
+	return date.UTC(), nil
+}
+
+// csvEntry is a row of a CSV file read with a profile, or the error that stopped it
+type csvEntry struct {
+	line  int
+	entry StatementEntry
+	err   error
+}
+
+// next reads the next row, io.EOF at the end of the file
+func (c *csvProfileReader) next() (csvEntry, error) {
+	row, line := c.first, c.line
+	if row == nil {
+		var err error
+		if row, line, err = c.read(); err != nil {
+			return csvEntry{}, err
+		}
+	}
+	c.first = nil
+	return c.entry(row, line), nil
+}
+
+func (c *csvProfileReader) cell(row []string, field string) string {
+	if i := c.index[field]; i >= 0 && i < len(row) {
+		return strings.TrimSpace(row[i])
+	}
+	return ""
+}
+
+func (c *csvProfileReader) amount(row []string) (float64, error) {
+	if c.index["amount"] >= 0 {
+		return parseCSVAmount(c.cell(row, "amount"), c.profile)
+	}
+	debit, err := parseCSVAmount(c.cell(row, "debit"), c.profile)
+	if err != nil {
+		return 0, err
+	}
+	credit, err := parseCSVAmount(c.cell(row, "credit"), c.profile)
+	if err != nil {
+		return 0, err
+	}
+	if debit < 0 { // some banks write debits as negative numbers
+		debit = -debit
+	}
+	return credit - debit, nil
+}
+
+// entry reads a data row with the profile
+func (c *csvProfileReader) entry(row []string, line int) csvEntry {
+	result := csvEntry{line: line}
+	date, err := parseCSVDate(c.cell(row, "date"), c.profile)
+	if err != nil {
+		result.err = &rowError{RowInvalidDate, err}
+		return result
+	}
+	amount, err := c.amount(row)
+	if err != nil {
+		result.err = &rowError{RowInvalidAmount, err}
+		return result
+	}
+	if c.profile.InvertSign {
+		amount = -amount
+	}
+	currency := c.cell(row, "currency")
+	if currency != "" {
+		if currency, err = storage.ValidateCurrency(currency); err != nil {
+			result.err = &rowError{RowUnknownCurrency, err}
+			return result
+		}
+	}
+	result.entry = StatementEntry{
+		Name:     c.cell(row, "name"),
+		Amount:   amount,
+		Currency: currency,
+		Date:     date,
+		Category: c.cell(row, "category"),
+	}
+	if ref := c.cell(row, "reference"); ref != "" {
+		result.entry.ExternalID = "csv:" + c.profile.Name + ":" + ref
+	} else {
+		result.entry.ExternalID = c.ids.next("csv:"+c.profile.Name+":", row...)
+	}
+	return result
+}
+
+// ParseCSVWithProfile reads the rows of a bank CSV export with a saved profile; rows that cannot
+// be read are returned as errors instead of failing the whole file
+func ParseCSVWithProfile(r io.Reader, profile storage.CSVProfile) ([]StatementEntry, []string, error) {
+	rows, err := newCSVProfileReader(r, profile)
+	if err != nil {
+		return nil, nil, err
+	}
+	var entries []StatementEntry
+	var entryErrors []string
+	for {
+		row, err := rows.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read CSV file: %v", err)
+		}
+		if row.err != nil {
+			entryErrors = append(entryErrors, fmt.Sprintf("line %d: %v", row.line, row.err))
+			continue
+		}
+		entries = append(entries, row.entry)
+	}
+	return entries, entryErrors, nil
+}
+
+// header names of each field in the exports of common banks, in a few languages
+var csvColumnNames = []struct {
+	field string
+	names []string
+}{
+	{"date", []string{"date", "booking date", "transaction date", "posting date", "posted date", "buchungstag", "buchungsdatum", "datum", "valuta", "fecha", "data", "date operation"}},
+	{"amount", []string{"amount", "betrag", "umsatz", "value", "montant", "importe", "importo", "bedrag", "transaction amount"}},
+	{"debit", []string{"debit", "debit amount", "withdrawal", "withdrawals", "paid out", "money out", "soll", "ausgang"}},
+	{"credit", []string{"credit", "credit amount", "deposit", "deposits", "paid in", "money in", "haben", "eingang"}},
+	{"currency", []string{"currency", "waehrung", "währung", "ccy", "devise", "moneda"}},
+	{"reference", []string{"reference", "transaction id", "id", "ref", "referenz", "bank reference", "fitid"}},
+	{"category", []string{"category", "kategorie", "categorie", "categoria"}},
+	{"name", []string{"name", "description", "payee", "merchant", "details", "verwendungszweck", "beguenstigter", "empfänger", "auftraggeber", "memo", "narrative", "text", "libelle", "concepto", "transaction description"}},
+}
+
+// date layouts tried by the suggestion, most specific first
+var csvDateLayouts = []string{"YYYY-M-D", "D.M.YYYY", "D/M/YYYY", "M/D/YYYY", "D-M-YYYY", "YYYY/M/D", "D.M.YY", "D/M/YY", "M/D/YY", "YYYYMMDD"}
+
+// CSVSuggestion is a profile guessed from the first rows of a file, to review before saving
+type CSVSuggestion struct {
+	Profile  storage.CSVProfile `json:"profile"`
+	Header   []string           `json:"header"`
+	Rows     [][]string         `json:"rows"`     // the first data rows
+	Preview  []StatementEntry   `json:"preview"`  // the first rows read with the profile
+	Errors   []string           `json:"errors"`   // rows of the preview that could not be read
+	Warnings []string           `json:"warnings"` // guesses that should be checked
+}
+
+// SuggestCSVProfile guesses the encoding, delimiter, header row, column mapping, number format
+// and date layout of a bank CSV export
+func SuggestCSVProfile(data []byte) (*CSVSuggestion, error) {
+	suggestion := &CSVSuggestion{Warnings: []string{}, Errors: []string{}}
+	profile := storage.CSVProfile{Name: "suggested", Encoding: "utf-8"}
+	if !utf8.Valid(data) {
+		profile.Encoding = "windows-1252"
+	}
+	decoded, err := decodeText(profile.Encoding, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	sample, _ := io.ReadAll(decoded)
+	sample = bytes.TrimPrefix(sample, []byte("\xef\xbb\xbf"))
+	lines := strings.Split(strings.ReplaceAll(string(sample), "\r\n", "\n"), "\n")
+	lines = lines[:min(len(lines), 50)]
+
+	// the delimiter splitting most lines into the same number of fields; lines before the first
+	// of them are a preamble
+	bestScore, fieldCount := 0, 0
+	for _, delimiter := range []rune{',', ';', '\t', '|'} {
+		counts := map[int]int{}
+		for _, line := range lines {
+			if fields := splitCSVLine(line, delimiter); len(fields) > 1 {
+				counts[len(fields)]++
+			}
+		}
+		for n, c := range counts {
+			if c > bestScore || (c == bestScore && n > fieldCount) {
+				bestScore, fieldCount, profile.Delimiter = c, n, string(delimiter)
+			}
+		}
+	}
+	if bestScore == 0 {
+		return nil, fmt.Errorf("could not find the delimiter of the CSV file")
+	}
+	delimiter, _ := utf8.DecodeRuneInString(profile.Delimiter)
+	var table [][]string
+	for i, line := range lines {
+		fields := splitCSVLine(line, delimiter)
+		if len(fields) != fieldCount {
+			if table == nil {
+				profile.SkipRows = i + 1
+			}
+			continue
+		}
+		table = append(table, fields)
+	}
+
+	// a first row without numbers is the header
+	header := table[0]
+	for _, cell := range header {
+		if _, err := strconv.ParseFloat(strings.TrimSpace(cell), 64); err == nil || looksLikeDate(cell) {
+			header = nil
+			break
+		}
+	}
+	dataRows := table
+	if header != nil {
+		dataRows = table[1:]
+	} else {
+		profile.NoHeader = true
+		suggestion.Warnings = append(suggestion.Warnings, "no header row found, columns are mapped by number")
+	}
+	suggestion.Header = header
+	suggestion.Rows = dataRows[:min(len(dataRows), 5)]
+
+	// columns by header name, then by content for fields that are still missing
+	assigned := map[int]bool{}
+	mapping := map[string]int{}
+	for _, exact := range []bool{true, false} {
+		for _, f := range csvColumnNames {
+			if _, ok := mapping[f.field]; ok {
+				continue
+			}
+			for i, h := range header {
+				h = strings.ToLower(strings.TrimSpace(h))
+				if assigned[i] || h == "" {
+					continue
+				}
+				if slices.ContainsFunc(f.names, func(name string) bool {
+					return h == name || (!exact && len(name) > 3 && strings.Contains(h, name))
+				}) {
+					mapping[f.field] = i
+					assigned[i] = true
+					break
+				}
+			}
+		}
+	}
+	columnValues := func(i int) []string {
+		var values []string
+		for _, row := range dataRows {
+			if i < len(row) && strings.TrimSpace(row[i]) != "" {
+				values = append(values, strings.TrimSpace(row[i]))
+			}
+		}
+		return values
+	}
+	if _, ok := mapping["date"]; !ok {
+		for i := range fieldCount {
+			if values := columnValues(i); !assigned[i] && len(values) > 0 && dateLayoutFor(values) != "" {
+				mapping["date"], assigned[i] = i, true
+				break
+			}
+		}
+	}
+	_, hasDebit := mapping["debit"]
+	_, hasCredit := mapping["credit"]
+	if _, ok := mapping["amount"]; ok {
+		delete(mapping, "debit")
+		delete(mapping, "credit")
+	} else if !hasDebit || !hasCredit {
+		for i := range fieldCount {
+			if values := columnValues(i); !assigned[i] && len(values) > 0 && allAmounts(values) {
+				mapping["amount"], assigned[i] = i, true
+				delete(mapping, "debit")
+				delete(mapping, "credit")
+				break
+			}
+		}
+	}
+	if _, ok := mapping["name"]; !ok { // the column with the longest text
+		longest := 0
+		for i := range fieldCount {
+			values := columnValues(i)
+			if assigned[i] || len(values) == 0 || allAmounts(values) {
+				continue
+			}
+			total := 0
+			for _, v := range values {
+				total += len(v)
+			}
+			if avg := total / len(values); avg > longest {
+				longest, mapping["name"] = avg, i
+			}
+		}
+	}
+	ref := func(field string) string {
+		i, ok := mapping[field]
+		switch {
+		case !ok:
+			return ""
+		case header != nil:
+			return strings.TrimSpace(header[i])
+		default:
+			return strconv.Itoa(i + 1)
+		}
+	}
+	profile.Columns = storage.CSVColumns{
+		Date: ref("date"), Name: ref("name"), Amount: ref("amount"), Debit: ref("debit"), Credit: ref("credit"),
+		Category: ref("category"), Currency: ref("currency"), Reference: ref("reference"),
+	}
+
+	// number format from the amounts, date layout from the dates
+	var amounts []string
+	for _, field := range []string{"amount", "debit", "credit"} {
+		if i, ok := mapping[field]; ok {
+			amounts = append(amounts, columnValues(i)...)
+		}
+	}
+	profile.Decimal, profile.Thousands = ".", ","
+	if decimalComma(amounts) {
+		profile.Decimal, profile.Thousands = ",", "."
+	}
+	if i, ok := mapping["date"]; ok {
+		values := columnValues(i)
+		profile.DateLayout = dateLayoutFor(values)
+		if strings.HasPrefix(profile.DateLayout, "D/M") && dateLayoutCount("M/D"+profile.DateLayout[3:], values) == dateLayoutCount(profile.DateLayout, values) {
+			suggestion.Warnings = append(suggestion.Warnings, "dates could be DD/MM or MM/DD, check the date layout")
+		}
+	}
+	if err := profile.Validate(); err != nil {
+		suggestion.Warnings = append(suggestion.Warnings, "incomplete profile: "+err.Error())
+	}
+	suggestion.Warnings = append(suggestion.Warnings, "check whether expenses are negative in the preview, or set invertSign")
+	suggestion.Profile = profile
+	if entries, entryErrors, err := ParseCSVWithProfile(bytes.NewReader(data), profile); err == nil {
+		suggestion.Preview = entries[:min(len(entries), 5)]
+		suggestion.Errors = append(suggestion.Errors, entryErrors[:min(len(entryErrors), 5)]...)
+	}
+	return suggestion, nil
+}
+
+// splitCSVLine splits one line, or nil when it is not valid CSV on its own
+func splitCSVLine(line string, delimiter rune) []string {
+	reader := csv.NewReader(strings.NewReader(line))
+	reader.Comma = delimiter
+	reader.LazyQuotes = true
+	fields, err := reader.Read()
+	if err != nil {
+		return nil
+	}
+	return fields
+}
+
+func looksLikeDate(value string) bool {
+	return dateLayoutFor([]string{strings.TrimSpace(value)}) != ""
+}
+
+// dateLayoutFor returns the layout reading most values, or none when no layout reads at least
+// half of them; the first layout wins ties
+func dateLayoutFor(values []string) string {
+	best, bestCount := "", 0
+	for _, layout := range csvDateLayouts {
+		if count := dateLayoutCount(layout, values); count > bestCount {
+			best, bestCount = layout, count
+		}
+	}
+	if bestCount*2 < len(values) {
+		return ""
+	}
+	return best
+}
+
+func dateLayoutCount(layout string, values []string) int {
+	profile := storage.CSVProfile{DateLayout: layout}
+	count := 0
+	for _, v := range values {
+		if _, err := parseCSVDate(v, profile); err == nil {
+			count++
+		}
+	}
+	return count
+}
+
+func allAmounts(values []string) bool {
+	for _, v := range values {
+		v = strings.Trim(v, " ()€$£+-")
+		if v == "" || strings.IndexFunc(v, func(r rune) bool { return !unicode.IsDigit(r) && r != '.' && r != ',' }) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// decimalComma tells whether most amounts end with a comma and one or two digits
+func decimalComma(values []string) bool {
+	comma, dot := 0, 0
+	for _, v := range values {
+		v = strings.TrimRight(v, " -)€$£")
+		i := strings.LastIndexAny(v, ".,")
+		if i < 0 || len(v)-i-1 > 2 {
+			continue
+		}
+		if v[i] == ',' {
+			comma++
+		} else {
+			dot++
+		}
+	}
+	return comma > dot
+}
+
+func (h *Handler) GetCSVProfiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	profiles, err := h.store(r).GetCSVProfiles()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get CSV profiles"})
+		log.Printf("API ERROR: Failed to get CSV profiles: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, profiles)
+}
+
+func (h *Handler) SaveCSVProfile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var profile storage.CSVProfile
+	if err := json.NewDecoder(r.Body).Decode(&profile); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	if err := profile.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := h.store(r).SaveCSVProfile(profile); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to save CSV profile"})
+		log.Printf("API ERROR: Failed to save CSV profile: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, profile)
+}
+
+func (h *Handler) DeleteCSVProfile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Name parameter is required"})
+		return
+	}
+	if err := h.store(r).RemoveCSVProfile(name); err != nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "CSV profile not found"})
+		log.Printf("API ERROR: Failed to delete CSV profile: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// suggests a CSV profile from the first rows of an uploaded file
+func (h *Handler) SuggestCSVProfile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	if err := r.ParseMultipartForm(10 << 20); err != nil { // 10MB max file size
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Could not parse multipart form"})
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Error retrieving the file"})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, 64<<10)) // the first rows are enough
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Error reading the file"})
+		return
+	}
+	if i := bytes.LastIndexByte(data, '\n'); len(data) == 64<<10 && i > 0 {
+		data = data[:i+1] // drops the partial last line
+	}
+	suggestion, err := SuggestCSVProfile(data)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, suggestion)
+}
+
+// importCSVWithProfile imports a bank CSV export with a saved profile, or previews the import
+func (h *Handler) importCSVWithProfile(w http.ResponseWriter, r *http.Request, name string, file io.Reader, preview, skipInvalid bool) {
+	profiles, err := h.store(r).GetCSVProfiles()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get CSV profiles"})
+		log.Printf("API ERROR: Failed to get CSV profiles: %v\n", err)
+		return
+	}
+	i := slices.IndexFunc(profiles, func(p storage.CSVProfile) bool { return strings.EqualFold(p.Name, name) })
+	if i < 0 {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "CSV profile not found: " + name})
+		return
+	}
+	rows, err := newCSVProfileReader(file, profiles[i])
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	owner := UserFromContext(r.Context())
+	next := func() (importCandidate, error) {
+		row, err := rows.next()
+		if err != nil {
+			return importCandidate{}, err
+		}
+		return importCandidate{row: row.line, expense: row.entry.expense(owner), err: row.err}, nil
+	}
+	if preview {
+		var candidates []importCandidate
+		for {
+			candidate, err := next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Failed to read CSV file"})
+				return
+			}
+			candidates = append(candidates, candidate)
+		}
+		h.writeImportPreview(w, r, "csv", candidates)
+		return
+	}
+	h.writeImport(w, r, "csv", next, skipInvalid)
+}
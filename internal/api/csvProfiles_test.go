@@ -0,0 +1,168 @@
+package api
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+func TestParseCSVAmount(t *testing.T) {
+	dot := storage.CSVProfile{Decimal: ".", Thousands: ","}
+	comma := storage.CSVProfile{Decimal: ",", Thousands: "."}
+	tests := []struct {
+		value   string
+		profile storage.CSVProfile
+		want    float64
+		err     bool
+	}{
+		{"-1,234.56", dot, -1234.56, false},
+		{"+3.00", dot, 3, false},
+		{"(12.50)", dot, -12.5, false},
+		{"€ 9.99", dot, 9.99, false},
+		{"1.234,56", comma, 1234.56, false},
+		{"12,50-", comma, -12.5, false},
+		{"-0,99 EUR", comma, -0.99, false},
+		{"", comma, 0, false},
+		{"n/a", dot, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseCSVAmount(tt.value, tt.profile)
+		if (err != nil) != tt.err {
+			t.Errorf("parseCSVAmount(%q): err = %v, want error %v", tt.value, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseCSVAmount(%q, decimal %q) = %v, want %v", tt.value, tt.profile.Decimal, got, tt.want)
+		}
+	}
+}
+
+func TestParseCSVDate(t *testing.T) {
+	tests := []struct {
+		value  string
+		layout string
+		want   string // YYYY-MM-DD, empty for an error
+	}{
+		{"05.03.2025", "DD.MM.YYYY", "2025-03-05"},
+		{"5.3.25", "D.M.YY", "2025-03-05"},
+		{"03/05/2025", "MM/DD/YYYY", "2025-03-05"},
+		{"05.03.2025 14:30", "DD.MM.YYYY", "2025-03-05"},
+		{"20250305", "YYYYMMDD", "2025-03-05"},
+		{"2025-03-05", "", "2025-03-05"}, // the formats of the plain CSV import
+		{"2025-03-05", "DD.MM.YYYY", ""},
+		{"31.02.2025", "DD.MM.YYYY", ""},
+	}
+	for _, tt := range tests {
+		date, err := parseCSVDate(tt.value, storage.CSVProfile{DateLayout: tt.layout})
+		switch {
+		case tt.want == "" && err == nil:
+			t.Errorf("parseCSVDate(%q, %q) = %s, want an error", tt.value, tt.layout, date.Format(time.DateOnly))
+		case tt.want != "" && err != nil:
+			t.Errorf("parseCSVDate(%q, %q): %v", tt.value, tt.layout, err)
+		case tt.want != "" && date.Format(time.DateOnly) != tt.want:
+			t.Errorf("parseCSVDate(%q, %q) = %s, want %s", tt.value, tt.layout, date.Format(time.DateOnly), tt.want)
+		}
+	}
+}
+
+// a German bank export in windows-1252, with two lines of account details before the header
+// and separate debit (Soll) and credit (Haben) columns
+const csvBankSample = "Konto;DE89370400440532013000\r\n" +
+	"Zeitraum;M\xe4rz 2025\r\n" +
+	"Buchungstag;Empf\xe4nger;Soll;Haben;Referenz\r\n" +
+	"03.03.2025;B\xe4ckerei M\xfcller;4,50;;R1\r\n" +
+	"04.03.2025;Arbeitgeber;;2.500,00;R2\r\n" +
+	"xx.03.2025;Broken;1,00;;R3\r\n"
+
+func TestParseCSVWithProfile(t *testing.T) {
+	profile := storage.CSVProfile{
+		Name:       "bank",
+		Columns:    storage.CSVColumns{Date: "buchungstag", Name: "Empfänger", Debit: "Soll", Credit: "Haben", Reference: "Referenz"},
+		Delimiter:  ";",
+		Decimal:    ",",
+		Thousands:  ".",
+		DateLayout: "DD.MM.YYYY",
+		SkipRows:   2,
+		Encoding:   "windows-1252",
+	}
+	entries, entryErrors, err := ParseCSVWithProfile(strings.NewReader(csvBankSample), profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []StatementEntry{
+		{ExternalID: "csv:bank:R1", Name: "Bäckerei Müller", Amount: -4.5, Date: time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)},
+		{ExternalID: "csv:bank:R2", Name: "Arbeitgeber", Amount: 2500, Date: time.Date(2025, 3, 4, 0, 0, 0, 0, time.UTC)},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("entries = %+v, want %+v", entries, want)
+	}
+	wantErrors := []string{`line 6: invalid date "xx.03.2025" for layout DD.MM.YYYY`}
+	if !reflect.DeepEqual(entryErrors, wantErrors) {
+		t.Errorf("errors = %q, want %q", entryErrors, wantErrors)
+	}
+
+	profile.Columns.Debit = "Ausgang"
+	if _, _, err := ParseCSVWithProfile(strings.NewReader(csvBankSample), profile); err == nil {
+		t.Error("expected an error for a column the file does not have")
+	}
+}
+
+func TestSuggestCSVProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		profile storage.CSVProfile
+		preview int
+	}{
+		{
+			name:  "windows-1252 with a preamble",
+			input: csvBankSample,
+			profile: storage.CSVProfile{
+				Name:       "suggested",
+				Columns:    storage.CSVColumns{Date: "Buchungstag", Name: "Empfänger", Debit: "Soll", Credit: "Haben", Reference: "Referenz"},
+				Delimiter:  ";",
+				Decimal:    ",",
+				Thousands:  ".",
+				DateLayout: "D.M.YYYY",
+				SkipRows:   2,
+				Encoding:   "windows-1252",
+			},
+			preview: 2,
+		},
+		{
+			name:  "UTF-8 without a header",
+			input: "2025-01-02,Coffee at the station,-3.50\n2025-01-03,Books,-12.00\n",
+			profile: storage.CSVProfile{
+				Name:       "suggested",
+				Columns:    storage.CSVColumns{Date: "1", Name: "2", Amount: "3"},
+				Delimiter:  ",",
+				Decimal:    ".",
+				Thousands:  ",",
+				DateLayout: "YYYY-M-D",
+				NoHeader:   true,
+				Encoding:   "utf-8",
+			},
+			preview: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suggestion, err := SuggestCSVProfile([]byte(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(suggestion.Profile, tt.profile) {
+				t.Errorf("profile = %+v, want %+v", suggestion.Profile, tt.profile)
+			}
+			if len(suggestion.Preview) != tt.preview {
+				t.Errorf("preview has %d entries, want %d", len(suggestion.Preview), tt.preview)
+			}
+		})
+	}
+	if _, err := SuggestCSVProfile([]byte("just text\nmore text\n")); err == nil {
+		t.Error("expected an error for a file without a delimiter")
+	}
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// addedExpense is the response of AddExpense, flagging stored expenses it likely duplicates
+type addedExpense struct {
+	storage.Expense
+	PossibleDuplicates []storage.DuplicateMatch `json:"possibleDuplicates,omitempty"`
+}
+
+// possibleDuplicates finds the user's stored expenses that the expense likely duplicates
+func (h *Handler) possibleDuplicates(r *http.Request, expense storage.Expense) ([]storage.DuplicateMatch, error) {
+	window := storage.DuplicateWindowDays * 24 * time.Hour
+	minAmount, maxAmount := expense.Amount-0.005, expense.Amount+0.005
+	result, err := h.store(r).QueryExpenses(storage.ExpenseQuery{
+		From:      expense.Date.Add(-window - 24*time.Hour),
+		To:        expense.Date.Add(window + 24*time.Hour),
+		MinAmount: &minAmount,
+		MaxAmount: &maxAmount,
+		Viewer:    UserFromContext(r.Context()),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return storage.FindDuplicates(expense, result.Expenses), nil
+}
+
+// lists clusters of the user's expenses that likely are the same transaction
+func (h *Handler) GetDuplicates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	expenses, err := h.visibleExpenses(r)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to find duplicates"})
+		log.Printf("API ERROR: Failed to retrieve expenses: %v\n", err)
+		return
+	}
+	dismissed, err := h.store(r).GetDismissedDuplicates()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to find duplicates"})
+		log.Printf("API ERROR: Failed to retrieve dismissed duplicates: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, storage.DuplicateClusters(expenses, dismissed))
+}
+
+// marks expenses as not duplicates of each other, so they are no longer listed together
+func (h *Handler) DismissDuplicates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var payload struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	if len(payload.IDs) < 2 {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "At least two expenses are required"})
+		return
+	}
+	user := UserFromContext(r.Context())
+	for _, id := range payload.IDs {
+		if expense, err := h.store(r).GetExpense(id); err != nil || !expense.VisibleTo(user) {
+			writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Expense not found"})
+			return
+		}
+	}
+	if err := h.store(r).DismissDuplicates(payload.IDs); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to dismiss duplicates"})
+		log.Printf("API ERROR: Failed to dismiss duplicates: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// merges duplicates into the kept expense: the others are deleted, their tags are added to it, and
+// it takes over a bank reference so that re-imports are still skipped
+func (h *Handler) MergeDuplicates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var payload struct {
+		Keep   string   `json:"keep"`
+		Remove []string `json:"remove"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	if payload.Keep == "" || len(payload.Remove) == 0 || slices.Contains(payload.Remove, payload.Keep) {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "One expense to keep and at least one other to remove are required"})
+		return
+	}
+	// nothing is merged unless the user may change every expense
+	kept, ok := h.editableExpense(w, r, payload.Keep)
+	if !ok {
+		return
+	}
+	for _, id := range payload.Remove {
+		removed, ok := h.editableExpense(w, r, id)
+		if !ok {
+			return
+		}
+		for _, tag := range removed.Tags {
+			if !slices.Contains(kept.Tags, tag) {
+				kept.Tags = append(kept.Tags, tag)
+			}
+		}
+		if kept.ExternalID == "" {
+			kept.ExternalID = removed.ExternalID
+		}
+	}
+	if err := h.store(r).MergeExpenses(kept, payload.Remove); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to merge duplicates"})
+		log.Printf("API ERROR: Failed to merge duplicates: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, kept)
+	log.Printf("HTTP: Merged %d duplicates into expense %s\n", len(payload.Remove), kept.ID)
+}
+
+// duplicateCandidates indexes the expenses an imported row can duplicate by amount in cents
+func duplicateCandidates(expenses []storage.Expense, owner string) map[int64][]storage.Expense {
+	byAmount := make(map[int64][]storage.Expense)
+	for _, e := range expenses {
+		if e.VisibleTo(owner) {
+			byAmount[amountKey(e.Amount)] = append(byAmount[amountKey(e.Amount)], e)
+		}
+	}
+	return byAmount
+}
+
+func amountKey(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
@@ -5,22 +5,29 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/tanq16/expenseowl/internal/storage"
 	"github.com/tanq16/expenseowl/internal/web"
 )
 
 // Handler holds the storage interface
 type Handler struct {
-	storage storage.Storage
+	storage   storage.Storage
+	previews  *importPreviews
+	snapshots *storage.Snapshotter // nil when automatic backups are off
 }
 
 // NewHandler creates a new API handler
-func NewHandler(s storage.Storage) *Handler {
+func NewHandler(s storage.Storage, snapshots *storage.Snapshotter) *Handler {
 	return &Handler{
-		storage: s,
+		storage:   s,
+		previews:  newImportPreviews(),
+		snapshots: snapshots,
 	}
 }
 
@@ -47,12 +54,21 @@ func (h *Handler) GetConfig(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
 		return
 	}
-	config, err := h.storage.GetConfig()
+	config, err := h.store(r).GetConfig()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get config"})
 		log.Printf("API ERROR: Failed to get config: %v\n", err)
 		return
 	}
+	// recurring expenses are filtered like in GetRecurringExpenses
+	user := UserFromContext(r.Context())
+	visible := []storage.RecurringExpense{}
+	for _, re := range config.RecurringExpenses {
+		if re.VisibleTo(user) {
+			visible = append(visible, re)
+		}
+	}
+	config.RecurringExpenses = visible
 	writeJSON(w, http.StatusOK, config)
 }
 
@@ -61,7 +77,7 @@ func (h *Handler) GetCategories(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
 		return
 	}
-	categories, err := h.storage.GetCategories()
+	categories, err := h.store(r).GetCategories()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get categories"})
 		log.Printf("API ERROR: Failed to get categories: %v\n", err)
@@ -90,7 +106,7 @@ func (h *Handler) UpdateCategories(w http.ResponseWriter, r *http.Request) {
 		}
 		sanitizedCategories = append(sanitizedCategories, sanitized)
 	}
-	if err := h.storage.UpdateCategories(sanitizedCategories); err != nil {
+	if err := h.store(r).UpdateCategories(sanitizedCategories); err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to update categories"})
 		log.Printf("API ERROR: Failed to update categories: %v\n", err)
 		return
@@ -98,12 +114,49 @@ func (h *Handler) UpdateCategories(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
 }
 
+func (h *Handler) GetCategoryRules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	rules, err := h.store(r).GetCategoryRules()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get category rules"})
+		log.Printf("API ERROR: Failed to get category rules: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rules)
+}
+
+func (h *Handler) UpdateCategoryRules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var rules []storage.CategoryRule
+	if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	rules, err := storage.ValidateCategoryRules(rules)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := h.store(r).UpdateCategoryRules(rules); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to update category rules"})
+		log.Printf("API ERROR: Failed to update category rules: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
 func (h *Handler) GetCurrency(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
 		return
 	}
-	currency, err := h.storage.GetCurrency()
+	currency, err := h.store(r).GetCurrency()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get currency"})
 		log.Printf("API ERROR: Failed to get currency: %v\n", err)
@@ -122,7 +175,7 @@ func (h *Handler) UpdateCurrency(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
 		return
 	}
-	if err := h.storage.UpdateCurrency(currency); err != nil {
+	if err := h.store(r).UpdateCurrency(currency); err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		log.Printf("API ERROR: Failed to update currency: %v\n", err)
 		return
@@ -135,7 +188,7 @@ func (h *Handler) GetStartDate(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
 		return
 	}
-	startDate, err := h.storage.GetStartDate()
+	startDate, err := h.store(r).GetStartDate()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get start date"})
 		log.Printf("API ERROR: Failed to get start date: %v\n", err)
@@ -154,7 +207,7 @@ func (h *Handler) UpdateStartDate(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
 		return
 	}
-	if err := h.storage.UpdateStartDate(startDate); err != nil {
+	if err := h.store(r).UpdateStartDate(startDate); err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		log.Printf("API ERROR: Failed to update start date: %v\n", err)
 		return
@@ -180,15 +233,49 @@ func (h *Handler) AddExpense(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
-	if expense.Date.IsZero() {
-		expense.Date = time.Now()
+	expense.Owner = UserFromContext(r.Context())
+	shared, err := h.participants(expense.Owner, expense.SharedWith)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	expense.SharedWith = shared
+	// rules marked for expenses added by hand run on the expense in the ledger's currency
+	store := h.store(r)
+	rules, err := store.GetCategoryRules()
+	if err == nil && expense.Currency == "" {
+		expense.Currency, err = store.GetCurrency()
 	}
-	if err := h.storage.AddExpense(expense); err != nil {
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to save expense"})
+		log.Printf("API ERROR: Failed to read rules: %v\n", err)
+		return
+	}
+	expense, _ = storage.NewRuleEngine(rules).Apply(expense, true)
+	// rules can rename or recategorize the expense, so it is checked again
+	err = expense.Validate()
+	if err == nil {
+		expense.Category, err = storage.ValidateCategory(expense.Category)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Invalid expense after applying category rules: %v", err)})
+		return
+	}
+	// the ID is assigned here to be returned with the stored expense
+	if expense.ID == "" {
+		expense.ID = uuid.New().String()
+	}
+	// checked before saving, so the expense does not match itself
+	duplicates, err := h.possibleDuplicates(r, expense)
+	if err != nil {
+		log.Printf("API ERROR: Failed to check for duplicates: %v\n", err)
+	}
+	if err := store.AddExpense(expense); err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to save expense"})
 		log.Printf("API ERROR: Failed to save expense: %v\n", err)
 		return
 	}
-	writeJSON(w, http.StatusOK, expense)
+	writeJSON(w, http.StatusOK, addedExpense{Expense: expense, PossibleDuplicates: duplicates})
 }
 
 func (h *Handler) GetExpenses(w http.ResponseWriter, r *http.Request) {
@@ -196,13 +283,171 @@ func (h *Handler) GetExpenses(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
 		return
 	}
-	expenses, err := h.storage.GetAllExpenses()
+	user := UserFromContext(r.Context())
+	// without query parameters the full list is returned as a plain array, as before
+	values := r.URL.Query()
+	values.Del("ledger")
+	if len(values) == 0 {
+		expenses, err := h.visibleExpenses(r)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve expenses"})
+			log.Printf("API ERROR: Failed to retrieve expenses: %v\n", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, expenses)
+		return
+	}
+	query, err := parseExpenseQuery(r.URL.Query())
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	query.Viewer = user
+	result, err := h.store(r).QueryExpenses(query)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve expenses"})
-		log.Printf("API ERROR: Failed to retrieve expenses: %v\n", err)
+		log.Printf("API ERROR: Failed to query expenses: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// visibleExpenses returns all expenses the user may see, newest first like GetAllExpenses
+func (h *Handler) visibleExpenses(r *http.Request) ([]storage.Expense, error) {
+	user := UserFromContext(r.Context())
+	if user == "" {
+		return h.store(r).GetAllExpenses()
+	}
+	result, err := h.store(r).QueryExpenses(storage.ExpenseQuery{SortBy: "date", SortDesc: true, Viewer: user})
+	if err != nil {
+		return nil, err
+	}
+	return result.Expenses, nil
+}
+
+// participants validates who an expense is shared with; all of them must be known users
+func (h *Handler) participants(owner string, sharedWith []string) ([]string, error) {
+	shared, err := storage.NormalizeParticipants(owner, sharedWith)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range shared {
+		if _, err := h.storage.GetUser(p); err != nil {
+			return nil, fmt.Errorf("unknown participant '%s'", p)
+		}
+	}
+	return shared, nil
+}
+
+// splits repeated and comma-separated values of a query parameter
+func queryList(values url.Values, key string) []string {
+	var list []string
+	for _, v := range values[key] {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// builds a storage query from GET /expenses parameters
+func parseExpenseQuery(values url.Values) (storage.ExpenseQuery, error) {
+	query := storage.ExpenseQuery{
+		Categories:    queryList(values, "category"),
+		Tags:          queryList(values, "tag"),
+		Name:          strings.TrimSpace(values.Get("name")),
+		SortBy:        values.Get("sort"),
+		RecurringOnly: values.Get("recurring") == "true",
+	}
+	if v := values.Get("from"); v != "" {
+		from, err := parseDate(v)
+		if err != nil {
+			return query, fmt.Errorf("invalid 'from' date: %s", v)
+		}
+		query.From = from
+	}
+	if v := values.Get("to"); v != "" {
+		to, err := parseDate(v)
+		if err != nil {
+			return query, fmt.Errorf("invalid 'to' date: %s", v)
+		}
+		// a plain date includes that whole day
+		if !strings.Contains(v, ":") {
+			to = to.AddDate(0, 0, 1)
+		}
+		query.To = to
+	}
+	for key, target := range map[string]**float64{"minAmount": &query.MinAmount, "maxAmount": &query.MaxAmount} {
+		if v := values.Get(key); v != "" {
+			amount, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return query, fmt.Errorf("invalid '%s': %s", key, v)
+			}
+			*target = &amount
+		}
+	}
+	for key, target := range map[string]*int{"limit": &query.Limit, "offset": &query.Offset} {
+		if v := values.Get(key); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return query, fmt.Errorf("invalid '%s': %s", key, v)
+			}
+			*target = n
+		}
+	}
+	switch values.Get("order") {
+	case "asc":
+		query.SortDesc = false
+	case "desc":
+		query.SortDesc = true
+	case "":
+		query.SortDesc = query.SortBy == "" || query.SortBy == "date" // newest first by default
+	default:
+		return query, fmt.Errorf("invalid 'order': must be 'asc' or 'desc'")
+	}
+	return query, query.Validate()
+}
+
+func (h *Handler) GetSummary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	values := r.URL.Query()
+	filter, err := parseExpenseQuery(values)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
-	writeJSON(w, http.StatusOK, expenses)
+	filter.Viewer = UserFromContext(r.Context())
+	query := storage.SummaryQuery{Filter: filter, GroupBy: values.Get("groupBy"), Location: time.UTC}
+	if tz := values.Get("tz"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("invalid 'tz': %s", tz)})
+			return
+		}
+		query.Location = loc
+		// plain dates mean midnight in the requested time zone
+		for key, target := range map[string]*time.Time{"from": &query.Filter.From, "to": &query.Filter.To} {
+			if v := values.Get(key); v != "" && !strings.Contains(v, ":") {
+				*target = time.Date(target.Year(), target.Month(), target.Day(), 0, 0, 0, 0, loc)
+			}
+		}
+	}
+	if err := query.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	summary, err := h.store(r).SummarizeExpenses(query)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to summarize expenses"})
+		log.Printf("API ERROR: Failed to summarize expenses: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, summary)
 }
 
 func (h *Handler) EditExpense(w http.ResponseWriter, r *http.Request) {
@@ -224,7 +469,26 @@ func (h *Handler) EditExpense(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
-	if err := h.storage.UpdateExpense(id, expense); err != nil {
+	existing, ok := h.editableExpense(w, r, id)
+	if !ok {
+		return
+	}
+	// the owner and bank reference never change on edit, and participants and currency are kept unless sent
+	expense.Owner = existing.Owner
+	expense.ExternalID = existing.ExternalID
+	if expense.SharedWith == nil {
+		expense.SharedWith = existing.SharedWith
+	}
+	if expense.Currency == "" {
+		expense.Currency = existing.Currency
+	}
+	shared, err := h.participants(expense.Owner, expense.SharedWith)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	expense.SharedWith = shared
+	if err := h.store(r).UpdateExpense(id, expense); err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to edit expense"})
 		log.Printf("API ERROR: Failed to edit expense: %v\n", err)
 		return
@@ -232,6 +496,21 @@ func (h *Handler) EditExpense(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, expense)
 }
 
+// editableExpense loads an expense and writes an error response unless the user may change it
+func (h *Handler) editableExpense(w http.ResponseWriter, r *http.Request, id string) (storage.Expense, bool) {
+	user := UserFromContext(r.Context())
+	expense, err := h.store(r).GetExpense(id)
+	if err != nil || !expense.VisibleTo(user) {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Expense not found"})
+		return storage.Expense{}, false
+	}
+	if !expense.EditableBy(user) {
+		writeJSON(w, http.StatusForbidden, ErrorResponse{Error: "Only the owner can change this expense"})
+		return storage.Expense{}, false
+	}
+	return expense, true
+}
+
 func (h *Handler) DeleteExpense(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
 		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
@@ -242,7 +521,10 @@ func (h *Handler) DeleteExpense(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "ID parameter is required"})
 		return
 	}
-	if err := h.storage.RemoveExpense(id); err != nil {
+	if _, ok := h.editableExpense(w, r, id); !ok {
+		return
+	}
+	if err := h.store(r).RemoveExpense(id); err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete expense"})
 		log.Printf("API ERROR: Failed to delete expense: %v\n", err)
 		return
@@ -262,7 +544,13 @@ func (h *Handler) DeleteMultipleExpenses(w http.ResponseWriter, r *http.Request)
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
 		return
 	}
-	if err := h.storage.RemoveMultipleExpenses(payload.IDs); err != nil {
+	// nothing is deleted unless the user may delete every expense
+	for _, id := range payload.IDs {
+		if _, ok := h.editableExpense(w, r, id); !ok {
+			return
+		}
+	}
+	if err := h.store(r).RemoveMultipleExpenses(payload.IDs); err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete multiple expenses"})
 		log.Printf("API ERROR: Failed to delete multiple expenses: %v\n", err)
 		return
@@ -288,7 +576,14 @@ func (h *Handler) AddRecurringExpense(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
-	if err := h.storage.AddRecurringExpense(re); err != nil {
+	re.Owner = UserFromContext(r.Context())
+	shared, err := h.participants(re.Owner, re.SharedWith)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	re.SharedWith = shared
+	if err := h.store(r).AddRecurringExpense(re); err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to add recurring expense"})
 		log.Printf("API ERROR: Failed to add recurring expense: %v\n", err)
 		return
@@ -301,13 +596,20 @@ func (h *Handler) GetRecurringExpenses(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
 		return
 	}
-	res, err := h.storage.GetRecurringExpenses()
+	res, err := h.store(r).GetRecurringExpenses()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get recurring expenses"})
 		log.Printf("API ERROR: Failed to get recurring expenses: %v\n", err)
 		return
 	}
-	writeJSON(w, http.StatusOK, res)
+	user := UserFromContext(r.Context())
+	visible := []storage.RecurringExpense{}
+	for _, re := range res {
+		if re.VisibleTo(user) {
+			visible = append(visible, re)
+		}
+	}
+	writeJSON(w, http.StatusOK, visible)
 }
 
 func (h *Handler) UpdateRecurringExpense(w http.ResponseWriter, r *http.Request) {
@@ -331,7 +633,24 @@ func (h *Handler) UpdateRecurringExpense(w http.ResponseWriter, r *http.Request)
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
-	if err := h.storage.UpdateRecurringExpense(id, re, updateAll); err != nil {
+	existing, ok := h.editableRecurringExpense(w, r, id)
+	if !ok {
+		return
+	}
+	re.Owner = existing.Owner
+	if re.SharedWith == nil {
+		re.SharedWith = existing.SharedWith
+	}
+	if re.Currency == "" {
+		re.Currency = existing.Currency
+	}
+	shared, err := h.participants(re.Owner, re.SharedWith)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	re.SharedWith = shared
+	if err := h.store(r).UpdateRecurringExpense(id, re, updateAll); err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to update recurring expense"})
 		log.Printf("API ERROR: Failed to update recurring expense: %v\n", err)
 		return
@@ -339,6 +658,20 @@ func (h *Handler) UpdateRecurringExpense(w http.ResponseWriter, r *http.Request)
 	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
 }
 
+func (h *Handler) editableRecurringExpense(w http.ResponseWriter, r *http.Request, id string) (storage.RecurringExpense, bool) {
+	user := UserFromContext(r.Context())
+	re, err := h.store(r).GetRecurringExpense(id)
+	if err != nil || !re.VisibleTo(user) {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Recurring expense not found"})
+		return storage.RecurringExpense{}, false
+	}
+	if !re.EditableBy(user) {
+		writeJSON(w, http.StatusForbidden, ErrorResponse{Error: "Only the owner can change this recurring expense"})
+		return storage.RecurringExpense{}, false
+	}
+	return re, true
+}
+
 func (h *Handler) DeleteRecurringExpense(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
 		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
@@ -350,8 +683,10 @@ func (h *Handler) DeleteRecurringExpense(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	removeAll, _ := strconv.ParseBool(r.URL.Query().Get("removeAll"))
-
-	if err := h.storage.RemoveRecurringExpense(id, removeAll); err != nil {
+	if _, ok := h.editableRecurringExpense(w, r, id); !ok {
+		return
+	}
+	if err := h.store(r).RemoveRecurringExpense(id, removeAll); err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete recurring expense"})
 		log.Printf("API ERROR: Failed to delete recurring expense: %v\n", err)
 		return
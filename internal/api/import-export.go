@@ -1,25 +1,136 @@
 package api
 
 import (
+	"cmp"
 	"encoding/csv"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
-	"slices"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/tanq16/expenseowl/internal/storage"
 )
 
-// exports all expenses to CSV
+// csvExportColumns are the columns an export can pick, by header name (ignoring case)
+var csvExportColumns = map[string]func(e storage.Expense, o *CSVExportOptions) string{
+	"ID":          func(e storage.Expense, o *CSVExportOptions) string { return e.ID },
+	"Name":        func(e storage.Expense, o *CSVExportOptions) string { return e.Name },
+	"Category":    func(e storage.Expense, o *CSVExportOptions) string { return e.Category },
+	"Amount":      func(e storage.Expense, o *CSVExportOptions) string { return o.amount(e.Amount) },
+	"Currency":    func(e storage.Expense, o *CSVExportOptions) string { return cmp.Or(e.Currency, o.Currency) },
+	"Date":        func(e storage.Expense, o *CSVExportOptions) string { return e.Date.UTC().Format(o.DateLayout) },
+	"Tags":        func(e storage.Expense, o *CSVExportOptions) string { return strings.Join(e.Tags, ",") },
+	"RecurringID": func(e storage.Expense, o *CSVExportOptions) string { return e.RecurringID },
+	"Owner":       func(e storage.Expense, o *CSVExportOptions) string { return e.Owner },
+	"SharedWith":  func(e storage.Expense, o *CSVExportOptions) string { return strings.Join(e.SharedWith, ",") },
+	"ExternalID":  func(e storage.Expense, o *CSVExportOptions) string { return e.ExternalID },
+}
+
+// the default columns can be imported again as they are
+var defaultCSVExportColumns = []string{"ID", "Name", "Category", "Amount", "Currency", "Date", "Tags", "RecurringID"}
+
+// CSVExportOptions shape a CSV export
+type CSVExportOptions struct {
+	Columns    []string // header names in csvExportColumns
+	Delimiter  rune
+	Decimal    string // decimal separator of amounts
+	DateLayout string // Go layout
+	Currency   string // of expenses without one, usually the ledger's currency
+}
+
+// parseCSVExportOptions reads the columns, delimiter, decimal and dateFormat parameters of a
+// query; the delimiter is a character or comma, semicolon or tab, and the date format is rfc3339
+// (default), or a layout like DD.MM.YYYY as in CSV import profiles
+func parseCSVExportOptions(rawQuery string) (CSVExportOptions, error) {
+	opts := CSVExportOptions{Delimiter: ',', Decimal: ".", DateLayout: time.RFC3339}
+	// Go drops parameters with an unescaped semicolon, which would silently lose delimiter=;
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return opts, fmt.Errorf("invalid query: %v (write a semicolon delimiter as delimiter=semicolon or %%3B)", err)
+	}
+	for _, column := range queryList(values, "columns") {
+		name := ""
+		for known := range csvExportColumns {
+			if strings.EqualFold(known, column) {
+				name = known
+			}
+		}
+		if name == "" {
+			return opts, fmt.Errorf("unknown column: %s", column)
+		}
+		opts.Columns = append(opts.Columns, name)
+	}
+	if len(opts.Columns) == 0 {
+		opts.Columns = defaultCSVExportColumns
+	}
+	switch delimiter := values.Get("delimiter"); strings.ToLower(delimiter) {
+	case "", "comma":
+	case "semicolon":
+		opts.Delimiter = ';'
+	case `\t`, "tab":
+		opts.Delimiter = '\t'
+	default:
+		r, size := utf8.DecodeRuneInString(delimiter)
+		if size != len(delimiter) || r == '"' || r == '\r' || r == '\n' || r == utf8.RuneError {
+			return opts, fmt.Errorf("invalid delimiter: %q", delimiter)
+		}
+		opts.Delimiter = r
+	}
+	switch decimal := values.Get("decimal"); decimal {
+	case "", ".":
+	case ",":
+		opts.Decimal = ","
+	default:
+		return opts, fmt.Errorf("invalid decimal separator: %q (must be . or ,)", decimal)
+	}
+	if opts.Decimal == string(opts.Delimiter) {
+		return opts, fmt.Errorf("the decimal separator and the delimiter must differ")
+	}
+	switch format := strings.TrimSpace(values.Get("dateFormat")); strings.ToLower(format) {
+	case "", "rfc3339":
+	default:
+		if !storage.ValidDateLayout(format) {
+			return opts, fmt.Errorf("invalid date format: %s", format)
+		}
+		opts.DateLayout = storage.GoDateLayout(format)
+	}
+	return opts, nil
+}
+
+func (o *CSVExportOptions) amount(amount float64) string {
+	return strings.Replace(strconv.FormatFloat(amount, 'f', 2, 64), ".", o.Decimal, 1)
+}
+
+// exports expenses to CSV; the GET /expenses filters (from, to, category, tag, recurring, ...)
+// pick the expenses, and parseCSVExportOptions lists the options of the file
 func (h *Handler) ExportCSV(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
 		return
 	}
-	expenses, err := h.storage.GetAllExpenses()
+	query, err := parseExpenseQuery(r.URL.Query())
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	query.Viewer = UserFromContext(r.Context())
+	opts, err := parseCSVExportOptions(r.URL.RawQuery)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if opts.Currency, err = h.store(r).GetCurrency(); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve currency"})
+		log.Printf("API ERROR: Failed to retrieve currency for CSV export: %v\n", err)
+		return
+	}
+	result, err := h.store(r).QueryExpenses(query)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve expenses"})
 		log.Printf("API ERROR: Failed to retrieve expenses for CSV export: %v\n", err)
@@ -28,35 +139,31 @@ func (h *Handler) ExportCSV(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/csv")
 	w.Header().Set("Content-Disposition", "attachment; filename=expenses.csv")
 	writer := csv.NewWriter(w)
+	writer.Comma = opts.Delimiter
 	defer writer.Flush()
 
 	// Write header
-	headers := []string{"ID", "Name", "Category", "Amount", "Date", "Tags"}
-	if err := writer.Write(headers); err != nil {
+	if err := writer.Write(opts.Columns); err != nil {
 		log.Printf("API ERROR: Failed to write CSV header: %v\n", err)
 		return
 	}
 
 	// Write records
-	for _, expense := range expenses {
-		record := []string{
-			expense.ID,
-			expense.Name,
-			expense.Category,
-			// expense.Currency,
-			strconv.FormatFloat(expense.Amount, 'f', 2, 64),
-			expense.Date.Format(time.RFC3339),
-			strings.Join(expense.Tags, ","),
+	record := make([]string, len(opts.Columns))
+	for _, expense := range result.Expenses {
+		for i, column := range opts.Columns {
+			record[i] = csvExportColumns[column](expense, &opts)
 		}
 		if err := writer.Write(record); err != nil {
 			log.Printf("API ERROR: Failed to write CSV record for expense ID %s: %v\n", expense.ID, err)
 			continue
 		}
 	}
-	log.Println("HTTP: Exported expenses to CSV")
+	log.Printf("HTTP: Exported %d expenses to CSV\n", len(result.Expenses))
 }
 
-// imports expenses from CSV
+// imports expenses from CSV, or previews the import with preview=true; the import is cancelled
+// by any invalid row unless skipInvalid=true
 func (h *Handler) ImportCSV(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
@@ -72,18 +179,148 @@ func (h *Handler) ImportCSV(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer file.Close()
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+	preview := r.FormValue("preview") == "true"
+	skipInvalid := r.FormValue("skipInvalid") == "true"
+	if profile := r.FormValue("profile"); profile != "" {
+		h.importCSVWithProfile(w, r, profile, file, preview, skipInvalid)
+		return
+	}
+	rows, err := newExpenseOwlCSV(file, UserFromContext(r.Context()))
 	if err != nil {
-		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Failed to read CSV file"})
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
-	if len(records) < 2 {
+	if preview {
+		var candidates []importCandidate
+		for {
+			candidate, err := rows.next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Failed to read CSV file"})
+				return
+			}
+			candidates = append(candidates, candidate)
+		}
+		h.writeImportPreview(w, r, "csv", candidates)
+		return
+	}
+	h.writeImport(w, r, "csv", rows.next, skipInvalid)
+}
+
+// importBatchSize is the number of rows checked and written at a time
+const importBatchSize = 1000
+
+// errInvalidRows cancels an import with invalid rows that are not skipped
+var errInvalidRows = errors.New("the file has invalid rows")
+
+// importCandidates checks rows as they are read and writes them in batches, in one transaction;
+// duplicates are skipped, and an invalid row cancels the whole import unless skipInvalid is set
+func importCandidates(store storage.Storage, format, owner string, next func() (importCandidate, error), skipInvalid bool) (StatementImport, error) {
+	report := StatementImport{Format: format, NewCategories: []string{}}
+	check, err := newImportCheck(store, owner)
+	if err != nil {
+		return report, err
+	}
+	invalid := false
+	report.Imported, err = store.ImportExpenses(func() ([]storage.Expense, error) {
+		var batch []storage.Expense
+		for len(batch) < importBatchSize {
+			candidate, err := next()
+			if err == io.EOF {
+				if invalid && !skipInvalid {
+					return nil, errInvalidRows
+				}
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			report.TotalProcessed++
+			row := check.check(candidate)
+			switch {
+			case row.Status == RowDuplicate:
+				report.Skipped++
+			case !row.importable():
+				report.Skipped++
+				report.Errors = append(report.Errors, fmt.Sprintf("row %d: %s: %s", row.Row, row.Status, row.Error))
+				invalid = true
+			case !invalid || skipInvalid: // once cancelled, the rest is only checked
+				if row.Status == RowPossibleDuplicate {
+					report.PossibleDuplicates++
+				}
+				batch = append(batch, check.use(row))
+			}
+		}
+		return batch, nil
+	})
+	if err != nil {
+		report.Imported = 0
+		return report, err
+	}
+	report.NewCategories = check.added
+	return report, check.saveCategories(store)
+}
+
+// nextCandidate returns the rows one at a time, io.EOF after the last
+func nextCandidate(candidates []importCandidate) func() (importCandidate, error) {
+	return func() (importCandidate, error) {
+		if len(candidates) == 0 {
+			return importCandidate{}, io.EOF
+		}
+		candidate := candidates[0]
+		candidates = candidates[1:]
+		return candidate, nil
+	}
+}
+
+// writeImport imports the rows into the request's ledger and writes the report
+func (h *Handler) writeImport(w http.ResponseWriter, r *http.Request, format string, next func() (importCandidate, error), skipInvalid bool) {
+	report, err := importCandidates(h.store(r), format, UserFromContext(r.Context()), next, skipInvalid)
+	var parseErr *csv.ParseError
+	switch {
+	case errors.Is(err, errInvalidRows):
+		writeJSON(w, http.StatusBadRequest, map[string]any{
+			"error":  fmt.Sprintf("Nothing was imported: %d rows are invalid, fix them or skip invalid rows", len(report.Errors)),
+			"errors": report.Errors,
+		})
+		return
+	case errors.As(err, &parseErr):
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Failed to read CSV file, nothing was imported: %v", parseErr)})
+		return
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to import file, nothing was imported"})
+		log.Printf("API ERROR: Failed to import %s file: %v\n", format, err)
+		return
+	case report.TotalProcessed == 0:
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "CSV file must have a header and at least one data row"})
 		return
 	}
+	writeJSON(w, http.StatusOK, report)
+	log.Printf("HTTP: Imported %d expenses from %s file. Skipped %d records.", report.Imported, format, report.Skipped)
+}
 
-	header := records[0]
+// expenseOwlCSV streams the rows of a CSV file with name, category, amount and date columns
+// (in any case and order) and the optional id, tags and currency columns of ExpenseOwl's export
+type expenseOwlCSV struct {
+	reader  *csv.Reader
+	owner   string
+	columns map[string]int
+	width   int
+}
+
+func newExpenseOwlCSV(file io.Reader, owner string) (*expenseOwlCSV, error) {
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1 // rows with another column count are reported, not fatal
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("CSV file must have a header and at least one data row")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read CSV file")
+	}
 	colMap := make(map[string]int)
 	for i, col := range header {
 		colMap[strings.ToLower(strings.TrimSpace(col))] = i
@@ -92,129 +329,66 @@ func (h *Handler) ImportCSV(w http.ResponseWriter, r *http.Request) {
 	requiredCols := []string{"name", "category", "amount", "date"}
 	for _, col := range requiredCols {
 		if _, ok := colMap[col]; !ok {
-			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Missing required column: %s", col)})
-			return
+			return nil, fmt.Errorf("Missing required column: %s", col)
 		}
 	}
-	// Get optional column indices
-	idIdx, idExists := colMap["id"]
-	tagsIdx, tagsExists := colMap["tags"]
-	currencyIdx, currencyExists := colMap["currency"]
+	return &expenseOwlCSV{reader: reader, owner: owner, columns: colMap, width: len(header)}, nil
+}
 
-	currentCategories, err := h.storage.GetCategories()
+// next reads the next row, io.EOF at the end of the file
+func (c *expenseOwlCSV) next() (importCandidate, error) {
+	record, err := c.reader.Read()
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Could not retrieve current categories"})
-		return
+		return importCandidate{}, err
 	}
-	categorySet := make(map[string]bool)
-	for _, cat := range currentCategories {
-		categorySet[strings.ToLower(cat)] = true
+	line, _ := c.reader.FieldPos(0)
+	candidate := importCandidate{row: line}
+	if len(record) != c.width {
+		candidate.err = fmt.Errorf("incorrect column count")
+		return candidate, nil
 	}
-	var newCategories []string
-	var importedCount, skippedCount int
-	// TODO: might be worth setting default currency when we have currency updation behavior
-	currencyVal, err := h.storage.GetCurrency()
-	if err != nil {
-		log.Printf("Error: Could not retrieve currency, shutting down import: %v\n", err)
-		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Could not retrieve currency"})
-		return
+	if i, ok := c.columns["id"]; ok {
+		candidate.id = strings.TrimSpace(record[i])
 	}
-
-	for i, record := range records[1:] {
-		if len(record) != len(header) {
-			log.Printf("Warning: Skipping row %d due to incorrect column count\n", i+2)
-			skippedCount++
-			continue
-		}
-
-		// Check if expense exists by ID, if provided - without doing a clash resolution
-		if idExists {
-			id := record[idIdx]
-			if _, err := h.storage.GetExpense(id); err == nil {
-				log.Printf("Info: Skipping row %d because expense with ID '%s' already exists\n", i+2, id)
-				skippedCount++
-				continue
-			}
-		}
-
-		// Check for currency field, if provided - default is retrieved
-		localCurrency := currencyVal
-		if currencyExists {
-			currency := record[currencyIdx]
-			if !slices.Contains(storage.SupportedCurrencies, currency) {
-				log.Printf("Warning: Skipping row %d due to invalid currency: %s\n", i+2, currency)
-				skippedCount++
-				continue
-			}
-			localCurrency = strings.TrimSpace(currency)
+	// an empty currency is the ledger's currency
+	var currency string
+	if i, ok := c.columns["currency"]; ok && strings.TrimSpace(record[i]) != "" {
+		if currency, err = storage.ValidateCurrency(record[i]); err != nil {
+			candidate.err = &rowError{RowUnknownCurrency, err}
+			return candidate, nil
 		}
-
-		amount, err := strconv.ParseFloat(record[colMap["amount"]], 64)
-		if err != nil {
-			log.Printf("Warning: Skipping row %d due to invalid amount: %s\n", i+2, record[colMap["amount"]])
-			skippedCount++
-			continue
-		}
-		date, err := parseDate(record[colMap["date"]])
-		if err != nil {
-			log.Printf("Warning: Skipping row %d due to invalid date: %v\n", i+2, err)
-			skippedCount++
-			continue
-		}
-		category := strings.TrimSpace(record[colMap["category"]])
-		if _, ok := categorySet[strings.ToLower(category)]; !ok {
-			newCategories = append(newCategories, category)
-			categorySet[strings.ToLower(category)] = true // Add to set to handle duplicates in the same file
-		}
-		var tags []string
-		if tagsExists {
-			tagsStr := record[tagsIdx]
-			if tagsStr != "" {
-				tags = strings.Split(tagsStr, ",")
-				for i := range tags {
-					tags[i] = strings.TrimSpace(tags[i])
-				}
-			}
-		}
-
-		expense := storage.Expense{
-			Name:     strings.TrimSpace(record[colMap["name"]]),
-			Category: category,
-			Amount:   amount,
-			Currency: localCurrency,
-			Date:     date,
-			Tags:     tags,
-		}
-		if err := expense.Validate(); err != nil {
-			log.Printf("Warning: Skipping row %d due to validation error: %v\n", i+2, err)
-			skippedCount++
-			continue
-		}
-		if err := h.storage.AddExpense(expense); err != nil {
-			log.Printf("Error: Could not add expense from row %d: %v\n", i+2, err)
-			skippedCount++
-			continue
-		}
-		importedCount++
-		time.Sleep(10 * time.Millisecond) // Throttle to reduce storage overhead
 	}
-
-	if len(newCategories) > 0 {
-		if err := h.storage.UpdateCategories(append(currentCategories, newCategories...)); err != nil {
-			log.Printf("Warning: Failed to add new categories to config: %v\n", err)
+	amount, err := strconv.ParseFloat(strings.TrimSpace(record[c.columns["amount"]]), 64)
+	if err != nil {
+		candidate.err = &rowError{RowInvalidAmount, fmt.Errorf("invalid amount: %s", record[c.columns["amount"]])}
+		return candidate, nil
+	}
+	date, err := parseDate(strings.TrimSpace(record[c.columns["date"]]))
+	if err != nil {
+		candidate.err = &rowError{RowInvalidDate, err}
+		return candidate, nil
+	}
+	var tags []string
+	if i, ok := c.columns["tags"]; ok && record[i] != "" {
+		tags = strings.Split(record[i], ",")
+		for i := range tags {
+			tags[i] = strings.TrimSpace(tags[i])
 		}
 	}
-	writeJSON(w, http.StatusOK, map[string]any{
-		"status":          "success",
-		"total_processed": len(records) - 1,
-		"imported":        importedCount,
-		"skipped":         skippedCount,
-		"new_categories":  newCategories,
-	})
-	log.Printf("HTTP: Imported %d expenses from CSV file. Skipped %d records.", importedCount, skippedCount)
+	candidate.expense = storage.Expense{
+		Name:     strings.TrimSpace(record[c.columns["name"]]),
+		Category: strings.TrimSpace(record[c.columns["category"]]),
+		Amount:   amount,
+		Currency: currency,
+		Date:     date,
+		Tags:     tags,
+		Owner:    c.owner,
+	}
+	return candidate, nil
 }
 
-// handles importing from ExpenseOwl < v4.0
+// handles importing from ExpenseOwl < v4.0, which stored expenses as positive amounts; like
+// other imports, an invalid row cancels the import unless skipInvalid=true
 // TODO: remove this in the future
 func (h *Handler) ImportOldCSV(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -231,104 +405,19 @@ func (h *Handler) ImportOldCSV(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer file.Close()
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
-	if err != nil {
-		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Failed to read CSV file"})
-		return
-	}
-	if len(records) < 2 {
-		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "CSV file must have a header and at least one data row"})
-		return
-	}
-
-	header := records[0]
-	colMap := make(map[string]int)
-	for i, col := range header {
-		colMap[strings.ToLower(strings.TrimSpace(col))] = i
-	}
-	requiredCols := []string{"name", "category", "amount", "date"}
-	for _, col := range requiredCols {
-		if _, ok := colMap[col]; !ok {
-			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Missing required column: %s", col)})
-			return
-		}
-	}
-
-	currentCategories, err := h.storage.GetCategories()
+	rows, err := newExpenseOwlCSV(file, UserFromContext(r.Context()))
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Could not retrieve current categories"})
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
-	categorySet := make(map[string]bool)
-	for _, cat := range currentCategories {
-		categorySet[strings.ToLower(cat)] = true
-	}
-	var newCategories []string
-	var importedCount, skippedCount int
-
-	for i, record := range records[1:] {
-		if len(record) != len(header) {
-			log.Printf("Warning: Skipping row %d due to incorrect column count\n", i+2)
-			skippedCount++
-			continue
-		}
-		amount, err := strconv.ParseFloat(record[colMap["amount"]], 64)
-		if err != nil {
-			log.Printf("Warning: Skipping row %d due to invalid amount: %s\n", i+2, record[colMap["amount"]])
-			skippedCount++
-			continue
-		}
-		date, err := parseDate(record[colMap["date"]])
-		if err != nil {
-			log.Printf("Warning: Skipping row %d due to invalid date: %v\n", i+2, err)
-			skippedCount++
-			continue
-		}
-		category := strings.TrimSpace(record[colMap["category"]])
-		if _, ok := categorySet[strings.ToLower(category)]; !ok {
-			newCategories = append(newCategories, category)
-			categorySet[strings.ToLower(category)] = true // Add to set to handle duplicates in the same file
-		}
-
+	h.writeImport(w, r, "csv", func() (importCandidate, error) {
+		candidate, err := rows.next()
 		// switches sign for new expenseowl
-		amountUpdated := amount
-		if category != "Income" {
-			amountUpdated = amount * -1
+		if err == nil && candidate.err == nil && candidate.expense.Category != "Income" {
+			candidate.expense.Amount = -candidate.expense.Amount
 		}
-		expense := storage.Expense{
-			Name:     strings.TrimSpace(record[colMap["name"]]),
-			Category: category,
-			Amount:   amountUpdated,
-			Date:     date,
-		}
-		if err := expense.Validate(); err != nil {
-			log.Printf("Warning: Skipping row %d due to validation error: %v\n", i+2, err)
-			skippedCount++
-			continue
-		}
-		if err := h.storage.AddExpense(expense); err != nil {
-			log.Printf("Error: Could not add expense from row %d: %v\n", i+2, err)
-			skippedCount++
-			continue
-		}
-		importedCount++
-		time.Sleep(10 * time.Millisecond)
-	}
-
-	if len(newCategories) > 0 {
-		if err := h.storage.UpdateCategories(append(currentCategories, newCategories...)); err != nil {
-			log.Printf("Warning: Failed to add new categories to config: %v\n", err)
-		}
-	}
-	writeJSON(w, http.StatusOK, map[string]any{
-		"status":          "success",
-		"total_processed": len(records) - 1,
-		"imported":        importedCount,
-		"skipped":         skippedCount,
-		"new_categories":  newCategories,
-	})
-	log.Printf("HTTP: Imported %d expenses from CSV file. Skipped %d records.", importedCount, skippedCount)
+		return candidate, err
+	}, r.FormValue("skipInvalid") == "true")
 }
 
 func parseDate(dateStr string) (time.Time, error) {
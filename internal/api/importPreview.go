@@ -0,0 +1,346 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// statuses of the rows of an import preview
+const (
+	RowOK                = "ok"
+	RowNewCategory       = "new_category"       // importable, adding its category to the ledger
+	RowDuplicate         = "duplicate"          // already stored, or repeated in the file
+	RowPossibleDuplicate = "possible_duplicate" // importable, but likely stored with another name or date
+	RowInvalidDate       = "invalid_date"
+	RowInvalidAmount     = "invalid_amount"
+	RowUnknownCurrency   = "unknown_currency"
+	RowInvalid           = "invalid"
+)
+
+// previews can be committed for this long
+const importPreviewTTL = 30 * time.Minute
+
+// rowError is a row that cannot be read, with the status it gets in a preview
+type rowError struct {
+	status string
+	err    error
+}
+
+func (e *rowError) Error() string {
+	return e.err.Error()
+}
+
+// ImportRow is a row of an import preview, with the expense it would create
+type ImportRow struct {
+	Row                int                      `json:"row"` // line in a CSV file, position in a statement
+	Status             string                   `json:"status"`
+	Error              string                   `json:"error,omitempty"`
+	Expense            *storage.Expense         `json:"expense,omitempty"`
+	PossibleDuplicates []storage.DuplicateMatch `json:"possibleDuplicates,omitempty"`
+}
+
+func (r ImportRow) importable() bool {
+	return r.Status == RowOK || r.Status == RowNewCategory || r.Status == RowPossibleDuplicate
+}
+
+// ImportPreview lists what an import would do; its token commits some or all importable rows
+type ImportPreview struct {
+	Token     string         `json:"token"`
+	Format    string         `json:"format"`
+	ExpiresAt time.Time      `json:"expiresAt"`
+	Counts    map[string]int `json:"counts"` // rows by status
+	Rows      []ImportRow    `json:"rows"`
+}
+
+// importCandidate is a row read from an import file, before it is checked against the ledger
+type importCandidate struct {
+	row     int
+	id      string // expense ID in files exported by ExpenseOwl
+	expense storage.Expense
+	err     error
+}
+
+// importCheck holds what imported rows are checked against in a ledger
+type importCheck struct {
+	ids         map[string]bool
+	externalIDs map[string]bool
+	categories  []string
+	known       map[string]bool // lowercase categories of the ledger and of imported rows
+	added       []string        // categories of imported rows that the ledger lacks
+	rules       *storage.RuleEngine
+	currency    string                      // of the ledger, for rows without one
+	duplicates  map[int64][]storage.Expense // expenses of the importing user by amount
+}
+
+func newImportCheck(store storage.Storage, owner string) (*importCheck, error) {
+	existing, err := store.GetAllExpenses()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read expenses: %v", err)
+	}
+	rules, err := store.GetCategoryRules()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read category rules: %v", err)
+	}
+	categories, err := store.GetCategories()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read categories: %v", err)
+	}
+	currency, err := store.GetCurrency()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read currency: %v", err)
+	}
+	c := &importCheck{
+		ids:         make(map[string]bool, len(existing)),
+		externalIDs: make(map[string]bool),
+		categories:  categories,
+		known:       make(map[string]bool, len(categories)),
+		added:       []string{},
+		rules:       storage.NewRuleEngine(rules),
+		currency:    currency,
+		duplicates:  duplicateCandidates(existing, owner),
+	}
+	for _, e := range existing {
+		c.ids[e.ID] = true
+		if e.ExternalID != "" {
+			c.externalIDs[e.ExternalID] = true
+		}
+	}
+	for _, cat := range categories {
+		c.known[strings.ToLower(cat)] = true
+	}
+	return c, nil
+}
+
+// check gives a row its status: rows whose ID or bank reference is stored or came earlier in the
+// file are duplicates, rows resembling a stored expense are possible duplicates, and rows are changed
+// by the matching rules; rows still without a valid category get a fallback one
+func (c *importCheck) check(candidate importCandidate) ImportRow {
+	row := ImportRow{Row: candidate.row}
+	if candidate.err != nil {
+		row.Status, row.Error = RowInvalid, candidate.err.Error()
+		var re *rowError
+		if errors.As(candidate.err, &re) {
+			row.Status = re.status
+		}
+		return row
+	}
+	expense := candidate.expense
+	if expense.Currency == "" {
+		expense.Currency = c.currency
+	}
+	expense, _ = c.rules.Apply(expense, false)
+	if category, err := storage.ValidateCategory(expense.Category); err == nil {
+		expense.Category = category
+	} else {
+		expense.Category = storage.FallbackCategory(expense.Amount)
+	}
+	row.Expense = &expense
+	if (candidate.id != "" && c.ids[candidate.id]) || (expense.ExternalID != "" && c.externalIDs[expense.ExternalID]) {
+		row.Status = RowDuplicate
+		return row
+	}
+	if err := expense.Validate(); err != nil {
+		row.Status, row.Error = RowInvalid, err.Error()
+		return row
+	}
+	if candidate.id != "" {
+		c.ids[candidate.id] = true
+	}
+	if expense.ExternalID != "" {
+		c.externalIDs[expense.ExternalID] = true
+	}
+	row.Status = RowOK
+	if !c.known[strings.ToLower(expense.Category)] {
+		row.Status = RowNewCategory
+	}
+	if matches := storage.FindDuplicates(expense, c.duplicates[amountKey(expense.Amount)]); len(matches) > 0 {
+		row.Status, row.PossibleDuplicates = RowPossibleDuplicate, matches
+	}
+	return row
+}
+
+// use records a row that is imported, collecting the category it adds to the ledger
+func (c *importCheck) use(row ImportRow) storage.Expense {
+	if key := strings.ToLower(row.Expense.Category); !c.known[key] {
+		c.known[key] = true
+		c.added = append(c.added, row.Expense.Category)
+	}
+	return *row.Expense
+}
+
+// saveCategories adds the categories of the imported rows to the ledger
+func (c *importCheck) saveCategories(store storage.Storage) error {
+	if len(c.added) == 0 {
+		return nil
+	}
+	if err := store.UpdateCategories(append(c.categories, c.added...)); err != nil {
+		return fmt.Errorf("failed to add new categories: %v", err)
+	}
+	return nil
+}
+
+// pendingImport is a previewed import waiting to be committed
+type pendingImport struct {
+	ledger     string
+	owner      string
+	format     string
+	candidates []importCandidate
+	rows       []ImportRow
+	expiresAt  time.Time
+}
+
+// importPreviews keeps previewed imports in memory until they are committed or expire
+type importPreviews struct {
+	mu      sync.Mutex
+	pending map[string]*pendingImport
+}
+
+func newImportPreviews() *importPreviews {
+	return &importPreviews{pending: make(map[string]*pendingImport)}
+}
+
+func (p *importPreviews) put(pending *pendingImport) (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	token := hex.EncodeToString(raw)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	for t, other := range p.pending {
+		if now.After(other.expiresAt) {
+			delete(p.pending, t)
+		}
+	}
+	p.pending[token] = pending
+	return token, nil
+}
+
+// take removes and returns a preview of the ledger and user, so it is committed only once
+func (p *importPreviews) take(token, ledger, owner string) (*pendingImport, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pending, ok := p.pending[token]
+	if !ok || pending.ledger != ledger || pending.owner != owner || time.Now().After(pending.expiresAt) {
+		return nil, false
+	}
+	delete(p.pending, token)
+	return pending, true
+}
+
+// restore puts back a preview whose commit was rejected
+func (p *importPreviews) restore(token string, pending *pendingImport) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending[token] = pending
+}
+
+// writeImportPreview checks the rows against the request's ledger, without storing anything, and
+// writes the preview with a token to commit it
+func (h *Handler) writeImportPreview(w http.ResponseWriter, r *http.Request, format string, candidates []importCandidate) {
+	check, err := newImportCheck(h.store(r), UserFromContext(r.Context()))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to preview import"})
+		log.Printf("API ERROR: Failed to preview %s import: %v\n", format, err)
+		return
+	}
+	preview := ImportPreview{
+		Format:    format,
+		ExpiresAt: time.Now().Add(importPreviewTTL).UTC(),
+		Counts:    make(map[string]int),
+		Rows:      make([]ImportRow, 0, len(candidates)),
+	}
+	for _, candidate := range candidates {
+		row := check.check(candidate)
+		preview.Rows = append(preview.Rows, row)
+		preview.Counts[row.Status]++
+	}
+	preview.Token, err = h.previews.put(&pendingImport{
+		ledger:     ledgerSelector(r),
+		owner:      UserFromContext(r.Context()),
+		format:     format,
+		candidates: candidates,
+		rows:       preview.Rows,
+		expiresAt:  preview.ExpiresAt,
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to preview import"})
+		log.Printf("API ERROR: Failed to preview %s import: %v\n", format, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, preview)
+	log.Printf("HTTP: Previewed %d rows of %s file\n", len(preview.Rows), format)
+}
+
+// commits the rows of an import preview; when none are given, all importable rows except
+// possible duplicates
+func (h *Handler) CommitImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var request struct {
+		Token string `json:"token"`
+		Rows  []int  `json:"rows"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	pending, ok := h.previews.take(request.Token, ledgerSelector(r), UserFromContext(r.Context()))
+	if !ok {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Import preview not found or expired"})
+		return
+	}
+	byRow := make(map[int]int, len(pending.rows))
+	for i, row := range pending.rows {
+		byRow[row.Row] = i
+	}
+	var selected []importCandidate
+	if len(request.Rows) == 0 {
+		for i, row := range pending.rows {
+			if row.importable() && row.Status != RowPossibleDuplicate {
+				selected = append(selected, pending.candidates[i])
+			}
+		}
+	}
+	for _, n := range request.Rows {
+		i, ok := byRow[n]
+		if !ok {
+			h.previews.restore(request.Token, pending)
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Row %d is not in the preview", n)})
+			return
+		}
+		if !pending.rows[i].importable() {
+			h.previews.restore(request.Token, pending)
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Row %d cannot be imported: %s", n, pending.rows[i].Status)})
+			return
+		}
+		selected = append(selected, pending.candidates[i])
+	}
+
+	// the ledger may have changed since the preview, so the rows are checked again and the
+	// ones that no longer fit are skipped; the rest are stored in one transaction
+	report, err := importCandidates(h.store(r), pending.format, pending.owner, nextCandidate(selected), true)
+	if err != nil {
+		if report.Imported == 0 { // nothing was stored, so the preview can be committed again
+			h.previews.restore(request.Token, pending)
+		}
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to import rows"})
+		log.Printf("API ERROR: Failed to commit %s import: %v\n", pending.format, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+	log.Printf("HTTP: Imported %d expenses from %s preview. Skipped %d records.", report.Imported, pending.format, report.Skipped)
+}
@@ -0,0 +1,274 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// plain-text accounting formats
+const (
+	JournalLedger    = "ledger"
+	JournalHledger   = "hledger"
+	JournalBeancount = "beancount"
+)
+
+// account names, where {type} is Expenses, or Income for positive amounts
+const (
+	DefaultAccountTemplate = "{type}:{category}"
+	DefaultBalanceAccount  = "Assets:Cash"
+)
+
+// JournalOptions configure a plain-text accounting export
+type JournalOptions struct {
+	Format          string
+	AccountTemplate string // with {type} and {category}, e.g., "Expenses:Household:{category}"
+	BalanceAccount  string // the other side of every transaction
+	Currency        string // of expenses without one, usually the ledger's currency
+}
+
+func (o *JournalOptions) validate() error {
+	if o.Format != JournalLedger && o.Format != JournalHledger && o.Format != JournalBeancount {
+		return fmt.Errorf("invalid journal format: %s", o.Format)
+	}
+	if o.AccountTemplate = strings.TrimSpace(o.AccountTemplate); o.AccountTemplate == "" {
+		o.AccountTemplate = DefaultAccountTemplate
+	}
+	if o.BalanceAccount = strings.TrimSpace(o.BalanceAccount); o.BalanceAccount == "" {
+		o.BalanceAccount = DefaultBalanceAccount
+	}
+	balance, err := o.account(o.BalanceAccount)
+	if err != nil {
+		return fmt.Errorf("invalid balance account: %v", err)
+	}
+	o.BalanceAccount = balance
+	return nil
+}
+
+// beancount accounts start with one of these, and their parts with a capital letter or digit
+var (
+	beancountRoots  = []string{"Assets", "Liabilities", "Equity", "Income", "Expenses"}
+	reBeancountPart = regexp.MustCompile(`[^\p{L}\p{N}-]+`)
+	reBeancountTag  = regexp.MustCompile(`[^A-Za-z0-9_/.-]+`)
+)
+
+// account cleans an account name for the format: ledger and hledger end account names at
+// two spaces or a tab, and beancount only allows letters, digits and dashes
+func (o *JournalOptions) account(name string) (string, error) {
+	var parts []string
+	for _, part := range strings.Split(name, ":") {
+		part = strings.Join(strings.Fields(part), " ")
+		if o.Format == JournalBeancount {
+			part = strings.Trim(reBeancountPart.ReplaceAllString(part, "-"), "-")
+			if runes := []rune(part); len(runes) > 0 {
+				runes[0] = unicode.ToUpper(runes[0])
+				part = string(runes)
+			}
+		}
+		if part == "" {
+			return "", fmt.Errorf("empty part in account %q", name)
+		}
+		parts = append(parts, part)
+	}
+	if o.Format == JournalBeancount && !slices.Contains(beancountRoots, parts[0]) {
+		return "", fmt.Errorf("beancount accounts must start with one of %s, not %q", strings.Join(beancountRoots, ", "), parts[0])
+	}
+	return strings.Join(parts, ":"), nil
+}
+
+// categoryAccount is the account of an expense's category through the template
+func (o *JournalOptions) categoryAccount(expense storage.Expense) (string, error) {
+	kind := "Expenses"
+	if expense.Amount > 0 {
+		kind = "Income"
+	}
+	category := strings.ReplaceAll(expense.Category, ":", "-")
+	if strings.TrimSpace(category) == "" {
+		category = "Uncategorized"
+	}
+	return o.account(strings.NewReplacer("{type}", kind, "{category}", category).Replace(o.AccountTemplate))
+}
+
+func (o *JournalOptions) commodity(expense storage.Expense) string {
+	if expense.Currency != "" {
+		return strings.ToUpper(expense.Currency)
+	}
+	return strings.ToUpper(o.Currency)
+}
+
+// journalText keeps a payee or value on one line and out of comments
+func journalText(value string) string {
+	return strings.ReplaceAll(strings.Join(strings.Fields(value), " "), ";", ",")
+}
+
+// journalTag makes a tag name valid for the format
+func journalTag(tag, format string) string {
+	if format == JournalBeancount {
+		return strings.Trim(reBeancountTag.ReplaceAllString(tag, "-"), "-")
+	}
+	return strings.NewReplacer(":", "-", ",", "-").Replace(strings.Join(strings.Fields(tag), "-"))
+}
+
+// WriteJournal writes expenses as a ledger, hledger or beancount journal, oldest first; every
+// expense is a transaction between its category account and the balance account
+func WriteJournal(w io.Writer, expenses []storage.Expense, opts JournalOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	expenses = slices.Clone(expenses)
+	sort.SliceStable(expenses, func(i, j int) bool { return expenses[i].Date.Before(expenses[j].Date) })
+
+	// accounts are checked before anything is written, and beancount must open them
+	accounts := make([]string, len(expenses))
+	used := []string{opts.BalanceAccount}
+	for i, expense := range expenses {
+		account, err := opts.categoryAccount(expense)
+		if err != nil {
+			return fmt.Errorf("expense %s: %v", expense.ID, err)
+		}
+		accounts[i] = account
+		if !slices.Contains(used, account) {
+			used = append(used, account)
+		}
+	}
+	sort.Strings(used)
+
+	writer := bufio.NewWriter(w)
+	fmt.Fprintf(writer, "; Exported from ExpenseOwl on %s\n\n", time.Now().UTC().Format(time.DateOnly))
+	if opts.Format == JournalBeancount {
+		if opts.Currency != "" {
+			fmt.Fprintf(writer, "option \"operating_currency\" \"%s\"\n\n", strings.ToUpper(opts.Currency))
+		}
+		opened := "1970-01-01"
+		if len(expenses) > 0 {
+			opened = expenses[0].Date.UTC().Format(time.DateOnly)
+		}
+		for _, account := range used {
+			fmt.Fprintf(writer, "%s open %s\n", opened, account)
+		}
+	} else {
+		for _, account := range used {
+			fmt.Fprintf(writer, "account %s\n", account)
+		}
+	}
+	for i, expense := range expenses {
+		writer.WriteString("\n")
+		writeJournalTransaction(writer, expense, accounts[i], opts)
+	}
+	return writer.Flush()
+}
+
+func writeJournalTransaction(w *bufio.Writer, expense storage.Expense, account string, opts JournalOptions) {
+	date := expense.Date.UTC().Format(time.DateOnly)
+	commodity := opts.commodity(expense)
+	amount := strconv.FormatFloat(0-expense.Amount, 'f', 2, 64) // not -0.00 for zero amounts
+	balance := strconv.FormatFloat(expense.Amount, 'f', 2, 64)
+	var tags []string
+	for _, tag := range expense.Tags {
+		if tag = journalTag(tag, opts.Format); tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+
+	switch opts.Format {
+	case JournalBeancount:
+		name := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(strings.Join(strings.Fields(expense.Name), " "))
+		fmt.Fprintf(w, "%s * \"%s\"", date, name)
+		for _, tag := range tags {
+			fmt.Fprintf(w, " #%s", tag)
+		}
+		fmt.Fprintf(w, "\n    id: \"%s\"\n", expense.ID)
+		if expense.ExternalID != "" {
+			fmt.Fprintf(w, "    reference: \"%s\"\n", strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(expense.ExternalID))
+		}
+	case JournalHledger:
+		// hledger tags are name:value pairs in comments
+		fmt.Fprintf(w, "%s %s\n    ; id:%s", date, journalText(expense.Name), expense.ID)
+		if expense.ExternalID != "" {
+			fmt.Fprintf(w, ", reference:%s", strings.ReplaceAll(journalText(expense.ExternalID), ",", " "))
+		}
+		for _, tag := range tags {
+			fmt.Fprintf(w, ", %s:", tag)
+		}
+		w.WriteString("\n")
+	default:
+		// ledger metadata is "Key: value" and tags are :tag1:tag2:
+		fmt.Fprintf(w, "%s %s\n    ; ID: %s\n", date, journalText(expense.Name), expense.ID)
+		if expense.ExternalID != "" {
+			fmt.Fprintf(w, "    ; Reference: %s\n", journalText(expense.ExternalID))
+		}
+		if len(tags) > 0 {
+			fmt.Fprintf(w, "    ; :%s:\n", strings.Join(tags, ":"))
+		}
+	}
+	fmt.Fprintf(w, "    %-40s  %s %s\n", account, amount, commodity)
+	fmt.Fprintf(w, "    %-40s  %s %s\n", opts.BalanceAccount, balance, commodity)
+}
+
+// exports the user's expenses as a plain-text accounting journal; ?template= and ?balance=
+// change the account names
+func (h *Handler) exportJournal(w http.ResponseWriter, r *http.Request, format, extension string) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	currency, err := h.store(r).GetCurrency()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve currency"})
+		log.Printf("API ERROR: Failed to retrieve currency for %s export: %v\n", format, err)
+		return
+	}
+	opts := JournalOptions{
+		Format:          format,
+		AccountTemplate: r.URL.Query().Get("template"),
+		BalanceAccount:  r.URL.Query().Get("balance"),
+		Currency:        currency,
+	}
+	if err := opts.validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	expenses, err := h.visibleExpenses(r)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve expenses"})
+		log.Printf("API ERROR: Failed to retrieve expenses for %s export: %v\n", format, err)
+		return
+	}
+	// the accounts are checked before the response starts, so a bad template is still a 400
+	for _, expense := range expenses {
+		if _, err := opts.categoryAccount(expense); err != nil {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Invalid account template: %v", err)})
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=expenses."+extension)
+	if err := WriteJournal(w, expenses, opts); err != nil {
+		log.Printf("API ERROR: Failed to write %s export: %v\n", format, err)
+		return
+	}
+	log.Printf("HTTP: Exported expenses to %s\n", format)
+}
+
+func (h *Handler) ExportLedger(w http.ResponseWriter, r *http.Request) {
+	h.exportJournal(w, r, JournalLedger, "ledger")
+}
+
+func (h *Handler) ExportHledger(w http.ResponseWriter, r *http.Request) {
+	h.exportJournal(w, r, JournalHledger, "journal")
+}
+
+func (h *Handler) ExportBeancount(w http.ResponseWriter, r *http.Request) {
+	h.exportJournal(w, r, JournalBeancount, "beancount")
+}
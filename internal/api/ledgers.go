@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+const ledgerContextKey contextKey = "ledger"
+
+// ledgerSelector reads the ledger a request is for, from the ledger query parameter or the
+// X-Ledger header; an empty selector means the default ledger
+func ledgerSelector(r *http.Request) string {
+	if id := r.URL.Query().Get("ledger"); id != "" {
+		return strings.TrimSpace(id)
+	}
+	return strings.TrimSpace(r.Header.Get("X-Ledger"))
+}
+
+// WithLedger resolves the selected ledger for every request, so handlers work on that
+// ledger's storage; archived ledgers can still be read but not changed
+func (h *Handler) WithLedger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := ledgerSelector(r)
+		if id == "" || id == storage.DefaultLedgerID {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ledger, err := h.storage.GetLedger(id)
+		if err != nil {
+			writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Ledger not found"})
+			return
+		}
+		if ledger.Archived && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			writeJSON(w, http.StatusForbidden, ErrorResponse{Error: "Ledger is archived and read-only"})
+			return
+		}
+		store, err := h.storage.ForLedger(id)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to open ledger"})
+			log.Printf("API ERROR: Failed to open ledger %s: %v\n", id, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ledgerContextKey, store)))
+	})
+}
+
+// store returns the storage of the ledger selected for the request
+func (h *Handler) store(r *http.Request) storage.Storage {
+	if s, ok := r.Context().Value(ledgerContextKey).(storage.Storage); ok {
+		return s
+	}
+	return h.storage
+}
+
+func (h *Handler) GetLedgers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	ledgers, err := h.storage.GetLedgers()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to list ledgers"})
+		log.Printf("API ERROR: Failed to list ledgers: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ledgers)
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// MT940 is the SWIFT customer statement: fields start with a :tag: and may continue on the
+// following lines, each :61: statement line is followed by an optional :86: with its details,
+// and a line with - ends a statement
+
+var (
+	reMT940Tag = regexp.MustCompile(`^:(\d{2}[A-Z]?):(.*)$`)
+	// value date, optional booking date (MMDD), debit/credit mark, optional funds code, amount,
+	// transaction type, customer reference and optional //bank reference
+	reMT940Line = regexp.MustCompile(`^(\d{6})(\d{4})?(RC|RD|C|D)([A-Z])?(\d+,\d*)([NSF][A-Z0-9]{3})(.*?)(?://(.*))?$`)
+)
+
+type mt940Field struct {
+	tag   string
+	value string
+	line  int
+}
+
+// mt940Fields splits statements into their fields, dropping the SWIFT envelope ({1:...} blocks)
+func mt940Fields(r io.Reader) ([]mt940Field, error) {
+	var fields []mt940Field
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), "\r ")
+		if lineNumber == 1 {
+			line = strings.TrimPrefix(line, "\uFEFF")
+		}
+		switch {
+		case line == "" || strings.HasPrefix(line, "{") || line == "-}":
+			continue
+		case line == "-":
+			fields = append(fields, mt940Field{tag: "-", line: lineNumber})
+		case reMT940Tag.MatchString(line):
+			m := reMT940Tag.FindStringSubmatch(line)
+			fields = append(fields, mt940Field{tag: m[1], value: m[2], line: lineNumber})
+		case len(fields) > 0:
+			fields[len(fields)-1].value += "\n" + line
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read MT940 file: %v", err)
+	}
+	return fields, nil
+}
+
+// ParseMT940 reads the statement lines (:61:) of an MT940 file; lines that cannot be read
+// are returned as errors instead of failing the whole file
+func ParseMT940(r io.Reader) ([]StatementEntry, []string, error) {
+	fields, err := mt940Fields(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	var entries []StatementEntry
+	var entryErrors []string
+	ids := contentIDs{}
+	account, currency := "", ""
+	sawStatement := false
+	for i, field := range fields {
+		switch field.tag {
+		case "20":
+			sawStatement = true
+		case "25":
+			account = strings.TrimSpace(field.value)
+		case "60F", "60M":
+			// opening balance: mark, date (YYMMDD) and currency, e.g., C240101EUR1000,00
+			if len(field.value) >= 10 {
+				currency = field.value[7:10]
+			}
+		case "-":
+			account, currency = "", ""
+		case "61":
+			details := ""
+			if i+1 < len(fields) && fields[i+1].tag == "86" {
+				details = fields[i+1].value
+			}
+			entry, err := mt940Entry(field.value, details, account, currency, ids)
+			if err != nil {
+				entryErrors = append(entryErrors, fmt.Sprintf("line %d: %v", field.line, err))
+				continue
+			}
+			entries = append(entries, entry)
+		}
+	}
+	if !sawStatement {
+		return nil, nil, fmt.Errorf("not an MT940 file: missing :20: field")
+	}
+	if len(entries) == 0 && len(entryErrors) == 0 {
+		return nil, nil, fmt.Errorf("no statement lines found in MT940 file")
+	}
+	return entries, entryErrors, nil
+}
+
+func mt940Entry(value, details, account, currency string, ids contentIDs) (StatementEntry, error) {
+	first, _, _ := strings.Cut(value, "\n") // the rest holds supplementary details
+	m := reMT940Line.FindStringSubmatch(strings.TrimSpace(first))
+	if m == nil {
+		return StatementEntry{}, fmt.Errorf("invalid statement line %q", first)
+	}
+	valueDate, err := time.Parse("060102", m[1])
+	if err != nil {
+		return StatementEntry{}, fmt.Errorf("invalid value date %q", m[1])
+	}
+	date := valueDate
+	if m[2] != "" { // the booking date has no year, so it is taken from the value date
+		booking, err := time.Parse("0102", m[2])
+		if err != nil {
+			return StatementEntry{}, fmt.Errorf("invalid booking date %q", m[2])
+		}
+		year := valueDate.Year()
+		switch {
+		case booking.Month() == time.December && valueDate.Month() == time.January:
+			year--
+		case booking.Month() == time.January && valueDate.Month() == time.December:
+			year++
+		}
+		date = time.Date(year, booking.Month(), booking.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	amount, err := strconv.ParseFloat(strings.Replace(m[5], ",", ".", 1), 64)
+	if err != nil {
+		return StatementEntry{}, fmt.Errorf("invalid amount %q", m[5])
+	}
+	if m[3] == "D" || m[3] == "RC" { // debits and reversed credits take money out
+		amount = -amount
+	}
+	if currency != "" {
+		if currency, err = storage.ValidateCurrency(currency); err != nil {
+			return StatementEntry{}, err
+		}
+	}
+
+	name := mt940Details(details)
+	bankRef := strings.TrimSpace(m[8])
+	customerRef := strings.TrimSpace(m[7])
+	if bankRef == "" && customerRef != "NONREF" {
+		bankRef = customerRef
+	}
+	externalID := "mt940:" + account + ":" + bankRef
+	if bankRef == "" {
+		externalID = ids.next("mt940:"+account+":", m[0], details)
+	}
+	return StatementEntry{
+		ExternalID: externalID,
+		Name:       name,
+		Amount:     amount,
+		Currency:   currency,
+		Date:       date,
+	}, nil
+}
+
+var reMT940Subfield = regexp.MustCompile(`\?(\d{2})`)
+
+// mt940Details returns the remittance information of a :86: field; German banks structure it
+// in ?NN subfields, with the remittance in ?20 to ?29 and the other party in ?32 and ?33
+func mt940Details(details string) string {
+	if !strings.Contains(details, "?20") && !strings.Contains(details, "?32") {
+		return strings.Join(strings.Fields(details), " ")
+	}
+	details = strings.ReplaceAll(details, "\n", "")
+	var remittance, party []string
+	matches := reMT940Subfield.FindAllStringSubmatchIndex(details, -1)
+	for i, m := range matches {
+		end := len(details)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		code, _ := strconv.Atoi(details[m[2]:m[3]])
+		text := details[m[1]:end] // subfields are chunks of one text, so spaces are kept
+		switch {
+		case code >= 20 && code <= 29, code >= 60 && code <= 63:
+			remittance = append(remittance, text)
+		case code == 32 || code == 33:
+			party = append(party, strings.TrimSpace(text))
+		}
+	}
+	text := strings.Join(remittance, "")
+	if _, purpose, ok := strings.Cut(text, "SVWZ+"); ok { // SEPA remittance after references like EREF+
+		text = purpose
+	}
+	return firstNonEmpty(strings.Join(strings.Fields(text), " "), strings.Join(party, " "))
+}
+
+// imports statement lines from an MT940 file
+func (h *Handler) ImportMT940(w http.ResponseWriter, r *http.Request) {
+	h.importStatementFile(w, r, "mt940", ParseMT940)
+}
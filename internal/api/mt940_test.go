@@ -0,0 +1,98 @@
+package api
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const mt940Sample = `{1:F01BANKDEFFXXXX0000000000}{2:O9401200250101BANKDEFFXXXX00000000002501011200N}{4:
+:20:STARTUMSE
+:25:10020030/1234567
+:28C:00001/001
+:60F:C241230EUR1000,00
+:61:2412311231D42,50NDDTNONREF//BANK-1
+:86:105?00SEPA-LASTSCHRIFT?20EREF+INV-99 SVWZ+Power Dece
+?21mber 2024?32Stadtwerke?33Muenchen
+:61:2501020102C2500,00NTRFSALARY-JAN
+:86:Salary January
+ 2025
+:61:2501030103RC10,00NCHGNONREF
+:86:?32Fee refund reversal
+:61:250104D1x,00NTRF
+:62F:C250104EUR3447,50
+-}
+`
+
+func TestParseMT940(t *testing.T) {
+	day := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name    string
+		input   string
+		entries []StatementEntry
+		errors  []string
+		err     bool
+	}{
+		{
+			name:  "statement lines with details",
+			input: mt940Sample,
+			entries: []StatementEntry{
+				{ExternalID: "mt940:10020030/1234567:BANK-1", Name: "Power December 2024", Amount: -42.5, Currency: "eur", Date: day(2024, 12, 31)},
+				{ExternalID: "mt940:10020030/1234567:SALARY-JAN", Name: "Salary January 2025", Amount: 2500, Currency: "eur", Date: day(2025, 1, 2)},
+				{ExternalID: contentIDs{}.next("mt940:10020030/1234567:", "2501030103RC10,00NCHGNONREF", "?32Fee refund reversal"), Name: "Fee refund reversal", Amount: -10, Currency: "eur", Date: day(2025, 1, 3)},
+			},
+			errors: []string{`line 14: invalid statement line "250104D1x,00NTRF"`},
+		},
+		{
+			// the booking date of December 31 belongs to the year before the January value date
+			name:    "booking date in the previous year",
+			input:   ":20:X\n:61:2501021231D5,00NMSCREF-1\n-\n",
+			entries: []StatementEntry{{ExternalID: "mt940::REF-1", Amount: -5, Date: day(2024, 12, 31)}},
+		},
+		{
+			name:  "missing :20:",
+			input: ":25:123\n:61:2501020102C1,00NTRFREF\n",
+			err:   true,
+		},
+		{
+			name:  "no statement lines",
+			input: ":20:X\n:25:123\n:60F:C250101EUR0,00\n-\n",
+			err:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, entryErrors, err := ParseMT940(strings.NewReader(tt.input))
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v, want error %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(entries, tt.entries) {
+				t.Errorf("entries = %+v, want %+v", entries, tt.entries)
+			}
+			if !reflect.DeepEqual(entryErrors, tt.errors) {
+				t.Errorf("errors = %q, want %q", entryErrors, tt.errors)
+			}
+		})
+	}
+}
+
+func TestMT940Details(t *testing.T) {
+	tests := []struct {
+		details string
+		want    string
+	}{
+		{"Card payment\n  Bakery", "Card payment Bakery"},
+		{"166?00GUTSCHRIFT?20Rent?21 March?32Tenant", "Rent March"},
+		{"?20EREF+123?21SVWZ+Invoice 7?32Shop", "Invoice 7"},
+		{"?20?32Other party?33 GmbH", "Other party GmbH"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := mt940Details(tt.details); got != tt.want {
+			t.Errorf("mt940Details(%q) = %q, want %q", tt.details, got, tt.want)
+		}
+	}
+}
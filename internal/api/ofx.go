@@ -0,0 +1,181 @@
+package api
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// OFX 1.x files are SGML where values are not closed (<TRNAMT>-12.50) and OFX 2.x files
+// are XML (<TRNAMT>-12.50</TRNAMT>); QFX is OFX with extra Quicken tags. Both are read
+// with one tokenizer that takes the text after an opening tag as that element's value
+
+type ofxToken struct {
+	name  string // upper-case tag name, empty for text
+	close bool
+	text  string
+}
+
+// ofxTokens splits an OFX body into tags and text, skipping the SGML header, processing
+// instructions and comments
+func ofxTokens(r io.Reader) ([]ofxToken, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	body := string(data)
+	start := strings.Index(strings.ToUpper(body), "<OFX>")
+	if start < 0 {
+		return nil, fmt.Errorf("not an OFX file: missing <OFX> element")
+	}
+	body = body[start:]
+	var tokens []ofxToken
+	for len(body) > 0 {
+		open := strings.IndexByte(body, '<')
+		if open < 0 {
+			break
+		}
+		if text := strings.TrimSpace(body[:open]); text != "" {
+			tokens = append(tokens, ofxToken{text: html.UnescapeString(text)})
+		}
+		end := strings.IndexByte(body[open:], '>')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated tag near %q", truncate(body[open:], 20))
+		}
+		tag := strings.TrimSpace(body[open+1 : open+end])
+		body = body[open+end+1:]
+		if tag == "" || tag[0] == '?' || tag[0] == '!' {
+			continue
+		}
+		token := ofxToken{}
+		if tag[0] == '/' {
+			token.close = true
+			tag = tag[1:]
+		}
+		fields := strings.Fields(strings.TrimSuffix(tag, "/"))
+		if len(fields) == 0 {
+			continue
+		}
+		token.name = strings.ToUpper(fields[0])
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// ParseOFX reads the bank and credit card transactions (STMTTRN) of an OFX or QFX statement;
+// transactions that cannot be read are returned as errors instead of failing the whole file
+func ParseOFX(r io.Reader) ([]StatementEntry, []string, error) {
+	tokens, err := ofxTokens(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	var entries []StatementEntry
+	var entryErrors []string
+	var currency, account string
+	var trn map[string]string // fields of the open STMTTRN
+	finish := func() {
+		if trn == nil {
+			return
+		}
+		entry, err := ofxEntry(trn, currency, account)
+		if err != nil {
+			entryErrors = append(entryErrors, fmt.Sprintf("transaction %d: %v", len(entries)+len(entryErrors)+1, err))
+		} else {
+			entries = append(entries, entry)
+		}
+		trn = nil
+	}
+	for i, token := range tokens {
+		switch {
+		case token.name == "STMTTRN" && !token.close:
+			finish()
+			trn = map[string]string{}
+		case token.name == "STMTTRN" || token.name == "BANKTRANLIST":
+			finish() // closing tags; the list close covers a missing </STMTTRN>
+		case token.name != "" && !token.close && i+1 < len(tokens) && tokens[i+1].name == "":
+			value := tokens[i+1].text
+			switch {
+			case trn != nil:
+				if _, ok := trn[token.name]; !ok { // keeps NAME over a nested PAYEE's NAME
+					trn[token.name] = value
+				}
+			case token.name == "CURDEF":
+				currency = value
+			case token.name == "ACCTID":
+				account = value
+			}
+		}
+	}
+	finish()
+	if len(entries) == 0 && len(entryErrors) == 0 {
+		return nil, nil, fmt.Errorf("no transactions found in OFX file")
+	}
+	return entries, entryErrors, nil
+}
+
+func ofxEntry(trn map[string]string, currency, account string) (StatementEntry, error) {
+	fitID := trn["FITID"]
+	if fitID == "" {
+		return StatementEntry{}, fmt.Errorf("missing FITID")
+	}
+	amountStr := trn["TRNAMT"]
+	if !strings.Contains(amountStr, ".") { // some banks write decimal commas
+		amountStr = strings.Replace(amountStr, ",", ".", 1)
+	}
+	amount, err := strconv.ParseFloat(strings.ReplaceAll(amountStr, " ", ""), 64)
+	if err != nil {
+		return StatementEntry{}, fmt.Errorf("FITID %s: invalid TRNAMT %q", fitID, trn["TRNAMT"])
+	}
+	date, err := parseOFXDate(trn["DTPOSTED"])
+	if err != nil {
+		return StatementEntry{}, fmt.Errorf("FITID %s: %v", fitID, err)
+	}
+	name := trn["NAME"]
+	if name == "" {
+		name = trn["MEMO"]
+	}
+	if currency != "" {
+		if currency, err = storage.ValidateCurrency(currency); err != nil {
+			return StatementEntry{}, fmt.Errorf("FITID %s: %v", fitID, err)
+		}
+	}
+	return StatementEntry{
+		// FITIDs are only unique within an account
+		ExternalID: "ofx:" + account + ":" + fitID,
+		Name:       name,
+		Amount:     amount,
+		Currency:   currency,
+		Date:       date,
+	}, nil
+}
+
+// parseOFXDate reads YYYYMMDD[HHMMSS[.XXX]][[offset:TZ]] dates; only the calendar day is kept,
+// as banks post transactions by day and a time zone shift would move them to another day
+func parseOFXDate(value string) (time.Time, error) {
+	if len(value) < 8 {
+		return time.Time{}, fmt.Errorf("invalid DTPOSTED %q", value)
+	}
+	date, err := time.Parse("20060102", value[:8])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid DTPOSTED %q", value)
+	}
+	return date.UTC(), nil
+}
+
+// imports transactions from an OFX or QFX statement
+func (h *Handler) ImportOFX(w http.ResponseWriter, r *http.Request) {
+	h.importStatementFile(w, r, "ofx", ParseOFX)
+}
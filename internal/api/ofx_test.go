@@ -0,0 +1,128 @@
+package api
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const ofxSGMLSample = `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+ENCODING:USASCII
+CHARSET:1252
+
+<OFX>
+<SIGNONMSGSRSV1><SONRS><STATUS><CODE>0<SEVERITY>INFO</STATUS><DTSERVER>20250305120000</SONRS></SIGNONMSGSRSV1>
+<BANKMSGSRSV1><STMTTRNRS><STMTRS>
+<CURDEF>USD
+<BANKACCTFROM><BANKID>121000248<ACCTID>123456<ACCTTYPE>CHECKING</BANKACCTFROM>
+<BANKTRANLIST>
+<DTSTART>20250301<DTEND>20250305
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20250302120000.000[-5:EST]
+<TRNAMT>-42.17
+<FITID>2025030201
+<NAME>WHOLE FOODS &amp; CO
+<MEMO>Card purchase
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>CREDIT
+<DTPOSTED>20250304
+<TRNAMT>1500,00
+<FITID>2025030402
+<MEMO>Payroll
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20250305
+<TRNAMT>-3.50
+<NAME>No reference
+</BANKTRANLIST>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>
+`
+
+const ofxXMLSample = `<?xml version="1.0" encoding="UTF-8"?>
+<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>
+<OFX>
+  <CREDITCARDMSGSRSV1>
+    <CCSTMTTRNRS>
+      <CCSTMTRS>
+        <CURDEF>EUR</CURDEF>
+        <CCACCTFROM><ACCTID>9999</ACCTID></CCACCTFROM>
+        <BANKTRANLIST>
+          <STMTTRN>
+            <TRNTYPE>DEBIT</TRNTYPE>
+            <DTPOSTED>20250110</DTPOSTED>
+            <TRNAMT>-9.99</TRNAMT>
+            <FITID>A1</FITID>
+            <NAME>Streaming</NAME>
+            <PAYEE><NAME>Streaming Inc</NAME><CITY>Berlin</CITY></PAYEE>
+          </STMTTRN>
+          <STMTTRN>
+            <TRNTYPE>DEBIT</TRNTYPE>
+            <DTPOSTED>2025011</DTPOSTED>
+            <TRNAMT>-1</TRNAMT>
+            <FITID>A2</FITID>
+          </STMTTRN>
+        </BANKTRANLIST>
+      </CCSTMTRS>
+    </CCSTMTTRNRS>
+  </CREDITCARDMSGSRSV1>
+</OFX>
+`
+
+func TestParseOFX(t *testing.T) {
+	day := func(month time.Month, d int) time.Time { return time.Date(2025, month, d, 0, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		name    string
+		input   string
+		entries []StatementEntry
+		errors  []string
+		err     bool
+	}{
+		{
+			name:  "SGML with unclosed values",
+			input: ofxSGMLSample,
+			entries: []StatementEntry{
+				{ExternalID: "ofx:123456:2025030201", Name: "WHOLE FOODS & CO", Amount: -42.17, Currency: "usd", Date: day(3, 2)},
+				{ExternalID: "ofx:123456:2025030402", Name: "Payroll", Amount: 1500, Currency: "usd", Date: day(3, 4)},
+			},
+			errors: []string{"transaction 3: missing FITID"},
+		},
+		{
+			name:  "XML with closing tags",
+			input: ofxXMLSample,
+			entries: []StatementEntry{
+				{ExternalID: "ofx:9999:A1", Name: "Streaming", Amount: -9.99, Currency: "eur", Date: day(1, 10)},
+			},
+			errors: []string{`transaction 2: FITID A2: invalid DTPOSTED "2025011"`},
+		},
+		{
+			name:  "not OFX",
+			input: "Date,Amount\n2025-01-01,-5\n",
+			err:   true,
+		},
+		{
+			name:  "no transactions",
+			input: "<OFX><BANKMSGSRSV1></BANKMSGSRSV1></OFX>",
+			err:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, entryErrors, err := ParseOFX(strings.NewReader(tt.input))
+			if (err != nil) != tt.err {
+				t.Fatalf("err = %v, want error %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(entries, tt.entries) {
+				t.Errorf("entries = %+v, want %+v", entries, tt.entries)
+			}
+			if !reflect.DeepEqual(entryErrors, tt.errors) {
+				t.Errorf("errors = %q, want %q", entryErrors, tt.errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,345 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// QIF is a line based format: a !Type header names the account type, and each record is a
+// list of fields (a code letter followed by the value) closed by a ^ line. Split transactions
+// repeat the S (category), E (memo) and $ (amount) fields once per split.
+
+// ways of flattening QIF categories with subcategories (Food:Groceries)
+const (
+	QIFSubcategoriesFull = "full" // Food - Groceries
+	QIFSubcategoriesTop  = "top"  // Food
+	QIFSubcategoriesLeaf = "leaf" // Groceries
+)
+
+// QIFOptions controls how QIF records are read
+type QIFOptions struct {
+	Subcategories string // one of the QIFSubcategories constants, defaults to full
+	DayFirst      bool   // dates are DD/MM instead of the usual MM/DD
+}
+
+func (o QIFOptions) validate() error {
+	switch o.Subcategories {
+	case "", QIFSubcategoriesFull, QIFSubcategoriesTop, QIFSubcategoriesLeaf:
+		return nil
+	}
+	return fmt.Errorf("invalid subcategories mode: %s", o.Subcategories)
+}
+
+// flattenCategory drops the class (after /) of a QIF category and flattens its subcategories;
+// transfers to another account ([Savings]) are put into a Transfer category
+func (o QIFOptions) flattenCategory(category string) string {
+	category, _, _ = strings.Cut(category, "/")
+	category = strings.TrimSpace(category)
+	if strings.HasPrefix(category, "[") && strings.HasSuffix(category, "]") {
+		return "Transfer"
+	}
+	parts := strings.Split(category, ":")
+	switch o.Subcategories {
+	case QIFSubcategoriesTop:
+		return strings.TrimSpace(parts[0])
+	case QIFSubcategoriesLeaf:
+		return strings.TrimSpace(parts[len(parts)-1])
+	}
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	return strings.Join(parts, " - ")
+}
+
+// account types holding transactions; other sections (categories, classes, investments,
+// memorized transactions) are skipped
+var qifTransactionTypes = []string{"bank", "cash", "ccard", "oth a", "oth l"}
+
+// qifSplit is one split of a split transaction
+type qifSplit struct {
+	category string // S
+	memo     string // E
+	amount   string // $
+}
+
+// ParseQIF reads the transactions of a QIF file, with each split of a split transaction as an
+// entry of its own; records that cannot be read are returned as errors instead of failing the
+// whole file
+func ParseQIF(r io.Reader, options QIFOptions) ([]StatementEntry, []string, error) {
+	if err := options.validate(); err != nil {
+		return nil, nil, err
+	}
+	var entries []StatementEntry
+	var entryErrors []string
+	ids := contentIDs{} // QIF has no transaction IDs
+	inTransactions := false
+	record := map[byte]string{}
+	var splits []qifSplit
+	recordLine := 0
+	finish := func() {
+		if len(record) == 0 && len(splits) == 0 {
+			return
+		}
+		if inTransactions {
+			parts, err := qifEntries(record, splits, options)
+			if err != nil {
+				entryErrors = append(entryErrors, fmt.Sprintf("record at line %d: %v", recordLine, err))
+			}
+			for i, entry := range parts {
+				if len(splits) == 0 {
+					entry.ExternalID = ids.next("qif:", record['D'], record['T']+record['U'], entry.Name, record['L'])
+				} else {
+					entry.ExternalID = ids.next("qif:", record['D'], record['T']+record['U'], entry.Name, record['L'], splits[i].category, splits[i].amount)
+				}
+				entries = append(entries, entry)
+			}
+		}
+		record = map[byte]string{}
+		splits = nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	sawHeader := false
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\uFEFF"))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "!") {
+			finish()
+			header := strings.ToLower(line)
+			if typ, ok := strings.CutPrefix(header, "!type:"); ok {
+				sawHeader = true
+				inTransactions = false
+				for _, t := range qifTransactionTypes {
+					if strings.TrimSpace(typ) == t {
+						inTransactions = true
+					}
+				}
+			} else if header == "!account" {
+				inTransactions = false // account list, until the next !Type
+			}
+			continue
+		}
+		if line == "^" {
+			finish()
+			continue
+		}
+		if len(record) == 0 && len(splits) == 0 {
+			recordLine = lineNumber
+		}
+		code, value := line[0], strings.TrimSpace(line[1:])
+		switch code {
+		case 'S':
+			splits = append(splits, qifSplit{category: value})
+		case 'E', '$':
+			if len(splits) == 0 {
+				splits = append(splits, qifSplit{})
+			}
+			if code == 'E' {
+				splits[len(splits)-1].memo = value
+			} else {
+				splits[len(splits)-1].amount = value
+			}
+		default:
+			if _, ok := record[code]; !ok { // the first of repeated fields is kept
+				record[code] = value
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read QIF file: %v", err)
+	}
+	finish()
+	if !sawHeader {
+		return nil, nil, fmt.Errorf("not a QIF file: missing !Type header")
+	}
+	if len(entries) == 0 && len(entryErrors) == 0 {
+		return nil, nil, fmt.Errorf("no transactions found in QIF file")
+	}
+	return entries, entryErrors, nil
+}
+
+func qifEntry(record map[byte]string, options QIFOptions) (StatementEntry, error) {
+	date, err := parseQIFDate(record['D'], options.DayFirst)
+	if err != nil {
+		return StatementEntry{}, err
+	}
+	amountStr := record['T']
+	if amountStr == "" {
+		amountStr = record['U']
+	}
+	amount, err := parseQIFAmount(amountStr)
+	if err != nil {
+		return StatementEntry{}, err
+	}
+	name := record['P']
+	if name == "" {
+		name = record['M']
+	}
+	category := record['L']
+	if category != "" {
+		category = options.flattenCategory(category)
+	}
+	return StatementEntry{
+		Name:     name,
+		Amount:   amount,
+		Date:     date,
+		Category: category,
+	}, nil
+}
+
+// qifEntries returns the entry of a record, or one entry per split, named after the payee and
+// the split's memo; the splits must add up to the record's total
+func qifEntries(record map[byte]string, splits []qifSplit, options QIFOptions) ([]StatementEntry, error) {
+	entry, err := qifEntry(record, options)
+	if err != nil {
+		return nil, err
+	}
+	if len(splits) == 0 {
+		return []StatementEntry{entry}, nil
+	}
+	entries := make([]StatementEntry, 0, len(splits))
+	total := 0.0
+	for i, split := range splits {
+		amount, err := parseQIFAmount(split.amount)
+		if err != nil {
+			return nil, fmt.Errorf("split %d: %v", i+1, err)
+		}
+		total += amount
+		part := entry
+		part.Amount = amount
+		part.Category = ""
+		if split.category != "" {
+			part.Category = options.flattenCategory(split.category)
+		}
+		switch {
+		case split.memo != "" && part.Name != "":
+			part.Name += " - " + split.memo
+		case split.memo != "":
+			part.Name = split.memo
+		}
+		entries = append(entries, part)
+	}
+	if math.Abs(total-entry.Amount) >= 0.005 {
+		return nil, fmt.Errorf("splits add up to %.2f instead of %.2f", total, entry.Amount)
+	}
+	return entries, nil
+}
+
+// parseQIFAmount reads amounts like -1,234.56
+func parseQIFAmount(value string) (float64, error) {
+	amount, err := strconv.ParseFloat(strings.ReplaceAll(value, ",", ""), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+	return amount, nil
+}
+
+// parseQIFDate reads dates like 01/15/2024, 1/15'24, 1/15/24 and 2024-01-15; Quicken writes an
+// apostrophe before two digit years from 2000 on
+func parseQIFDate(value string, dayFirst bool) (time.Time, error) {
+	cleaned := strings.ReplaceAll(value, " ", "")
+	apostrophe := strings.Contains(cleaned, "'")
+	parts := strings.FieldsFunc(cleaned, func(r rune) bool { return r == '/' || r == '\'' || r == '-' || r == '.' })
+	if len(parts) != 3 {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	numbers := make([]int, 3)
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date %q", value)
+		}
+		numbers[i] = n
+	}
+	var year, month, day int
+	switch {
+	case len(parts[0]) == 4:
+		year, month, day = numbers[0], numbers[1], numbers[2]
+	case dayFirst:
+		day, month, year = numbers[0], numbers[1], numbers[2]
+	default:
+		month, day, year = numbers[0], numbers[1], numbers[2]
+	}
+	if len(parts[2]) <= 2 && len(parts[0]) != 4 {
+		switch {
+		case apostrophe || year < 70:
+			year += 2000
+		default:
+			year += 1900
+		}
+	}
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if date.Year() != year || int(date.Month()) != month || date.Day() != day {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+	return date, nil
+}
+
+// imports transactions from a QIF file, with the options as form fields
+func (h *Handler) ImportQIF(w http.ResponseWriter, r *http.Request) {
+	h.importStatementFile(w, r, "qif", func(file io.Reader) ([]StatementEntry, []string, error) {
+		options := QIFOptions{
+			Subcategories: r.FormValue("subcategories"),
+			DayFirst:      r.FormValue("dayFirst") == "true",
+		}
+		return ParseQIF(file, options)
+	})
+}
+
+// exports all expenses to QIF as a bank account
+func (h *Handler) ExportQIF(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	expenses, err := h.visibleExpenses(r)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve expenses"})
+		log.Printf("API ERROR: Failed to retrieve expenses for QIF export: %v\n", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/qif")
+	w.Header().Set("Content-Disposition", "attachment; filename=expenses.qif")
+	if err := WriteQIF(w, expenses); err != nil {
+		log.Printf("API ERROR: Failed to write QIF export: %v\n", err)
+		return
+	}
+	log.Println("HTTP: Exported expenses to QIF")
+}
+
+// WriteQIF writes expenses as QIF bank transactions, with MM/DD/YYYY dates as most tools expect
+// and tags in the memo; QIF has no currency field, so amounts are written as stored and
+// their currency is dropped
+func WriteQIF(w io.Writer, expenses []storage.Expense) error {
+	writer := bufio.NewWriter(w)
+	fmt.Fprintln(writer, "!Type:Bank")
+	for _, expense := range expenses {
+		fmt.Fprintf(writer, "D%s\n", expense.Date.UTC().Format("01/02/2006"))
+		fmt.Fprintf(writer, "T%s\n", strconv.FormatFloat(expense.Amount, 'f', 2, 64))
+		fmt.Fprintf(writer, "P%s\n", qifValue(expense.Name))
+		if len(expense.Tags) > 0 {
+			fmt.Fprintf(writer, "MTags: %s\n", qifValue(strings.Join(expense.Tags, ", ")))
+		}
+		fmt.Fprintf(writer, "L%s\n", qifValue(expense.Category))
+		fmt.Fprintln(writer, "^")
+	}
+	return writer.Flush()
+}
+
+// qifValue keeps a value on one line, since every line is a field
+func qifValue(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
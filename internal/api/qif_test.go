@@ -0,0 +1,178 @@
+package api
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+func TestParseQIFDate(t *testing.T) {
+	tests := []struct {
+		value    string
+		dayFirst bool
+		want     string // YYYY-MM-DD, empty for an error
+	}{
+		{"01/15/2024", false, "2024-01-15"},
+		{"1/5'24", false, "2024-01-05"},
+		{"12/31' 9", false, "2009-12-31"},
+		{"1/15/24", false, "2024-01-15"},
+		{"1/15/98", false, "1998-01-15"},
+		{"2024-01-15", false, "2024-01-15"},
+		{"15/01/2024", true, "2024-01-15"},
+		{"15.01.24", true, "2024-01-15"},
+		{"15/01/2024", false, ""},
+		{"02/30/2024", false, ""},
+		{"yesterday", false, ""},
+	}
+	for _, tt := range tests {
+		date, err := parseQIFDate(tt.value, tt.dayFirst)
+		switch {
+		case tt.want == "" && err == nil:
+			t.Errorf("parseQIFDate(%q, %v) = %s, want an error", tt.value, tt.dayFirst, date.Format(time.DateOnly))
+		case tt.want != "" && err != nil:
+			t.Errorf("parseQIFDate(%q, %v): %v", tt.value, tt.dayFirst, err)
+		case tt.want != "" && date.Format(time.DateOnly) != tt.want:
+			t.Errorf("parseQIFDate(%q, %v) = %s, want %s", tt.value, tt.dayFirst, date.Format(time.DateOnly), tt.want)
+		}
+	}
+}
+
+func TestQIFFlattenCategory(t *testing.T) {
+	tests := []struct {
+		category string
+		mode     string
+		want     string
+	}{
+		{"Food:Groceries", QIFSubcategoriesFull, "Food - Groceries"},
+		{"Food:Groceries", "", "Food - Groceries"},
+		{"Food:Groceries", QIFSubcategoriesTop, "Food"},
+		{"Food:Groceries", QIFSubcategoriesLeaf, "Groceries"},
+		{"Auto:Fuel/Business", QIFSubcategoriesFull, "Auto - Fuel"},
+		{"Rent", QIFSubcategoriesLeaf, "Rent"},
+		{"[Savings]", QIFSubcategoriesFull, "Transfer"},
+	}
+	for _, tt := range tests {
+		if got := (QIFOptions{Subcategories: tt.mode}).flattenCategory(tt.category); got != tt.want {
+			t.Errorf("flattenCategory(%q) with %q = %q, want %q", tt.category, tt.mode, got, tt.want)
+		}
+	}
+}
+
+const qifSample = `!Account
+NChecking
+TBank
+^
+!Type:Bank
+D1/15'25
+T-1,250.00
+PLandlord
+LHousing:Rent
+^
+D1/16'25
+T-80.00
+PSupermarket
+L--Split--
+SFood:Groceries
+EWeekly shop
+$-60.00
+SHousehold
+$-20.00
+^
+D1/17'25
+T-50.00
+PBroken split
+SFood
+$-30.00
+^
+D13/45'25
+T-1.00
+PBad date
+^
+!Type:Cat
+NFood
+^
+`
+
+func TestParseQIF(t *testing.T) {
+	entries, entryErrors, err := ParseQIF(strings.NewReader(qifSample), QIFOptions{Subcategories: QIFSubcategoriesTop})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []StatementEntry{
+		{Name: "Landlord", Amount: -1250, Category: "Housing"},
+		{Name: "Supermarket - Weekly shop", Amount: -60, Category: "Food"},
+		{Name: "Supermarket", Amount: -20, Category: "Household"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d: %+v", len(entries), len(want), entries)
+	}
+	ids := map[string]bool{}
+	for i, entry := range entries {
+		if entry.Name != want[i].Name || entry.Amount != want[i].Amount || entry.Category != want[i].Category {
+			t.Errorf("entry %d = %+v, want %+v", i, entry, want[i])
+		}
+		if !strings.HasPrefix(entry.ExternalID, "qif:") || ids[entry.ExternalID] {
+			t.Errorf("entry %d has reference %q, want a distinct qif: reference", i, entry.ExternalID)
+		}
+		ids[entry.ExternalID] = true
+	}
+	wantErrors := []string{
+		"record at line 21: splits add up to -30.00 instead of -50.00",
+		`record at line 27: invalid date "13/45'25"`,
+	}
+	if strings.Join(entryErrors, "\n") != strings.Join(wantErrors, "\n") {
+		t.Errorf("errors = %q, want %q", entryErrors, wantErrors)
+	}
+
+	// the same file gives the same references, so importing it again adds nothing
+	again, _, _ := ParseQIF(strings.NewReader(qifSample), QIFOptions{Subcategories: QIFSubcategoriesTop})
+	for i := range again {
+		if again[i].ExternalID != entries[i].ExternalID {
+			t.Errorf("entry %d: reference %q on the second read, %q on the first", i, again[i].ExternalID, entries[i].ExternalID)
+		}
+	}
+}
+
+func TestParseQIFRejects(t *testing.T) {
+	tests := map[string]string{
+		"no header":       "D01/01/2025\nT-1\n^\n",
+		"no transactions": "!Type:Cat\nNFood\n^\n",
+	}
+	for name, input := range tests {
+		if _, _, err := ParseQIF(strings.NewReader(input), QIFOptions{}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, _, err := ParseQIF(strings.NewReader(qifSample), QIFOptions{Subcategories: "middle"}); err == nil {
+		t.Error("expected an error for an unknown subcategories mode")
+	}
+}
+
+func TestWriteQIF(t *testing.T) {
+	expenses := []storage.Expense{
+		{Name: "Coffee\nshop", Category: "Food", Amount: -3.5, Currency: "eur", Date: time.Date(2025, 2, 3, 0, 0, 0, 0, time.UTC), Tags: []string{"work", "daily"}},
+		{Name: "Salary", Category: "Income", Amount: 2000, Date: time.Date(2025, 2, 28, 0, 0, 0, 0, time.UTC)},
+	}
+	var buf bytes.Buffer
+	if err := WriteQIF(&buf, expenses); err != nil {
+		t.Fatal(err)
+	}
+	want := "!Type:Bank\n" +
+		"D02/03/2025\nT-3.50\nPCoffee shop\nMTags: work, daily\nLFood\n^\n" +
+		"D02/28/2025\nT2000.00\nPSalary\nLIncome\n^\n"
+	if buf.String() != want {
+		t.Errorf("WriteQIF wrote\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	// the export reads back as the same expenses
+	entries, entryErrors, err := ParseQIF(&buf, QIFOptions{})
+	if err != nil || len(entryErrors) > 0 {
+		t.Fatalf("reading the export: %v %v", err, entryErrors)
+	}
+	if len(entries) != 2 || entries[0].Name != "Coffee shop" || entries[0].Amount != -3.5 || entries[1].Category != "Income" {
+		t.Errorf("read back %+v", entries)
+	}
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// conversion rates are shared by all ledgers, so these handlers use the root storage
+
+type rateRequest struct {
+	From          string  `json:"from"`
+	To            string  `json:"to"`
+	Rate          float64 `json:"rate"`
+	EffectiveDate string  `json:"effectiveDate"` // a date (2006-01-02) or RFC 3339 time
+}
+
+type convertRequest struct {
+	To      string `json:"to"` // defaults to the ledger's currency
+	Amounts []struct {
+		Amount   float64   `json:"amount"`
+		Currency string    `json:"currency"`
+		Date     time.Time `json:"date"`
+	} `json:"amounts"`
+}
+
+type convertedAmount struct {
+	Amount    float64 `json:"amount"`
+	Converted bool    `json:"converted"` // false when no rate links the currencies
+}
+
+func (h *Handler) GetConversionRates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	rates, err := h.storage.GetConversionRates()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get conversion rates"})
+		log.Printf("API ERROR: Failed to get conversion rates: %v\n", err)
+		return
+	}
+	// optional filters for a single currency pair
+	from := strings.ToLower(r.URL.Query().Get("from"))
+	to := strings.ToLower(r.URL.Query().Get("to"))
+	filtered := []storage.ConversionRate{}
+	for _, rate := range rates {
+		if (from == "" || rate.From == from) && (to == "" || rate.To == to) {
+			filtered = append(filtered, rate)
+		}
+	}
+	writeJSON(w, http.StatusOK, filtered)
+}
+
+func (h *Handler) SaveConversionRate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var req rateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	rate := storage.ConversionRate{From: req.From, To: req.To, Rate: req.Rate}
+	if req.EffectiveDate != "" {
+		date, err := parseDate(req.EffectiveDate)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid 'effectiveDate': " + req.EffectiveDate})
+			return
+		}
+		rate.EffectiveDate = date
+	}
+	if err := rate.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := h.storage.SaveConversionRate(rate); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to save conversion rate"})
+		log.Printf("API ERROR: Failed to save conversion rate: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rate)
+}
+
+func (h *Handler) DeleteConversionRate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	values := r.URL.Query()
+	from, to, dateStr := strings.ToLower(values.Get("from")), strings.ToLower(values.Get("to")), values.Get("date")
+	if from == "" || to == "" || dateStr == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "from, to and date parameters are required"})
+		return
+	}
+	date, err := parseDate(dateStr)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid 'date': " + dateStr})
+		return
+	}
+	if err := h.storage.RemoveConversionRate(from, to, date); err != nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Conversion rate not found"})
+		log.Printf("API ERROR: Failed to delete conversion rate: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// ConvertAmounts converts amounts with the rates in effect on their dates, so clients get
+// the same numbers as the summary report without downloading the rate history
+func (h *Handler) ConvertAmounts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var req convertRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	to := req.To
+	if to == "" {
+		currency, err := h.store(r).GetCurrency()
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get currency"})
+			log.Printf("API ERROR: Failed to get currency: %v\n", err)
+			return
+		}
+		to = currency
+	}
+	to, err := storage.ValidateCurrency(to)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	rates, err := h.storage.GetConversionRates()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get conversion rates"})
+		log.Printf("API ERROR: Failed to get conversion rates: %v\n", err)
+		return
+	}
+	table := storage.NewRateTable(rates)
+	converted := make([]convertedAmount, len(req.Amounts))
+	for i, a := range req.Amounts {
+		amount, ok := table.Convert(a.Amount, strings.ToLower(a.Currency), to, a.Date)
+		converted[i] = convertedAmount{Amount: amount, Converted: ok}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"to": to, "amounts": converted})
+}
+
+func (h *Handler) ImportRates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	if err := r.ParseMultipartForm(10 << 20); err != nil { // larger files are buffered on disk
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Could not parse multipart form"})
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Error retrieving the file"})
+		return
+	}
+	defer file.Close()
+	report, err := storage.ImportConversionRates(h.storage, file)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		log.Printf("API ERROR: Failed to import rates: %v\n", err)
+		return
+	}
+	log.Printf("Imported %d conversion rates, skipped %d\n", report.Imported, report.Skipped)
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// StatementEntry is one transaction read from a bank statement; amounts follow the
+// expense convention (negative is money spent) and ExternalID is the bank's reference
+type StatementEntry struct {
+	ExternalID string    `json:"externalID"`
+	Name       string    `json:"name"`
+	Amount     float64   `json:"amount"`
+	Currency   string    `json:"currency"` // empty for the ledger's currency
+	Date       time.Time `json:"date"`
+	Category   string    `json:"category"` // empty to use the category rules
+}
+
+// StatementImport reports the outcome of a statement import, with the same keys as the CSV import
+type StatementImport struct {
+	Format             string   `json:"format"`
+	TotalProcessed     int      `json:"total_processed"`
+	Imported           int      `json:"imported"`
+	Skipped            int      `json:"skipped"` // already imported or invalid entries
+	NewCategories      []string `json:"new_categories"`
+	PossibleDuplicates int      `json:"possible_duplicates"` // imported expenses resembling stored ones
+	Errors             []string `json:"errors,omitempty"`
+}
+
+// expense returns the expense an entry creates for owner, before its category is resolved
+func (e StatementEntry) expense(owner string) storage.Expense {
+	return storage.Expense{
+		Name:       e.Name,
+		Category:   e.Category,
+		Amount:     e.Amount,
+		Currency:   e.Currency,
+		Date:       e.Date,
+		Owner:      owner,
+		ExternalID: e.ExternalID,
+	}
+}
+
+// ImportStatement stores the entries of a parsed statement as expenses of owner, in one
+// transaction; entries whose bank reference was already imported are skipped, so the same
+// statement can be imported again safely, and entries are changed by the ledger's rules, which
+// also assign their categories. An entry that cannot be read or stored cancels the import
+// unless skipInvalid is set.
+func ImportStatement(store storage.Storage, format string, entries []StatementEntry, entryErrors []string, owner string, skipInvalid bool) (StatementImport, error) {
+	candidates := statementCandidates(entries, entryErrors, owner)
+	return importCandidates(store, format, owner, nextCandidate(candidates), skipInvalid)
+}
+
+// statementCandidates turns parsed entries into import rows numbered by their position in the
+// statement, followed by the entries that could not be read
+func statementCandidates(entries []StatementEntry, entryErrors []string, owner string) []importCandidate {
+	candidates := make([]importCandidate, 0, len(entries)+len(entryErrors))
+	for _, entry := range entries {
+		candidates = append(candidates, importCandidate{row: len(candidates) + 1, expense: entry.expense(owner)})
+	}
+	for _, entryError := range entryErrors {
+		candidates = append(candidates, importCandidate{row: len(candidates) + 1, err: errors.New(entryError)})
+	}
+	return candidates
+}
+
+// statementParser reads the entries of a statement file, returning unreadable entries as errors
+type statementParser func(r io.Reader) ([]StatementEntry, []string, error)
+
+// importStatementFile handles the upload of a statement file in the given format, or previews
+// the import with preview=true; an entry that cannot be read cancels the import unless
+// skipInvalid=true
+func (h *Handler) importStatementFile(w http.ResponseWriter, r *http.Request, format string, parse statementParser) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	if err := r.ParseMultipartForm(10 << 20); err != nil { // 10MB max file size
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Could not parse multipart form"})
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Error retrieving the file"})
+		return
+	}
+	defer file.Close()
+	entries, entryErrors, err := parse(file)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	owner := UserFromContext(r.Context())
+	candidates := statementCandidates(entries, entryErrors, owner)
+	if r.FormValue("preview") == "true" {
+		h.writeImportPreview(w, r, format, candidates)
+		return
+	}
+	h.writeImport(w, r, format, nextCandidate(candidates), r.FormValue("skipInvalid") == "true")
+}
+
+// contentIDs builds references for entries that have none from their content, numbering
+// identical entries of a file to tell them apart; importing the same file again gives the
+// same references, so it is still skipped
+type contentIDs map[string]int
+
+func (c contentIDs) next(prefix string, fields ...string) string {
+	hash := sha256.Sum256([]byte(strings.Join(fields, "\x00")))
+	id := prefix + hex.EncodeToString(hash[:8])
+	c[id]++
+	return fmt.Sprintf("%s:%d", id, c[id])
+}
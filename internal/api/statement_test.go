@@ -0,0 +1,43 @@
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStatementCandidates(t *testing.T) {
+	entries := []StatementEntry{{Name: "Rent", Amount: -900}, {Name: "Salary", Amount: 2000}}
+	candidates := statementCandidates(entries, []string{"line 9: invalid amount"}, "alice")
+	if len(candidates) != 3 {
+		t.Fatalf("got %d candidates, want 3", len(candidates))
+	}
+	for i, c := range candidates {
+		if c.row != i+1 {
+			t.Errorf("candidate %d has row %d", i, c.row)
+		}
+	}
+	if candidates[1].expense.Name != "Salary" || candidates[1].expense.Owner != "alice" || candidates[1].err != nil {
+		t.Errorf("second candidate = %+v", candidates[1])
+	}
+	// unreadable entries come after the entries that were read
+	if candidates[2].err == nil || candidates[2].err.Error() != "line 9: invalid amount" {
+		t.Errorf("third candidate has error %v", candidates[2].err)
+	}
+}
+
+func TestContentIDs(t *testing.T) {
+	ids := contentIDs{}
+	first := ids.next("mt940:acct:", "2501020102D5,00NMSC", "Coffee")
+	second := ids.next("mt940:acct:", "2501020102D5,00NMSC", "Coffee")
+	other := ids.next("mt940:acct:", "2501020102D5,00NMSC", "Tea")
+	if !strings.HasPrefix(first, "mt940:acct:") || !strings.HasSuffix(first, ":1") || !strings.HasSuffix(second, ":2") || !strings.HasSuffix(other, ":1") {
+		t.Errorf("references %q, %q, %q", first, second, other)
+	}
+	if strings.TrimSuffix(first, ":1") != strings.TrimSuffix(second, ":2") {
+		t.Errorf("identical entries got different hashes: %q, %q", first, second)
+	}
+	// reading the same file again gives the same references
+	if again := (contentIDs{}).next("mt940:acct:", "2501020102D5,00NMSC", "Coffee"); again != first {
+		t.Errorf("second read gave %q, want %q", again, first)
+	}
+}
@@ -0,0 +1,318 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"cmp"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// cell styles, indexes into cellXfs of xlsxStyles
+const (
+	xlsxStyleDefault = iota
+	xlsxStyleHeader
+	xlsxStyleDate
+	xlsxStyleAmount
+	xlsxStyleTotal
+)
+
+// xlsxCell is a typed worksheet cell; empty cells are written as nothing
+type xlsxCell struct {
+	text   string
+	number float64
+	isNum  bool
+	style  int
+}
+
+func xlsxText(s string) xlsxCell { return xlsxCell{text: s} }
+
+func xlsxHeader(s string) xlsxCell { return xlsxCell{text: s, style: xlsxStyleHeader} }
+
+func xlsxAmount(v float64) xlsxCell {
+	return xlsxCell{number: math.Round(v*100) / 100, isNum: true, style: xlsxStyleAmount}
+}
+
+func xlsxTotal(v float64) xlsxCell {
+	return xlsxCell{number: math.Round(v*100) / 100, isNum: true, style: xlsxStyleTotal}
+}
+
+// xlsxDate is a date serial number: days since 1899-12-30 in the 1900 date system
+func xlsxDate(t time.Time) xlsxCell {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	days := day.Sub(time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)).Hours() / 24
+	return xlsxCell{number: math.Round(days), isNum: true, style: xlsxStyleDate}
+}
+
+// xlsxSheet is one worksheet; the first row is frozen as the header
+type xlsxSheet struct {
+	name   string
+	widths []float64 // of the first columns, in characters
+	rows   [][]xlsxCell
+}
+
+// xlsxColumn turns a 0-based column index into its letters, e.g., 27 into AB
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+func xlsxEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+func (s *xlsxSheet) xml() []byte {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	if len(s.widths) > 0 {
+		b.WriteString("<cols>")
+		for i, width := range s.widths {
+			fmt.Fprintf(&b, `<col min="%d" max="%d" width="%g" customWidth="1"/>`, i+1, i+1, width)
+		}
+		b.WriteString("</cols>")
+	}
+	b.WriteString("<sheetData>")
+	for r, row := range s.rows {
+		fmt.Fprintf(&b, `<row r="%d">`, r+1)
+		for c, cell := range row {
+			ref := xlsxColumn(c) + strconv.Itoa(r+1)
+			switch {
+			case cell.isNum:
+				fmt.Fprintf(&b, `<c r="%s" s="%d"><v>%s</v></c>`, ref, cell.style, strconv.FormatFloat(cell.number, 'f', -1, 64))
+			case cell.text != "":
+				fmt.Fprintf(&b, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, cell.style, xlsxEscape(cell.text))
+			}
+		}
+		b.WriteString("</row>")
+	}
+	b.WriteString("</sheetData></worksheet>")
+	return b.Bytes()
+}
+
+const xlsxStyles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd"/></numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="5">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="4" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="4" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1" applyNumberFormat="1"/>` +
+	`</cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`
+
+// xlsxPart is one file of the workbook's zip package
+type xlsxPart struct {
+	name    string
+	content []byte
+}
+
+// writeXLSX writes the sheets as an Office Open XML workbook
+func writeXLSX(w io.Writer, sheets []xlsxSheet) error {
+	var contentTypes, workbook, workbookRels bytes.Buffer
+	contentTypes.WriteString(xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	workbook.WriteString(xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	workbookRels.WriteString(xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i, sheet := range sheets {
+		fmt.Fprintf(&contentTypes, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+		fmt.Fprintf(&workbook, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xlsxEscape(sheet.name), i+1, i+1)
+		fmt.Fprintf(&workbookRels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+	}
+	contentTypes.WriteString("</Types>")
+	workbook.WriteString("</sheets></workbook>")
+	fmt.Fprintf(&workbookRels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(sheets)+1)
+	workbookRels.WriteString("</Relationships>")
+
+	parts := []xlsxPart{
+		{"[Content_Types].xml", contentTypes.Bytes()},
+		{"_rels/.rels", []byte(xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`)},
+		{"xl/workbook.xml", workbook.Bytes()},
+		{"xl/_rels/workbook.xml.rels", workbookRels.Bytes()},
+		{"xl/styles.xml", []byte(xlsxStyles)},
+	}
+	for i := range sheets {
+		parts = append(parts, xlsxPart{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), sheets[i].xml()})
+	}
+
+	archive := zip.NewWriter(w)
+	for _, part := range parts {
+		file, err := archive.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := file.Write(part.content); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// exports the user's expenses as a workbook with the transactions, a category pivot per
+// month and the monthly cashflow; the summary sheets are in the ledger's currency
+func (h *Handler) ExportXLSX(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	expenses, err := h.visibleExpenses(r)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve expenses"})
+		log.Printf("API ERROR: Failed to retrieve expenses for XLSX export: %v\n", err)
+		return
+	}
+	filter := storage.ExpenseQuery{Viewer: UserFromContext(r.Context())}
+	months, err := h.store(r).SummarizeExpenses(storage.SummaryQuery{Filter: filter, GroupBy: "month", Location: time.UTC})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to summarize expenses"})
+		log.Printf("API ERROR: Failed to summarize expenses for XLSX export: %v\n", err)
+		return
+	}
+	// the pivot sums the categories of each month period, as the dashboard does
+	byMonth := make([]*storage.Summary, len(months.Groups))
+	for i, month := range months.Groups {
+		filter.From, filter.To = *month.Start, *month.End
+		if byMonth[i], err = h.store(r).SummarizeExpenses(storage.SummaryQuery{Filter: filter, GroupBy: "category", Location: time.UTC}); err != nil {
+			writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to summarize expenses"})
+			log.Printf("API ERROR: Failed to summarize categories for XLSX export: %v\n", err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", "attachment; filename=expenses.xlsx")
+	sheets := []xlsxSheet{transactionsSheet(expenses, months.Currency), pivotSheet(months, byMonth), cashflowSheet(months)}
+	if err := writeXLSX(w, sheets); err != nil {
+		log.Printf("API ERROR: Failed to write XLSX export: %v\n", err)
+		return
+	}
+	log.Println("HTTP: Exported expenses to XLSX")
+}
+
+func transactionsSheet(expenses []storage.Expense, currency string) xlsxSheet {
+	sheet := xlsxSheet{
+		name:   "Transactions",
+		widths: []float64{12, 32, 18, 12, 10, 24, 14, 20, 38, 24, 38},
+		rows: [][]xlsxCell{{
+			xlsxHeader("Date"), xlsxHeader("Name"), xlsxHeader("Category"), xlsxHeader("Amount"), xlsxHeader("Currency"),
+			xlsxHeader("Tags"), xlsxHeader("Owner"), xlsxHeader("Shared With"), xlsxHeader("Recurring ID"), xlsxHeader("Reference"), xlsxHeader("ID"),
+		}},
+	}
+	expenses = slices.Clone(expenses)
+	sort.SliceStable(expenses, func(i, j int) bool { return expenses[i].Date.Before(expenses[j].Date) })
+	for _, e := range expenses {
+		sheet.rows = append(sheet.rows, []xlsxCell{
+			xlsxDate(e.Date), xlsxText(e.Name), xlsxText(e.Category), xlsxAmount(e.Amount),
+			xlsxText(strings.ToUpper(cmp.Or(e.Currency, currency))), xlsxText(strings.Join(e.Tags, ", ")),
+			xlsxText(e.Owner), xlsxText(strings.Join(e.SharedWith, ", ")), xlsxText(e.RecurringID), xlsxText(e.ExternalID), xlsxText(e.ID),
+		})
+	}
+	return sheet
+}
+
+// pivotSheet has a row per category and a column per month, with the net amounts
+func pivotSheet(months *storage.Summary, byMonth []*storage.Summary) xlsxSheet {
+	header := []xlsxCell{xlsxHeader(fmt.Sprintf("Category (%s)", strings.ToUpper(months.Currency)))}
+	for _, month := range months.Groups {
+		header = append(header, xlsxHeader(month.Key))
+	}
+	header = append(header, xlsxHeader("Total"))
+
+	// categories in order of spending over all months, like the dashboard
+	var categories []string
+	spent, nets := map[string]float64{}, map[string]float64{}
+	cells := map[string][]xlsxCell{} // months without the category stay blank
+	for i, summary := range byMonth {
+		for _, group := range summary.Groups {
+			if _, ok := cells[group.Key]; !ok {
+				categories = append(categories, group.Key)
+				cells[group.Key] = make([]xlsxCell, len(byMonth))
+			}
+			cells[group.Key][i] = xlsxAmount(group.Net)
+			spent[group.Key] += group.Expense
+			nets[group.Key] += group.Net
+		}
+	}
+	sort.SliceStable(categories, func(i, j int) bool { return spent[categories[i]] > spent[categories[j]] })
+
+	widths := []float64{24}
+	for range len(months.Groups) + 1 {
+		widths = append(widths, 12)
+	}
+	sheet := xlsxSheet{name: "Categories by Month", widths: widths, rows: [][]xlsxCell{header}}
+	for _, category := range categories {
+		row := append([]xlsxCell{xlsxText(category)}, cells[category]...)
+		sheet.rows = append(sheet.rows, append(row, xlsxTotal(nets[category])))
+	}
+	total := []xlsxCell{xlsxHeader("Total")}
+	for _, month := range months.Groups {
+		total = append(total, xlsxTotal(month.Net))
+	}
+	sheet.rows = append(sheet.rows, append(total, xlsxTotal(months.Totals.Net)))
+	return withUnconvertedNote(sheet, months)
+}
+
+// cashflowSheet has the income, spending and net of every month, with the running balance
+func cashflowSheet(months *storage.Summary) xlsxSheet {
+	currency := strings.ToUpper(months.Currency)
+	sheet := xlsxSheet{
+		name:   "Cashflow",
+		widths: []float64{12, 12, 14, 14, 14, 14, 10},
+		rows: [][]xlsxCell{{
+			xlsxHeader("Month"), xlsxHeader("From"), xlsxHeader("Income (" + currency + ")"), xlsxHeader("Expenses (" + currency + ")"),
+			xlsxHeader("Net (" + currency + ")"), xlsxHeader("Cumulative (" + currency + ")"), xlsxHeader("Count"),
+		}},
+	}
+	cumulative := 0.0
+	for _, month := range months.Groups {
+		cumulative += month.Net
+		sheet.rows = append(sheet.rows, []xlsxCell{
+			xlsxText(month.Key), xlsxDate(*month.Start), xlsxAmount(month.Income), xlsxAmount(month.Expense),
+			xlsxAmount(month.Net), xlsxAmount(cumulative), {number: float64(month.Count), isNum: true},
+		})
+	}
+	sheet.rows = append(sheet.rows, []xlsxCell{
+		xlsxHeader("Total"), {}, xlsxTotal(months.Totals.Income), xlsxTotal(months.Totals.Expense),
+		xlsxTotal(months.Totals.Net), {}, {number: float64(months.Totals.Count), isNum: true, style: xlsxStyleHeader},
+	})
+	return withUnconvertedNote(sheet, months)
+}
+
+// withUnconvertedNote warns below the sheet about currencies summed without a rate
+func withUnconvertedNote(sheet xlsxSheet, summary *storage.Summary) xlsxSheet {
+	if len(summary.Unconverted) > 0 {
+		note := fmt.Sprintf("No conversion rate to %s for %s; these amounts are summed as they are.",
+			strings.ToUpper(summary.Currency), strings.ToUpper(strings.Join(summary.Unconverted, ", ")))
+		sheet.rows = append(sheet.rows, nil, []xlsxCell{xlsxText(note)})
+	}
+	return sheet
+}
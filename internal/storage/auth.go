@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// User is a local account; passwords are only ever stored as bcrypt hashes
+type User struct {
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"passwordHash"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+const (
+	TokenKindSession = "session" // browser login, sent as a cookie
+	TokenKindAPI     = "api"     // bearer token for scripts and apps
+)
+
+// AuthToken is a session or API token; only the SHA-256 hash of the secret is stored
+type AuthToken struct {
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	Kind      string    `json:"kind"`
+	Name      string    `json:"name"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"` // zero for tokens that never expire
+}
+
+const minPasswordLength = 8
+
+// prefix of API token secrets, so leaked tokens are easy to recognize
+const apiTokenPrefix = "eo_"
+
+func ValidateUsername(username string) error {
+	if username == "" || len(username) > 64 {
+		return fmt.Errorf("username must be between 1 and 64 characters")
+	}
+	if strings.ContainsFunc(username, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) {
+		return fmt.Errorf("username cannot contain whitespace or control characters")
+	}
+	return nil
+}
+
+func (u *User) SetPassword(password string) error {
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %v", err)
+	}
+	u.PasswordHash = string(hash)
+	return nil
+}
+
+func (u *User) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
+}
+
+// HashAuthToken returns the form of a token secret that is stored and looked up
+func HashAuthToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewAuthToken creates a token and returns it with its secret, which is not stored anywhere
+func NewAuthToken(username, kind, name string, ttl time.Duration) (AuthToken, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return AuthToken{}, "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	secret := base64.RawURLEncoding.EncodeToString(raw)
+	if kind == TokenKindAPI {
+		secret = apiTokenPrefix + secret
+	}
+	now := time.Now().UTC()
+	token := AuthToken{
+		ID:        uuid.New().String(),
+		Username:  username,
+		Kind:      kind,
+		Name:      SanitizeString(name),
+		Hash:      HashAuthToken(secret),
+		CreatedAt: now,
+	}
+	if ttl > 0 {
+		token.ExpiresAt = now.Add(ttl)
+	}
+	return token, secret, nil
+}
+
+func (t *AuthToken) Expired() bool {
+	return !t.ExpiresAt.IsZero() && time.Now().After(t.ExpiresAt)
+}
@@ -0,0 +1,609 @@
+package storage
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BackupVersion is the version of the backup format written by this release; older versions
+// are restored, newer ones are refused
+const BackupVersion = 1
+
+// Backup is a full copy of one ledger: its configuration with the recurring expenses, its
+// expenses, and the conversion rates shared by all ledgers; users and tokens are never included
+type Backup struct {
+	Version   int              `json:"version"`
+	CreatedAt time.Time        `json:"createdAt"`
+	Ledger    string           `json:"ledger,omitempty"` // ID of the backed-up ledger, for reference
+	Config    Config           `json:"config"`
+	Expenses  []Expense        `json:"expenses"`
+	Rates     []ConversionRate `json:"rates"`
+}
+
+// restore modes and what merges do with expenses whose ID is already stored
+const (
+	RestoreReplace    = "replace" // removes the ledger's expenses and recurring expenses, and replaces its settings
+	RestoreMerge      = "merge"   // adds what is missing and keeps the ledger's settings
+	ConflictSkip      = "skip"
+	ConflictOverwrite = "overwrite"
+	ConflictNew       = "new" // restores the expense under a new ID
+)
+
+// RestoreOptions choose how a backup is restored
+type RestoreOptions struct {
+	Mode     string
+	Conflict string // used by merges only
+	User     string // only expenses the user may edit are removed or restored, "" for all
+	Rates    bool   // also adds the backup's conversion rates, which all ledgers share
+}
+
+func (o *RestoreOptions) Validate() error {
+	if o.Mode != RestoreReplace && o.Mode != RestoreMerge {
+		return fmt.Errorf("invalid restore mode: %s", o.Mode)
+	}
+	if o.Conflict == "" {
+		o.Conflict = ConflictSkip
+	}
+	if o.Conflict != ConflictSkip && o.Conflict != ConflictOverwrite && o.Conflict != ConflictNew {
+		return fmt.Errorf("invalid conflict handling: %s", o.Conflict)
+	}
+	return nil
+}
+
+// RestoreReport summarizes the restore of a backup
+type RestoreReport struct {
+	Mode              string `json:"mode"`
+	ExpensesRemoved   int    `json:"expensesRemoved"`
+	ExpensesRestored  int    `json:"expensesRestored"`
+	ExpensesUpdated   int    `json:"expensesUpdated"` // overwritten on ID conflicts
+	ExpensesSkipped   int    `json:"expensesSkipped"` // ID conflicts, or expenses of other users
+	RecurringRemoved  int    `json:"recurringRemoved"`
+	RecurringRestored int    `json:"recurringRestored"`
+	RecurringSkipped  int    `json:"recurringSkipped"`
+	RatesRestored     int    `json:"ratesRestored"`
+	RatesSkipped      int    `json:"ratesSkipped"`  // not requested, or already stored for the pair and day
+	IDsReassigned     int    `json:"idsReassigned"` // expenses and recurring expenses whose ID another ledger uses
+}
+
+// NewBackup reads the store's ledger into a backup; with a viewer, only the expenses and
+// recurring expenses visible to them are included
+func NewBackup(store Storage, viewer string) (*Backup, error) {
+	config, err := store.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %v", err)
+	}
+	expenses, err := store.GetAllExpenses()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read expenses: %v", err)
+	}
+	rates, err := store.GetConversionRates()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read conversion rates: %v", err)
+	}
+	backup := &Backup{
+		Version:   BackupVersion,
+		CreatedAt: time.Now().UTC(),
+		Config:    *config,
+		Expenses:  expenses,
+		Rates:     rates,
+	}
+	backup.KeepVisible(viewer)
+	return backup, nil
+}
+
+// KeepVisible drops the expenses and recurring expenses that the viewer cannot see
+func (b *Backup) KeepVisible(viewer string) {
+	b.Expenses = slices.DeleteFunc(b.Expenses, func(e Expense) bool { return !e.VisibleTo(viewer) })
+	b.Config.RecurringExpenses = slices.DeleteFunc(slices.Clone(b.Config.RecurringExpenses), func(r RecurringExpense) bool {
+		return !r.VisibleTo(viewer)
+	})
+}
+
+// WriteBackup writes the backup as JSON, gzipped when compress is set
+func WriteBackup(w io.Writer, backup *Backup, compress bool) error {
+	if compress {
+		gz := gzip.NewWriter(w)
+		if err := json.NewEncoder(gz).Encode(backup); err != nil {
+			return err
+		}
+		return gz.Close()
+	}
+	return json.NewEncoder(w).Encode(backup)
+}
+
+// ReadBackup reads a backup written by WriteBackup, gzipped or not
+func ReadBackup(r io.Reader) (*Backup, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress backup: %v", err)
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+	var backup Backup
+	if err := json.NewDecoder(r).Decode(&backup); err != nil {
+		return nil, fmt.Errorf("failed to parse backup: %v", err)
+	}
+	if backup.Version < 1 {
+		return nil, fmt.Errorf("not an ExpenseOwl backup")
+	}
+	if backup.Version > BackupVersion {
+		return nil, fmt.Errorf("backup version %d is newer than this release supports (%d)", backup.Version, BackupVersion)
+	}
+	return &backup, nil
+}
+
+// Validate checks and cleans everything in the backup, so that a restore fails before it
+// changes anything
+func (b *Backup) Validate() error {
+	c := &b.Config
+	for i, category := range c.Categories {
+		valid, err := ValidateCategory(category)
+		if err != nil {
+			return fmt.Errorf("category %q: %v", category, err)
+		}
+		c.Categories[i] = valid
+	}
+	currency, err := ValidateCurrency(c.Currency)
+	if err != nil {
+		return err
+	}
+	c.Currency = currency
+	if c.StartDate < 1 || c.StartDate > 31 {
+		return fmt.Errorf("invalid start date: %d", c.StartDate)
+	}
+	if c.CategoryRules, err = ValidateCategoryRules(c.CategoryRules); err != nil {
+		return err
+	}
+	for i := range c.CSVProfiles {
+		if err := c.CSVProfiles[i].Validate(); err != nil {
+			return fmt.Errorf("CSV profile %s: %v", c.CSVProfiles[i].Name, err)
+		}
+	}
+	for i := range c.RecurringExpenses {
+		if err := c.RecurringExpenses[i].Validate(); err != nil {
+			return fmt.Errorf("recurring expense %s: %v", c.RecurringExpenses[i].ID, err)
+		}
+	}
+	for i := range b.Expenses {
+		if err := b.Expenses[i].Validate(); err != nil {
+			return fmt.Errorf("expense %s: %v", b.Expenses[i].ID, err)
+		}
+	}
+	for i := range b.Rates {
+		if err := b.Rates[i].Validate(); err != nil {
+			return fmt.Errorf("conversion rate %s/%s: %v", b.Rates[i].From, b.Rates[i].To, err)
+		}
+	}
+	return nil
+}
+
+// RestoreBackup writes a backup into the store's ledger. Replacing removes the ledger's expenses
+// and recurring expenses and takes over the backup's settings; merging adds the missing
+// categories, rules, profiles and recurring expenses, and handles expenses whose ID is already
+// stored as the options say. Conversion rates are shared by all ledgers, so they are only
+// restored on request, and never replace a stored rate.
+//
+// The whole restore is planned from the backup and the stored data before anything is written:
+// IDs used by another ledger are reassigned, so the writes cannot collide. If a write still
+// fails, the ones before it are rolled back.
+func RestoreBackup(store Storage, backup *Backup, opts RestoreOptions) (*RestoreReport, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if err := backup.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid backup: %v", err)
+	}
+	plan, err := planRestore(store, backup, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := runRestoreSteps(plan.steps); err != nil {
+		return nil, err
+	}
+	report := plan.report
+	log.Printf("Restored backup (%s): %d expenses restored, %d updated, %d skipped, %d removed\n",
+		opts.Mode, report.ExpensesRestored, report.ExpensesUpdated, report.ExpensesSkipped, report.ExpensesRemoved)
+	return &report, nil
+}
+
+// restoreStep is one write of a restore and the write that reverts it
+type restoreStep struct {
+	name string
+	do   func() error
+	undo func() error // nil for steps that need no rollback
+}
+
+// runRestoreSteps runs the steps in order; when one fails, the earlier ones are undone in
+// reverse order
+func runRestoreSteps(steps []restoreStep) error {
+	for i, step := range steps {
+		err := step.do()
+		if err == nil {
+			continue
+		}
+		for j := i - 1; j >= 0; j-- {
+			if steps[j].undo == nil {
+				continue
+			}
+			if undoErr := steps[j].undo(); undoErr != nil {
+				log.Printf("Warning: failed to roll back restore step (%s): %v\n", steps[j].name, undoErr)
+			}
+		}
+		return fmt.Errorf("failed to %s: %v", step.name, err)
+	}
+	return nil
+}
+
+type restorePlan struct {
+	report RestoreReport
+	steps  []restoreStep
+}
+
+// usedIDs returns the expense and recurring expense IDs of every ledger other than the store's,
+// which the restored data must not reuse; ledger is the store's own data
+func usedIDs(store Storage, ledger []Expense, recurring []RecurringExpense) (expenses, recurringIDs map[string]bool, err error) {
+	own := make(map[string]bool, len(ledger)+len(recurring))
+	for _, e := range ledger {
+		own[e.ID] = true
+	}
+	for _, r := range recurring {
+		own[r.ID] = true
+	}
+	ledgers, err := store.GetLedgers()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list ledgers: %v", err)
+	}
+	expenses, recurringIDs = map[string]bool{}, map[string]bool{}
+	for _, l := range ledgers {
+		other, err := store.ForLedger(l.ID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open ledger %s: %v", l.ID, err)
+		}
+		otherExpenses, err := other.GetAllExpenses()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read expenses of ledger %s: %v", l.ID, err)
+		}
+		for _, e := range otherExpenses {
+			if !own[e.ID] {
+				expenses[e.ID] = true
+			}
+		}
+		otherRecurring, err := other.GetRecurringExpenses()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read recurring expenses of ledger %s: %v", l.ID, err)
+		}
+		for _, r := range otherRecurring {
+			if !own[r.ID] {
+				recurringIDs[r.ID] = true
+			}
+		}
+	}
+	return expenses, recurringIDs, nil
+}
+
+func planRestore(store Storage, backup *Backup, opts RestoreOptions) (*restorePlan, error) {
+	plan := &restorePlan{report: RestoreReport{Mode: opts.Mode}}
+	config, err := store.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %v", err)
+	}
+	existing, err := store.GetAllExpenses()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read expenses: %v", err)
+	}
+	foreignExpenses, foreignRecurring, err := usedIDs(store, existing, config.RecurringExpenses)
+	if err != nil {
+		return nil, err
+	}
+
+	// IDs taken by another ledger are replaced, and instances follow their recurring expense
+	recurringIDs := map[string]string{}
+	expenseIDs := map[string]string{}
+	recurring := slices.Clone(backup.Config.RecurringExpenses)
+	for i := range recurring {
+		if recurring[i].ID == "" || foreignRecurring[recurring[i].ID] {
+			id := uuid.New().String()
+			if recurring[i].ID != "" {
+				recurringIDs[recurring[i].ID] = id
+				plan.report.IDsReassigned++
+			}
+			recurring[i].ID = id
+		}
+	}
+	expenses := slices.Clone(backup.Expenses)
+	for i := range expenses {
+		if expenses[i].ID == "" || foreignExpenses[expenses[i].ID] {
+			id := uuid.New().String()
+			if expenses[i].ID != "" {
+				expenseIDs[expenses[i].ID] = id
+				plan.report.IDsReassigned++
+			}
+			expenses[i].ID = id
+		}
+		if id, ok := recurringIDs[expenses[i].RecurringID]; ok {
+			expenses[i].RecurringID = id
+		}
+	}
+
+	removedRecurring := planRecurring(plan, store, config.RecurringExpenses, recurring, opts)
+	planExpenses(plan, store, existing, expenses, removedRecurring, opts)
+	if err := planConfig(plan, store, config, &backup.Config, expenseIDs, opts.Mode); err != nil {
+		return nil, err
+	}
+	if opts.Rates {
+		if err := planRates(plan, store, backup.Rates); err != nil {
+			return nil, err
+		}
+	} else {
+		plan.report.RatesSkipped = len(backup.Rates)
+	}
+	return plan, nil
+}
+
+// planRecurring stores the recurring expenses as rules only, since their expenses are part of
+// the backup; recurring expenses whose ID is stored are kept unless conflicts are overwritten.
+// It returns the IDs of the removed recurring expenses.
+func planRecurring(plan *restorePlan, store Storage, existing, recurring []RecurringExpense, opts RestoreOptions) map[string]bool {
+	stored := make(map[string]bool, len(existing))
+	removed := map[string]bool{}
+	remove := func(r RecurringExpense) {
+		removed[r.ID] = true
+		plan.steps = append(plan.steps, restoreStep{
+			name: "remove recurring expense " + r.ID,
+			do:   func() error { return store.RemoveRecurringExpense(r.ID, false) },
+			undo: func() error { return store.AddRecurringExpenseRule(r) },
+		})
+	}
+	for _, r := range existing {
+		if opts.Mode == RestoreReplace && r.EditableBy(opts.User) {
+			remove(r)
+			plan.report.RecurringRemoved++
+			continue
+		}
+		stored[r.ID] = true
+	}
+	for _, r := range recurring {
+		if !r.EditableBy(opts.User) {
+			plan.report.RecurringSkipped++
+			continue
+		}
+		if stored[r.ID] {
+			i := slices.IndexFunc(existing, func(e RecurringExpense) bool { return e.ID == r.ID })
+			if opts.Mode == RestoreReplace || opts.Conflict != ConflictOverwrite || !existing[i].EditableBy(opts.User) {
+				plan.report.RecurringSkipped++
+				continue
+			}
+			remove(existing[i])
+		}
+		plan.steps = append(plan.steps, restoreStep{
+			name: "restore recurring expense " + r.ID,
+			do:   func() error { return store.AddRecurringExpenseRule(r) },
+			undo: func() error { return store.RemoveRecurringExpense(r.ID, false) },
+		})
+		plan.report.RecurringRestored++
+	}
+	return removed
+}
+
+// planExpenses removes, adds and overwrites expenses; removing a recurring expense also drops
+// its future instances, so those are removed explicitly to be able to put them back
+func planExpenses(plan *restorePlan, store Storage, existing, expenses []Expense, removedRecurring map[string]bool, opts RestoreOptions) {
+	now := time.Now()
+	stored := make(map[string]Expense, len(existing))
+	var remove []Expense
+	for _, e := range existing {
+		replaced := opts.Mode == RestoreReplace && e.EditableBy(opts.User)
+		if replaced || (removedRecurring[e.RecurringID] && e.Date.After(now)) {
+			remove = append(remove, e)
+			continue
+		}
+		stored[e.ID] = e
+	}
+	plan.report.ExpensesRemoved = len(remove)
+
+	var add, update, previous []Expense
+	seen := make(map[string]bool, len(expenses))
+	for _, e := range expenses {
+		if !e.EditableBy(opts.User) || seen[e.ID] {
+			plan.report.ExpensesSkipped++
+			continue
+		}
+		seen[e.ID] = true
+		current, ok := stored[e.ID]
+		switch {
+		case !ok:
+			add = append(add, e)
+		case opts.Mode == RestoreMerge && opts.Conflict == ConflictOverwrite && current.EditableBy(opts.User):
+			update = append(update, e)
+			previous = append(previous, current)
+		case opts.Mode == RestoreMerge && opts.Conflict == ConflictNew:
+			e.ID = uuid.New().String()
+			add = append(add, e)
+		default:
+			plan.report.ExpensesSkipped++
+		}
+	}
+	plan.report.ExpensesRestored = len(add)
+	plan.report.ExpensesUpdated = len(update)
+
+	// expenses go before the recurring steps, so recurring removals find no instances left
+	steps := []restoreStep{}
+	if len(remove) > 0 {
+		steps = append(steps, restoreStep{
+			name: "remove expenses",
+			do:   func() error { return store.RemoveMultipleExpenses(expenseIDList(remove)) },
+			undo: func() error { _, err := store.ImportExpenses(singleBatch(remove)); return err },
+		})
+	}
+	plan.steps = append(steps, plan.steps...)
+	if len(add) > 0 {
+		plan.steps = append(plan.steps, restoreStep{
+			name: "restore expenses",
+			do:   func() error { _, err := store.ImportExpenses(singleBatch(add)); return err },
+			undo: func() error { return store.RemoveMultipleExpenses(expenseIDList(add)) },
+		})
+	}
+	if len(update) > 0 {
+		plan.steps = append(plan.steps, restoreStep{
+			name: "overwrite expenses",
+			do:   func() error { return store.UpdateMultipleExpenses(update) },
+			undo: func() error { return store.UpdateMultipleExpenses(previous) },
+		})
+	}
+}
+
+func expenseIDList(expenses []Expense) []string {
+	ids := make([]string, len(expenses))
+	for i, e := range expenses {
+		ids[i] = e.ID
+	}
+	return ids
+}
+
+// planConfig restores the settings after the expenses, as each setter is its own write
+func planConfig(plan *restorePlan, store Storage, dst, src *Config, expenseIDs map[string]string, mode string) error {
+	categories, rules := src.Categories, src.CategoryRules
+	var saveProfiles, removeProfiles []CSVProfile
+	if mode == RestoreMerge {
+		categories = slices.Clone(dst.Categories)
+		for _, category := range src.Categories {
+			if !slices.ContainsFunc(categories, func(c string) bool { return strings.EqualFold(c, category) }) {
+				categories = append(categories, category)
+			}
+		}
+		rules = slices.Clone(dst.CategoryRules)
+		for _, rule := range src.CategoryRules {
+			if !slices.ContainsFunc(rules, func(r CategoryRule) bool { return reflect.DeepEqual(r, rule) }) {
+				rules = append(rules, rule)
+			}
+		}
+		for _, profile := range src.CSVProfiles {
+			if !slices.ContainsFunc(dst.CSVProfiles, func(p CSVProfile) bool { return strings.EqualFold(p.Name, profile.Name) }) {
+				saveProfiles = append(saveProfiles, profile)
+			}
+		}
+	} else {
+		currency, startDate := dst.Currency, dst.StartDate
+		plan.steps = append(plan.steps,
+			restoreStep{
+				name: "restore currency",
+				do:   func() error { return store.UpdateCurrency(src.Currency) },
+				undo: func() error { return store.UpdateCurrency(currency) },
+			},
+			restoreStep{
+				name: "restore start date",
+				do:   func() error { return store.UpdateStartDate(src.StartDate) },
+				undo: func() error { return store.UpdateStartDate(startDate) },
+			})
+		saveProfiles = src.CSVProfiles
+		for _, profile := range dst.CSVProfiles {
+			if !slices.ContainsFunc(src.CSVProfiles, func(p CSVProfile) bool { return strings.EqualFold(p.Name, profile.Name) }) {
+				removeProfiles = append(removeProfiles, profile)
+			}
+		}
+	}
+	// rules are checked here too, since a merge combines them with the stored ones
+	rules, err := ValidateCategoryRules(rules)
+	if err != nil {
+		return fmt.Errorf("invalid category rules: %v", err)
+	}
+	previousCategories, previousRules := dst.Categories, dst.CategoryRules
+	plan.steps = append(plan.steps,
+		restoreStep{
+			name: "restore categories",
+			do:   func() error { return store.UpdateCategories(categories) },
+			undo: func() error { return store.UpdateCategories(previousCategories) },
+		},
+		restoreStep{
+			name: "restore category rules",
+			do:   func() error { return store.UpdateCategoryRules(rules) },
+			undo: func() error { return store.UpdateCategoryRules(previousRules) },
+		})
+	for _, profile := range removeProfiles {
+		plan.steps = append(plan.steps, restoreStep{
+			name: "remove CSV profile " + profile.Name,
+			do:   func() error { return store.RemoveCSVProfile(profile.Name) },
+			undo: func() error { return store.SaveCSVProfile(profile) },
+		})
+	}
+	for _, profile := range saveProfiles {
+		i := slices.IndexFunc(dst.CSVProfiles, func(p CSVProfile) bool { return strings.EqualFold(p.Name, profile.Name) })
+		undo := func() error { return store.RemoveCSVProfile(profile.Name) }
+		if i >= 0 {
+			previous := dst.CSVProfiles[i]
+			undo = func() error { return store.SaveCSVProfile(previous) }
+		}
+		plan.steps = append(plan.steps, restoreStep{
+			name: "restore CSV profile " + profile.Name,
+			do:   func() error { return store.SaveCSVProfile(profile) },
+			undo: undo,
+		})
+	}
+	// dismissed pairs only hide duplicate warnings, so they are added last and not rolled back
+	for _, key := range src.DismissedDuplicates {
+		ids := strings.Split(key, "|")
+		for i, id := range ids {
+			if renamed, ok := expenseIDs[id]; ok {
+				ids[i] = renamed
+			}
+		}
+		plan.steps = append(plan.steps, restoreStep{
+			name: "restore dismissed duplicates",
+			do:   func() error { return store.DismissDuplicates(ids) },
+		})
+	}
+	return nil
+}
+
+// planRates adds the backup's rates for pairs and days that have none, keeping stored rates
+func planRates(plan *restorePlan, store Storage, rates []ConversionRate) error {
+	stored, err := store.GetConversionRates()
+	if err != nil {
+		return fmt.Errorf("failed to read conversion rates: %v", err)
+	}
+	keys := make(map[rateKey]bool, len(stored))
+	for _, rate := range stored {
+		keys[rate.key()] = true
+	}
+	var add []ConversionRate
+	for _, rate := range rates {
+		if keys[rate.key()] {
+			plan.report.RatesSkipped++
+			continue
+		}
+		keys[rate.key()] = true
+		add = append(add, rate)
+	}
+	plan.report.RatesRestored = len(add)
+	if len(add) == 0 {
+		return nil
+	}
+	plan.steps = append(plan.steps, restoreStep{
+		name: "restore conversion rates",
+		do:   func() error { return store.SaveConversionRates(add) },
+		undo: func() error {
+			for _, rate := range add {
+				if err := store.RemoveConversionRate(rate.From, rate.To, rate.EffectiveDate); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+	return nil
+}
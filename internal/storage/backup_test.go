@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func openBackupTestStore(t *testing.T) Storage {
+	t.Helper()
+	store, err := InitializeSQLiteStore(SystemConfig{StorageType: BackendTypeSQLite, StorageURL: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// testBackends opens an empty store of each backend that runs without a server
+var testBackends = map[string]func(t *testing.T) Storage{
+	"sqlite": openBackupTestStore,
+	"json": func(t *testing.T) Storage {
+		store, err := InitializeJsonStore(SystemConfig{StorageType: BackendTypeJSON, StorageURL: t.TempDir()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	},
+}
+
+func TestRestoreBackupIntoAnotherLedger(t *testing.T) {
+	store := openBackupTestStore(t)
+	expense := Expense{
+		ID:       "e1",
+		Name:     "Rent",
+		Category: "Rent",
+		Amount:   -900,
+		Currency: "usd",
+		Date:     time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if err := store.AddExpense(expense); err != nil {
+		t.Fatal(err)
+	}
+	rate := ConversionRate{From: "usd", To: "eur", Rate: 0.9, EffectiveDate: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)}
+	if err := store.SaveConversionRates([]ConversionRate{rate}); err != nil {
+		t.Fatal(err)
+	}
+	backup, err := NewBackup(store, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddLedger(Ledger{ID: "biz", Name: "Business"}); err != nil {
+		t.Fatal(err)
+	}
+	biz, err := store.ForLedger("biz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the backup's rate differs from the stored one, which must be kept
+	backup.Rates[0].Rate = 2
+	for _, mode := range []string{RestoreMerge, RestoreReplace} {
+		report, err := RestoreBackup(biz, backup, RestoreOptions{Mode: mode, Rates: true})
+		if err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+		if report.ExpensesRestored != 1 || report.IDsReassigned != 1 {
+			t.Errorf("%s: restored %d, reassigned %d IDs, want 1 and 1", mode, report.ExpensesRestored, report.IDsReassigned)
+		}
+		if report.RatesRestored != 0 || report.RatesSkipped != 1 {
+			t.Errorf("%s: restored %d rates, skipped %d, want 0 and 1", mode, report.RatesRestored, report.RatesSkipped)
+		}
+	}
+
+	restored, err := biz.GetAllExpenses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored) != 1 || restored[0].ID == expense.ID || restored[0].Name != expense.Name {
+		t.Errorf("ledger biz holds %+v, want one copy of %q under a new ID", restored, expense.Name)
+	}
+	original, err := store.GetExpense(expense.ID)
+	if err != nil || original.Name != expense.Name {
+		t.Errorf("default ledger lost its expense: %+v, %v", original, err)
+	}
+	rates, err := store.GetConversionRates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rates) != 1 || rates[0].Rate != rate.Rate {
+		t.Errorf("stored rates changed to %+v", rates)
+	}
+}
+
+func TestRestoreBackupSkipsRatesByDefault(t *testing.T) {
+	store := openBackupTestStore(t)
+	backup := &Backup{
+		Version: BackupVersion,
+		Config:  Config{Categories: []string{"Food"}, Currency: "usd", StartDate: 1},
+		Rates:   []ConversionRate{{From: "usd", To: "eur", Rate: 0.9, EffectiveDate: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)}},
+	}
+	report, err := RestoreBackup(store, backup, RestoreOptions{Mode: RestoreMerge})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rates, err := store.GetConversionRates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rates) != 0 || report.RatesSkipped != 1 {
+		t.Errorf("rates were restored without being requested: %+v", rates)
+	}
+}
+
+func TestRunRestoreStepsRollsBack(t *testing.T) {
+	var done []string
+	step := func(name string, fail bool) restoreStep {
+		return restoreStep{
+			name: name,
+			do: func() error {
+				if fail {
+					return errors.New("step failed")
+				}
+				done = append(done, name)
+				return nil
+			},
+			undo: func() error {
+				done = append(done, "undo "+name)
+				return nil
+			},
+		}
+	}
+	err := runRestoreSteps([]restoreStep{step("a", false), step("b", false), step("c", true)})
+	if err == nil {
+		t.Fatal("expected the failing step's error")
+	}
+	if want := []string{"a", "b", "undo b", "undo a"}; !slices.Equal(done, want) {
+		t.Errorf("ran %v, want %v", done, want)
+	}
+}
@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// CategoryRule changes expenses that match all of its conditions; empty conditions match
+// everything. Rules are applied in order: every matching rule adds its tags, and the first
+// matching rule that sets the category or the name wins. Rules saved before conditions and
+// actions were added only have Match and Category and keep working.
+type CategoryRule struct {
+	// conditions
+	Match     string   `json:"match,omitempty"`     // name contains, ignoring case
+	Pattern   string   `json:"pattern,omitempty"`   // name regular expression, e.g., "(?i)^amzn mktp"
+	MinAmount *float64 `json:"minAmount,omitempty"` // inclusive, signed like the amount
+	MaxAmount *float64 `json:"maxAmount,omitempty"`
+	Currency  string   `json:"currency,omitempty"`
+	Source    string   `json:"source,omitempty"` // see Expense.FromSource
+
+	// actions
+	Category string   `json:"category,omitempty"`
+	Tags     []string `json:"tags,omitempty"` // added to the expense's tags
+	Rename   string   `json:"rename,omitempty"`
+	Income   bool     `json:"income,omitempty"` // makes the amount positive
+
+	OnAdd bool `json:"onAdd,omitempty"` // also applied to expenses added by hand, not only imported ones
+}
+
+// categories of imported expenses that match no rule
+const (
+	importIncomeCategory  = "Income"
+	importExpenseCategory = "Miscellaneous"
+)
+
+func ValidateCategoryRules(rules []CategoryRule) ([]CategoryRule, error) {
+	cleaned := make([]CategoryRule, 0, len(rules))
+	for i, rule := range rules {
+		rule.Match = strings.TrimSpace(rule.Match)
+		rule.Pattern = strings.TrimSpace(rule.Pattern)
+		rule.Source = strings.ToLower(strings.TrimSpace(rule.Source))
+		rule.Category = SanitizeString(rule.Category)
+		rule.Rename = SanitizeString(rule.Rename)
+		if rule.Match == "" && rule.Pattern == "" && rule.MinAmount == nil && rule.MaxAmount == nil && rule.Currency == "" && rule.Source == "" {
+			return nil, fmt.Errorf("rule %d: needs at least one condition", i+1)
+		}
+		if rule.Pattern != "" {
+			if _, err := regexp.Compile(rule.Pattern); err != nil {
+				return nil, fmt.Errorf("rule %d: invalid pattern: %v", i+1, err)
+			}
+		}
+		if rule.MinAmount != nil && rule.MaxAmount != nil && *rule.MinAmount > *rule.MaxAmount {
+			return nil, fmt.Errorf("rule %d: 'minAmount' is greater than 'maxAmount'", i+1)
+		}
+		if rule.Currency != "" {
+			currency, err := ValidateCurrency(rule.Currency)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: %v", i+1, err)
+			}
+			rule.Currency = currency
+		}
+		var tags []string
+		for _, tag := range rule.Tags {
+			if tag = SanitizeString(tag); tag != "" && !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+		rule.Tags = tags
+		if rule.Category == "" && len(rule.Tags) == 0 && rule.Rename == "" && !rule.Income {
+			return nil, fmt.Errorf("rule %d: needs at least one action", i+1)
+		}
+		cleaned = append(cleaned, rule)
+	}
+	return cleaned, nil
+}
+
+// FromSource reports whether the expense came from a source: an import format, optionally with
+// the account or CSV profile, like "ofx", "ofx:123456" or "csv:My Bank", matched against its
+// bank reference; "manual" is every expense without one
+func (e Expense) FromSource(source string) bool {
+	if source == "manual" {
+		return e.ExternalID == ""
+	}
+	return strings.HasPrefix(strings.ToLower(e.ExternalID), source+":")
+}
+
+// RuleEngine applies rules to expenses, with their patterns compiled once
+type RuleEngine struct {
+	rules    []CategoryRule
+	patterns []*regexp.Regexp
+}
+
+// NewRuleEngine prepares rules for applying; rules are validated when saved, so a pattern that
+// does not compile never matches
+func NewRuleEngine(rules []CategoryRule) *RuleEngine {
+	e := &RuleEngine{rules: rules, patterns: make([]*regexp.Regexp, len(rules))}
+	for i, rule := range rules {
+		if rule.Pattern != "" {
+			e.patterns[i], _ = regexp.Compile(rule.Pattern)
+		}
+	}
+	return e
+}
+
+func (e *RuleEngine) matches(i int, expense Expense) bool {
+	rule := e.rules[i]
+	if rule.Match != "" && !strings.Contains(strings.ToLower(expense.Name), strings.ToLower(rule.Match)) {
+		return false
+	}
+	if rule.Pattern != "" && (e.patterns[i] == nil || !e.patterns[i].MatchString(expense.Name)) {
+		return false
+	}
+	if (rule.MinAmount != nil && expense.Amount < *rule.MinAmount) || (rule.MaxAmount != nil && expense.Amount > *rule.MaxAmount) {
+		return false
+	}
+	if rule.Currency != "" && !strings.EqualFold(rule.Currency, expense.Currency) {
+		return false
+	}
+	return rule.Source == "" || expense.FromSource(rule.Source)
+}
+
+// Apply returns the expense changed by the matching rules, and whether any rule matched; the
+// conditions are checked against the expense as given. With onAdd, only rules marked OnAdd apply.
+func (e *RuleEngine) Apply(expense Expense, onAdd bool) (Expense, bool) {
+	matched, categorized, renamed := false, false, false
+	original := expense
+	expense.Tags = slices.Clone(expense.Tags)
+	for i, rule := range e.rules {
+		if (onAdd && !rule.OnAdd) || !e.matches(i, original) {
+			continue
+		}
+		matched = true
+		if rule.Category != "" && !categorized {
+			expense.Category, categorized = rule.Category, true
+		}
+		if rule.Rename != "" && !renamed {
+			expense.Name, renamed = rule.Rename, true
+		}
+		for _, tag := range rule.Tags {
+			if !slices.Contains(expense.Tags, tag) {
+				expense.Tags = append(expense.Tags, tag)
+			}
+		}
+		if rule.Income {
+			expense.Amount = math.Abs(expense.Amount)
+		}
+	}
+	return expense, matched
+}
+
+// FallbackCategory is the category of imported expenses that no rule categorizes
+func FallbackCategory(amount float64) string {
+	if amount > 0 {
+		return importIncomeCategory
+	}
+	return importExpenseCategory
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRuleEngineApply(t *testing.T) {
+	amount := func(v float64) *float64 { return &v }
+	tests := []struct {
+		name    string
+		rules   []CategoryRule
+		expense Expense
+		onAdd   bool
+		want    Expense
+		matched bool
+	}{
+		{
+			name:    "legacy rule with only match and category",
+			rules:   []CategoryRule{{Match: "netflix", Category: "Subscriptions"}},
+			expense: Expense{Name: "NETFLIX.COM 4711", Amount: -12.99},
+			want:    Expense{Name: "NETFLIX.COM 4711", Category: "Subscriptions", Amount: -12.99},
+			matched: true,
+		},
+		{
+			name: "first category and rename win",
+			rules: []CategoryRule{
+				{Match: "rewe", Category: "Groceries", Rename: "REWE"},
+				{Pattern: "(?i)markt", Category: "Food", Rename: "Supermarket"},
+			},
+			expense: Expense{Name: "Rewe Markt Koeln", Amount: -23.4},
+			want:    Expense{Name: "REWE", Category: "Groceries", Amount: -23.4},
+			matched: true,
+		},
+		{
+			name: "later rule sets what earlier ones leave",
+			rules: []CategoryRule{
+				{Match: "rewe", Rename: "REWE"},
+				{Match: "rewe", Category: "Groceries", Rename: "Supermarket"},
+			},
+			expense: Expense{Name: "Rewe Markt Koeln", Amount: -23.4},
+			want:    Expense{Name: "REWE", Category: "Groceries", Amount: -23.4},
+			matched: true,
+		},
+		{
+			name: "tags add up without repeats",
+			rules: []CategoryRule{
+				{Match: "amazon", Tags: []string{"online"}},
+				{MaxAmount: amount(-100), Tags: []string{"large", "online"}},
+			},
+			expense: Expense{Name: "Amazon", Amount: -150, Tags: []string{"gift"}},
+			want:    Expense{Name: "Amazon", Amount: -150, Tags: []string{"gift", "online", "large"}},
+			matched: true,
+		},
+		{
+			name: "conditions see the expense as given",
+			rules: []CategoryRule{
+				{Match: "amzn", Rename: "Amazon"},
+				{Match: "amazon", Category: "Shopping"},
+			},
+			expense: Expense{Name: "AMZN Mktp", Amount: -20},
+			want:    Expense{Name: "Amazon", Amount: -20},
+			matched: true,
+		},
+		{
+			name:    "income makes the amount positive",
+			rules:   []CategoryRule{{Match: "refund", Category: "Income", Income: true}},
+			expense: Expense{Name: "Refund order 12", Amount: -30},
+			want:    Expense{Name: "Refund order 12", Category: "Income", Amount: 30},
+			matched: true,
+		},
+		{
+			name: "amount range and currency",
+			rules: []CategoryRule{
+				{MinAmount: amount(-50), MaxAmount: amount(-10), Currency: "usd", Category: "Dining"},
+			},
+			expense: Expense{Name: "Diner", Amount: -60, Currency: "usd"},
+			want:    Expense{Name: "Diner", Amount: -60, Currency: "usd"},
+			matched: false,
+		},
+		{
+			name: "source of the bank reference",
+			rules: []CategoryRule{
+				{Source: "manual", Tags: []string{"by hand"}},
+				{Source: "csv:my bank", Tags: []string{"bank"}},
+				{Source: "ofx", Tags: []string{"ofx"}},
+			},
+			expense: Expense{Name: "Rent", Amount: -900, ExternalID: "csv:My Bank:R1"},
+			want:    Expense{Name: "Rent", Amount: -900, ExternalID: "csv:My Bank:R1", Tags: []string{"bank"}},
+			matched: true,
+		},
+		{
+			name: "manual source",
+			rules: []CategoryRule{
+				{Source: "manual", Tags: []string{"by hand"}},
+				{Source: "ofx", Tags: []string{"ofx"}},
+			},
+			expense: Expense{Name: "Rent", Amount: -900},
+			want:    Expense{Name: "Rent", Amount: -900, Tags: []string{"by hand"}},
+			matched: true,
+		},
+		{
+			name: "only rules marked onAdd apply to added expenses",
+			rules: []CategoryRule{
+				{Match: "coffee", Category: "Food"},
+				{Match: "coffee", Tags: []string{"caffeine"}, OnAdd: true},
+			},
+			expense: Expense{Name: "Coffee", Amount: -3.5},
+			onAdd:   true,
+			want:    Expense{Name: "Coffee", Amount: -3.5, Tags: []string{"caffeine"}},
+			matched: true,
+		},
+	}
+	for _, tt := range tests {
+		got, matched := NewRuleEngine(tt.rules).Apply(tt.expense, tt.onAdd)
+		if matched != tt.matched || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Apply = %+v, %v, want %+v, %v", tt.name, got, matched, tt.want, tt.matched)
+		}
+	}
+
+	// the given expense's tags are not changed
+	expense := Expense{Name: "Amazon", Tags: make([]string, 1, 4)}
+	NewRuleEngine([]CategoryRule{{Match: "amazon", Tags: []string{"online"}}}).Apply(expense, false)
+	if tags := expense.Tags[:2]; tags[1] != "" {
+		t.Errorf("Apply wrote to the tags of the given expense: %q", tags)
+	}
+}
+
+func TestValidateCategoryRules(t *testing.T) {
+	amount := func(v float64) *float64 { return &v }
+	tests := []struct {
+		name string
+		rule CategoryRule
+		want CategoryRule
+		err  string
+	}{
+		{
+			name: "cleaned",
+			rule: CategoryRule{Match: " rewe ", Source: " CSV:My Bank ", Currency: "EUR", Category: " Groceries ", Tags: []string{"food", " food", ""}},
+			want: CategoryRule{Match: "rewe", Source: "csv:my bank", Currency: "eur", Category: "Groceries", Tags: []string{"food"}},
+		},
+		{name: "legacy", rule: CategoryRule{Match: "netflix", Category: "Subscriptions"}, want: CategoryRule{Match: "netflix", Category: "Subscriptions"}},
+		{name: "income only", rule: CategoryRule{Source: "ofx", Income: true}, want: CategoryRule{Source: "ofx", Income: true}},
+		{name: "no condition", rule: CategoryRule{Category: "Food"}, err: "needs at least one condition"},
+		{name: "no action", rule: CategoryRule{Match: "rewe", Tags: []string{" "}}, err: "needs at least one action"},
+		{name: "invalid pattern", rule: CategoryRule{Pattern: "(rewe", Category: "Food"}, err: "invalid pattern"},
+		{name: "empty range", rule: CategoryRule{MinAmount: amount(10), MaxAmount: amount(5), Category: "Food"}, err: "'minAmount' is greater than 'maxAmount'"},
+		{name: "unknown currency", rule: CategoryRule{Currency: "xyz", Category: "Food"}, err: "invalid currency"},
+	}
+	for _, tt := range tests {
+		rules, err := ValidateCategoryRules([]CategoryRule{{Match: "ok", Category: "Food"}, tt.rule})
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), "rule 2: "+tt.err) {
+				t.Errorf("%s: err = %v, want rule 2: %s", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(rules[1], tt.want) {
+			t.Errorf("%s: rule = %+v, want %+v", tt.name, rules[1], tt.want)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// CopyReport summarizes a copy between two storage backends
+type CopyReport struct {
+	RecurringCopied  int     `json:"recurringCopied"`
+	RecurringSkipped int     `json:"recurringSkipped"`
+	ExpensesCopied   int     `json:"expensesCopied"`
+	ExpensesSkipped  int     `json:"expensesSkipped"`
+	UsersCopied      int     `json:"usersCopied"`
+	LedgersCopied    int     `json:"ledgersCopied"`
+	RatesCopied      int     `json:"ratesCopied"`
+	IDsReassigned    int     `json:"idsReassigned"` // expenses and recurring expenses whose ID another ledger uses
+	SourceCount      int     `json:"sourceCount"`
+	SourceSum        float64 `json:"sourceSum"`
+	DestinationSum   float64 `json:"destinationSum"`
+}
+
+// CopyStorage copies every ledger with its config, recurring rules and expenses from src
+// to dst, keeping IDs and recurring links, followed by conversion rates, users and tokens. A non-empty
+// destination ledger is refused unless force is set, in which case records whose ID already
+// exists in the destination ledger are skipped and records whose ID another destination ledger
+// uses get a new one. Each ledger is verified after it is copied.
+func CopyStorage(src, dst Storage, force bool) (*CopyReport, error) {
+	ledgers, err := src.GetLedgers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read source ledgers: %v", err)
+	}
+	// check every ledger up front so a refused copy writes nothing
+	if !force {
+		for _, ledger := range ledgers {
+			if _, err := dst.GetLedger(ledger.ID); err != nil {
+				continue
+			}
+			dstLedger, err := dst.ForLedger(ledger.ID)
+			if err != nil {
+				return nil, err
+			}
+			if err := requireEmpty(dstLedger); err != nil {
+				return nil, fmt.Errorf("ledger %s: %v", ledger.ID, err)
+			}
+		}
+	}
+	report := &CopyReport{}
+	for _, ledger := range ledgers {
+		existing, err := dst.GetLedger(ledger.ID)
+		if err != nil {
+			err = dst.AddLedger(ledger)
+		} else if existing.Name != ledger.Name || existing.Archived != ledger.Archived {
+			err = dst.UpdateLedger(ledger)
+		}
+		if err != nil {
+			return report, fmt.Errorf("failed to copy ledger %s: %v", ledger.ID, err)
+		}
+		srcLedger, err := src.ForLedger(ledger.ID)
+		if err != nil {
+			return report, err
+		}
+		dstLedger, err := dst.ForLedger(ledger.ID)
+		if err != nil {
+			return report, err
+		}
+		if err := copyLedger(srcLedger, dstLedger, report); err != nil {
+			return report, fmt.Errorf("ledger %s: %v", ledger.ID, err)
+		}
+		report.LedgersCopied++
+	}
+	if err := copyRates(src, dst, report); err != nil {
+		return report, err
+	}
+	return report, copyAuth(src, dst, report)
+}
+
+func requireEmpty(dst Storage) error {
+	dstExpenses, err := dst.GetAllExpenses()
+	if err != nil {
+		return fmt.Errorf("failed to read destination expenses: %v", err)
+	}
+	dstRecurring, err := dst.GetRecurringExpenses()
+	if err != nil {
+		return fmt.Errorf("failed to read destination recurring expenses: %v", err)
+	}
+	if len(dstExpenses) > 0 || len(dstRecurring) > 0 {
+		return fmt.Errorf("destination is not empty (%d expenses, %d recurring expenses), use force to write anyway", len(dstExpenses), len(dstRecurring))
+	}
+	return nil
+}
+
+// copyLedger copies the data of one ledger and adds its counts to report
+func copyLedger(src, dst Storage, report *CopyReport) error {
+	dstExpenses, err := dst.GetAllExpenses()
+	if err != nil {
+		return fmt.Errorf("failed to read destination expenses: %v", err)
+	}
+	dstRecurring, err := dst.GetRecurringExpenses()
+	if err != nil {
+		return fmt.Errorf("failed to read destination recurring expenses: %v", err)
+	}
+	// database backends use expense IDs as global keys, so IDs of other ledgers are replaced
+	foreignExpenses, foreignRecurring, err := usedIDs(dst, dstExpenses, dstRecurring)
+	if err != nil {
+		return err
+	}
+
+	srcConfig, err := src.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to read source config: %v", err)
+	}
+	if err := dst.UpdateCategories(srcConfig.Categories); err != nil {
+		return fmt.Errorf("failed to copy categories: %v", err)
+	}
+	if err := dst.UpdateCurrency(srcConfig.Currency); err != nil {
+		return fmt.Errorf("failed to copy currency: %v", err)
+	}
+	if err := dst.UpdateStartDate(srcConfig.StartDate); err != nil {
+		return fmt.Errorf("failed to copy start date: %v", err)
+	}
+	if err := dst.UpdateCategoryRules(srcConfig.CategoryRules); err != nil {
+		return fmt.Errorf("failed to copy category rules: %v", err)
+	}
+	for _, profile := range srcConfig.CSVProfiles {
+		if err := dst.SaveCSVProfile(profile); err != nil {
+			return fmt.Errorf("failed to copy CSV profile %s: %v", profile.Name, err)
+		}
+	}
+	log.Println("Copied config")
+	recurringBefore := report.RecurringCopied
+
+	existingRecurring := make(map[string]struct{}, len(dstRecurring))
+	for _, r := range dstRecurring {
+		existingRecurring[r.ID] = struct{}{}
+	}
+	srcRecurring, err := src.GetRecurringExpenses()
+	if err != nil {
+		return fmt.Errorf("failed to read source recurring expenses: %v", err)
+	}
+	recurringIDs := map[string]string{}
+	for _, r := range srcRecurring {
+		if _, ok := existingRecurring[r.ID]; ok {
+			report.RecurringSkipped++
+			continue
+		}
+		if foreignRecurring[r.ID] {
+			id := uuid.New().String()
+			recurringIDs[r.ID] = id
+			r.ID = id
+			report.IDsReassigned++
+		}
+		if err := dst.AddRecurringExpenseRule(r); err != nil {
+			return fmt.Errorf("failed to copy recurring expense %s: %v", r.ID, err)
+		}
+		report.RecurringCopied++
+	}
+	log.Printf("Copied %d recurring expenses\n", report.RecurringCopied-recurringBefore)
+
+	existingExpenses := make(map[string]struct{}, len(dstExpenses))
+	for _, e := range dstExpenses {
+		existingExpenses[e.ID] = struct{}{}
+	}
+	srcExpenses, err := src.GetAllExpenses()
+	if err != nil {
+		return fmt.Errorf("failed to read source expenses: %v", err)
+	}
+	var toCopy []Expense
+	expenseIDs := map[string]string{}
+	for _, e := range srcExpenses {
+		if _, ok := existingExpenses[e.ID]; ok {
+			report.ExpensesSkipped++
+			continue
+		}
+		if foreignExpenses[e.ID] {
+			id := uuid.New().String()
+			expenseIDs[e.ID] = id
+			e.ID = id
+			report.IDsReassigned++
+		}
+		if id, ok := recurringIDs[e.RecurringID]; ok {
+			e.RecurringID = id
+		}
+		toCopy = append(toCopy, e)
+	}
+	if err := dst.AddMultipleExpenses(toCopy); err != nil {
+		return fmt.Errorf("failed to copy expenses: %v", err)
+	}
+	report.ExpensesCopied += len(toCopy)
+	log.Printf("Copied %d expenses\n", len(toCopy))
+
+	// dismissed pairs follow their expenses to reassigned IDs
+	for _, key := range srcConfig.DismissedDuplicates {
+		ids := strings.Split(key, "|")
+		for i, id := range ids {
+			if newID, ok := expenseIDs[id]; ok {
+				ids[i] = newID
+			}
+		}
+		if err := dst.DismissDuplicates(ids); err != nil {
+			return fmt.Errorf("failed to copy dismissed duplicates: %v", err)
+		}
+	}
+
+	return verifyCopy(srcExpenses, expenseIDs, dst, report)
+}
+
+// copies all conversion rates, replacing rates of the same pair and day in dst
+func copyRates(src, dst Storage, report *CopyReport) error {
+	rates, err := src.GetConversionRates()
+	if err != nil {
+		return fmt.Errorf("failed to read source conversion rates: %v", err)
+	}
+	if len(rates) == 0 {
+		return nil
+	}
+	if err := dst.SaveConversionRates(rates); err != nil {
+		return fmt.Errorf("failed to copy conversion rates: %v", err)
+	}
+	report.RatesCopied = len(rates)
+	if report.RatesCopied > 0 {
+		log.Printf("Copied %d conversion rates\n", report.RatesCopied)
+	}
+	return nil
+}
+
+// copies users that do not exist in dst yet, with their unexpired tokens
+func copyAuth(src, dst Storage, report *CopyReport) error {
+	users, err := src.GetUsers()
+	if err != nil {
+		return fmt.Errorf("failed to read source users: %v", err)
+	}
+	for _, user := range users {
+		if _, err := dst.GetUser(user.Username); err == nil {
+			continue
+		}
+		if err := dst.SaveUser(user); err != nil {
+			return fmt.Errorf("failed to copy user %s: %v", user.Username, err)
+		}
+		tokens, err := src.GetAuthTokens(user.Username)
+		if err != nil {
+			return fmt.Errorf("failed to read tokens of %s: %v", user.Username, err)
+		}
+		for _, token := range tokens {
+			if token.Expired() {
+				continue
+			}
+			if err := dst.AddAuthToken(token); err != nil {
+				return fmt.Errorf("failed to copy token %s: %v", token.ID, err)
+			}
+		}
+		report.UsersCopied++
+	}
+	if report.UsersCopied > 0 {
+		log.Printf("Copied %d users\n", report.UsersCopied)
+	}
+	return nil
+}
+
+// checks that every source expense exists in dst, under its new ID if it was reassigned, and
+// that counts and sums agree
+func verifyCopy(srcExpenses []Expense, reassigned map[string]string, dst Storage, report *CopyReport) error {
+	dstExpenses, err := dst.GetAllExpenses()
+	if err != nil {
+		return fmt.Errorf("failed to read destination expenses for verification: %v", err)
+	}
+	dstByID := make(map[string]Expense, len(dstExpenses))
+	for _, e := range dstExpenses {
+		dstByID[e.ID] = e
+	}
+	// sums are compared in cents since Postgres stores amounts as NUMERIC(10, 2)
+	var srcCents, dstCents int64
+	var missing int
+	for _, e := range srcExpenses {
+		srcCents += int64(math.Round(e.Amount * 100))
+		id := e.ID
+		if newID, ok := reassigned[id]; ok {
+			id = newID
+		}
+		d, ok := dstByID[id]
+		if !ok {
+			missing++
+			continue
+		}
+		dstCents += int64(math.Round(d.Amount * 100))
+	}
+	report.SourceCount += len(srcExpenses)
+	report.SourceSum = roundCents(report.SourceSum + float64(srcCents)/100)
+	report.DestinationSum = roundCents(report.DestinationSum + float64(dstCents)/100)
+	if missing > 0 {
+		return fmt.Errorf("verification failed: %d of %d expenses missing in destination", missing, len(srcExpenses))
+	}
+	if srcCents != dstCents {
+		return fmt.Errorf("verification failed: source sum %.2f does not match destination sum %.2f", float64(srcCents)/100, float64(dstCents)/100)
+	}
+	return nil
+}
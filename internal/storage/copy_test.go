@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCopyStorageReassignsIDsOfOtherLedgers(t *testing.T) {
+	src := openBackupTestStore(t)
+	dst := openBackupTestStore(t)
+	date := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	rule := RecurringExpense{ID: "r1", Name: "Rent", Category: "Rent", Amount: -900, StartDate: date, Interval: "monthly", Occurrences: 2}
+	if err := src.AddRecurringExpenseRule(rule); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.AddMultipleExpenses([]Expense{
+		{ID: "e1", Name: "Rent", Category: "Rent", Amount: -900, Date: date, RecurringID: "r1"},
+		{ID: "e2", Name: "Coffee", Category: "Food", Amount: -3.5, Date: date},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// another destination ledger already uses the IDs e1 and r1
+	if err := dst.AddLedger(Ledger{ID: "biz", Name: "Business"}); err != nil {
+		t.Fatal(err)
+	}
+	biz, err := dst.ForLedger("biz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := biz.AddRecurringExpenseRule(rule); err != nil {
+		t.Fatal(err)
+	}
+	if err := biz.AddMultipleExpenses([]Expense{{ID: "e1", Name: "Invoice", Category: "Income", Amount: 100, Date: date}}); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := CopyStorage(src, dst, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.ExpensesCopied != 2 || report.IDsReassigned != 2 {
+		t.Errorf("copied %d expenses and reassigned %d IDs, want 2 and 2", report.ExpensesCopied, report.IDsReassigned)
+	}
+	recurring, err := dst.GetRecurringExpenses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recurring) != 1 || recurring[0].ID == "r1" {
+		t.Fatalf("recurring expenses = %+v, want one with a new ID", recurring)
+	}
+	expenses, err := dst.GetAllExpenses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range expenses {
+		switch e.Name {
+		case "Rent":
+			if e.ID == "e1" || e.RecurringID != recurring[0].ID {
+				t.Errorf("rent has ID %q and recurring ID %q, want a new ID linked to %q", e.ID, e.RecurringID, recurring[0].ID)
+			}
+		case "Coffee":
+			if e.ID != "e2" {
+				t.Errorf("coffee has ID %q, want e2 kept", e.ID)
+			}
+		}
+	}
+	if kept, err := biz.GetExpense("e1"); err != nil || kept.Name != "Invoice" {
+		t.Errorf("ledger biz lost expense e1: %+v %v", kept, err)
+	}
+}
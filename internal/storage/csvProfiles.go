@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// CSVProfile describes the CSV export of one bank, so its files can be imported without editing
+type CSVProfile struct {
+	Name      string     `json:"name"`
+	Columns   CSVColumns `json:"columns"`
+	Delimiter string     `json:"delimiter"` // defaults to a comma, \t for tabs
+	Decimal   string     `json:"decimal"`   // decimal separator, defaults to a dot
+	Thousands string     `json:"thousands"` // thousands separator, removed from amounts
+	// DateLayout is written with YYYY, YY, MM, M, DD and D (e.g., DD.MM.YYYY); empty for the
+	// formats the plain CSV import accepts
+	DateLayout string `json:"dateLayout"`
+	InvertSign bool   `json:"invertSign"` // for exports where spending is positive
+	SkipRows   int    `json:"skipRows"`   // lines before the header row, like account details
+	NoHeader   bool   `json:"noHeader"`   // columns are then given by number, starting at 1
+	Encoding   string `json:"encoding"`   // utf-8 (default), iso-8859-1 or windows-1252
+}
+
+// CSVColumns maps expense fields to column headers (ignoring case) or column numbers;
+// the amount is either one signed column or split into debit and credit columns
+type CSVColumns struct {
+	Date      string `json:"date"`
+	Name      string `json:"name"`
+	Amount    string `json:"amount,omitempty"`
+	Debit     string `json:"debit,omitempty"`  // money out, as a positive or negative number
+	Credit    string `json:"credit,omitempty"` // money in
+	Category  string `json:"category,omitempty"`
+	Currency  string `json:"currency,omitempty"`
+	Reference string `json:"reference,omitempty"` // bank reference, to skip rows already imported
+}
+
+var csvDateTokens = []struct{ token, layout string }{
+	{"YYYY", "2006"}, {"YY", "06"}, {"MM", "01"}, {"M", "1"}, {"DD", "02"}, {"D", "2"},
+}
+
+// GoDateLayout converts the profile's date layout into a time.Parse layout
+func (p CSVProfile) GoDateLayout() string {
+	return GoDateLayout(p.DateLayout)
+}
+
+// GoDateLayout converts a layout written with YYYY, YY, MM, M, DD and D into a Go layout
+func GoDateLayout(dateLayout string) string {
+	var layout strings.Builder
+	rest := dateLayout
+	for rest != "" {
+		matched := false
+		for _, t := range csvDateTokens {
+			if strings.HasPrefix(rest, t.token) {
+				layout.WriteString(t.layout)
+				rest = rest[len(t.token):]
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			layout.WriteString(rest[:1])
+			rest = rest[1:]
+		}
+	}
+	return layout.String()
+}
+
+func (p *CSVProfile) Validate() error {
+	p.Name = SanitizeString(p.Name)
+	if p.Name == "" {
+		return fmt.Errorf("profile 'name' cannot be empty")
+	}
+	if p.Columns.Date == "" || p.Columns.Name == "" {
+		return fmt.Errorf("profile must map the 'date' and 'name' columns")
+	}
+	if p.Columns.Amount == "" && p.Columns.Debit == "" && p.Columns.Credit == "" {
+		return fmt.Errorf("profile must map the 'amount' column or the 'debit' and 'credit' columns")
+	}
+	if p.Delimiter == `\t` {
+		p.Delimiter = "\t"
+	}
+	if p.Delimiter == "" {
+		p.Delimiter = ","
+	}
+	if p.Decimal == "" {
+		p.Decimal = "."
+	}
+	if utf8.RuneCountInString(p.Delimiter) != 1 || p.Delimiter == "\n" || p.Delimiter == `"` {
+		return fmt.Errorf("invalid delimiter: %q", p.Delimiter)
+	}
+	if utf8.RuneCountInString(p.Decimal) != 1 || utf8.RuneCountInString(p.Thousands) > 1 || p.Decimal == p.Thousands {
+		return fmt.Errorf("decimal and thousands separators must be different single characters")
+	}
+	if p.SkipRows < 0 {
+		return fmt.Errorf("'skipRows' cannot be negative")
+	}
+	p.Encoding = strings.ToLower(strings.TrimSpace(p.Encoding))
+	switch p.Encoding {
+	case "", "utf-8", "utf8":
+		p.Encoding = "utf-8"
+	case "iso-8859-1", "latin1", "latin-1":
+		p.Encoding = "iso-8859-1"
+	case "windows-1252", "cp1252":
+		p.Encoding = "windows-1252"
+	default:
+		return fmt.Errorf("unsupported encoding: %s", p.Encoding)
+	}
+	p.DateLayout = strings.TrimSpace(p.DateLayout)
+	if p.DateLayout != "" && !ValidDateLayout(p.DateLayout) {
+		return fmt.Errorf("invalid date layout: %s", p.DateLayout)
+	}
+	return nil
+}
+
+// ValidDateLayout reports whether a YYYY/MM/DD style layout has a year, month and day
+func ValidDateLayout(dateLayout string) bool {
+	return strings.Contains(dateLayout, "Y") && strings.Contains(dateLayout, "M") && strings.Contains(dateLayout, "D")
+}
+
+// setCSVProfile adds the profile or replaces the one of the same name (ignoring case)
+func (c *Config) setCSVProfile(profile CSVProfile) {
+	for i, p := range c.CSVProfiles {
+		if strings.EqualFold(p.Name, profile.Name) {
+			c.CSVProfiles[i] = profile
+			return
+		}
+	}
+	c.CSVProfiles = append(c.CSVProfiles, profile)
+}
+
+func (c *Config) removeCSVProfile(name string) error {
+	for i, p := range c.CSVProfiles {
+		if strings.EqualFold(p.Name, name) {
+			c.CSVProfiles = append(c.CSVProfiles[:i], c.CSVProfiles[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("CSV profile not found: %s", name)
+}
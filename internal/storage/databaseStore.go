@@ -14,45 +14,14 @@ import (
 
 // databaseStore implements the Storage interface for PostgreSQL.
 type databaseStore struct {
+	sqlAuthStore
+	sqlLedgerStore
+	sqlRateStore
 	db       *sql.DB
-	defaults map[string]string // allows reusing defaults without querying for config
-}
-
-// SQL queries as constants for reusability and clarity.
-const (
-	createExpensesTableSQL = `
-	CREATE TABLE IF NOT EXISTS expenses (
-		id VARCHAR(36) PRIMARY KEY,
-		recurring_id VARCHAR(36),
-		name VARCHAR(255) NOT NULL,
-		category VARCHAR(255) NOT NULL,
-		amount NUMERIC(10, 2) NOT NULL,
-		currency VARCHAR(3) NOT NULL,
-		date TIMESTAMPTZ NOT NULL,
-		tags TEXT
-	);`
-
-	createRecurringExpensesTableSQL = `
-	CREATE TABLE IF NOT EXISTS recurring_expenses (
-		id VARCHAR(36) PRIMARY KEY,
-		name VARCHAR(255) NOT NULL,
-		amount NUMERIC(10, 2) NOT NULL,
-		currency VARCHAR(3) NOT NULL,
-		category VARCHAR(255) NOT NULL,
-		start_date TIMESTAMPTZ NOT NULL,
-		interval VARCHAR(50) NOT NULL,
-		occurrences INTEGER NOT NULL,
-		tags TEXT
-	);`
-
-	createConfigTableSQL = `
-	CREATE TABLE IF NOT EXISTS config (
-		id VARCHAR(255) PRIMARY KEY DEFAULT 'default',
-		categories TEXT NOT NULL,
-		currency VARCHAR(255) NOT NULL,
-		start_date INTEGER NOT NULL
-	);`
-)
+	defaults *ledgerDefaults // allows reusing defaults without querying for config
+	ledger   string          // every query is scoped to this ledger
+	scoped   bool            // ledger views share the connection of the store they came from
+}
 
 func InitializePostgresStore(baseConfig SystemConfig) (Storage, error) {
 	dbURL := makeDBURL(baseConfig)
@@ -65,26 +34,58 @@ func InitializePostgresStore(baseConfig SystemConfig) (Storage, error) {
 	}
 	log.Println("Connected to PostgreSQL database")
 
-	if err := createTables(db); err != nil {
-		return nil, fmt.Errorf("failed to create database tables: %v", err)
+	if err := applyMigrations(db, dialectPostgres); err != nil {
+		return nil, fmt.Errorf("failed to migrate database schema: %v", err)
+	}
+	store := &databaseStore{
+		sqlAuthStore:   sqlAuthStore{db, dialectPostgres},
+		sqlLedgerStore: sqlLedgerStore{db, dialectPostgres},
+		sqlRateStore:   sqlRateStore{db, dialectPostgres},
+		db:             db,
+		ledger:         DefaultLedgerID,
 	}
-	return &databaseStore{db: db, defaults: map[string]string{}}, nil
+	if err := store.loadDefaults(); err != nil {
+		return nil, err
+	}
+	return store, nil
 }
 
-func makeDBURL(baseConfig SystemConfig) string {
-	return fmt.Sprintf("postgres://%s:%s@%s?sslmode=%s", baseConfig.StorageUser, baseConfig.StoragePass, baseConfig.StorageURL, baseConfig.StorageSSL)
+// loadDefaults reads the defaults of the ledger; GetConfig may save a fresh config, which
+// already needs the defaults in place
+func (s *databaseStore) loadDefaults() error {
+	s.defaults = &ledgerDefaults{}
+	config, err := s.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %v", err)
+	}
+	s.defaults.set(config)
+	return nil
 }
 
-func createTables(db *sql.DB) error {
-	for _, query := range []string{createExpensesTableSQL, createRecurringExpensesTableSQL, createConfigTableSQL} {
-		if _, err := db.Exec(query); err != nil {
-			return err
-		}
+func (s *databaseStore) ForLedger(id string) (Storage, error) {
+	if id == "" {
+		id = DefaultLedgerID
 	}
-	return nil
+	if _, err := s.GetLedger(id); err != nil {
+		return nil, err
+	}
+	scoped := *s
+	scoped.ledger = id
+	scoped.scoped = true
+	if err := scoped.loadDefaults(); err != nil {
+		return nil, err
+	}
+	return &scoped, nil
+}
+
+func makeDBURL(baseConfig SystemConfig) string {
+	return fmt.Sprintf("postgres://%s:%s@%s?sslmode=%s", baseConfig.StorageUser, baseConfig.StoragePass, baseConfig.StorageURL, baseConfig.StorageSSL)
 }
 
 func (s *databaseStore) Close() error {
+	if s.scoped {
+		return nil
+	}
 	return s.db.Close()
 }
 
@@ -93,18 +94,34 @@ func (s *databaseStore) saveConfig(config *Config) error {
 	if err != nil {
 		return fmt.Errorf("failed to marshal categories: %v", err)
 	}
+	rulesJSON, err := json.Marshal(config.CategoryRules)
+	if err != nil {
+		return fmt.Errorf("failed to marshal category rules: %v", err)
+	}
+	profilesJSON, err := json.Marshal(config.CSVProfiles)
+	if err != nil {
+		return fmt.Errorf("failed to marshal CSV profiles: %v", err)
+	}
+	dismissedJSON, err := json.Marshal(config.DismissedDuplicates)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dismissed duplicates: %v", err)
+	}
 	query := `
-		INSERT INTO config (id, categories, currency, start_date)
-		VALUES ('default', $1, $2, $3)
+		INSERT INTO config (id, categories, currency, start_date, category_rules, csv_profiles, dismissed_duplicates)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		ON CONFLICT (id) DO UPDATE SET
 			categories = EXCLUDED.categories,
 			currency = EXCLUDED.currency,
-			start_date = EXCLUDED.start_date;
+			start_date = EXCLUDED.start_date,
+			category_rules = EXCLUDED.category_rules,
+			csv_profiles = EXCLUDED.csv_profiles,
+			dismissed_duplicates = EXCLUDED.dismissed_duplicates;
 	`
-	_, err = s.db.Exec(query, string(categoriesJSON), config.Currency, config.StartDate)
-	s.defaults["currency"] = config.Currency
-	s.defaults["start_date"] = fmt.Sprintf("%d", config.StartDate)
-	return err
+	if _, err := s.db.Exec(query, s.ledger, string(categoriesJSON), config.Currency, config.StartDate, string(rulesJSON), string(profilesJSON), string(dismissedJSON)); err != nil {
+		return err
+	}
+	s.defaults.set(config)
+	return nil
 }
 
 func (s *databaseStore) updateConfig(updater func(c *Config) error) error {
@@ -119,10 +136,11 @@ func (s *databaseStore) updateConfig(updater func(c *Config) error) error {
 }
 
 func (s *databaseStore) GetConfig() (*Config, error) {
-	query := `SELECT categories, currency, start_date FROM config WHERE id = 'default'`
+	query := `SELECT categories, currency, start_date, category_rules, csv_profiles, dismissed_duplicates FROM config WHERE id = $1`
 	var categoriesStr, currency string
+	var rulesStr, profilesStr, dismissedStr sql.NullString
 	var startDate int
-	err := s.db.QueryRow(query).Scan(&categoriesStr, &currency, &startDate)
+	err := s.db.QueryRow(query, s.ledger).Scan(&categoriesStr, &currency, &startDate, &rulesStr, &profilesStr, &dismissedStr)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -142,6 +160,24 @@ func (s *databaseStore) GetConfig() (*Config, error) {
 	if err := json.Unmarshal([]byte(categoriesStr), &config.Categories); err != nil {
 		return nil, fmt.Errorf("failed to parse categories from db: %v", err)
 	}
+	config.CategoryRules = []CategoryRule{}
+	if rulesStr.Valid && rulesStr.String != "" {
+		if err := json.Unmarshal([]byte(rulesStr.String), &config.CategoryRules); err != nil {
+			return nil, fmt.Errorf("failed to parse category rules from db: %v", err)
+		}
+	}
+	config.CSVProfiles = []CSVProfile{}
+	if profilesStr.Valid && profilesStr.String != "" {
+		if err := json.Unmarshal([]byte(profilesStr.String), &config.CSVProfiles); err != nil {
+			return nil, fmt.Errorf("failed to parse CSV profiles from db: %v", err)
+		}
+	}
+	config.DismissedDuplicates = []string{}
+	if dismissedStr.Valid && dismissedStr.String != "" {
+		if err := json.Unmarshal([]byte(dismissedStr.String), &config.DismissedDuplicates); err != nil {
+			return nil, fmt.Errorf("failed to parse dismissed duplicates from db: %v", err)
+		}
+	}
 
 	recurring, err := s.GetRecurringExpenses()
 	if err != nil {
@@ -203,11 +239,74 @@ func (s *databaseStore) UpdateStartDate(startDate int) error {
 	})
 }
 
+func (s *databaseStore) GetCategoryRules() ([]CategoryRule, error) {
+	config, err := s.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	return config.CategoryRules, nil
+}
+
+func (s *databaseStore) UpdateCategoryRules(rules []CategoryRule) error {
+	rules, err := ValidateCategoryRules(rules)
+	if err != nil {
+		return err
+	}
+	return s.updateConfig(func(c *Config) error {
+		c.CategoryRules = rules
+		return nil
+	})
+}
+
+func (s *databaseStore) GetCSVProfiles() ([]CSVProfile, error) {
+	config, err := s.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config.CSVProfiles == nil {
+		return []CSVProfile{}, nil
+	}
+	return config.CSVProfiles, nil
+}
+
+func (s *databaseStore) SaveCSVProfile(profile CSVProfile) error {
+	if err := profile.Validate(); err != nil {
+		return err
+	}
+	return s.updateConfig(func(c *Config) error {
+		c.setCSVProfile(profile)
+		return nil
+	})
+}
+
+func (s *databaseStore) RemoveCSVProfile(name string) error {
+	return s.updateConfig(func(c *Config) error {
+		return c.removeCSVProfile(name)
+	})
+}
+
+func (s *databaseStore) GetDismissedDuplicates() ([]string, error) {
+	config, err := s.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config.DismissedDuplicates == nil {
+		return []string{}, nil
+	}
+	return config.DismissedDuplicates, nil
+}
+
+func (s *databaseStore) DismissDuplicates(ids []string) error {
+	return s.updateConfig(func(c *Config) error {
+		return c.dismissDuplicates(ids)
+	})
+}
+
 func scanExpense(scanner interface{ Scan(...any) error }) (Expense, error) {
 	var expense Expense
-	var tagsStr sql.NullString
+	var tagsStr, sharedStr sql.NullString
 	var recurringID sql.NullString
-	err := scanner.Scan(&expense.ID, &recurringID, &expense.Name, &expense.Category, &expense.Amount, &expense.Date, &tagsStr)
+	err := scanner.Scan(&expense.ID, &recurringID, &expense.Name, &expense.Category, &expense.Amount, &expense.Currency, &expense.Date, &tagsStr, &expense.Owner, &sharedStr, &expense.ExternalID)
 	if err != nil {
 		return Expense{}, err
 	}
@@ -219,12 +318,15 @@ func scanExpense(scanner interface{ Scan(...any) error }) (Expense, error) {
 			return Expense{}, fmt.Errorf("failed to parse tags for expense %s: %v", expense.ID, err)
 		}
 	}
+	if expense.SharedWith, err = unmarshalList(sharedStr); err != nil {
+		return Expense{}, fmt.Errorf("failed to parse participants for expense %s: %v", expense.ID, err)
+	}
 	return expense, nil
 }
 
 func (s *databaseStore) GetAllExpenses() ([]Expense, error) {
-	query := `SELECT id, recurring_id, name, category, amount, date, tags FROM expenses ORDER BY date DESC`
-	rows, err := s.db.Query(query)
+	query := `SELECT ` + expenseColumns + ` FROM expenses WHERE ledger_id = $1 ORDER BY date DESC`
+	rows, err := s.db.Query(query, s.ledger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query expenses: %v", err)
 	}
@@ -241,9 +343,46 @@ func (s *databaseStore) GetAllExpenses() ([]Expense, error) {
 	return expenses, nil
 }
 
+func (s *databaseStore) QueryExpenses(query ExpenseQuery) (*ExpenseQueryResult, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	query.ledgerID = s.ledger
+	where, args := query.sqlFilter(dialectPostgres)
+	result := &ExpenseQueryResult{Expenses: []Expense{}, Limit: query.Limit, Offset: query.Offset}
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM expenses WHERE `+where, args...).Scan(&result.Total); err != nil {
+		return nil, fmt.Errorf("failed to count expenses: %v", err)
+	}
+	rows, err := s.db.Query(`SELECT `+expenseColumns+` FROM expenses WHERE `+where+query.sqlOrder(dialectPostgres), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expenses: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		expense, err := scanExpense(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan expense: %v", err)
+		}
+		result.Expenses = append(result.Expenses, expense)
+	}
+	return result, rows.Err()
+}
+
+func (s *databaseStore) SummarizeExpenses(query SummaryQuery) (*Summary, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	config, err := s.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	query.Filter.ledgerID = s.ledger
+	return querySummary(s.db, dialectPostgres, query, config.StartDate, config.Currency, s.GetConversionRates, s.QueryExpenses)
+}
+
 func (s *databaseStore) GetExpense(id string) (Expense, error) {
-	query := `SELECT id, recurring_id, name, category, amount, date, tags FROM expenses WHERE id = $1`
-	expense, err := scanExpense(s.db.QueryRow(query, id))
+	query := `SELECT ` + expenseColumns + ` FROM expenses WHERE id = $1 AND ledger_id = $2`
+	expense, err := scanExpense(s.db.QueryRow(query, id, s.ledger))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return Expense{}, fmt.Errorf("expense with ID %s not found", id)
@@ -258,7 +397,7 @@ func (s *databaseStore) AddExpense(expense Expense) error {
 		expense.ID = uuid.New().String()
 	}
 	if expense.Currency == "" {
-		expense.Currency = s.defaults["currency"]
+		expense.Currency = s.defaults.defaultCurrency()
 	}
 	if expense.Date.IsZero() {
 		expense.Date = time.Now()
@@ -268,28 +407,67 @@ func (s *databaseStore) AddExpense(expense Expense) error {
 		return err
 	}
 	query := `
-		INSERT INTO expenses (id, recurring_id, name, category, amount, currency, date, tags)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO expenses (` + expenseColumns + `, ledger_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 	`
-	_, err = s.db.Exec(query, expense.ID, expense.RecurringID, expense.Name, expense.Category, expense.Amount, expense.Currency, expense.Date, string(tagsJSON))
+	_, err = s.db.Exec(query, expense.ID, expense.RecurringID, expense.Name, expense.Category, expense.Amount, expense.Currency, expense.Date, string(tagsJSON), expense.Owner, marshalList(expense.SharedWith), expense.ExternalID, s.ledger)
 	return err
 }
 
 func (s *databaseStore) UpdateExpense(id string, expense Expense) error {
+	return s.updateExpense(s.db, id, expense)
+}
+
+func (s *databaseStore) UpdateMultipleExpenses(expenses []Expense) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	for _, exp := range expenses {
+		if err := s.updateExpense(tx, exp.ID, exp); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+func (s *databaseStore) MergeExpenses(kept Expense, remove []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	if err := s.updateExpense(tx, kept.ID, kept); err != nil {
+		return err
+	}
+	if err := s.removeExpenses(tx, remove); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+func (s *databaseStore) updateExpense(ex execer, id string, expense Expense) error {
 	tagsJSON, err := json.Marshal(expense.Tags)
 	if err != nil {
 		return err
 	}
 	// TODO: revisit to maybe remove this later, might not be a good default for update
 	if expense.Currency == "" {
-		expense.Currency = s.defaults["currency"]
+		expense.Currency = s.defaults.defaultCurrency()
 	}
 	query := `
 		UPDATE expenses
-		SET name = $1, category = $2, amount = $3, currency = $4, date = $5, tags = $6, recurring_id = $7
-		WHERE id = $8
+		SET name = $1, category = $2, amount = $3, currency = $4, date = $5, tags = $6, recurring_id = $7, owner = $8, shared_with = $9, external_id = $10
+		WHERE id = $11 AND ledger_id = $12
 	`
-	result, err := s.db.Exec(query, expense.Name, expense.Category, expense.Amount, expense.Currency, expense.Date, string(tagsJSON), expense.RecurringID, id)
+	result, err := ex.Exec(query, expense.Name, expense.Category, expense.Amount, expense.Currency, expense.Date, string(tagsJSON), expense.RecurringID, expense.Owner, marshalList(expense.SharedWith), expense.ExternalID, id, s.ledger)
 	if err != nil {
 		return fmt.Errorf("failed to update expense: %v", err)
 	}
@@ -304,8 +482,8 @@ func (s *databaseStore) UpdateExpense(id string, expense Expense) error {
 }
 
 func (s *databaseStore) RemoveExpense(id string) error {
-	query := `DELETE FROM expenses WHERE id = $1`
-	result, err := s.db.Exec(query, id)
+	query := `DELETE FROM expenses WHERE id = $1 AND ledger_id = $2`
+	result, err := s.db.Exec(query, id, s.ledger)
 	if err != nil {
 		return fmt.Errorf("failed to delete expense: %v", err)
 	}
@@ -323,21 +501,73 @@ func (s *databaseStore) AddMultipleExpenses(expenses []Expense) error {
 	if len(expenses) == 0 {
 		return nil
 	}
-	// use the same addexpense method
-	for _, exp := range expenses {
-		if err := s.AddExpense(exp); err != nil {
-			return err
+	_, err := s.ImportExpenses(singleBatch(expenses))
+	return err
+}
+
+// ImportExpenses streams the expenses into the table with COPY
+func (s *databaseStore) ImportExpenses(next func() ([]Expense, error)) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(pq.CopyIn("expenses", "id", "recurring_id", "name", "category", "amount", "currency", "date", "tags", "owner", "shared_with", "external_id", "ledger_id"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to start copy: %v", err)
+	}
+	defer stmt.Close()
+	count := 0
+	for {
+		batch, err := next()
+		if err != nil {
+			return 0, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		for _, exp := range batch {
+			if exp.ID == "" {
+				exp.ID = uuid.New().String()
+			}
+			if exp.Currency == "" {
+				exp.Currency = s.defaults.defaultCurrency()
+			}
+			if exp.Date.IsZero() {
+				exp.Date = time.Now()
+			}
+			tagsJSON, err := json.Marshal(exp.Tags)
+			if err != nil {
+				return 0, err
+			}
+			if _, err := stmt.Exec(exp.ID, exp.RecurringID, exp.Name, exp.Category, exp.Amount, exp.Currency, exp.Date, string(tagsJSON), exp.Owner, marshalList(exp.SharedWith), exp.ExternalID, s.ledger); err != nil {
+				return 0, fmt.Errorf("failed to copy expense: %v", err)
+			}
 		}
+		count += len(batch)
 	}
-	return nil
+	if _, err := stmt.Exec(); err != nil { // flushes the copied rows
+		return 0, fmt.Errorf("failed to copy expenses: %v", err)
+	}
+	if err := stmt.Close(); err != nil {
+		return 0, fmt.Errorf("failed to copy expenses: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return count, nil
 }
 
 func (s *databaseStore) RemoveMultipleExpenses(ids []string) error {
+	return s.removeExpenses(s.db, ids)
+}
+
+func (s *databaseStore) removeExpenses(ex execer, ids []string) error {
 	if len(ids) == 0 {
 		return nil
 	}
-	query := `DELETE FROM expenses WHERE id = ANY($1)`
-	_, err := s.db.Exec(query, pq.Array(ids))
+	query := `DELETE FROM expenses WHERE id = ANY($1) AND ledger_id = $2`
+	_, err := ex.Exec(query, pq.Array(ids), s.ledger)
 	if err != nil {
 		return fmt.Errorf("failed to delete multiple expenses: %v", err)
 	}
@@ -346,8 +576,8 @@ func (s *databaseStore) RemoveMultipleExpenses(ids []string) error {
 
 func scanRecurringExpense(scanner interface{ Scan(...any) error }) (RecurringExpense, error) {
 	var re RecurringExpense
-	var tagsStr sql.NullString
-	err := scanner.Scan(&re.ID, &re.Name, &re.Amount, &re.Currency, &re.Category, &re.StartDate, &re.Interval, &re.Occurrences, &tagsStr)
+	var tagsStr, sharedStr sql.NullString
+	err := scanner.Scan(&re.ID, &re.Name, &re.Amount, &re.Currency, &re.Category, &re.StartDate, &re.Interval, &re.Occurrences, &tagsStr, &re.Owner, &sharedStr)
 	if err != nil {
 		return RecurringExpense{}, err
 	}
@@ -356,12 +586,15 @@ func scanRecurringExpense(scanner interface{ Scan(...any) error }) (RecurringExp
 			return RecurringExpense{}, fmt.Errorf("failed to parse tags for recurring expense %s: %v", re.ID, err)
 		}
 	}
+	if re.SharedWith, err = unmarshalList(sharedStr); err != nil {
+		return RecurringExpense{}, fmt.Errorf("failed to parse participants for recurring expense %s: %v", re.ID, err)
+	}
 	return re, nil
 }
 
 func (s *databaseStore) GetRecurringExpenses() ([]RecurringExpense, error) {
-	query := `SELECT id, name, amount, currency, category, start_date, interval, occurrences, tags FROM recurring_expenses`
-	rows, err := s.db.Query(query)
+	query := `SELECT ` + recurringColumns + ` FROM recurring_expenses WHERE ledger_id = $1`
+	rows, err := s.db.Query(query, s.ledger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query recurring expenses: %v", err)
 	}
@@ -378,8 +611,8 @@ func (s *databaseStore) GetRecurringExpenses() ([]RecurringExpense, error) {
 }
 
 func (s *databaseStore) GetRecurringExpense(id string) (RecurringExpense, error) {
-	query := `SELECT id, name, amount, category, start_date, interval, occurrences, tags FROM recurring_expenses WHERE id = $1`
-	re, err := scanRecurringExpense(s.db.QueryRow(query, id))
+	query := `SELECT ` + recurringColumns + ` FROM recurring_expenses WHERE id = $1 AND ledger_id = $2`
+	re, err := scanRecurringExpense(s.db.QueryRow(query, id, s.ledger))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return RecurringExpense{}, fmt.Errorf("recurring expense with ID %s not found", id)
@@ -400,28 +633,28 @@ func (s *databaseStore) AddRecurringExpense(recurringExpense RecurringExpense) e
 		recurringExpense.ID = uuid.New().String()
 	}
 	if recurringExpense.Currency == "" {
-		recurringExpense.Currency = s.defaults["currency"]
+		recurringExpense.Currency = s.defaults.defaultCurrency()
 	}
 	tagsJSON, _ := json.Marshal(recurringExpense.Tags)
 	ruleQuery := `
-		INSERT INTO recurring_expenses (id, name, amount, currency, category, start_date, interval, occurrences, tags)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		INSERT INTO recurring_expenses (` + recurringColumns + `, ledger_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 	`
-	_, err = tx.Exec(ruleQuery, recurringExpense.ID, recurringExpense.Name, recurringExpense.Amount, recurringExpense.Currency, recurringExpense.Category, recurringExpense.StartDate, recurringExpense.Interval, recurringExpense.Occurrences, string(tagsJSON))
+	_, err = tx.Exec(ruleQuery, recurringExpense.ID, recurringExpense.Name, recurringExpense.Amount, recurringExpense.Currency, recurringExpense.Category, recurringExpense.StartDate, recurringExpense.Interval, recurringExpense.Occurrences, string(tagsJSON), recurringExpense.Owner, marshalList(recurringExpense.SharedWith), s.ledger)
 	if err != nil {
 		return fmt.Errorf("failed to insert recurring expense rule: %v", err)
 	}
 
 	expensesToAdd := generateExpensesFromRecurring(recurringExpense, false)
 	if len(expensesToAdd) > 0 {
-		stmt, err := tx.Prepare(pq.CopyIn("expenses", "id", "recurring_id", "name", "category", "amount", "currency", "date", "tags"))
+		stmt, err := tx.Prepare(pq.CopyIn("expenses", "id", "recurring_id", "name", "category", "amount", "currency", "date", "tags", "owner", "shared_with", "external_id", "ledger_id"))
 		if err != nil {
 			return fmt.Errorf("failed to prepare copy in: %v", err)
 		}
 		defer stmt.Close()
 		for _, exp := range expensesToAdd {
 			expTagsJSON, _ := json.Marshal(exp.Tags)
-			_, err = stmt.Exec(exp.ID, exp.RecurringID, exp.Name, exp.Category, exp.Amount, exp.Currency, exp.Date, string(expTagsJSON))
+			_, err = stmt.Exec(exp.ID, exp.RecurringID, exp.Name, exp.Category, exp.Amount, exp.Currency, exp.Date, string(expTagsJSON), exp.Owner, marshalList(exp.SharedWith), exp.ExternalID, s.ledger)
 			if err != nil {
 				return fmt.Errorf("failed to execute copy in: %v", err)
 			}
@@ -433,6 +666,25 @@ func (s *databaseStore) AddRecurringExpense(recurringExpense RecurringExpense) e
 	return tx.Commit()
 }
 
+func (s *databaseStore) AddRecurringExpenseRule(recurringExpense RecurringExpense) error {
+	if recurringExpense.ID == "" {
+		recurringExpense.ID = uuid.New().String()
+	}
+	if recurringExpense.Currency == "" {
+		recurringExpense.Currency = s.defaults.defaultCurrency()
+	}
+	tagsJSON, _ := json.Marshal(recurringExpense.Tags)
+	ruleQuery := `
+		INSERT INTO recurring_expenses (` + recurringColumns + `, ledger_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	`
+	_, err := s.db.Exec(ruleQuery, recurringExpense.ID, recurringExpense.Name, recurringExpense.Amount, recurringExpense.Currency, recurringExpense.Category, recurringExpense.StartDate, recurringExpense.Interval, recurringExpense.Occurrences, string(tagsJSON), recurringExpense.Owner, marshalList(recurringExpense.SharedWith), s.ledger)
+	if err != nil {
+		return fmt.Errorf("failed to insert recurring expense rule: %v", err)
+	}
+	return nil
+}
+
 func (s *databaseStore) UpdateRecurringExpense(id string, recurringExpense RecurringExpense, updateAll bool) error {
 	tx, err := s.db.Begin()
 	if err != nil {
@@ -441,15 +693,15 @@ func (s *databaseStore) UpdateRecurringExpense(id string, recurringExpense Recur
 	defer tx.Rollback()
 	recurringExpense.ID = id // Ensure ID is preserved
 	if recurringExpense.Currency == "" {
-		recurringExpense.Currency = s.defaults["currency"]
+		recurringExpense.Currency = s.defaults.defaultCurrency()
 	}
 	tagsJSON, _ := json.Marshal(recurringExpense.Tags)
 	ruleQuery := `
 		UPDATE recurring_expenses
-		SET name = $1, amount = $2, category = $3, start_date = $4, interval = $5, occurrences = $6, tags = $7, currency = $8
-		WHERE id = $9
+		SET name = $1, amount = $2, category = $3, start_date = $4, interval = $5, occurrences = $6, tags = $7, currency = $8, owner = $9, shared_with = $10
+		WHERE id = $11 AND ledger_id = $12
 	`
-	res, err := tx.Exec(ruleQuery, recurringExpense.Name, recurringExpense.Amount, recurringExpense.Category, recurringExpense.StartDate, recurringExpense.Interval, recurringExpense.Occurrences, string(tagsJSON), recurringExpense.Currency, id)
+	res, err := tx.Exec(ruleQuery, recurringExpense.Name, recurringExpense.Amount, recurringExpense.Category, recurringExpense.StartDate, recurringExpense.Interval, recurringExpense.Occurrences, string(tagsJSON), recurringExpense.Currency, recurringExpense.Owner, marshalList(recurringExpense.SharedWith), id, s.ledger)
 	if err != nil {
 		return fmt.Errorf("failed to update recurring expense rule: %v", err)
 	}
@@ -460,11 +712,11 @@ func (s *databaseStore) UpdateRecurringExpense(id string, recurringExpense Recur
 
 	var deleteQuery string
 	if updateAll {
-		deleteQuery = `DELETE FROM expenses WHERE recurring_id = $1`
-		_, err = tx.Exec(deleteQuery, id)
+		deleteQuery = `DELETE FROM expenses WHERE recurring_id = $1 AND ledger_id = $2`
+		_, err = tx.Exec(deleteQuery, id, s.ledger)
 	} else {
-		deleteQuery = `DELETE FROM expenses WHERE recurring_id = $1 AND date > $2`
-		_, err = tx.Exec(deleteQuery, id, time.Now())
+		deleteQuery = `DELETE FROM expenses WHERE recurring_id = $1 AND ledger_id = $2 AND date > $3`
+		_, err = tx.Exec(deleteQuery, id, s.ledger, time.Now())
 	}
 	if err != nil {
 		return fmt.Errorf("failed to delete old expense instances for update: %v", err)
@@ -472,14 +724,14 @@ func (s *databaseStore) UpdateRecurringExpense(id string, recurringExpense Recur
 
 	expensesToAdd := generateExpensesFromRecurring(recurringExpense, !updateAll)
 	if len(expensesToAdd) > 0 {
-		stmt, err := tx.Prepare(pq.CopyIn("expenses", "id", "recurring_id", "name", "category", "amount", "currency", "date", "tags"))
+		stmt, err := tx.Prepare(pq.CopyIn("expenses", "id", "recurring_id", "name", "category", "amount", "currency", "date", "tags", "owner", "shared_with", "external_id", "ledger_id"))
 		if err != nil {
 			return fmt.Errorf("failed to prepare copy in for update: %v", err)
 		}
 		defer stmt.Close()
 		for _, exp := range expensesToAdd {
 			expTagsJSON, _ := json.Marshal(exp.Tags)
-			_, err = stmt.Exec(exp.ID, exp.RecurringID, exp.Name, exp.Category, exp.Amount, exp.Currency, exp.Date, string(expTagsJSON))
+			_, err = stmt.Exec(exp.ID, exp.RecurringID, exp.Name, exp.Category, exp.Amount, exp.Currency, exp.Date, string(expTagsJSON), exp.Owner, marshalList(exp.SharedWith), exp.ExternalID, s.ledger)
 			if err != nil {
 				return fmt.Errorf("failed to execute copy in for update: %v", err)
 			}
@@ -497,7 +749,7 @@ func (s *databaseStore) RemoveRecurringExpense(id string, removeAll bool) error
 		return fmt.Errorf("failed to begin transaction: %v", err)
 	}
 	defer tx.Rollback()
-	res, err := tx.Exec(`DELETE FROM recurring_expenses WHERE id = $1`, id)
+	res, err := tx.Exec(`DELETE FROM recurring_expenses WHERE id = $1 AND ledger_id = $2`, id, s.ledger)
 	if err != nil {
 		return fmt.Errorf("failed to delete recurring expense rule: %v", err)
 	}
@@ -508,11 +760,11 @@ func (s *databaseStore) RemoveRecurringExpense(id string, removeAll bool) error
 
 	var deleteQuery string
 	if removeAll {
-		deleteQuery = `DELETE FROM expenses WHERE recurring_id = $1`
-		_, err = tx.Exec(deleteQuery, id)
+		deleteQuery = `DELETE FROM expenses WHERE recurring_id = $1 AND ledger_id = $2`
+		_, err = tx.Exec(deleteQuery, id, s.ledger)
 	} else {
-		deleteQuery = `DELETE FROM expenses WHERE recurring_id = $1 AND date > $2`
-		_, err = tx.Exec(deleteQuery, id, time.Now())
+		deleteQuery = `DELETE FROM expenses WHERE recurring_id = $1 AND ledger_id = $2 AND date > $3`
+		_, err = tx.Exec(deleteQuery, id, s.ledger, time.Now())
 	}
 	if err != nil {
 		return fmt.Errorf("failed to delete expense instances: %v", err)
@@ -559,6 +811,8 @@ func generateExpensesFromRecurring(recExp RecurringExpense, fromToday bool) []Ex
 			Currency:    recExp.Currency,
 			Date:        currentDate,
 			Tags:        recExp.Tags,
+			Owner:       recExp.Owner,
+			SharedWith:  recExp.SharedWith,
 		}
 		expenses = append(expenses, expense)
 		switch recExp.Interval {
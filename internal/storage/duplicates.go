@@ -0,0 +1,225 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// expenses at most this many days apart can be duplicates, e.g., a purchase entered on the day and
+// booked by the bank a few days later
+const DuplicateWindowDays = 3
+
+// expenses scoring at least this are likely duplicates; equal amounts on the same day also need
+// somewhat similar names
+const DuplicateThreshold = 0.55
+
+// DuplicateMatch is a stored expense that another expense likely duplicates
+type DuplicateMatch struct {
+	Expense Expense `json:"expense"`
+	Score   float64 `json:"score"`
+}
+
+// DuplicateCluster is a group of expenses that likely are the same transaction
+type DuplicateCluster struct {
+	Score    float64   `json:"score"` // highest score of two expenses of the cluster
+	Expenses []Expense `json:"expenses"`
+}
+
+// DuplicateScore rates from 0 to 1 how likely two expenses are the same transaction. Only equal
+// amounts in the same currency within the date window score; closer dates and more similar names
+// score higher. An empty currency is the ledger's and matches any.
+func DuplicateScore(a, b Expense) float64 {
+	if a.ID != "" && a.ID == b.ID {
+		return 0
+	}
+	if math.Abs(a.Amount-b.Amount) >= 0.005 {
+		return 0
+	}
+	if a.Currency != "" && b.Currency != "" && !strings.EqualFold(a.Currency, b.Currency) {
+		return 0
+	}
+	// occurrences of one recurring expense, or separate transactions of one bank statement
+	if a.RecurringID != "" && a.RecurringID == b.RecurringID {
+		return 0
+	}
+	if source := externalSource(a.ExternalID); source != "" && a.ExternalID != b.ExternalID && source == externalSource(b.ExternalID) {
+		return 0
+	}
+	days := math.Abs(float64(dayOf(a.Date).Sub(dayOf(b.Date)) / (24 * time.Hour)))
+	if days > DuplicateWindowDays {
+		return 0
+	}
+	dateScore := 1 - days/(DuplicateWindowDays+1)
+	return math.Round((0.5*dateScore+0.5*NameSimilarity(a.Name, b.Name))*100) / 100
+}
+
+// FindDuplicates returns the expenses that the expense likely duplicates, best match first
+func FindDuplicates(expense Expense, expenses []Expense) []DuplicateMatch {
+	var matches []DuplicateMatch
+	for _, other := range expenses {
+		if score := DuplicateScore(expense, other); score >= DuplicateThreshold {
+			matches = append(matches, DuplicateMatch{Expense: other, Score: score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	return matches
+}
+
+// DuplicateClusters groups the expenses that likely are the same transaction, skipping dismissed
+// pairs (see DuplicatePairKey); clusters are sorted by date
+func DuplicateClusters(expenses []Expense, dismissed []string) []DuplicateCluster {
+	skip := make(map[string]bool, len(dismissed))
+	for _, key := range dismissed {
+		skip[key] = true
+	}
+	// only equal amounts can be duplicates, so expenses are compared within their amount
+	byAmount := make(map[int64][]int)
+	for i, e := range expenses {
+		cents := int64(math.Round(e.Amount * 100))
+		byAmount[cents] = append(byAmount[cents], i)
+	}
+	parent := make([]int, len(expenses))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	scores := make(map[int]float64)
+	for _, group := range byAmount {
+		sort.Slice(group, func(i, j int) bool {
+			return expenses[group[i]].Date.Before(expenses[group[j]].Date)
+		})
+		for x, i := range group {
+			for _, j := range group[x+1:] {
+				if dayOf(expenses[j].Date).Sub(dayOf(expenses[i].Date)) > DuplicateWindowDays*24*time.Hour {
+					break
+				}
+				score := DuplicateScore(expenses[i], expenses[j])
+				if score < DuplicateThreshold || skip[DuplicatePairKey(expenses[i].ID, expenses[j].ID)] {
+					continue
+				}
+				ri, rj := find(i), find(j)
+				parent[rj] = ri
+				scores[ri] = max(scores[ri], scores[rj], score)
+			}
+		}
+	}
+
+	members := make(map[int][]Expense)
+	for i, e := range expenses {
+		if _, ok := scores[find(i)]; ok {
+			members[find(i)] = append(members[find(i)], e)
+		}
+	}
+	clusters := []DuplicateCluster{}
+	for root, group := range members {
+		sort.Slice(group, func(i, j int) bool {
+			return group[i].Date.Before(group[j].Date)
+		})
+		clusters = append(clusters, DuplicateCluster{Score: scores[root], Expenses: group})
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i].Expenses[0].Date.After(clusters[j].Expenses[0].Date)
+	})
+	return clusters
+}
+
+// DuplicatePairKey identifies a dismissed pair of expenses regardless of order
+func DuplicatePairKey(a, b string) string {
+	if b < a {
+		a, b = b, a
+	}
+	return a + "|" + b
+}
+
+// NameSimilarity rates from 0 to 1 how similar two expense names are, ignoring case, punctuation
+// and long numbers such as card or reference numbers
+func NameSimilarity(a, b string) float64 {
+	a, b = normalizeName(a), normalizeName(b)
+	if a == "" || b == "" {
+		return 0
+	}
+	if a == b {
+		return 1
+	}
+	// "rewe" entered by hand and "rewe markt koeln" from the bank
+	if strings.Contains(" "+b+" ", " "+a+" ") || strings.Contains(" "+a+" ", " "+b+" ") {
+		return 0.9
+	}
+	return diceCoefficient(strings.ReplaceAll(a, " ", ""), strings.ReplaceAll(b, " ", ""))
+}
+
+func normalizeName(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	words = slices.DeleteFunc(words, func(w string) bool {
+		return len(w) >= 4 && strings.IndexFunc(w, func(r rune) bool { return !unicode.IsDigit(r) }) < 0
+	})
+	return strings.Join(words, " ")
+}
+
+// diceCoefficient compares the character pairs of two strings
+func diceCoefficient(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) < 2 || len(rb) < 2 {
+		return 0
+	}
+	pairs := make(map[string]int, len(ra)-1)
+	for i := 0; i < len(ra)-1; i++ {
+		pairs[string(ra[i:i+2])]++
+	}
+	shared := 0
+	for i := 0; i < len(rb)-1; i++ {
+		pair := string(rb[i : i+2])
+		if pairs[pair] > 0 {
+			pairs[pair]--
+			shared++
+		}
+	}
+	return float64(2*shared) / float64(len(ra)+len(rb)-2)
+}
+
+// externalSource is the format and account of a bank reference like "ofx:<account>:<transaction>"
+func externalSource(id string) string {
+	parts := strings.SplitN(id, ":", 3)
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[0] + ":" + parts[1]
+}
+
+func dayOf(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// dismissDuplicates records that the expenses are not duplicates of each other
+func (c *Config) dismissDuplicates(ids []string) error {
+	if len(ids) < 2 {
+		return fmt.Errorf("at least two expenses are needed to dismiss duplicates")
+	}
+	for i, a := range ids {
+		for _, b := range ids[i+1:] {
+			if a == b {
+				continue
+			}
+			if key := DuplicatePairKey(a, b); !slices.Contains(c.DismissedDuplicates, key) {
+				c.DismissedDuplicates = append(c.DismissedDuplicates, key)
+			}
+		}
+	}
+	return nil
+}
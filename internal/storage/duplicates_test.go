@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDuplicateScore(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, 3, d, 12, 0, 0, 0, time.UTC) }
+	base := Expense{ID: "a", Name: "Rewe", Amount: -23.4, Currency: "eur", Date: day(1)}
+	with := func(change func(e *Expense)) Expense {
+		e := base
+		e.ID = "b"
+		change(&e)
+		return e
+	}
+	tests := []struct {
+		name string
+		b    Expense
+		want float64
+	}{
+		{"same transaction", with(func(e *Expense) {}), 1},
+		{"same expense", base, 0},
+		{"other amount", with(func(e *Expense) { e.Amount = -23.5 }), 0},
+		{"two days later", with(func(e *Expense) { e.Date = day(3) }), 0.75},
+		{"at the end of the window", with(func(e *Expense) { e.Date = day(4) }), 0.63},
+		{"outside the window", with(func(e *Expense) { e.Date = day(5) }), 0},
+		{"other currency", with(func(e *Expense) { e.Currency = "usd" }), 0},
+		{"ledger currency", with(func(e *Expense) { e.Currency = "" }), 1},
+		{"longer name from the bank", with(func(e *Expense) { e.Name = "REWE Markt Koeln 4711" }), 0.95},
+		{"occurrences of a recurring expense", with(func(e *Expense) { e.RecurringID = "r" }), 1},
+	}
+	for _, tt := range tests {
+		if got := DuplicateScore(base, tt.b); got != tt.want {
+			t.Errorf("%s: DuplicateScore = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// transactions of one statement are never duplicates, the same transaction of two imports is
+	a := with(func(e *Expense) { e.ExternalID = "ofx:DE123:T1"; e.RecurringID = "r" })
+	b := with(func(e *Expense) { e.ID = "c"; e.ExternalID = "ofx:DE123:T2" })
+	c := with(func(e *Expense) { e.ID = "d"; e.ExternalID = "ofx:DE123:T1" })
+	d := with(func(e *Expense) { e.ID = "e"; e.ExternalID = "camt:DE123:T9" })
+	if got := DuplicateScore(a, b); got != 0 {
+		t.Errorf("same statement: DuplicateScore = %v, want 0", got)
+	}
+	if got := DuplicateScore(a, c); got != 1 {
+		t.Errorf("same bank reference: DuplicateScore = %v, want 1", got)
+	}
+	if got := DuplicateScore(a, d); got != 1 {
+		t.Errorf("other statement: DuplicateScore = %v, want 1", got)
+	}
+	if got := DuplicateScore(a, with(func(e *Expense) { e.RecurringID = "r" })); got != 0 {
+		t.Errorf("same recurring expense: DuplicateScore = %v, want 0", got)
+	}
+}
+
+func TestNameSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"Coffee", "coffee!", 1},
+		{"Amazon 123456789", "AMAZON", 1}, // long numbers are ignored
+		{"Rewe", "REWE Markt Koeln", 0.9},
+		{"card payment", "Card 4711 payment Netflix", 0.9},
+		{"coffee", "toffee", 0.8},
+		{"Rent", "Groceries", 0},
+		{"", "Rent", 0},
+		{"12345678", "12345678", 0},
+	}
+	for _, tt := range tests {
+		if got := NameSimilarity(tt.a, tt.b); got != tt.want {
+			t.Errorf("NameSimilarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestDuplicateClusters(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, 3, d, 0, 0, 0, 0, time.UTC) }
+	expenses := []Expense{
+		{ID: "a", Name: "Rewe", Amount: -20, Date: day(1)},
+		{ID: "b", Name: "Rewe", Amount: -20, Date: day(3)},
+		{ID: "c", Name: "Rewe", Amount: -20, Date: day(5)}, // four days after a, but two after b
+		{ID: "d", Name: "Netflix", Amount: -12.99, Date: day(10)},
+		{ID: "e", Name: "NETFLIX.COM", Amount: -12.99, Date: day(10)},
+		{ID: "f", Name: "Rent", Amount: -900, Date: day(1)},
+		{ID: "g", Name: "Rent", Amount: -950, Date: day(1)},
+	}
+	tests := []struct {
+		name      string
+		dismissed []string
+		want      [][]string
+		scores    []float64
+	}{
+		{"chained", nil, [][]string{{"d", "e"}, {"a", "b", "c"}}, []float64{0.95, 0.75}},
+		{"dismissed pair", []string{DuplicatePairKey("e", "d")}, [][]string{{"a", "b", "c"}}, []float64{0.75}},
+		{"dismissed link of a chain", []string{DuplicatePairKey("a", "b")}, [][]string{{"d", "e"}, {"b", "c"}}, []float64{0.95, 0.75}},
+	}
+	for _, tt := range tests {
+		clusters := DuplicateClusters(expenses, tt.dismissed)
+		var got [][]string
+		var scores []float64
+		for _, cluster := range clusters {
+			var ids []string
+			for _, e := range cluster.Expenses {
+				ids = append(ids, e.ID)
+			}
+			got = append(got, ids)
+			scores = append(scores, cluster.Score)
+		}
+		if !slices.EqualFunc(got, tt.want, slices.Equal) || !slices.Equal(scores, tt.scores) {
+			t.Errorf("%s: clusters %v with scores %v, want %v with %v", tt.name, got, scores, tt.want, tt.scores)
+		}
+	}
+}
+
+func TestMergeExpenses(t *testing.T) {
+	date := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	for name, open := range testBackends {
+		t.Run(name, func(t *testing.T) {
+			store := open(t)
+			if err := store.AddMultipleExpenses([]Expense{
+				{ID: "a", Name: "Rewe", Category: "Food", Amount: -20, Date: date},
+				{ID: "b", Name: "REWE Markt", Category: "Food", Amount: -20, Date: date, ExternalID: "ofx:DE123:T1"},
+			}); err != nil {
+				t.Fatal(err)
+			}
+			// nothing is removed when the kept expense cannot be written
+			if err := store.MergeExpenses(Expense{ID: "x", Name: "Rewe", Category: "Food", Amount: -20, Date: date}, []string{"b"}); err == nil {
+				t.Fatal("expected an error for a missing expense")
+			}
+			if _, err := store.GetExpense("b"); err != nil {
+				t.Fatalf("failed merge removed b: %v", err)
+			}
+
+			kept := Expense{ID: "a", Name: "Rewe", Category: "Food", Amount: -20, Date: date, ExternalID: "ofx:DE123:T1"}
+			if err := store.MergeExpenses(kept, []string{"b"}); err != nil {
+				t.Fatal(err)
+			}
+			expenses, err := store.GetAllExpenses()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(expenses) != 1 || expenses[0].ID != "a" || expenses[0].ExternalID != "ofx:DE123:T1" {
+				t.Errorf("expenses after merge = %+v, want a with the bank reference of b", expenses)
+			}
+		})
+	}
+}
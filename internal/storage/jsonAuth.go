@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"time"
+)
+
+// users and tokens of the JSON store live in auth.json next to the other files, which is
+// only created once the first user is added; it is cached like the other files. They are
+// shared by all ledgers, so ledger stores hand these calls to the root store.
+
+type authFileData struct {
+	Users  []User      `json:"users"`
+	Tokens []AuthToken `json:"tokens"`
+}
+
+// refreshAuth reloads auth.json if it changed; callers must hold the write lock
+func (s *jsonStore) refreshAuth() error {
+	if s.auth != nil && !fileChanged(s.authPath, s.authInfo) {
+		return nil
+	}
+	info, err := os.Stat(s.authPath)
+	if os.IsNotExist(err) {
+		s.auth = &authFileData{Users: []User{}, Tokens: []AuthToken{}}
+		s.authInfo = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(s.authPath)
+	if err != nil {
+		return err
+	}
+	var data authFileData
+	if err := json.Unmarshal(content, &data); err != nil {
+		return err
+	}
+	s.auth = &data
+	s.authInfo = info
+	return nil
+}
+
+// rlockAuth takes the read lock with up-to-date auth data; callers must RUnlock even on error
+func (s *jsonStore) rlockAuth() error {
+	s.mu.RLock()
+	if s.auth != nil && s.authInfo != nil && !fileChanged(s.authPath, s.authInfo) {
+		return nil
+	}
+	s.mu.RUnlock()
+	s.mu.Lock()
+	err := s.refreshAuth()
+	s.mu.Unlock()
+	s.mu.RLock()
+	return err
+}
+
+// updateAuth applies updater to the auth data under the write lock and persists it
+func (s *jsonStore) updateAuth(updater func(data *authFileData) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refreshAuth(); err != nil {
+		return fmt.Errorf("failed to read auth file: %v", err)
+	}
+	data := &authFileData{Users: slices.Clone(s.auth.Users), Tokens: slices.Clone(s.auth.Tokens)}
+	if err := updater(data); err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(data, "", "    ")
+	if err != nil {
+		return err
+	}
+	// the file holds password hashes, so keep it private to the owner
+	if err := s.commitFile(s.authPath, content, 0600); err != nil {
+		s.authInfo = nil
+		return fmt.Errorf("failed to write auth file: %v", err)
+	}
+	s.auth = data
+	s.authInfo, _ = os.Stat(s.authPath)
+	log.Println("Wrote auth file")
+	return nil
+}
+
+func (s *jsonStore) GetUsers() ([]User, error) {
+	if s.root != nil {
+		return s.root.GetUsers()
+	}
+	defer s.mu.RUnlock()
+	if err := s.rlockAuth(); err != nil {
+		return nil, fmt.Errorf("failed to read auth file: %v", err)
+	}
+	users := slices.Clone(s.auth.Users)
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users, nil
+}
+
+func (s *jsonStore) GetUser(username string) (User, error) {
+	if s.root != nil {
+		return s.root.GetUser(username)
+	}
+	defer s.mu.RUnlock()
+	if err := s.rlockAuth(); err != nil {
+		return User{}, fmt.Errorf("failed to read auth file: %v", err)
+	}
+	for _, user := range s.auth.Users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+	return User{}, fmt.Errorf("user %s not found", username)
+}
+
+func (s *jsonStore) SaveUser(user User) error {
+	if s.root != nil {
+		return s.root.SaveUser(user)
+	}
+	if err := ValidateUsername(user.Username); err != nil {
+		return err
+	}
+	return s.updateAuth(func(data *authFileData) error {
+		for i, existing := range data.Users {
+			if existing.Username == user.Username {
+				data.Users[i].PasswordHash = user.PasswordHash
+				return nil
+			}
+		}
+		if user.CreatedAt.IsZero() {
+			user.CreatedAt = time.Now().UTC()
+		}
+		data.Users = append(data.Users, user)
+		return nil
+	})
+}
+
+func (s *jsonStore) RemoveUser(username string) error {
+	if s.root != nil {
+		return s.root.RemoveUser(username)
+	}
+	return s.updateAuth(func(data *authFileData) error {
+		before := len(data.Users)
+		data.Users = slices.DeleteFunc(data.Users, func(u User) bool { return u.Username == username })
+		if len(data.Users) == before {
+			return fmt.Errorf("user %s not found", username)
+		}
+		data.Tokens = slices.DeleteFunc(data.Tokens, func(t AuthToken) bool { return t.Username == username })
+		return nil
+	})
+}
+
+func (s *jsonStore) GetAuthTokens(username string) ([]AuthToken, error) {
+	if s.root != nil {
+		return s.root.GetAuthTokens(username)
+	}
+	defer s.mu.RUnlock()
+	if err := s.rlockAuth(); err != nil {
+		return nil, fmt.Errorf("failed to read auth file: %v", err)
+	}
+	tokens := []AuthToken{}
+	for _, token := range s.auth.Tokens {
+		if token.Username == username {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
+
+func (s *jsonStore) GetAuthTokenByHash(hash string) (AuthToken, error) {
+	if s.root != nil {
+		return s.root.GetAuthTokenByHash(hash)
+	}
+	defer s.mu.RUnlock()
+	if err := s.rlockAuth(); err != nil {
+		return AuthToken{}, fmt.Errorf("failed to read auth file: %v", err)
+	}
+	for _, token := range s.auth.Tokens {
+		if token.Hash == hash {
+			return token, nil
+		}
+	}
+	return AuthToken{}, fmt.Errorf("token not found")
+}
+
+func (s *jsonStore) AddAuthToken(token AuthToken) error {
+	if s.root != nil {
+		return s.root.AddAuthToken(token)
+	}
+	return s.updateAuth(func(data *authFileData) error {
+		data.Tokens = append(data.Tokens, token)
+		return nil
+	})
+}
+
+func (s *jsonStore) RemoveAuthToken(id string) error {
+	if s.root != nil {
+		return s.root.RemoveAuthToken(id)
+	}
+	return s.updateAuth(func(data *authFileData) error {
+		before := len(data.Tokens)
+		data.Tokens = slices.DeleteFunc(data.Tokens, func(t AuthToken) bool { return t.ID == id })
+		if len(data.Tokens) == before {
+			return fmt.Errorf("token with ID %s not found", id)
+		}
+		return nil
+	})
+}
+
+func (s *jsonStore) RemoveExpiredAuthTokens() error {
+	if s.root != nil {
+		return s.root.RemoveExpiredAuthTokens()
+	}
+	err := s.rlockAuth()
+	expired := err == nil && slices.ContainsFunc(s.auth.Tokens, func(t AuthToken) bool { return t.Expired() })
+	s.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to read auth file: %v", err)
+	}
+	if !expired {
+		return nil // avoids rewriting the file on every cleanup
+	}
+	return s.updateAuth(func(data *authFileData) error {
+		data.Tokens = slices.DeleteFunc(data.Tokens, func(t AuthToken) bool { return t.Expired() })
+		return nil
+	})
+}
@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"log"
+	"os"
+	"slices"
+)
+
+// The JSON store keeps both files in memory and serves reads from there. Writes go
+// through to disk immediately, and a file replaced or edited outside the app (detected
+// by identity, mtime and size) is reloaded on the next access.
+
+func fileChanged(path string, prev os.FileInfo) bool {
+	if prev == nil {
+		return true
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return true
+	}
+	return !os.SameFile(prev, info) || !info.ModTime().Equal(prev.ModTime()) || info.Size() != prev.Size()
+}
+
+func (s *jsonStore) cacheFresh() bool {
+	return !fileChanged(s.filePath, s.expensesInfo) && !fileChanged(s.configPath, s.configInfo)
+}
+
+// refresh reloads whichever file changed on disk; callers must hold the write lock
+func (s *jsonStore) refresh() error {
+	if fileChanged(s.filePath, s.expensesInfo) {
+		// stat before reading so a concurrent external edit triggers another reload
+		info, err := os.Stat(s.filePath)
+		if err != nil {
+			return err
+		}
+		data, sum, err := s.readExpensesFile(s.filePath)
+		if err != nil {
+			return err
+		}
+		if s.expensesInfo != nil {
+			log.Println("Reloaded expenses file changed on disk")
+		}
+		s.expenses = data.Expenses
+		s.expensesInfo = info
+		s.expensesSum, s.written = sum, expenseChecksums(data.Expenses)
+		s.reindex()
+	}
+	if fileChanged(s.configPath, s.configInfo) {
+		info, err := os.Stat(s.configPath)
+		if err != nil {
+			return err
+		}
+		config, sum, err := s.readConfigFile(s.configPath)
+		if err != nil {
+			return err
+		}
+		if s.configInfo != nil {
+			log.Println("Reloaded config file changed on disk")
+		}
+		s.config = config
+		s.configInfo = info
+		s.configSum = sum
+		s.defaults["currency"] = config.Currency
+	}
+	return nil
+}
+
+// rlockFresh takes the read lock with an up-to-date cache; callers must RUnlock even on error
+func (s *jsonStore) rlockFresh() error {
+	s.mu.RLock()
+	if s.cacheFresh() {
+		return nil
+	}
+	s.mu.RUnlock()
+	s.mu.Lock()
+	err := s.refresh()
+	s.mu.Unlock()
+	s.mu.RLock()
+	return err
+}
+
+// reindex rebuilds the ID, recurring ID and date indexes over s.expenses
+func (s *jsonStore) reindex() {
+	s.byID = make(map[string]int, len(s.expenses))
+	s.byRecurringID = map[string][]int{}
+	s.byDate = make([]int, len(s.expenses))
+	for i, exp := range s.expenses {
+		s.byID[exp.ID] = i
+		if exp.RecurringID != "" {
+			s.byRecurringID[exp.RecurringID] = append(s.byRecurringID[exp.RecurringID], i)
+		}
+		s.byDate[i] = i
+	}
+	slices.SortStableFunc(s.byDate, func(a, b int) int {
+		return s.expenses[a].Date.Compare(s.expenses[b].Date)
+	})
+}
+
+// saveExpenses writes the cached expenses through to disk; on failure the cache is
+// dropped so the next access reloads what is actually on disk
+func (s *jsonStore) saveExpenses() error {
+	if s.expenses == nil {
+		s.expenses = []Expense{}
+	}
+	if err := s.writeExpensesFile(s.filePath, &expensesFileData{Expenses: s.expenses}); err != nil {
+		s.expensesInfo = nil
+		return err
+	}
+	s.reindex()
+	info, err := os.Stat(s.filePath)
+	if err != nil {
+		s.expensesInfo = nil
+		return nil
+	}
+	s.expensesInfo = info
+	return nil
+}
+
+func (s *jsonStore) saveConfig() error {
+	if err := s.writeConfigFile(s.configPath, s.config); err != nil {
+		s.configInfo = nil
+		return err
+	}
+	s.defaults["currency"] = s.config.Currency
+	info, err := os.Stat(s.configPath)
+	if err != nil {
+		s.configInfo = nil
+		return nil
+	}
+	s.configInfo = info
+	return nil
+}
+
+// deep copies handed to callers, and taken from them, so neither side aliases the cache;
+// slices within expenses, recurring expenses and rules are copied too
+
+func cloneConfig(c *Config) *Config {
+	clone := *c
+	clone.Categories = slices.Clone(c.Categories)
+	clone.RecurringExpenses = slices.Clone(c.RecurringExpenses)
+	for i := range clone.RecurringExpenses {
+		clone.RecurringExpenses[i] = cloneRecurringExpense(clone.RecurringExpenses[i])
+	}
+	clone.CategoryRules = slices.Clone(c.CategoryRules)
+	for i := range clone.CategoryRules {
+		clone.CategoryRules[i] = cloneCategoryRule(clone.CategoryRules[i])
+	}
+	clone.CSVProfiles = slices.Clone(c.CSVProfiles)
+	clone.DismissedDuplicates = slices.Clone(c.DismissedDuplicates)
+	return &clone
+}
+
+func cloneExpense(e Expense) Expense {
+	e.Tags = slices.Clone(e.Tags)
+	e.SharedWith = slices.Clone(e.SharedWith)
+	return e
+}
+
+func cloneExpenses(expenses []Expense) []Expense {
+	clone := slices.Clone(expenses)
+	for i := range clone {
+		clone[i] = cloneExpense(clone[i])
+	}
+	return clone
+}
+
+func cloneRecurringExpense(r RecurringExpense) RecurringExpense {
+	r.Tags = slices.Clone(r.Tags)
+	r.SharedWith = slices.Clone(r.SharedWith)
+	return r
+}
+
+func cloneCategoryRule(rule CategoryRule) CategoryRule {
+	rule.Tags = slices.Clone(rule.Tags)
+	if rule.MinAmount != nil {
+		minAmount := *rule.MinAmount
+		rule.MinAmount = &minAmount
+	}
+	if rule.MaxAmount != nil {
+		maxAmount := *rule.MaxAmount
+		rule.MaxAmount = &maxAmount
+	}
+	return rule
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestJSONCacheDoesNotAliasCallers(t *testing.T) {
+	store, err := InitializeJsonStore(SystemConfig{StorageType: BackendTypeJSON, StorageURL: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	added := Expense{
+		ID:         "a",
+		Name:       "Groceries",
+		Category:   "Food",
+		Amount:     -12.5,
+		Date:       time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+		Tags:       []string{"weekly"},
+		SharedWith: []string{"bob"},
+	}
+	if err := store.AddExpense(added); err != nil {
+		t.Fatal(err)
+	}
+	added.Tags[0] = "changed by caller after add"
+
+	getters := map[string]func() ([]Expense, error){
+		"GetAllExpenses": store.GetAllExpenses,
+		"GetExpense": func() ([]Expense, error) {
+			expense, err := store.GetExpense("a")
+			return []Expense{expense}, err
+		},
+		"QueryExpenses": func() ([]Expense, error) {
+			result, err := store.QueryExpenses(ExpenseQuery{})
+			if err != nil {
+				return nil, err
+			}
+			return result.Expenses, nil
+		},
+	}
+	for name, get := range getters {
+		expenses, err := get()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		expenses[0].Tags[0] = "changed through " + name
+		expenses[0].SharedWith[0] = "changed through " + name
+	}
+
+	expense, err := store.GetExpense("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(expense.Tags, []string{"weekly"}) || !slices.Equal(expense.SharedWith, []string{"bob"}) {
+		t.Errorf("cached expense was changed through a returned copy: tags %v, shared with %v", expense.Tags, expense.SharedWith)
+	}
+}
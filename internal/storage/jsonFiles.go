@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// number of rotated .bak generations kept next to each JSON file
+const jsonBackupGenerations = 3
+
+// JSON files are never written in place: the old file is kept as path.bak.1 and the new
+// content is written to a temp file that is fsynced and renamed over it, so a crash leaves
+// either the old or the new file. A damaged file is restored from its newest valid backup;
+// the expense and config files of a ledger are also journaled, see jsonJournal.go.
+
+func backupPath(path string, generation int) string {
+	return fmt.Sprintf("%s.bak.%d", path, generation)
+}
+
+// shifts path.bak.N generations up by one and preserves the current file as path.bak.1
+func rotateBackups(path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	for gen := jsonBackupGenerations - 1; gen >= 1; gen-- {
+		if err := os.Rename(backupPath(path, gen), backupPath(path, gen+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	newest := backupPath(path, 1)
+	if err := os.Link(path, newest); err == nil {
+		return nil
+	}
+	return copyFile(path, newest)
+}
+
+func copyFile(src, dst string) error {
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, content, 0644)
+}
+
+// atomicWriteFile writes content to a temp file in the same directory, fsyncs it and
+// renames it over path, so readers see either the old or the new file and never a partial one
+func atomicWriteFile(path string, content []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) // no-op once renamed
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return err
+	}
+	// persist the rename itself; directories cannot be synced on every platform
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// recoverJSONFile checks that path holds valid JSON for target, restoring the newest valid
+// .bak generation otherwise; the damaged file is kept aside
+func recoverJSONFile(path string, target any) error {
+	content, err := os.ReadFile(path)
+	if err == nil {
+		if err = json.Unmarshal(content, target); err == nil {
+			return nil
+		}
+	}
+	log.Printf("Warning: %s is unreadable or corrupted: %v\n", filepath.Base(path), err)
+
+	type candidate struct {
+		source  string
+		content []byte
+	}
+	var candidates []candidate
+	for gen := 1; gen <= jsonBackupGenerations; gen++ {
+		if backup, readErr := os.ReadFile(backupPath(path, gen)); readErr == nil {
+			candidates = append(candidates, candidate{fmt.Sprintf("backup generation %d", gen), backup})
+		}
+	}
+
+	for _, c := range candidates {
+		if json.Unmarshal(c.content, target) != nil {
+			log.Printf("Warning: %s for %s is also corrupted\n", c.source, filepath.Base(path))
+			continue
+		}
+		if err := moveCorruptAside(path); err != nil {
+			return err
+		}
+		if err := atomicWriteFile(path, c.content, 0644); err != nil {
+			return fmt.Errorf("failed to restore %s: %v", c.source, err)
+		}
+		log.Printf("Restored %s from %s\n", filepath.Base(path), c.source)
+		return nil
+	}
+	return fmt.Errorf("%s is corrupted and no valid backup was found: %v", filepath.Base(path), err)
+}
+
+// moveCorruptAside keeps a damaged file as path.corrupt-<timestamp> before it is restored
+func moveCorruptAside(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	corrupt := fmt.Sprintf("%s.corrupt-%s", path, time.Now().UTC().Format("20060102T150405Z"))
+	if err := os.Rename(path, corrupt); err != nil {
+		return fmt.Errorf("failed to move corrupted file aside: %v", err)
+	}
+	log.Printf("Moved corrupted file to %s\n", filepath.Base(corrupt))
+	return nil
+}
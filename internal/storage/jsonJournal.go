@@ -0,0 +1,313 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// journal is compacted to the entries the backups still need once it grows past this size
+const journalCompactSize = 16 << 20
+
+// jsonJournal is the append-only write-ahead log of a ledger's expense and config files.
+// Every write is appended (and fsynced) here before the file is replaced: an expense write
+// records only the expenses it adds, changes or removes, a config write the whole (small)
+// config. Each entry names the checksum of the content it builds on, so on start a write that
+// did not reach its file is replayed, and a damaged file is rebuilt from its newest valid
+// backup and the writes journaled after it.
+type jsonJournal struct {
+	path string
+	mu   sync.Mutex
+	seq  int64
+}
+
+type journalEntry struct {
+	Seq      int64           `json:"seq"`
+	Time     time.Time       `json:"time"`
+	File     string          `json:"file,omitempty"`     // base name within the ledger directory
+	Base     string          `json:"base,omitempty"`     // checksum of the content the write changed
+	Checksum string          `json:"checksum,omitempty"` // checksum of the content written
+	Data     json.RawMessage `json:"data,omitempty"`     // whole content, for config writes
+	Upserts  []Expense       `json:"upserts,omitempty"`  // expenses added or changed
+	Deletes  []string        `json:"deletes,omitempty"`  // IDs of removed expenses
+	Aborted  int64           `json:"aborted,omitempty"`  // a write that failed after it was journaled
+}
+
+func newJSONJournal(dir string) *jsonJournal {
+	return &jsonJournal{path: filepath.Join(dir, "journal.log")}
+}
+
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// append journals entry under the next sequence number and returns it
+func (j *jsonJournal) append(entry journalEntry) (int64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entry.Seq = j.seq + 1
+	entry.Time = time.Now().UTC()
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(j.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return 0, err
+	}
+	if err := f.Sync(); err != nil {
+		return 0, err
+	}
+	j.seq = entry.Seq
+	return entry.Seq, nil
+}
+
+// abort marks a journaled write whose file could not be replaced, so it is never replayed
+func (j *jsonJournal) abort(seq int64) {
+	if _, err := j.append(journalEntry{Aborted: seq}); err != nil {
+		log.Printf("Warning: failed to journal the failed write %d: %v\n", seq, err)
+	}
+}
+
+// load reads the complete entries and continues their numbering; a torn trailing line from a
+// crash mid-append is cut off so the next entry starts on a line of its own
+func (j *jsonJournal) load() ([]journalEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	content, err := os.ReadFile(j.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if end := bytes.LastIndexByte(content, '\n') + 1; end < len(content) {
+		log.Println("Warning: ignoring incomplete trailing journal entry")
+		if err := os.Truncate(j.path, int64(end)); err != nil {
+			return nil, fmt.Errorf("failed to cut off the incomplete journal entry: %v", err)
+		}
+		content = content[:end]
+	}
+	var entries []journalEntry
+	reader := bufio.NewReader(bytes.NewReader(content))
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		var entry journalEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			log.Println("Warning: ignoring damaged journal entry")
+			continue
+		}
+		entries = append(entries, entry)
+		j.seq = max(j.seq, entry.Seq)
+	}
+	return entries, nil
+}
+
+// journalChain returns the writes of file that follow the content with checksum sum, oldest
+// first; when several writes build on the same content, the newest one is the one that counts
+func journalChain(entries []journalEntry, file, sum string) []journalEntry {
+	aborted := map[int64]bool{}
+	for _, e := range entries {
+		if e.Aborted != 0 {
+			aborted[e.Aborted] = true
+		}
+	}
+	var chain []journalEntry
+	var last int64
+	for {
+		next := -1
+		for i, e := range entries {
+			if e.File == file && e.Base == sum && e.Seq > last && !aborted[e.Seq] && (next < 0 || e.Seq > entries[next].Seq) {
+				next = i
+			}
+		}
+		if next < 0 {
+			return chain
+		}
+		chain = append(chain, entries[next])
+		sum, last = entries[next].Checksum, entries[next].Seq
+	}
+}
+
+// journals reports whether the journal holds writes of file, which then must not be created anew
+func journals(entries []journalEntry, file string) bool {
+	return slices.ContainsFunc(entries, func(e journalEntry) bool { return e.File == file })
+}
+
+// replayFunc applies journaled writes to the content of a file and returns the new content;
+// with no writes it only checks that the content is valid
+type replayFunc func(content []byte, chain []journalEntry) ([]byte, error)
+
+// replayConfig returns the content of the last write, which holds the whole config
+func replayConfig(content []byte, chain []journalEntry) ([]byte, error) {
+	if len(chain) > 0 {
+		content = chain[len(chain)-1].Data
+	}
+	var config Config
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, err
+	}
+	if len(chain) == 0 {
+		return content, nil
+	}
+	return json.MarshalIndent(config, "", "    ")
+}
+
+// replayExpenses applies the added, changed and removed expenses of each write in order
+func replayExpenses(content []byte, chain []journalEntry) ([]byte, error) {
+	var data expensesFileData
+	if err := json.Unmarshal(content, &data); err != nil {
+		return nil, err
+	}
+	if len(chain) == 0 {
+		return content, nil
+	}
+	for _, entry := range chain {
+		index := make(map[string]int, len(data.Expenses))
+		for i, e := range data.Expenses {
+			index[e.ID] = i
+		}
+		for _, e := range entry.Upserts {
+			if i, ok := index[e.ID]; ok {
+				data.Expenses[i] = e
+			} else {
+				index[e.ID] = len(data.Expenses)
+				data.Expenses = append(data.Expenses, e)
+			}
+		}
+		if len(entry.Deletes) > 0 {
+			deleted := make(map[string]bool, len(entry.Deletes))
+			for _, id := range entry.Deletes {
+				deleted[id] = true
+			}
+			data.Expenses = slices.DeleteFunc(data.Expenses, func(e Expense) bool { return deleted[e.ID] })
+		}
+	}
+	return json.MarshalIndent(data, "", "    ")
+}
+
+// recoverJournaledFile brings path up to date with the journal: writes that did not reach the
+// file are replayed, and a damaged file is rebuilt from its newest valid backup and the writes
+// journaled after it, keeping the damaged file aside
+func recoverJournaledFile(path string, entries []journalEntry, replay replayFunc) error {
+	file := filepath.Base(path)
+	content, err := os.ReadFile(path)
+	if err == nil {
+		_, err = replay(content, nil)
+	}
+	source := ""
+	if err != nil {
+		log.Printf("Warning: %s is unreadable or corrupted: %v\n", file, err)
+		content = nil
+		for gen := 1; gen <= jsonBackupGenerations; gen++ {
+			backup, readErr := os.ReadFile(backupPath(path, gen))
+			if readErr != nil {
+				continue
+			}
+			if _, replayErr := replay(backup, nil); replayErr != nil {
+				log.Printf("Warning: backup generation %d for %s is also corrupted\n", gen, file)
+				continue
+			}
+			content, source = backup, fmt.Sprintf("backup generation %d", gen)
+			break
+		}
+		if content == nil {
+			return fmt.Errorf("%s is corrupted and no valid backup was found: %v", file, err)
+		}
+	}
+
+	chain := journalChain(entries, file, checksum(content))
+	if source == "" && len(chain) == 0 {
+		return nil
+	}
+	restored, err := replay(content, chain)
+	if err != nil {
+		return fmt.Errorf("failed to replay the journal of %s: %v", file, err)
+	}
+	if source != "" {
+		if err := moveCorruptAside(path); err != nil {
+			return err
+		}
+	}
+	if err := rotateBackups(path); err != nil {
+		return fmt.Errorf("failed to rotate backups: %v", err)
+	}
+	if err := atomicWriteFile(path, restored, 0644); err != nil {
+		return fmt.Errorf("failed to restore %s: %v", file, err)
+	}
+	if source != "" {
+		log.Printf("Restored %s from %s and %d journaled writes\n", file, source, len(chain))
+	} else {
+		log.Printf("Replayed %d journaled writes that did not reach %s\n", len(chain), file)
+	}
+	return nil
+}
+
+// compact rewrites the journal once it gets large, keeping only the writes that follow the
+// oldest backup of each file, which are all a recovery can use
+func (j *jsonJournal) compact() error {
+	info, err := os.Stat(j.path)
+	if err != nil || info.Size() < journalCompactSize {
+		return nil
+	}
+	entries, err := j.load()
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	files := map[string]bool{}
+	for _, e := range entries {
+		if e.File != "" {
+			files[e.File] = true
+		}
+	}
+	keep := map[int64]bool{}
+	for file := range files {
+		path := filepath.Join(filepath.Dir(j.path), file)
+		oldest, err := os.ReadFile(path)
+		for gen := jsonBackupGenerations; gen >= 1; gen-- {
+			if backup, readErr := os.ReadFile(backupPath(path, gen)); readErr == nil {
+				oldest, err = backup, nil
+				break
+			}
+		}
+		if err != nil {
+			continue
+		}
+		for _, kept := range journalChain(entries, file, checksum(oldest)) {
+			keep[kept.Seq] = true
+		}
+	}
+	var content []byte
+	for _, e := range entries {
+		if !keep[e.Seq] {
+			continue
+		}
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		content = append(append(content, line...), '\n')
+	}
+	log.Println("Compacted journal")
+	return atomicWriteFile(j.path, content, 0644)
+}
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestJSONJournalRecovery(t *testing.T) {
+	// the files as they were before the last write of each, to stage a crash with
+	type before struct{ expenses, config []byte }
+	tests := []struct {
+		name     string
+		crash    func(t *testing.T, dir string, old before)
+		expenses []string
+		currency string
+	}{
+		{
+			name:     "no crash",
+			crash:    func(t *testing.T, dir string, old before) {},
+			expenses: []string{"Rent", "Coffee"},
+			currency: "eur",
+		},
+		{
+			name: "writes journaled but not renamed into place",
+			crash: func(t *testing.T, dir string, old before) {
+				writeTestFile(t, filepath.Join(dir, "expenses.json"), old.expenses)
+				writeTestFile(t, filepath.Join(dir, "config.json"), old.config)
+			},
+			expenses: []string{"Rent", "Coffee"},
+			currency: "eur",
+		},
+		{
+			name: "torn expenses and config files",
+			crash: func(t *testing.T, dir string, old before) {
+				for _, file := range []string{"expenses.json", "config.json"} {
+					path := filepath.Join(dir, file)
+					info, err := os.Stat(path)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if err := os.Truncate(path, info.Size()/2); err != nil {
+						t.Fatal(err)
+					}
+				}
+			},
+			expenses: []string{"Rent", "Coffee"},
+			currency: "eur",
+		},
+		{
+			name: "torn trailing journal entry",
+			crash: func(t *testing.T, dir string, old before) {
+				f, err := os.OpenFile(filepath.Join(dir, "journal.log"), os.O_APPEND|os.O_WRONLY, 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer f.Close()
+				if _, err := f.WriteString(`{"seq":99,"file":"expenses.json","upserts":[{"id":"c","na`); err != nil {
+					t.Fatal(err)
+				}
+			},
+			expenses: []string{"Rent", "Coffee"},
+			currency: "eur",
+		},
+		{
+			name: "file replaced outside the app",
+			crash: func(t *testing.T, dir string, old before) {
+				writeTestFile(t, filepath.Join(dir, "expenses.json"), []byte(`{"expenses": []}`))
+			},
+			expenses: nil,
+			currency: "eur",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			store, err := InitializeJsonStore(SystemConfig{StorageType: BackendTypeJSON, StorageURL: dir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			date := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+			if err := store.AddExpense(Expense{ID: "a", Name: "Rent", Category: "Rent", Amount: -900, Date: date}); err != nil {
+				t.Fatal(err)
+			}
+			var old before
+			old.expenses = readTestFile(t, filepath.Join(dir, "expenses.json"))
+			old.config = readTestFile(t, filepath.Join(dir, "config.json"))
+			if err := store.AddExpense(Expense{ID: "b", Name: "Coffee", Category: "Food", Amount: -3.5, Date: date}); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.UpdateCurrency("eur"); err != nil {
+				t.Fatal(err)
+			}
+
+			tt.crash(t, dir, old)
+			reopened, err := InitializeJsonStore(SystemConfig{StorageType: BackendTypeJSON, StorageURL: dir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkJSONStore(t, reopened, tt.expenses, tt.currency)
+
+			// the journal keeps working after the recovery
+			if err := reopened.AddExpense(Expense{ID: "c", Name: "Books", Category: "Shopping", Amount: -12, Date: date}); err != nil {
+				t.Fatal(err)
+			}
+			again, err := InitializeJsonStore(SystemConfig{StorageType: BackendTypeJSON, StorageURL: dir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkJSONStore(t, again, append(slices.Clone(tt.expenses), "Books"), tt.currency)
+		})
+	}
+}
+
+func checkJSONStore(t *testing.T, store Storage, names []string, currency string) {
+	t.Helper()
+	expenses, err := store.GetAllExpenses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range expenses {
+		got = append(got, e.Name)
+	}
+	if !slices.Equal(got, names) {
+		t.Errorf("expenses %v, want %v", got, names)
+	}
+	if c, err := store.GetCurrency(); err != nil || c != currency {
+		t.Errorf("currency %q (%v), want %q", c, err, currency)
+	}
+}
+
+func readTestFile(t *testing.T, path string) []byte {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func writeTestFile(t *testing.T, path string, content []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJournalChain(t *testing.T) {
+	write := func(seq int64, base, sum string) journalEntry {
+		return journalEntry{Seq: seq, File: "expenses.json", Base: base, Checksum: sum}
+	}
+	tests := []struct {
+		name    string
+		entries []journalEntry
+		from    string
+		want    []int64
+	}{
+		{"file is current", []journalEntry{write(1, "a", "b"), write(2, "b", "c")}, "c", nil},
+		{"writes after the file", []journalEntry{write(1, "a", "b"), write(2, "b", "c")}, "a", []int64{1, 2}},
+		{"failed write followed by another", []journalEntry{write(1, "a", "b"), {Seq: 2, Aborted: 1}, write(3, "a", "c")}, "a", []int64{3}},
+		{"failed last write", []journalEntry{write(1, "a", "b"), write(2, "b", "c"), {Seq: 3, Aborted: 2}}, "a", []int64{1}},
+		{"content seen before", []journalEntry{write(1, "a", "b"), write(2, "b", "a"), write(3, "a", "c")}, "a", []int64{3}},
+		{"other files", []journalEntry{{Seq: 1, File: "config.json", Base: "a", Checksum: "b"}}, "a", nil},
+	}
+	for _, tt := range tests {
+		var got []int64
+		for _, e := range journalChain(tt.entries, "expenses.json", tt.from) {
+			got = append(got, e.Seq)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: replayed %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
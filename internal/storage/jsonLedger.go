@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// the default ledger uses the files directly in the data directory, so existing data needs
+// no migration; every other ledger gets the same set of files (and its own journal and
+// backups) under ledgers/<id>/. The list of ledgers is kept in ledgers.json.
+
+type ledgersFileData struct {
+	Ledgers []Ledger `json:"ledgers"`
+}
+
+// rootStore is the store of the default ledger, which also owns users, tokens and ledgers
+func (s *jsonStore) rootStore() *jsonStore {
+	if s.root != nil {
+		return s.root
+	}
+	return s
+}
+
+func (s *jsonStore) ledgerDir(id string) string {
+	return filepath.Join(filepath.Dir(s.rootStore().ledgersPath), "ledgers", id)
+}
+
+func (s *jsonStore) readLedgers() ([]Ledger, error) {
+	content, err := os.ReadFile(s.rootStore().ledgersPath)
+	if os.IsNotExist(err) {
+		return []Ledger{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ledgers file: %v", err)
+	}
+	var data ledgersFileData
+	if err := json.Unmarshal(content, &data); err != nil {
+		return nil, fmt.Errorf("failed to parse ledgers file: %v", err)
+	}
+	return data.Ledgers, nil
+}
+
+// updateLedgers applies updater to the stored ledgers under the root's write lock and persists them
+func (s *jsonStore) updateLedgers(updater func(ledgers []Ledger) ([]Ledger, error)) error {
+	root := s.rootStore()
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	ledgers, err := root.readLedgers()
+	if err != nil {
+		return err
+	}
+	if ledgers, err = updater(ledgers); err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(ledgersFileData{Ledgers: ledgers}, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := root.commitFile(root.ledgersPath, content, 0644); err != nil {
+		return fmt.Errorf("failed to write ledgers file: %v", err)
+	}
+	log.Println("Wrote ledgers file")
+	return nil
+}
+
+func (s *jsonStore) GetLedgers() ([]Ledger, error) {
+	ledgers, err := s.readLedgers()
+	if err != nil {
+		return nil, err
+	}
+	return withDefaultLedger(ledgers), nil
+}
+
+func (s *jsonStore) GetLedger(id string) (Ledger, error) {
+	ledgers, err := s.readLedgers()
+	if err != nil {
+		return Ledger{}, err
+	}
+	return findLedger(ledgers, id)
+}
+
+func (s *jsonStore) AddLedger(ledger Ledger) error {
+	if err := ledger.Validate(); err != nil {
+		return err
+	}
+	if ledger.CreatedAt.IsZero() {
+		ledger.CreatedAt = time.Now().UTC()
+	}
+	return s.updateLedgers(func(ledgers []Ledger) ([]Ledger, error) {
+		if _, err := findLedger(ledgers, ledger.ID); err == nil {
+			return nil, fmt.Errorf("ledger %s already exists", ledger.ID)
+		}
+		if _, err := os.Stat(s.ledgerDir(ledger.ID)); err == nil {
+			return nil, fmt.Errorf("directory for ledger %s already exists", ledger.ID)
+		}
+		return append(ledgers, ledger), nil
+	})
+}
+
+func (s *jsonStore) UpdateLedger(ledger Ledger) error {
+	if err := ledger.Validate(); err != nil {
+		return err
+	}
+	return s.updateLedgers(func(ledgers []Ledger) ([]Ledger, error) {
+		existing, err := findLedger(ledgers, ledger.ID)
+		if err != nil {
+			return nil, err
+		}
+		existing.Name, existing.Archived = ledger.Name, ledger.Archived
+		// the default ledger is only stored once it is renamed
+		ledgers = slices.DeleteFunc(ledgers, func(l Ledger) bool { return l.ID == ledger.ID })
+		return append(ledgers, existing), nil
+	})
+}
+
+func (s *jsonStore) RemoveLedger(id string) error {
+	if id == DefaultLedgerID {
+		return fmt.Errorf("the default ledger cannot be deleted")
+	}
+	err := s.updateLedgers(func(ledgers []Ledger) ([]Ledger, error) {
+		if _, err := findLedger(ledgers, id); err != nil {
+			return nil, err
+		}
+		return slices.DeleteFunc(ledgers, func(l Ledger) bool { return l.ID == id }), nil
+	})
+	if err != nil {
+		return err
+	}
+	root := s.rootStore()
+	root.ledgerMu.Lock()
+	delete(root.ledgerStores, id)
+	root.ledgerMu.Unlock()
+	if err := os.RemoveAll(s.ledgerDir(id)); err != nil {
+		return fmt.Errorf("failed to delete ledger files: %v", err)
+	}
+	log.Printf("Deleted ledger %s\n", id)
+	return nil
+}
+
+// ForLedger opens a ledger's files on first use and keeps the store for later requests
+func (s *jsonStore) ForLedger(id string) (Storage, error) {
+	root := s.rootStore()
+	if id == "" || id == DefaultLedgerID {
+		return root, nil
+	}
+	if _, err := s.GetLedger(id); err != nil {
+		return nil, err
+	}
+	root.ledgerMu.Lock()
+	defer root.ledgerMu.Unlock()
+	if store, ok := root.ledgerStores[id]; ok {
+		return store, nil
+	}
+	store, err := openJSONLedger(s.ledgerDir(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ledger %s: %v", id, err)
+	}
+	store.root = root
+	root.ledgerStores[id] = store
+	return store, nil
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"time"
+)
+
+// conversion rates of the JSON store live in rates.json of the default ledger's directory,
+// which is only created once the first rate is saved; like the other files it is cached
+// in memory, since a full rate history is large
+
+type ratesFileData struct {
+	Rates []ConversionRate `json:"rates"`
+}
+
+// loadRates returns the cached rates, reloading rates.json if it changed; callers must
+// hold the root's write lock and must not modify the returned slice
+func (s *jsonStore) loadRates() ([]ConversionRate, error) {
+	root := s.rootStore()
+	if root.rates != nil && !fileChanged(root.ratesPath, root.ratesInfo) {
+		return root.rates, nil
+	}
+	info, err := os.Stat(root.ratesPath)
+	if os.IsNotExist(err) {
+		root.rates, root.ratesInfo = []ConversionRate{}, nil
+		return root.rates, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rates file: %v", err)
+	}
+	content, err := os.ReadFile(root.ratesPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rates file: %v", err)
+	}
+	var data ratesFileData
+	if err := json.Unmarshal(content, &data); err != nil {
+		return nil, fmt.Errorf("failed to parse rates file: %v", err)
+	}
+	sortRates(data.Rates)
+	root.rates, root.ratesInfo = data.Rates, info
+	return root.rates, nil
+}
+
+// updateRates applies updater to the stored rates under the root's write lock and persists them
+func (s *jsonStore) updateRates(updater func(rates []ConversionRate) ([]ConversionRate, error)) error {
+	root := s.rootStore()
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	rates, err := root.loadRates()
+	if err != nil {
+		return err
+	}
+	if rates, err = updater(slices.Clone(rates)); err != nil {
+		return err
+	}
+	sortRates(rates)
+	content, err := json.MarshalIndent(ratesFileData{Rates: rates}, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := root.commitFile(root.ratesPath, content, 0644); err != nil {
+		root.ratesInfo = nil
+		return fmt.Errorf("failed to write rates file: %v", err)
+	}
+	root.rates = rates
+	root.ratesInfo, _ = os.Stat(root.ratesPath)
+	log.Println("Wrote rates file")
+	return nil
+}
+
+func (s *jsonStore) GetConversionRates() ([]ConversionRate, error) {
+	root := s.rootStore()
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	rates, err := root.loadRates()
+	if err != nil {
+		return nil, err
+	}
+	return slices.Clone(rates), nil
+}
+
+func (s *jsonStore) SaveConversionRate(rate ConversionRate) error {
+	return s.SaveConversionRates([]ConversionRate{rate})
+}
+
+func (s *jsonStore) SaveConversionRates(newRates []ConversionRate) error {
+	byKey := make(map[rateKey]ConversionRate, len(newRates))
+	for _, rate := range newRates {
+		if err := rate.Validate(); err != nil {
+			return err
+		}
+		byKey[rate.key()] = rate
+	}
+	return s.updateRates(func(rates []ConversionRate) ([]ConversionRate, error) {
+		rates = slices.DeleteFunc(rates, func(r ConversionRate) bool {
+			_, replaced := byKey[r.key()]
+			return replaced
+		})
+		for _, rate := range byKey {
+			rates = append(rates, rate)
+		}
+		return rates, nil
+	})
+}
+
+func (s *jsonStore) RemoveConversionRate(from, to string, date time.Time) error {
+	day := rateDay(date)
+	return s.updateRates(func(rates []ConversionRate) ([]ConversionRate, error) {
+		remaining := slices.DeleteFunc(slices.Clone(rates), func(r ConversionRate) bool {
+			return r.From == from && r.To == to && r.EffectiveDate.Equal(day)
+		})
+		if len(remaining) == len(rates) {
+			return nil, fmt.Errorf("conversion rate %s/%s on %s not found", from, to, day.Format(time.DateOnly))
+		}
+		return remaining, nil
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"slices"
+	"sort"
 	"sync"
 	"time"
 
@@ -17,8 +18,39 @@ import (
 type jsonStore struct {
 	configPath string
 	filePath   string
+	journal    *jsonJournal
 	mu         sync.RWMutex
 	defaults   map[string]string // allows reusing defaults without querying for config
+
+	// what the files on disk hold, so that writes journal only what changed
+	expensesSum string            // checksum of the expenses file
+	configSum   string            // checksum of the config file
+	written     map[string]string // expense ID -> checksum of the expense as written
+
+	// in-memory cache, see jsonCache.go
+	config        *Config
+	expenses      []Expense
+	byID          map[string]int   // expense ID -> position in expenses
+	byRecurringID map[string][]int // recurring ID -> positions of its instances
+	byDate        []int            // positions in expenses ordered by date
+	configInfo    os.FileInfo
+	expensesInfo  os.FileInfo
+
+	// users and tokens, see jsonAuth.go
+	authPath string
+	auth     *authFileData
+	authInfo os.FileInfo
+
+	// ledgers other than the default live in subdirectories, see jsonLedger.go
+	root         *jsonStore // nil for the default ledger, which also holds users and ledgers
+	ledgersPath  string
+	ledgerMu     sync.Mutex
+	ledgerStores map[string]*jsonStore
+
+	// conversion rates shared by all ledgers, see jsonRates.go
+	ratesPath string
+	rates     []ConversionRate
+	ratesInfo os.FileInfo
 }
 
 type expensesFileData struct {
@@ -26,85 +58,173 @@ type expensesFileData struct {
 }
 
 func InitializeJsonStore(baseConfig SystemConfig) (*jsonStore, error) {
-	configPath := filepath.Join(baseConfig.StorageURL, "config.json")
-	filePath := filepath.Join(baseConfig.StorageURL, "expenses.json")
+	store, err := openJSONLedger(baseConfig.StorageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// auth, ledger and rate files are optional, but a damaged one must not silently lose data
+	store.authPath = filepath.Join(baseConfig.StorageURL, "auth.json")
+	if !isFreshJSONFile(store.authPath) {
+		if err := recoverJSONFile(store.authPath, &authFileData{}); err != nil {
+			return nil, fmt.Errorf("auth file check failed: %v", err)
+		}
+	}
+	store.ledgersPath = filepath.Join(baseConfig.StorageURL, "ledgers.json")
+	if !isFreshJSONFile(store.ledgersPath) {
+		if err := recoverJSONFile(store.ledgersPath, &ledgersFileData{}); err != nil {
+			return nil, fmt.Errorf("ledgers file check failed: %v", err)
+		}
+	}
+	store.ratesPath = filepath.Join(baseConfig.StorageURL, "rates.json")
+	if !isFreshJSONFile(store.ratesPath) {
+		if err := recoverJSONFile(store.ratesPath, &ratesFileData{}); err != nil {
+			return nil, fmt.Errorf("rates file check failed: %v", err)
+		}
+	}
+	store.ledgerStores = map[string]*jsonStore{}
+	return store, nil
+}
+
+// openJSONLedger prepares the expense and config files of one ledger in dir
+func openJSONLedger(dir string) (*jsonStore, error) {
+	configPath := filepath.Join(dir, "config.json")
+	filePath := filepath.Join(dir, "expenses.json")
 	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
 		return nil, fmt.Errorf("failed to create storage directory: %v", err)
 	}
 
-	// create expenses file if it doesn't exist
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	// finish any write interrupted by a crash before looking at the files
+	journal := newJSONJournal(dir)
+	entries, err := journal.load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal: %v", err)
+	}
+
+	// create expenses file if it doesn't exist, otherwise make sure it is readable and current
+	if isFreshJSONFile(filePath) && !journals(entries, filepath.Base(filePath)) {
 		initialData := expensesFileData{Expenses: []Expense{}}
 		data, err := json.Marshal(initialData)
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal initial data: %v", err)
 		}
-		if err := os.WriteFile(filePath, data, 0644); err != nil {
+		if err := atomicWriteFile(filePath, data, 0644); err != nil {
 			return nil, fmt.Errorf("failed to create storage file: %v", err)
 		}
 		log.Println("Created expense storage file")
 	} else {
+		if err := recoverJournaledFile(filePath, entries, replayExpenses); err != nil {
+			return nil, fmt.Errorf("expense storage file check failed: %v", err)
+		}
 		log.Println("Found existing expense storage file")
 	}
 
-	// create config file if it doesn't exist
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+	// create config file if it doesn't exist, otherwise make sure it is readable and current
+	if isFreshJSONFile(configPath) && !journals(entries, filepath.Base(configPath)) {
 		initialConfig := Config{}
 		initialConfig.SetBaseConfig()
 		data, err := json.Marshal(initialConfig)
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal initial config: %v", err)
 		}
-		if err := os.WriteFile(configPath, data, 0644); err != nil {
+		if err := atomicWriteFile(configPath, data, 0644); err != nil {
 			return nil, fmt.Errorf("failed to create config file: %v", err)
 		}
 		log.Println("Created expense storage config")
 	} else {
+		if err := recoverJournaledFile(configPath, entries, replayConfig); err != nil {
+			return nil, fmt.Errorf("expense storage config check failed: %v", err)
+		}
 		log.Println("Found existing expense storage config")
 	}
 
-	return &jsonStore{
+	store := &jsonStore{
 		configPath: configPath,
 		filePath:   filePath,
+		journal:    journal,
 		defaults:   map[string]string{},
-	}, nil
+	}
+	if err := store.refresh(); err != nil {
+		return nil, fmt.Errorf("failed to load storage files: %v", err)
+	}
+	return store, nil
+}
+
+// a file is only created from scratch when neither it nor a backup (or journaled write) of it exists
+func isFreshJSONFile(path string) bool {
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		return false
+	}
+	_, err := os.Stat(backupPath(path, 1))
+	return os.IsNotExist(err)
 }
 
 // primitive methods
 
-func (s *jsonStore) readExpensesFile(path string) (*expensesFileData, error) {
+// the read methods also return the checksum of the content, which the next write builds on
+
+func (s *jsonStore) readExpensesFile(path string) (*expensesFileData, string, error) {
 	content, err := os.ReadFile(path)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	var data expensesFileData
 	if err := json.Unmarshal(content, &data); err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	log.Println("Read expenses file")
-	return &data, nil
+	return &data, checksum(content), nil
 }
 
+// writeExpensesFile journals the expenses added, changed or removed since the last write,
+// then replaces the file
 func (s *jsonStore) writeExpensesFile(path string, data *expensesFileData) error {
 	content, err := json.MarshalIndent(data, "", "    ")
 	if err != nil {
 		return err
 	}
+	written := expenseChecksums(data.Expenses)
+	entry := journalEntry{File: filepath.Base(path), Base: s.expensesSum, Checksum: checksum(content)}
+	for _, e := range data.Expenses {
+		if s.written[e.ID] != written[e.ID] {
+			entry.Upserts = append(entry.Upserts, e)
+		}
+	}
+	for id := range s.written {
+		if _, ok := written[id]; !ok {
+			entry.Deletes = append(entry.Deletes, id)
+		}
+	}
+	slices.Sort(entry.Deletes)
+	if err := s.commitJournaled(path, content, entry); err != nil {
+		return err
+	}
+	s.expensesSum, s.written = entry.Checksum, written
 	log.Println("Wrote expenses file")
-	return os.WriteFile(path, content, 0644)
+	return nil
+}
+
+// expenseChecksums returns the checksum of each expense by ID, to find the ones a write changes
+func expenseChecksums(expenses []Expense) map[string]string {
+	sums := make(map[string]string, len(expenses))
+	for _, e := range expenses {
+		content, _ := json.Marshal(e)
+		sums[e.ID] = checksum(content)
+	}
+	return sums
 }
 
-func (s *jsonStore) readConfigFile(path string) (*Config, error) {
+func (s *jsonStore) readConfigFile(path string) (*Config, string, error) {
 	content, err := os.ReadFile(path)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	var data Config
 	if err := json.Unmarshal(content, &data); err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	log.Println("Read config file")
-	return &data, nil
+	return &data, checksum(content), nil
 }
 
 func (s *jsonStore) writeConfigFile(path string, data *Config) error {
@@ -112,8 +232,38 @@ func (s *jsonStore) writeConfigFile(path string, data *Config) error {
 	if err != nil {
 		return err
 	}
+	entry := journalEntry{File: filepath.Base(path), Base: s.configSum, Checksum: checksum(content), Data: content}
+	if err := s.commitJournaled(path, content, entry); err != nil {
+		return err
+	}
+	s.configSum = entry.Checksum
 	log.Println("Wrote config file")
-	return os.WriteFile(path, content, 0644)
+	return nil
+}
+
+// commitJournaled journals a write before committing it; a write whose file could not be
+// replaced is marked in the journal so that it is not replayed
+func (s *jsonStore) commitJournaled(path string, content []byte, entry journalEntry) error {
+	seq, err := s.journal.append(entry)
+	if err != nil {
+		return fmt.Errorf("failed to write journal: %v", err)
+	}
+	if err := s.commitFile(path, content, 0644); err != nil {
+		s.journal.abort(seq)
+		return err
+	}
+	if err := s.journal.compact(); err != nil {
+		log.Printf("Warning: failed to compact journal: %v\n", err)
+	}
+	return nil
+}
+
+// keeps the old file as a backup, then atomically replaces it
+func (s *jsonStore) commitFile(path string, content []byte, perm os.FileMode) error {
+	if err := rotateBackups(path); err != nil {
+		return fmt.Errorf("failed to rotate backups: %v", err)
+	}
+	return atomicWriteFile(path, content, perm)
 }
 
 // ------------------------------------------------------------
@@ -125,9 +275,24 @@ func (s *jsonStore) Close() error {
 }
 
 func (s *jsonStore) GetConfig() (*Config, error) {
-	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.readConfigFile(s.configPath)
+	if err := s.rlockFresh(); err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+	return cloneConfig(s.config), nil
+}
+
+// updateConfig applies updater to the cached config under the write lock and persists it
+func (s *jsonStore) updateConfig(updater func(c *Config) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refresh(); err != nil {
+		return fmt.Errorf("failed to read config file: %v", err)
+	}
+	if err := updater(s.config); err != nil {
+		return err
+	}
+	return s.saveConfig()
 }
 
 // Basic Config Updates
@@ -141,14 +306,10 @@ func (s *jsonStore) GetCategories() ([]string, error) {
 }
 
 func (s *jsonStore) UpdateCategories(categories []string) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	data, err := s.readConfigFile(s.configPath)
-	if err != nil {
-		return fmt.Errorf("failed to read config file: %v", err)
-	}
-	data.Categories = categories
-	return s.writeConfigFile(s.configPath, data)
+	return s.updateConfig(func(c *Config) error {
+		c.Categories = slices.Clone(categories)
+		return nil
+	})
 }
 
 func (s *jsonStore) GetCurrency() (string, error) {
@@ -163,15 +324,10 @@ func (s *jsonStore) UpdateCurrency(currency string) error {
 	if !slices.Contains(SupportedCurrencies, currency) {
 		return fmt.Errorf("invalid currency: %s", currency)
 	}
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	data, err := s.readConfigFile(s.configPath)
-	if err != nil {
-		return fmt.Errorf("failed to read config file: %v", err)
-	}
-	data.Currency = currency
-	s.defaults["currency"] = currency
-	return s.writeConfigFile(s.configPath, data)
+	return s.updateConfig(func(c *Config) error {
+		c.Currency = currency
+		return nil
+	})
 }
 
 func (s *jsonStore) GetStartDate() (int, error) {
@@ -186,15 +342,80 @@ func (s *jsonStore) UpdateStartDate(startDate int) error {
 	if startDate < 1 || startDate > 31 {
 		return fmt.Errorf("invalid start date: %d", startDate)
 	}
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	data, err := s.readConfigFile(s.configPath)
+	return s.updateConfig(func(c *Config) error {
+		c.StartDate = startDate
+		s.defaults["start_date"] = fmt.Sprintf("%d", startDate)
+		return nil
+	})
+}
+
+func (s *jsonStore) GetCategoryRules() ([]CategoryRule, error) {
+	config, err := s.GetConfig()
 	if err != nil {
-		return fmt.Errorf("failed to read config file: %v", err)
+		return nil, err
+	}
+	if config.CategoryRules == nil { // config files written before rules existed
+		return []CategoryRule{}, nil
+	}
+	return config.CategoryRules, nil
+}
+
+func (s *jsonStore) UpdateCategoryRules(rules []CategoryRule) error {
+	rules, err := ValidateCategoryRules(rules)
+	if err != nil {
+		return err
+	}
+	return s.updateConfig(func(c *Config) error {
+		c.CategoryRules = make([]CategoryRule, len(rules))
+		for i, rule := range rules {
+			c.CategoryRules[i] = cloneCategoryRule(rule)
+		}
+		return nil
+	})
+}
+
+func (s *jsonStore) GetCSVProfiles() ([]CSVProfile, error) {
+	config, err := s.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config.CSVProfiles == nil {
+		return []CSVProfile{}, nil
 	}
-	data.StartDate = startDate
-	s.defaults["start_date"] = fmt.Sprintf("%d", startDate)
-	return s.writeConfigFile(s.configPath, data)
+	return config.CSVProfiles, nil
+}
+
+func (s *jsonStore) SaveCSVProfile(profile CSVProfile) error {
+	if err := profile.Validate(); err != nil {
+		return err
+	}
+	return s.updateConfig(func(c *Config) error {
+		c.setCSVProfile(profile)
+		return nil
+	})
+}
+
+func (s *jsonStore) RemoveCSVProfile(name string) error {
+	return s.updateConfig(func(c *Config) error {
+		return c.removeCSVProfile(name)
+	})
+}
+
+func (s *jsonStore) GetDismissedDuplicates() ([]string, error) {
+	config, err := s.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config.DismissedDuplicates == nil {
+		return []string{}, nil
+	}
+	return config.DismissedDuplicates, nil
+}
+
+func (s *jsonStore) DismissDuplicates(ids []string) error {
+	return s.updateConfig(func(c *Config) error {
+		return c.dismissDuplicates(ids)
+	})
 }
 
 func (s *jsonStore) GetRecurringExpenses() ([]RecurringExpense, error) {
@@ -221,9 +442,8 @@ func (s *jsonStore) GetRecurringExpense(id string) (RecurringExpense, error) {
 func (s *jsonStore) AddRecurringExpense(recurringExpense RecurringExpense) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	config, err := s.readConfigFile(s.configPath)
-	if err != nil {
-		return fmt.Errorf("failed to read config file: %v", err)
+	if err := s.refresh(); err != nil {
+		return fmt.Errorf("failed to read storage: %v", err)
 	}
 	if recurringExpense.ID == "" {
 		recurringExpense.ID = uuid.New().String()
@@ -231,24 +451,59 @@ func (s *jsonStore) AddRecurringExpense(recurringExpense RecurringExpense) error
 	if recurringExpense.Currency == "" {
 		recurringExpense.Currency = s.defaults["currency"]
 	}
-	config.RecurringExpenses = append(config.RecurringExpenses, recurringExpense)
-	if err := s.writeConfigFile(s.configPath, config); err != nil {
+	s.config.RecurringExpenses = append(s.config.RecurringExpenses, cloneRecurringExpense(recurringExpense))
+	if err := s.saveConfig(); err != nil {
 		return fmt.Errorf("failed to write config file: %v", err)
 	}
 	expensesToAdd := generateExpensesFromRecurring(recurringExpense, false)
-	return s.AddMultipleExpenses(expensesToAdd)
+	return s.addExpenses(expensesToAdd)
+}
+
+func (s *jsonStore) AddRecurringExpenseRule(recurringExpense RecurringExpense) error {
+	if recurringExpense.ID == "" {
+		recurringExpense.ID = uuid.New().String()
+	}
+	return s.updateConfig(func(c *Config) error {
+		if recurringExpense.Currency == "" {
+			recurringExpense.Currency = c.Currency
+		}
+		c.RecurringExpenses = append(c.RecurringExpenses, cloneRecurringExpense(recurringExpense))
+		return nil
+	})
+}
+
+// drops instances of a recurring expense; with all unset, past instances are kept
+func (s *jsonStore) removeRecurringInstances(id string, all bool) {
+	instances := s.byRecurringID[id]
+	if len(instances) == 0 {
+		return
+	}
+	today := time.Now()
+	drop := make(map[int]struct{}, len(instances))
+	for _, i := range instances {
+		if all || s.expenses[i].Date.After(today) {
+			drop[i] = struct{}{}
+		}
+	}
+	remaining := make([]Expense, 0, len(s.expenses)-len(drop))
+	for i, exp := range s.expenses {
+		if _, ok := drop[i]; !ok {
+			remaining = append(remaining, exp)
+		}
+	}
+	s.expenses = remaining
+	s.reindex()
 }
 
 func (s *jsonStore) RemoveRecurringExpense(id string, removeAll bool) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	config, err := s.readConfigFile(s.configPath)
-	if err != nil {
-		return fmt.Errorf("failed to read config file: %v", err)
+	if err := s.refresh(); err != nil {
+		return fmt.Errorf("failed to read storage: %v", err)
 	}
 	var found bool
 	var updatedRecurringExpenses []RecurringExpense
-	for _, r := range config.RecurringExpenses {
+	for _, r := range s.config.RecurringExpenses {
 		if r.ID == id {
 			found = true
 		} else {
@@ -258,44 +513,28 @@ func (s *jsonStore) RemoveRecurringExpense(id string, removeAll bool) error {
 	if !found {
 		return fmt.Errorf("recurring expense with ID %s not found", id)
 	}
-	config.RecurringExpenses = updatedRecurringExpenses
-	expensesData, err := s.readExpensesFile(s.filePath)
-	if err != nil {
-		return fmt.Errorf("failed to read storage file: %v", err)
-	}
-	var updatedExpenses []Expense
-	today := time.Now()
-	for _, exp := range expensesData.Expenses {
-		if exp.RecurringID != id {
-			updatedExpenses = append(updatedExpenses, exp)
-			continue
-		}
-		if !removeAll && !exp.Date.After(today) {
-			updatedExpenses = append(updatedExpenses, exp)
-		}
-	}
-	expensesData.Expenses = updatedExpenses
-	if err := s.writeExpensesFile(s.filePath, expensesData); err != nil {
+	s.config.RecurringExpenses = updatedRecurringExpenses
+	s.removeRecurringInstances(id, removeAll)
+	if err := s.saveExpenses(); err != nil {
 		return err
 	}
-	return s.writeConfigFile(s.configPath, config)
+	return s.saveConfig()
 }
 
 func (s *jsonStore) UpdateRecurringExpense(id string, recurringExpense RecurringExpense, updateAll bool) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	config, err := s.readConfigFile(s.configPath)
-	if err != nil {
-		return fmt.Errorf("failed to read config file: %v", err)
+	if err := s.refresh(); err != nil {
+		return fmt.Errorf("failed to read storage: %v", err)
 	}
 	var found bool
-	for i, r := range config.RecurringExpenses {
+	for i, r := range s.config.RecurringExpenses {
 		if r.ID == id {
 			recurringExpense.ID = id // Ensure ID is preserved
 			if recurringExpense.Currency == "" {
 				recurringExpense.Currency = s.defaults["currency"]
 			}
-			config.RecurringExpenses[i] = recurringExpense
+			s.config.RecurringExpenses[i] = cloneRecurringExpense(recurringExpense)
 			found = true
 			break
 		}
@@ -303,54 +542,76 @@ func (s *jsonStore) UpdateRecurringExpense(id string, recurringExpense Recurring
 	if !found {
 		return fmt.Errorf("recurring expense with ID %s not found", id)
 	}
-	expensesData, err := s.readExpensesFile(s.filePath)
-	if err != nil {
-		return fmt.Errorf("failed to read storage file: %v", err)
-	}
-	var remainingExpenses []Expense
-	today := time.Now()
-	for _, exp := range expensesData.Expenses {
-		if exp.RecurringID != id {
-			remainingExpenses = append(remainingExpenses, exp)
-			continue
-		}
-		if !updateAll && !exp.Date.After(today) {
-			remainingExpenses = append(remainingExpenses, exp)
-		}
-	}
-	expensesData.Expenses = remainingExpenses
+	s.removeRecurringInstances(id, updateAll)
 	expensesToAdd := generateExpensesFromRecurring(recurringExpense, !updateAll)
-	expensesData.Expenses = append(expensesData.Expenses, expensesToAdd...)
-	if err := s.writeExpensesFile(s.filePath, expensesData); err != nil {
+	s.expenses = append(s.expenses, cloneExpenses(expensesToAdd)...)
+	if err := s.saveExpenses(); err != nil {
 		return err
 	}
-	return s.writeConfigFile(s.configPath, config)
+	return s.saveConfig()
 }
 
 // Expenses
 
 func (s *jsonStore) GetAllExpenses() ([]Expense, error) {
-	s.mu.RLock()
 	defer s.mu.RUnlock()
-	data, err := s.readExpensesFile(s.filePath)
-	if err != nil {
+	if err := s.rlockFresh(); err != nil {
 		return nil, fmt.Errorf("failed to read storage file: %v", err)
 	}
-	return data.Expenses, nil
+	return cloneExpenses(s.expenses), nil
 }
 
-func (s *jsonStore) GetExpense(id string) (Expense, error) {
-	s.mu.RLock()
+func (s *jsonStore) QueryExpenses(query ExpenseQuery) (*ExpenseQueryResult, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
 	defer s.mu.RUnlock()
-	data, err := s.readExpensesFile(s.filePath)
+	if err := s.rlockFresh(); err != nil {
+		return nil, fmt.Errorf("failed to read storage file: %v", err)
+	}
+	// narrow to the date range through the date index before applying the other filters
+	start, end := 0, len(s.byDate)
+	if !query.From.IsZero() {
+		start = sort.Search(len(s.byDate), func(i int) bool { return !s.expenses[s.byDate[i]].Date.Before(query.From) })
+	}
+	if !query.To.IsZero() {
+		end = sort.Search(len(s.byDate), func(i int) bool { return !s.expenses[s.byDate[i]].Date.Before(query.To) })
+	}
+	matched := []Expense{}
+	for _, i := range s.byDate[start:max(start, end)] {
+		if query.Matches(s.expenses[i]) {
+			matched = append(matched, cloneExpense(s.expenses[i]))
+		}
+	}
+	return query.sortAndPage(matched), nil
+}
+
+func (s *jsonStore) SummarizeExpenses(query SummaryQuery) (*Summary, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	result, err := s.QueryExpenses(query.Filter)
 	if err != nil {
+		return nil, err
+	}
+	config, err := s.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	rates, err := s.GetConversionRates()
+	if err != nil {
+		return nil, err
+	}
+	return summarizeExpenses(result.Expenses, query, config.StartDate, config.Currency, rates)
+}
+
+func (s *jsonStore) GetExpense(id string) (Expense, error) {
+	defer s.mu.RUnlock()
+	if err := s.rlockFresh(); err != nil {
 		return Expense{}, fmt.Errorf("failed to read storage file: %v", err)
 	}
-	for i, exp := range data.Expenses {
-		if exp.ID == id {
-			log.Printf("Retrieved expense with ID %s\n", id)
-			return data.Expenses[i], nil
-		}
+	if i, ok := s.byID[id]; ok {
+		return cloneExpense(s.expenses[i]), nil
 	}
 	return Expense{}, fmt.Errorf("expense with ID %s not found", id)
 }
@@ -358,8 +619,7 @@ func (s *jsonStore) GetExpense(id string) (Expense, error) {
 func (s *jsonStore) AddExpense(expense Expense) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	data, err := s.readExpensesFile(s.filePath)
-	if err != nil {
+	if err := s.refresh(); err != nil {
 		return fmt.Errorf("failed to read storage file: %v", err)
 	}
 	if expense.ID == "" {
@@ -371,47 +631,79 @@ func (s *jsonStore) AddExpense(expense Expense) error {
 	if expense.Date.IsZero() {
 		expense.Date = time.Now()
 	}
-	data.Expenses = append(data.Expenses, expense)
+	s.expenses = append(s.expenses, cloneExpense(expense))
 	log.Printf("Added expense with ID %s\n", expense.ID)
-	return s.writeExpensesFile(s.filePath, data)
+	return s.saveExpenses()
 }
 
 func (s *jsonStore) RemoveExpense(id string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	data, err := s.readExpensesFile(s.filePath)
-	if err != nil {
+	if err := s.refresh(); err != nil {
 		return fmt.Errorf("failed to read storage file: %v", err)
 	}
-	found := false
-	newExpenses := make([]Expense, 0, len(data.Expenses)-1)
-	for _, exp := range data.Expenses {
-		if exp.ID != id {
-			newExpenses = append(newExpenses, exp)
-		} else {
-			found = true
-		}
-	}
+	i, found := s.byID[id]
 	if !found {
 		log.Printf("Expense with ID %s not found\n", id)
 		return fmt.Errorf("expense with ID %s not found", id)
 	}
+	s.expenses = slices.Delete(s.expenses, i, i+1)
 	log.Printf("Deleted expense with ID %s\n", id)
-	data.Expenses = newExpenses
-	return s.writeExpensesFile(s.filePath, data)
+	return s.saveExpenses()
+}
+
+// addExpenses appends expenses and persists them; callers must hold the write lock
+func (s *jsonStore) addExpenses(expensesToAdd []Expense) error {
+	if len(expensesToAdd) == 0 {
+		return nil
+	}
+	s.expenses = append(s.expenses, cloneExpenses(expensesToAdd)...)
+	log.Printf("Added %d new expenses\n", len(expensesToAdd))
+	return s.saveExpenses()
 }
 
 func (s *jsonStore) AddMultipleExpenses(expensesToAdd []Expense) error {
 	if len(expensesToAdd) == 0 {
 		return nil
 	}
-	data, err := s.readExpensesFile(s.filePath)
-	if err != nil {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refresh(); err != nil {
 		return fmt.Errorf("failed to read storage file: %v", err)
 	}
-	data.Expenses = append(data.Expenses, expensesToAdd...)
-	log.Printf("Added %d new recurring expense instances\n", len(expensesToAdd))
-	return s.writeExpensesFile(s.filePath, data)
+	// fills in the same defaults as AddExpense, without changing the caller's slice
+	expensesToAdd = cloneExpenses(expensesToAdd)
+	for i := range expensesToAdd {
+		if expensesToAdd[i].ID == "" {
+			expensesToAdd[i].ID = uuid.New().String()
+		}
+		if expensesToAdd[i].Currency == "" {
+			expensesToAdd[i].Currency = s.defaults["currency"]
+		}
+		if expensesToAdd[i].Date.IsZero() {
+			expensesToAdd[i].Date = time.Now()
+		}
+	}
+	return s.addExpenses(expensesToAdd)
+}
+
+// ImportExpenses collects all batches first, so the expenses file is rewritten once
+func (s *jsonStore) ImportExpenses(next func() ([]Expense, error)) (int, error) {
+	var expenses []Expense
+	for {
+		batch, err := next()
+		if err != nil {
+			return 0, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		expenses = append(expenses, batch...)
+	}
+	if err := s.AddMultipleExpenses(expenses); err != nil {
+		return 0, err
+	}
+	return len(expenses), nil
 }
 
 func (s *jsonStore) RemoveMultipleExpenses(ids []string) error {
@@ -420,17 +712,16 @@ func (s *jsonStore) RemoveMultipleExpenses(ids []string) error {
 	if len(ids) == 0 {
 		return nil
 	}
-	data, err := s.readExpensesFile(s.filePath)
-	if err != nil {
+	if err := s.refresh(); err != nil {
 		return fmt.Errorf("failed to read storage file: %v", err)
 	}
 	idsToRemove := make(map[string]struct{}, len(ids))
 	for _, id := range ids {
 		idsToRemove[id] = struct{}{}
 	}
-	originalCount := len(data.Expenses)
+	originalCount := len(s.expenses)
 	newExpenses := make([]Expense, 0, originalCount)
-	for _, exp := range data.Expenses {
+	for _, exp := range s.expenses {
 		if _, found := idsToRemove[exp.ID]; !found {
 			newExpenses = append(newExpenses, exp)
 		}
@@ -440,33 +731,74 @@ func (s *jsonStore) RemoveMultipleExpenses(ids []string) error {
 		return nil
 	}
 	log.Printf("Removed %d expenses\n", originalCount-len(newExpenses))
-	data.Expenses = newExpenses
-	return s.writeExpensesFile(s.filePath, data)
+	s.expenses = newExpenses
+	return s.saveExpenses()
 }
 
 func (s *jsonStore) UpdateExpense(id string, expense Expense) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	data, err := s.readExpensesFile(s.filePath)
-	if err != nil {
+	if err := s.refresh(); err != nil {
 		return fmt.Errorf("failed to read storage file: %v", err)
 	}
-	found := false
-	for i, exp := range data.Expenses {
-		if exp.ID == id {
-			data.Expenses[i] = expense
-			data.Expenses[i].ID = id
-			if data.Expenses[i].Currency == "" {
-				data.Expenses[i].Currency = s.defaults["currency"]
-			}
-			found = true
-			break
-		}
-	}
+	i, found := s.byID[id]
 	if !found {
 		log.Printf("expense with ID %s not found\n", id)
 		return fmt.Errorf("expense with ID %s not found", id)
 	}
+	s.expenses[i] = cloneExpense(expense)
+	s.expenses[i].ID = id
+	if s.expenses[i].Currency == "" {
+		s.expenses[i].Currency = s.defaults["currency"]
+	}
 	log.Printf("Edited expense with ID %s\n", id)
-	return s.writeExpensesFile(s.filePath, data)
+	return s.saveExpenses()
+}
+
+func (s *jsonStore) MergeExpenses(kept Expense, remove []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refresh(); err != nil {
+		return fmt.Errorf("failed to read storage file: %v", err)
+	}
+	i, found := s.byID[kept.ID]
+	if !found {
+		return fmt.Errorf("expense with ID %s not found", kept.ID)
+	}
+	s.expenses[i] = cloneExpense(kept)
+	if s.expenses[i].Currency == "" {
+		s.expenses[i].Currency = s.defaults["currency"]
+	}
+	removed := make(map[string]bool, len(remove))
+	for _, id := range remove {
+		removed[id] = true
+	}
+	s.expenses = slices.DeleteFunc(s.expenses, func(e Expense) bool { return removed[e.ID] })
+	log.Printf("Merged %d expenses into expense with ID %s\n", len(remove), kept.ID)
+	return s.saveExpenses()
+}
+
+func (s *jsonStore) UpdateMultipleExpenses(expenses []Expense) error {
+	if len(expenses) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refresh(); err != nil {
+		return fmt.Errorf("failed to read storage file: %v", err)
+	}
+	// nothing is changed unless every expense exists
+	for _, exp := range expenses {
+		if _, found := s.byID[exp.ID]; !found {
+			return fmt.Errorf("expense with ID %s not found", exp.ID)
+		}
+	}
+	for _, exp := range expenses {
+		if exp.Currency == "" {
+			exp.Currency = s.defaults["currency"]
+		}
+		s.expenses[s.byID[exp.ID]] = cloneExpense(exp)
+	}
+	log.Printf("Edited %d expenses\n", len(expenses))
+	return s.saveExpenses()
 }
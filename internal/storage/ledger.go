@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"time"
+)
+
+// a ledger (book) is an independent set of config, recurring rules and expenses; the
+// default ledger always exists and holds the data from before ledgers were added
+type Ledger struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Archived  bool      `json:"archived"` // archived ledgers are read-only and hidden by default
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+const DefaultLedgerID = "default"
+
+// ledger IDs appear in URLs and directory names, so they are kept to a safe slug
+var reLedgerID = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+func ValidateLedgerID(id string) error {
+	if !reLedgerID.MatchString(id) {
+		return fmt.Errorf("ledger id must be 1-64 lowercase letters, digits, '-' or '_'")
+	}
+	return nil
+}
+
+func (l *Ledger) Validate() error {
+	if err := ValidateLedgerID(l.ID); err != nil {
+		return err
+	}
+	l.Name = SanitizeString(l.Name)
+	if l.Name == "" {
+		return fmt.Errorf("ledger name cannot be empty")
+	}
+	if l.ID == DefaultLedgerID && l.Archived {
+		return fmt.Errorf("the default ledger cannot be archived")
+	}
+	return nil
+}
+
+func defaultLedger() Ledger {
+	return Ledger{ID: DefaultLedgerID, Name: "Default"}
+}
+
+// withDefaultLedger adds the implicit default ledger unless it was stored (e.g., renamed)
+// and orders the list with the default ledger first
+func withDefaultLedger(ledgers []Ledger) []Ledger {
+	if !slices.ContainsFunc(ledgers, func(l Ledger) bool { return l.ID == DefaultLedgerID }) {
+		ledgers = append(ledgers, defaultLedger())
+	}
+	sort.Slice(ledgers, func(i, j int) bool {
+		if (ledgers[i].ID == DefaultLedgerID) != (ledgers[j].ID == DefaultLedgerID) {
+			return ledgers[i].ID == DefaultLedgerID
+		}
+		return ledgers[i].ID < ledgers[j].ID
+	})
+	return ledgers
+}
+
+func findLedger(ledgers []Ledger, id string) (Ledger, error) {
+	for _, l := range withDefaultLedger(ledgers) {
+		if l.ID == id {
+			return l, nil
+		}
+	}
+	return Ledger{}, fmt.Errorf("ledger %s not found", id)
+}
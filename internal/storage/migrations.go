@@ -0,0 +1,260 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schema steps live in migrations/<dialect>/NNNN_name.sql and are applied in version order;
+// released steps must never be edited, add a new step instead
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+type sqlDialect string
+
+const (
+	dialectPostgres sqlDialect = "postgres"
+	dialectSQLite   sqlDialect = "sqlite"
+)
+
+const createMigrationsTableSQL = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		checksum VARCHAR(64) NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL
+	);`
+
+type schemaMigration struct {
+	Version  int
+	Name     string
+	SQL      string
+	Checksum string
+}
+
+// MigrationStatus describes how a database schema compares to the embedded migrations
+type MigrationStatus struct {
+	Applied  []int    `json:"applied"`
+	Pending  []string `json:"pending"`  // embedded steps not yet applied
+	Unknown  []int    `json:"unknown"`  // applied steps this binary does not know about
+	Modified []string `json:"modified"` // applied steps whose SQL has changed since
+}
+
+func (m *MigrationStatus) InSync() bool {
+	return len(m.Pending) == 0 && len(m.Unknown) == 0 && len(m.Modified) == 0
+}
+
+func (d sqlDialect) insertMigrationSQL() string {
+	if d == dialectPostgres {
+		return `INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES ($1, $2, $3, $4)`
+	}
+	return `INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)`
+}
+
+func (d sqlDialect) migrationsTableExistsSQL() string {
+	if d == dialectPostgres {
+		return `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = 'schema_migrations'`
+	}
+	return `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`
+}
+
+func loadMigrations(dialect sqlDialect) ([]schemaMigration, error) {
+	dir := path.Join("migrations", string(dialect))
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedded migrations: %v", err)
+	}
+	var migrations []schemaMigration
+	seen := map[int]string{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), ".sql")
+		prefix, _, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration file name %s: %v", entry.Name(), err)
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("duplicate migration version %d: %s and %s", version, other, name)
+		}
+		seen[version] = name
+		content, err := migrationFiles.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %v", entry.Name(), err)
+		}
+		sum := sha256.Sum256(content)
+		migrations = append(migrations, schemaMigration{
+			Version:  version,
+			Name:     name,
+			SQL:      string(content),
+			Checksum: hex.EncodeToString(sum[:]),
+		})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// returns version -> checksum of applied steps, or an empty map if none were ever applied
+func readAppliedMigrations(db *sql.DB, dialect sqlDialect) (map[int]string, error) {
+	var count int
+	if err := db.QueryRow(dialect.migrationsTableExistsSQL()).Scan(&count); err != nil {
+		return nil, fmt.Errorf("failed to look up schema_migrations table: %v", err)
+	}
+	applied := map[int]string{}
+	if count == 0 {
+		return applied, nil
+	}
+	rows, err := db.Query(`SELECT version, checksum FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schema_migrations: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		var checksum string
+		if err := rows.Scan(&version, &checksum); err != nil {
+			return nil, fmt.Errorf("failed to scan schema_migrations: %v", err)
+		}
+		applied[version] = checksum
+	}
+	return applied, rows.Err()
+}
+
+func checkMigrations(db *sql.DB, dialect sqlDialect) (*MigrationStatus, error) {
+	migrations, err := loadMigrations(dialect)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := readAppliedMigrations(db, dialect)
+	if err != nil {
+		return nil, err
+	}
+	status := &MigrationStatus{}
+	known := map[int]struct{}{}
+	for _, m := range migrations {
+		known[m.Version] = struct{}{}
+		checksum, ok := applied[m.Version]
+		switch {
+		case !ok:
+			status.Pending = append(status.Pending, m.Name)
+		case checksum != m.Checksum:
+			status.Modified = append(status.Modified, m.Name)
+			status.Applied = append(status.Applied, m.Version)
+		default:
+			status.Applied = append(status.Applied, m.Version)
+		}
+	}
+	for version := range applied {
+		if _, ok := known[version]; !ok {
+			status.Unknown = append(status.Unknown, version)
+		}
+	}
+	sort.Ints(status.Unknown)
+	return status, nil
+}
+
+// applies every pending step in its own transaction, recording it in schema_migrations
+func applyMigrations(db *sql.DB, dialect sqlDialect) error {
+	if _, err := db.Exec(createMigrationsTableSQL); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %v", err)
+	}
+	status, err := checkMigrations(db, dialect)
+	if err != nil {
+		return err
+	}
+	if len(status.Unknown) > 0 {
+		return fmt.Errorf("database has migrations %v unknown to this version, refusing to start", status.Unknown)
+	}
+	if len(status.Modified) > 0 {
+		log.Printf("Warning: applied migrations differ from embedded ones: %v\n", status.Modified)
+	}
+	migrations, err := loadMigrations(dialect)
+	if err != nil {
+		return err
+	}
+	pending := map[string]struct{}{}
+	for _, name := range status.Pending {
+		pending[name] = struct{}{}
+	}
+	for _, m := range migrations {
+		if _, ok := pending[m.Name]; !ok {
+			continue
+		}
+		if err := applyMigration(db, dialect, m); err != nil {
+			return fmt.Errorf("failed to apply migration %s: %v", m.Name, err)
+		}
+		log.Printf("Applied schema migration %s\n", m.Name)
+	}
+	return nil
+}
+
+func applyMigration(db *sql.DB, dialect sqlDialect, m schemaMigration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	if dialect == dialectPostgres {
+		// serializes concurrent startups against the same database
+		if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(7355608)`); err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %v", err)
+		}
+		var exists bool
+		if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, m.Version).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to re-check migration: %v", err)
+		}
+		if exists {
+			return nil
+		}
+	}
+	if _, err := tx.Exec(m.SQL); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(dialect.insertMigrationSQL(), m.Version, m.Name, m.Checksum, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		return fmt.Errorf("failed to record migration: %v", err)
+	}
+	return tx.Commit()
+}
+
+// CheckMigrations reports schema drift for a database backend without modifying it
+func CheckMigrations(baseConfig SystemConfig) (*MigrationStatus, error) {
+	var db *sql.DB
+	var err error
+	var dialect sqlDialect
+	switch baseConfig.StorageType {
+	case BackendTypePostgres:
+		dialect = dialectPostgres
+		db, err = sql.Open("postgres", makeDBURL(baseConfig))
+	case BackendTypeSQLite:
+		dialect = dialectSQLite
+		dbPath := makeSQLitePath(baseConfig)
+		if _, statErr := os.Stat(dbPath); statErr != nil {
+			return nil, fmt.Errorf("cannot open SQLite database: %v", statErr)
+		}
+		db, err = sql.Open("sqlite", fmt.Sprintf("file:%s?mode=ro", dbPath))
+	default:
+		return nil, fmt.Errorf("backend %s has no schema migrations", baseConfig.StorageType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to ping database: %v", err)
+	}
+	return checkMigrations(db, dialect)
+}
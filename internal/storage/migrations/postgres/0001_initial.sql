@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS expenses (
+	id VARCHAR(36) PRIMARY KEY,
+	recurring_id VARCHAR(36),
+	name VARCHAR(255) NOT NULL,
+	category VARCHAR(255) NOT NULL,
+	amount NUMERIC(10, 2) NOT NULL,
+	currency VARCHAR(3) NOT NULL,
+	date TIMESTAMPTZ NOT NULL,
+	tags TEXT
+);
+
+CREATE TABLE IF NOT EXISTS recurring_expenses (
+	id VARCHAR(36) PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	amount NUMERIC(10, 2) NOT NULL,
+	currency VARCHAR(3) NOT NULL,
+	category VARCHAR(255) NOT NULL,
+	start_date TIMESTAMPTZ NOT NULL,
+	interval VARCHAR(50) NOT NULL,
+	occurrences INTEGER NOT NULL,
+	tags TEXT
+);
+
+CREATE TABLE IF NOT EXISTS config (
+	id VARCHAR(255) PRIMARY KEY DEFAULT 'default',
+	categories TEXT NOT NULL,
+	currency VARCHAR(255) NOT NULL,
+	start_date INTEGER NOT NULL
+);
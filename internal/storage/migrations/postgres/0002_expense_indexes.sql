@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS idx_expenses_date ON expenses (date);
+CREATE INDEX IF NOT EXISTS idx_expenses_recurring_id ON expenses (recurring_id);
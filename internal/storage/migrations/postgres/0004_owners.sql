@@ -0,0 +1,6 @@
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS owner VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS shared_with TEXT;
+ALTER TABLE recurring_expenses ADD COLUMN IF NOT EXISTS owner VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE recurring_expenses ADD COLUMN IF NOT EXISTS shared_with TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_expenses_owner ON expenses (owner);
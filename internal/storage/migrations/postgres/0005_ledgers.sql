@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS ledgers (
+	id VARCHAR(64) PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	archived BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TIMESTAMPTZ NOT NULL
+);
+
+-- existing rows belong to the default ledger; config rows are already keyed by ledger id
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS ledger_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE recurring_expenses ADD COLUMN IF NOT EXISTS ledger_id VARCHAR(64) NOT NULL DEFAULT 'default';
+
+CREATE INDEX IF NOT EXISTS idx_expenses_ledger_date ON expenses (ledger_id, date);
+CREATE INDEX IF NOT EXISTS idx_recurring_expenses_ledger ON recurring_expenses (ledger_id);
@@ -0,0 +1,9 @@
+-- rates are shared by all ledgers; one unit of from_currency is worth rate units of
+-- to_currency from effective_date until the next rate of the same pair
+CREATE TABLE IF NOT EXISTS conversion_rates (
+	from_currency VARCHAR(3) NOT NULL,
+	to_currency VARCHAR(3) NOT NULL,
+	effective_date TIMESTAMPTZ NOT NULL,
+	rate DOUBLE PRECISION NOT NULL,
+	PRIMARY KEY (from_currency, to_currency, effective_date)
+);
@@ -0,0 +1,6 @@
+-- bank reference of imported expenses, so importing a statement twice adds nothing
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS external_id VARCHAR(255) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_expenses_ledger_external_id ON expenses (ledger_id, external_id);
+
+-- rules assigning categories to imported expenses, as a JSON array
+ALTER TABLE config ADD COLUMN IF NOT EXISTS category_rules TEXT;
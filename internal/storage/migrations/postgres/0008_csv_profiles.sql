@@ -0,0 +1,2 @@
+-- saved column mappings for importing bank CSV exports, as a JSON array
+ALTER TABLE config ADD COLUMN IF NOT EXISTS csv_profiles TEXT;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS users (
+	username VARCHAR(64) PRIMARY KEY,
+	password_hash VARCHAR(255) NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS auth_tokens (
+	id VARCHAR(36) PRIMARY KEY,
+	username VARCHAR(64) NOT NULL REFERENCES users (username) ON DELETE CASCADE,
+	kind VARCHAR(16) NOT NULL,
+	name VARCHAR(255) NOT NULL,
+	token_hash VARCHAR(64) NOT NULL UNIQUE,
+	created_at TIMESTAMPTZ NOT NULL,
+	expires_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_tokens_username ON auth_tokens (username);
@@ -0,0 +1,6 @@
+ALTER TABLE expenses ADD COLUMN owner VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE expenses ADD COLUMN shared_with TEXT;
+ALTER TABLE recurring_expenses ADD COLUMN owner VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE recurring_expenses ADD COLUMN shared_with TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_expenses_owner ON expenses (owner);
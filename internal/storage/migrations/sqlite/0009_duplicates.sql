@@ -0,0 +1,2 @@
+-- pairs of expenses marked as not duplicates, as a JSON array
+ALTER TABLE config ADD COLUMN dismissed_duplicates TEXT;
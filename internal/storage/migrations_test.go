@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"database/sql"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func openMigrationTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestLoadMigrationsOrdered(t *testing.T) {
+	for _, dialect := range []sqlDialect{dialectSQLite, dialectPostgres} {
+		migrations, err := loadMigrations(dialect)
+		if err != nil {
+			t.Fatalf("%s: %v", dialect, err)
+		}
+		if len(migrations) == 0 {
+			t.Fatalf("%s: no migrations embedded", dialect)
+		}
+		for i := 1; i < len(migrations); i++ {
+			if migrations[i].Version <= migrations[i-1].Version {
+				t.Errorf("%s: %s is not after %s", dialect, migrations[i].Name, migrations[i-1].Name)
+			}
+		}
+	}
+}
+
+func TestCheckMigrationsDrift(t *testing.T) {
+	migrations, err := loadMigrations(dialectSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, last := migrations[0], migrations[len(migrations)-1]
+
+	tests := []struct {
+		name     string
+		tamper   func(t *testing.T, db *sql.DB)
+		inSync   bool
+		pending  []string
+		unknown  []int
+		modified []string
+	}{
+		{
+			name:   "up to date",
+			inSync: true,
+		},
+		{
+			name: "pending",
+			tamper: func(t *testing.T, db *sql.DB) {
+				mustExec(t, db, `DELETE FROM schema_migrations WHERE version = ?`, last.Version)
+			},
+			pending: []string{last.Name},
+		},
+		{
+			name: "unknown",
+			tamper: func(t *testing.T, db *sql.DB) {
+				mustExec(t, db, dialectSQLite.insertMigrationSQL(), 9999, "9999_future", "abc", "2030-01-01T00:00:00Z")
+			},
+			unknown: []int{9999},
+		},
+		{
+			name: "modified",
+			tamper: func(t *testing.T, db *sql.DB) {
+				mustExec(t, db, `UPDATE schema_migrations SET checksum = 'edited' WHERE version = ?`, first.Version)
+			},
+			modified: []string{first.Name},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openMigrationTestDB(t)
+			if err := applyMigrations(db, dialectSQLite); err != nil {
+				t.Fatal(err)
+			}
+			if tt.tamper != nil {
+				tt.tamper(t, db)
+			}
+			status, err := checkMigrations(db, dialectSQLite)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status.InSync() != tt.inSync {
+				t.Errorf("InSync() = %v, want %v", status.InSync(), tt.inSync)
+			}
+			if !slices.Equal(status.Pending, tt.pending) {
+				t.Errorf("Pending = %v, want %v", status.Pending, tt.pending)
+			}
+			if !slices.Equal(status.Unknown, tt.unknown) {
+				t.Errorf("Unknown = %v, want %v", status.Unknown, tt.unknown)
+			}
+			if !slices.Equal(status.Modified, tt.modified) {
+				t.Errorf("Modified = %v, want %v", status.Modified, tt.modified)
+			}
+		})
+	}
+}
+
+func TestCheckMigrationsFreshDatabase(t *testing.T) {
+	db := openMigrationTestDB(t)
+	status, err := checkMigrations(db, dialectSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrations, _ := loadMigrations(dialectSQLite)
+	if len(status.Applied) != 0 || len(status.Pending) != len(migrations) {
+		t.Errorf("fresh database: applied %v, pending %v", status.Applied, status.Pending)
+	}
+}
+
+func TestApplyMigrationsRefusesUnknown(t *testing.T) {
+	db := openMigrationTestDB(t)
+	if err := applyMigrations(db, dialectSQLite); err != nil {
+		t.Fatal(err)
+	}
+	mustExec(t, db, dialectSQLite.insertMigrationSQL(), 9999, "9999_future", "abc", "2030-01-01T00:00:00Z")
+	if err := applyMigrations(db, dialectSQLite); err == nil {
+		t.Error("applyMigrations accepted a database with an unknown migration")
+	}
+}
+
+func mustExec(t *testing.T, db *sql.DB, query string, args ...any) {
+	t.Helper()
+	if _, err := db.Exec(query, args...); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// expenses and recurring rules belong to the user who added them and may be shared with
+// other users of the household, who each carry an equal part of the amount; rows added
+// before authentication was enabled have no owner and stay visible to everyone
+
+const expenseColumns = `id, recurring_id, name, category, amount, currency, date, tags, owner, shared_with, external_id`
+const recurringColumns = `id, name, amount, currency, category, start_date, interval, occurrences, tags, owner, shared_with`
+
+// key used for expenses without an owner when splitting summaries by user
+const unassignedKey = "(unassigned)"
+
+// VisibleTo reports whether the user owns the expense, takes part in it, or it has no owner;
+// an empty username (authentication disabled) sees everything
+func (e Expense) VisibleTo(username string) bool {
+	return username == "" || e.Owner == "" || e.Owner == username || slices.Contains(e.SharedWith, username)
+}
+
+// EditableBy reports whether the user may change or delete the expense
+func (e Expense) EditableBy(username string) bool {
+	return username == "" || e.Owner == "" || e.Owner == username
+}
+
+func (r RecurringExpense) VisibleTo(username string) bool {
+	return username == "" || r.Owner == "" || r.Owner == username || slices.Contains(r.SharedWith, username)
+}
+
+func (r RecurringExpense) EditableBy(username string) bool {
+	return username == "" || r.Owner == "" || r.Owner == username
+}
+
+// NormalizeParticipants validates usernames, drops duplicates and the owner itself
+func NormalizeParticipants(owner string, participants []string) ([]string, error) {
+	var cleaned []string
+	for _, p := range participants {
+		if err := ValidateUsername(p); err != nil {
+			return nil, fmt.Errorf("invalid participant '%s': %v", p, err)
+		}
+		if p != owner && !slices.Contains(cleaned, p) {
+			cleaned = append(cleaned, p)
+		}
+	}
+	if len(cleaned) > 0 && owner == "" {
+		return nil, fmt.Errorf("only expenses with an owner can be shared")
+	}
+	return cleaned, nil
+}
+
+// splitters returns who carries an expense; unowned expenses go to a single placeholder
+func splitters(owner string, sharedWith []string) []string {
+	if owner == "" {
+		return []string{unassignedKey}
+	}
+	people := []string{owner}
+	for _, p := range sharedWith {
+		if !slices.Contains(people, p) {
+			people = append(people, p)
+		}
+	}
+	return people
+}
+
+// participants are stored as a JSON array in a text column, NULL when not shared
+func marshalList(values []string) any {
+	if len(values) == 0 {
+		return nil
+	}
+	content, _ := json.Marshal(values)
+	return string(content)
+}
+
+func unmarshalList(value sql.NullString) ([]string, error) {
+	if !value.Valid || value.String == "" {
+		return nil, nil
+	}
+	var values []string
+	if err := json.Unmarshal([]byte(value.String), &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
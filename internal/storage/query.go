@@ -0,0 +1,233 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ExpenseQuery filters, sorts and paginates expenses; zero values mean "no constraint"
+type ExpenseQuery struct {
+	From          time.Time // inclusive
+	To            time.Time // exclusive
+	Categories    []string  // matches any
+	Tags          []string  // matches any
+	Name          string    // case-insensitive substring
+	MinAmount     *float64
+	MaxAmount     *float64
+	RecurringOnly bool
+	SortBy        string // date (default), amount, name or category
+	SortDesc      bool
+	Limit         int // 0 returns everything after Offset
+	Offset        int
+	Viewer        string // only expenses visible to this user, empty for no scoping
+
+	ledgerID string // set by the database stores to scope the query to their ledger
+}
+
+// ExpenseQueryResult is one page of matching expenses plus the total number of matches
+type ExpenseQueryResult struct {
+	Expenses []Expense `json:"expenses"`
+	Total    int       `json:"total"`
+	Limit    int       `json:"limit"`
+	Offset   int       `json:"offset"`
+}
+
+var expenseSortFields = []string{"date", "amount", "name", "category"}
+
+// Validate normalizes the query and rejects unusable values
+func (q *ExpenseQuery) Validate() error {
+	if q.SortBy == "" {
+		q.SortBy = "date"
+	}
+	if !slices.Contains(expenseSortFields, q.SortBy) {
+		return fmt.Errorf("invalid sort field: '%s'. Must be one of %s", q.SortBy, strings.Join(expenseSortFields, ", "))
+	}
+	if q.Limit < 0 || q.Offset < 0 {
+		return fmt.Errorf("limit and offset cannot be negative")
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && !q.To.After(q.From) {
+		return fmt.Errorf("'to' must be after 'from'")
+	}
+	if q.MinAmount != nil && q.MaxAmount != nil && *q.MinAmount > *q.MaxAmount {
+		return fmt.Errorf("'minAmount' cannot be greater than 'maxAmount'")
+	}
+	return nil
+}
+
+// Matches reports whether an expense passes every filter of the query
+func (q *ExpenseQuery) Matches(e Expense) bool {
+	if !q.From.IsZero() && e.Date.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !e.Date.Before(q.To) {
+		return false
+	}
+	if len(q.Categories) > 0 && !slices.Contains(q.Categories, e.Category) {
+		return false
+	}
+	if len(q.Tags) > 0 && !slices.ContainsFunc(e.Tags, func(t string) bool { return slices.Contains(q.Tags, t) }) {
+		return false
+	}
+	if q.Name != "" && !strings.Contains(strings.ToLower(e.Name), strings.ToLower(q.Name)) {
+		return false
+	}
+	if q.MinAmount != nil && e.Amount < *q.MinAmount {
+		return false
+	}
+	if q.MaxAmount != nil && e.Amount > *q.MaxAmount {
+		return false
+	}
+	if q.RecurringOnly && e.RecurringID == "" {
+		return false
+	}
+	if q.Viewer != "" && !e.VisibleTo(q.Viewer) {
+		return false
+	}
+	return true
+}
+
+// sortAndPage orders matched expenses and cuts out the requested page (used by the JSON store)
+func (q *ExpenseQuery) sortAndPage(expenses []Expense) *ExpenseQueryResult {
+	compare := func(a, b Expense) int {
+		switch q.SortBy {
+		case "amount":
+			switch {
+			case a.Amount < b.Amount:
+				return -1
+			case a.Amount > b.Amount:
+				return 1
+			}
+			return 0
+		case "name":
+			return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+		case "category":
+			return strings.Compare(a.Category, b.Category)
+		}
+		return a.Date.Compare(b.Date)
+	}
+	sort.SliceStable(expenses, func(i, j int) bool {
+		c := compare(expenses[i], expenses[j])
+		if c == 0 {
+			c = strings.Compare(expenses[i].ID, expenses[j].ID)
+		}
+		if q.SortDesc {
+			return c > 0
+		}
+		return c < 0
+	})
+	result := &ExpenseQueryResult{Total: len(expenses), Limit: q.Limit, Offset: q.Offset}
+	start := min(q.Offset, len(expenses))
+	end := len(expenses)
+	if q.Limit > 0 {
+		end = min(start+q.Limit, end)
+	}
+	result.Expenses = expenses[start:end]
+	return result
+}
+
+// escapes LIKE wildcards so user input only ever matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// sqlFilter renders the query as a WHERE clause (without the keyword) and its arguments
+func (q *ExpenseQuery) sqlFilter(dialect sqlDialect) (string, []any) {
+	var clauses []string
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		if dialect == dialectPostgres {
+			return fmt.Sprintf("$%d", len(args))
+		}
+		return "?"
+	}
+	timeArg := func(t time.Time) string {
+		if dialect == dialectSQLite {
+			return arg(formatSQLiteTime(t))
+		}
+		return arg(t)
+	}
+	list := func(values []string) string {
+		placeholders := make([]string, len(values))
+		for i, v := range values {
+			placeholders[i] = arg(v)
+		}
+		return strings.Join(placeholders, ", ")
+	}
+
+	if q.ledgerID != "" {
+		clauses = append(clauses, "ledger_id = "+arg(q.ledgerID))
+	}
+	if !q.From.IsZero() {
+		clauses = append(clauses, "date >= "+timeArg(q.From))
+	}
+	if !q.To.IsZero() {
+		clauses = append(clauses, "date < "+timeArg(q.To))
+	}
+	if len(q.Categories) > 0 {
+		clauses = append(clauses, fmt.Sprintf("category IN (%s)", list(q.Categories)))
+	}
+	if len(q.Tags) > 0 {
+		// tags are stored as a JSON array in a text column
+		if dialect == dialectPostgres {
+			clauses = append(clauses, fmt.Sprintf("COALESCE(NULLIF(tags, ''), 'null')::jsonb ?| ARRAY[%s]::text[]", list(q.Tags)))
+		} else {
+			clauses = append(clauses, fmt.Sprintf("EXISTS (SELECT 1 FROM json_each(CASE WHEN json_valid(tags) THEN tags ELSE '[]' END) WHERE value IN (%s))", list(q.Tags)))
+		}
+	}
+	if q.Name != "" {
+		pattern := "%" + escapeLike(q.Name) + "%"
+		if dialect == dialectPostgres {
+			clauses = append(clauses, "name ILIKE "+arg(pattern))
+		} else {
+			clauses = append(clauses, "name LIKE "+arg(pattern)+` ESCAPE '\'`)
+		}
+	}
+	if q.MinAmount != nil {
+		clauses = append(clauses, "amount >= "+arg(*q.MinAmount))
+	}
+	if q.MaxAmount != nil {
+		clauses = append(clauses, "amount <= "+arg(*q.MaxAmount))
+	}
+	if q.RecurringOnly {
+		clauses = append(clauses, "recurring_id IS NOT NULL AND recurring_id <> ''")
+	}
+	if q.Viewer != "" {
+		// participants are stored as a JSON array like tags
+		if dialect == dialectPostgres {
+			clauses = append(clauses, fmt.Sprintf("(owner = '' OR owner = %s OR COALESCE(NULLIF(shared_with, ''), 'null')::jsonb ? %s)", arg(q.Viewer), arg(q.Viewer)))
+		} else {
+			clauses = append(clauses, fmt.Sprintf("(owner = '' OR owner = %s OR EXISTS (SELECT 1 FROM json_each(CASE WHEN json_valid(shared_with) THEN shared_with ELSE '[]' END) WHERE value = %s))", arg(q.Viewer), arg(q.Viewer)))
+		}
+	}
+	if len(clauses) == 0 {
+		return "TRUE", args
+	}
+	return strings.Join(clauses, " AND "), args
+}
+
+// sqlOrder renders the ORDER BY and LIMIT/OFFSET tail; fields are whitelisted by Validate
+func (q *ExpenseQuery) sqlOrder(dialect sqlDialect) string {
+	direction := "ASC"
+	if q.SortDesc {
+		direction = "DESC"
+	}
+	field := q.SortBy
+	if field == "name" {
+		field = "LOWER(name)"
+	}
+	order := fmt.Sprintf(" ORDER BY %s %s, id %s", field, direction, direction)
+	switch {
+	case q.Limit > 0:
+		order += fmt.Sprintf(" LIMIT %d", q.Limit)
+	case q.Offset > 0 && dialect == dialectSQLite:
+		order += " LIMIT -1" // SQLite only accepts OFFSET after a LIMIT
+	}
+	if q.Offset > 0 {
+		order += fmt.Sprintf(" OFFSET %d", q.Offset)
+	}
+	return order
+}
@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rate files can be downloaded elsewhere and dropped onto an offline server; two formats
+// are read: the ECB reference rates (eurofxref-hist.xml or the daily eurofxref-daily.xml)
+// and a plain CSV with date,from,to,rate rows
+
+// RatesImportReport summarizes an exchange rate file import
+type RatesImportReport struct {
+	Format      string    `json:"format"` // ecb or csv
+	Imported    int       `json:"imported"`
+	Skipped     int       `json:"skipped"`               // rates of currencies ExpenseOwl does not support
+	Unsupported []string  `json:"unsupported,omitempty"` // the currencies that were skipped
+	FirstDate   time.Time `json:"firstDate"`
+	LastDate    time.Time `json:"lastDate"`
+}
+
+func (r *RatesImportReport) add(rate ConversionRate) {
+	r.Imported++
+	if r.FirstDate.IsZero() || rate.EffectiveDate.Before(r.FirstDate) {
+		r.FirstDate = rate.EffectiveDate
+	}
+	if rate.EffectiveDate.After(r.LastDate) {
+		r.LastDate = rate.EffectiveDate
+	}
+}
+
+func (r *RatesImportReport) skip(currency string) {
+	r.Skipped++
+	currency = strings.ToLower(strings.TrimSpace(currency))
+	if !slices.Contains(r.Unsupported, currency) {
+		r.Unsupported = append(r.Unsupported, currency)
+	}
+}
+
+// ecbEnvelope matches the nested Cube elements of the ECB files, ignoring namespaces
+type ecbEnvelope struct {
+	Days []struct {
+		Time  string `xml:"time,attr"`
+		Rates []struct {
+			Currency string `xml:"currency,attr"`
+			Rate     string `xml:"rate,attr"`
+		} `xml:"Cube"`
+	} `xml:"Cube>Cube"`
+}
+
+// ParseRatesFile reads an ECB XML or date,from,to,rate CSV file, telling them apart by
+// content; rates of unsupported currencies are skipped and listed in the report
+func ParseRatesFile(r io.Reader) ([]ConversionRate, *RatesImportReport, error) {
+	reader := bufio.NewReader(r)
+	// files saved by spreadsheet tools may start with a byte order mark
+	if bom, _ := reader.Peek(3); bytes.Equal(bom, []byte("\xef\xbb\xbf")) {
+		reader.Discard(3)
+	}
+	start, _ := reader.Peek(512)
+	if bytes.HasPrefix(bytes.TrimSpace(start), []byte("<")) {
+		return parseECBRates(reader)
+	}
+	return parseCSVRates(reader)
+}
+
+func parseECBRates(r io.Reader) ([]ConversionRate, *RatesImportReport, error) {
+	var envelope ecbEnvelope
+	if err := xml.NewDecoder(r).Decode(&envelope); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse ECB rate file: %v", err)
+	}
+	if len(envelope.Days) == 0 {
+		return nil, nil, fmt.Errorf("no rates found in ECB rate file")
+	}
+	report := &RatesImportReport{Format: "ecb"}
+	rates := []ConversionRate{}
+	for _, day := range envelope.Days {
+		date, err := time.Parse(time.DateOnly, day.Time)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid date in ECB rate file: %s", day.Time)
+		}
+		for _, entry := range day.Rates {
+			if _, err := ValidateCurrency(entry.Currency); err != nil {
+				report.skip(entry.Currency)
+				continue
+			}
+			value, err := strconv.ParseFloat(strings.TrimSpace(entry.Rate), 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid rate for %s on %s: %s", entry.Currency, day.Time, entry.Rate)
+			}
+			// ECB reference rates are quoted as units of the currency per euro
+			rate := ConversionRate{From: "eur", To: entry.Currency, Rate: value, EffectiveDate: date}
+			if err := rate.Validate(); err != nil {
+				return nil, nil, fmt.Errorf("invalid rate for %s on %s: %v", entry.Currency, day.Time, err)
+			}
+			rates = append(rates, rate)
+			report.add(rate)
+		}
+	}
+	return rates, report, nil
+}
+
+func parseCSVRates(r io.Reader) ([]ConversionRate, *RatesImportReport, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 4
+	reader.TrimLeadingSpace = true
+	report := &RatesImportReport{Format: "csv"}
+	rates := []ConversionRate{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read rate CSV: %v", err)
+		}
+		// the header row is optional
+		if line == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "date") {
+			continue
+		}
+		date, err := time.Parse(time.DateOnly, strings.TrimSpace(record[0]))
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: invalid date '%s', expected YYYY-MM-DD", line, record[0])
+		}
+		_, fromErr := ValidateCurrency(record[1])
+		_, toErr := ValidateCurrency(record[2])
+		if fromErr != nil || toErr != nil {
+			if fromErr != nil {
+				report.skip(record[1])
+			} else {
+				report.skip(record[2])
+			}
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(record[3]), 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: invalid rate '%s'", line, record[3])
+		}
+		rate := ConversionRate{From: record[1], To: record[2], Rate: value, EffectiveDate: date}
+		if err := rate.Validate(); err != nil {
+			return nil, nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		rates = append(rates, rate)
+		report.add(rate)
+	}
+	if len(rates) == 0 && report.Skipped == 0 {
+		return nil, nil, fmt.Errorf("no rates found in rate CSV")
+	}
+	return rates, report, nil
+}
+
+// ImportConversionRates parses a rate file and saves all of its rates in one write
+func ImportConversionRates(store Storage, r io.Reader) (*RatesImportReport, error) {
+	rates, report, err := ParseRatesFile(r)
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(report.Unsupported)
+	if len(rates) == 0 {
+		return report, nil
+	}
+	if err := store.SaveConversionRates(rates); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
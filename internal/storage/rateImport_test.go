@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRatesFile(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2025, 3, d, 0, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		file   string
+		rates  []ConversionRate
+		report RatesImportReport
+	}{
+		{
+			file: "eurofxref-hist.xml",
+			rates: []ConversionRate{
+				{From: "eur", To: "usd", Rate: 1.0486, EffectiveDate: day(4)},
+				{From: "eur", To: "jpy", Rate: 156.08, EffectiveDate: day(4)},
+				{From: "eur", To: "usd", Rate: 1.0465, EffectiveDate: day(3)},
+				{From: "eur", To: "jpy", Rate: 157.13, EffectiveDate: day(3)},
+			},
+			report: RatesImportReport{Format: "ecb", Imported: 4, Skipped: 4, Unsupported: []string{"czk", "huf"}, FirstDate: day(3), LastDate: day(4)},
+		},
+		{
+			file: "rates-bom.csv",
+			rates: []ConversionRate{
+				{From: "usd", To: "eur", Rate: 0.9556, EffectiveDate: day(3)},
+				{From: "usd", To: "gbp", Rate: 0.7891, EffectiveDate: day(4)},
+			},
+			report: RatesImportReport{Format: "csv", Imported: 2, Skipped: 1, Unsupported: []string{"nok"}, FirstDate: day(3), LastDate: day(4)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			f, err := os.Open("testdata/" + tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			rates, report, err := ParseRatesFile(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(rates, tt.rates) {
+				t.Errorf("rates = %+v, want %+v", rates, tt.rates)
+			}
+			if !reflect.DeepEqual(*report, tt.report) {
+				t.Errorf("report = %+v, want %+v", *report, tt.report)
+			}
+		})
+	}
+}
+
+func TestParseRatesFileErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{"empty CSV", "date,from,to,rate\n", "no rates found in rate CSV"},
+		{"invalid date", "2025-03-03,usd,eur,0.95\n03.03.2025,usd,eur,0.95\n", "line 2: invalid date"},
+		{"invalid rate", "2025-03-03,usd,eur,n/a\n", "line 1: invalid rate"},
+		{"same currency", "2025-03-03,usd,usd,1\n", "line 1: rate must convert between two different currencies"},
+		{"missing column", "2025-03-03,usd,eur\n", "failed to read rate CSV"},
+		{"ECB file without rates", `<Envelope><Cube></Cube></Envelope>`, "no rates found in ECB rate file"},
+		{"ECB invalid date", `<Envelope><Cube><Cube time="03.03.2025"><Cube currency="USD" rate="1.04"/></Cube></Cube></Envelope>`, "invalid date in ECB rate file"},
+	}
+	for _, tt := range tests {
+		_, _, err := ParseRatesFile(strings.NewReader(tt.input))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+
+	// a file of only unsupported currencies is read, with nothing to import
+	rates, report, err := ParseRatesFile(strings.NewReader("2025-03-03,usd,nok,11.2\n"))
+	if err != nil || len(rates) != 0 || report.Skipped != 1 {
+		t.Errorf("unsupported only: %d rates, %+v, %v, want no rates and one skipped", len(rates), report, err)
+	}
+}
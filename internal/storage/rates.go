@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ConversionRate says one unit of From is worth Rate units of To, starting at EffectiveDate
+// and until the next rate of the same pair; rates are shared by all ledgers
+type ConversionRate struct {
+	From          string    `json:"from"`
+	To            string    `json:"to"`
+	Rate          float64   `json:"rate"`
+	EffectiveDate time.Time `json:"effectiveDate"` // stored as midnight UTC of the day
+}
+
+func ValidateCurrency(currency string) (string, error) {
+	currency = strings.ToLower(strings.TrimSpace(currency))
+	if !slices.Contains(SupportedCurrencies, currency) {
+		return "", fmt.Errorf("invalid currency: %s", currency)
+	}
+	return currency, nil
+}
+
+func (r *ConversionRate) Validate() error {
+	var err error
+	if r.From, err = ValidateCurrency(r.From); err != nil {
+		return err
+	}
+	if r.To, err = ValidateCurrency(r.To); err != nil {
+		return err
+	}
+	if r.From == r.To {
+		return fmt.Errorf("rate must convert between two different currencies")
+	}
+	if r.Rate <= 0 {
+		return fmt.Errorf("rate must be greater than 0")
+	}
+	if r.EffectiveDate.IsZero() {
+		return fmt.Errorf("rate 'effectiveDate' cannot be empty")
+	}
+	r.EffectiveDate = rateDay(r.EffectiveDate)
+	return nil
+}
+
+// rates are unique per pair and day
+type rateKey struct {
+	from, to string
+	day      int64
+}
+
+func (r ConversionRate) key() rateKey {
+	return rateKey{r.From, r.To, r.EffectiveDate.Unix()}
+}
+
+// rateDay truncates a time to the UTC day it falls on, so a rate applies to the whole day
+func rateDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// sortRates orders rates by pair and then effective date
+func sortRates(rates []ConversionRate) {
+	sort.Slice(rates, func(i, j int) bool {
+		if rates[i].From != rates[j].From {
+			return rates[i].From < rates[j].From
+		}
+		if rates[i].To != rates[j].To {
+			return rates[i].To < rates[j].To
+		}
+		return rates[i].EffectiveDate.Before(rates[j].EffectiveDate)
+	})
+}
+
+// RateTable looks up the rates of every pair, ordered by effective date
+type RateTable struct {
+	pairs      map[[2]string][]ConversionRate
+	currencies []string // every currency with a rate, tried as a pivot for cross rates
+}
+
+func NewRateTable(rates []ConversionRate) *RateTable {
+	t := &RateTable{pairs: map[[2]string][]ConversionRate{}}
+	for _, r := range rates {
+		pair := [2]string{r.From, r.To}
+		t.pairs[pair] = append(t.pairs[pair], r)
+		for _, c := range pair {
+			if !slices.Contains(t.currencies, c) {
+				t.currencies = append(t.currencies, c)
+			}
+		}
+	}
+	for _, pairRates := range t.pairs {
+		sort.Slice(pairRates, func(i, j int) bool { return pairRates[i].EffectiveDate.Before(pairRates[j].EffectiveDate) })
+	}
+	sort.Strings(t.currencies)
+	return t
+}
+
+// effective returns the rate of a pair in effect on date; dates before the first rate
+// use the first rate, so a pair entered today still converts older expenses
+func (t *RateTable) effective(from, to string, date time.Time) (float64, bool) {
+	pairRates := t.pairs[[2]string{from, to}]
+	if len(pairRates) == 0 {
+		return 0, false
+	}
+	i := sort.Search(len(pairRates), func(i int) bool { return pairRates[i].EffectiveDate.After(date) })
+	return pairRates[max(i-1, 0)].Rate, true
+}
+
+// pairRate uses the direct pair or the inverse of the opposite pair
+func (t *RateTable) pairRate(from, to string, date time.Time) (float64, bool) {
+	if rate, ok := t.effective(from, to, date); ok {
+		return rate, true
+	}
+	if rate, ok := t.effective(to, from, date); ok {
+		return 1 / rate, true
+	}
+	return 0, false
+}
+
+// Convert turns an amount into the target currency, going through a third currency when
+// there is no rate between the two (e.g., ECB rates are all quoted against the euro);
+// empty currencies are taken as the target currency
+func (t *RateTable) Convert(amount float64, from, to string, date time.Time) (float64, bool) {
+	if from == "" || from == to {
+		return amount, true
+	}
+	if rate, ok := t.pairRate(from, to, date); ok {
+		return amount * rate, true
+	}
+	for _, pivot := range t.currencies {
+		if pivot == from || pivot == to {
+			continue
+		}
+		first, ok := t.pairRate(from, pivot, date)
+		if !ok {
+			continue
+		}
+		if second, ok := t.pairRate(pivot, to, date); ok {
+			return amount * first * second, true
+		}
+	}
+	return amount, false
+}
@@ -0,0 +1,406 @@
+package storage
+
+import (
+	"cmp"
+	"database/sql"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SummaryQuery groups the expenses matched by Filter; pagination and sorting in Filter are ignored
+type SummaryQuery struct {
+	Filter   ExpenseQuery
+	GroupBy  string         // category, tag, week, month or year
+	Location *time.Location // time zone for period boundaries, UTC if nil
+}
+
+// SummaryGroup holds the totals of one group; Start and End are set for period groupings
+type SummaryGroup struct {
+	Key     string     `json:"key"`
+	Start   *time.Time `json:"start,omitempty"`
+	End     *time.Time `json:"end,omitempty"`
+	Income  float64    `json:"income"`
+	Expense float64    `json:"expense"` // positive sum of -ve amounts
+	Net     float64    `json:"net"`
+	Count   int        `json:"count"`
+}
+
+type Summary struct {
+	GroupBy  string         `json:"groupBy"`
+	Currency string         `json:"currency"`
+	Groups   []SummaryGroup `json:"groups"`
+	Totals   SummaryGroup   `json:"totals"`
+	Shares   []SummaryGroup `json:"shares"` // each user's part of the totals, keyed by username
+	// totals per original currency, in that currency; everything else is in Currency
+	Currencies  []SummaryGroup `json:"currencies"`
+	Unconverted []string       `json:"unconverted,omitempty"` // currencies without a rate, summed as-is
+}
+
+var SummaryGroupings = []string{"category", "tag", "week", "month", "year"}
+
+// key used for expenses without tags when grouping by tag
+const untaggedKey = "(untagged)"
+
+func (q *SummaryQuery) Validate() error {
+	if q.GroupBy == "" {
+		q.GroupBy = "category"
+	}
+	if !slices.Contains(SummaryGroupings, q.GroupBy) {
+		return fmt.Errorf("invalid grouping: '%s'. Must be one of %s", q.GroupBy, strings.Join(SummaryGroupings, ", "))
+	}
+	if q.Location == nil {
+		q.Location = time.UTC
+	}
+	q.Filter.Limit, q.Filter.Offset = 0, 0
+	return q.Filter.Validate()
+}
+
+func daysIn(year int, month time.Month, loc *time.Location) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, loc).Day()
+}
+
+// monthStart is when the month period labelled year/month begins, given the configured
+// start day; months shorter than the start day begin on their last day
+func monthStart(year int, month time.Month, startDate int, loc *time.Location) time.Time {
+	first := time.Date(year, month, 1, 0, 0, 0, 0, loc)
+	return time.Date(first.Year(), first.Month(), min(startDate, daysIn(first.Year(), first.Month(), loc)), 0, 0, 0, 0, loc)
+}
+
+// monthPeriodOf returns the start of the month period containing t
+func monthPeriodOf(t time.Time, startDate int) time.Time {
+	start := monthStart(t.Year(), t.Month(), startDate, t.Location())
+	if t.Before(start) {
+		return monthStart(t.Year(), t.Month()-1, startDate, t.Location())
+	}
+	return start
+}
+
+// periodKey labels the week, month or year period that contains t
+func periodKey(groupBy string, t time.Time, startDate int) string {
+	switch groupBy {
+	case "week":
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%04d-W%02d", year, week)
+	case "year":
+		return monthPeriodOf(t, startDate).Format("2006")
+	}
+	return monthPeriodOf(t, startDate).Format("2006-01")
+}
+
+// periodBounds turns a period key back into its [start, end) range
+func periodBounds(groupBy, key string, startDate int, loc *time.Location) (time.Time, time.Time, error) {
+	switch groupBy {
+	case "week":
+		var year, week int
+		if _, err := fmt.Sscanf(key, "%04d-W%02d", &year, &week); err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		// ISO week 1 contains January 4th
+		jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, loc)
+		monday := jan4.AddDate(0, 0, -((int(jan4.Weekday())+6)%7)+(week-1)*7)
+		return monday, monday.AddDate(0, 0, 7), nil
+	case "year":
+		year, err := strconv.Atoi(key)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		return monthStart(year, time.January, startDate, loc), monthStart(year+1, time.January, startDate, loc), nil
+	}
+	t, err := time.ParseInLocation("2006-01", key, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return monthStart(t.Year(), t.Month(), startDate, loc), monthStart(t.Year(), t.Month()+1, startDate, loc), nil
+}
+
+func (g *SummaryGroup) add(amount float64) {
+	if amount > 0 {
+		g.Income += amount
+	} else {
+		g.Expense -= amount
+	}
+	g.Net += amount
+	g.Count++
+}
+
+// shareSplitter splits totals equally between the owner and participants of expenses
+type shareSplitter map[string]*SummaryGroup
+
+func (s shareSplitter) add(owner string, sharedWith []string, income, expense float64, count int) {
+	people := splitters(owner, sharedWith)
+	n := float64(len(people))
+	for _, p := range people {
+		g, ok := s[p]
+		if !ok {
+			g = &SummaryGroup{Key: p}
+			s[p] = g
+		}
+		g.Income += income / n
+		g.Expense += expense / n
+		g.Net += (income - expense) / n
+		g.Count += count
+	}
+}
+
+func (s shareSplitter) groups() []SummaryGroup {
+	shares := make([]SummaryGroup, 0, len(s))
+	for _, g := range s {
+		g.roundToCents()
+		shares = append(shares, *g)
+	}
+	sort.Slice(shares, func(i, j int) bool { return shares[i].Key < shares[j].Key })
+	return shares
+}
+
+// currencyTotals collects the original amounts of expenses per currency
+type currencyTotals map[string]*SummaryGroup
+
+func (c currencyTotals) add(currency string, income, expense float64, count int) {
+	g, ok := c[currency]
+	if !ok {
+		g = &SummaryGroup{Key: currency}
+		c[currency] = g
+	}
+	g.Income += income
+	g.Expense += expense
+	g.Net += income - expense
+	g.Count += count
+}
+
+func (c currencyTotals) groups() []SummaryGroup {
+	totals := make([]SummaryGroup, 0, len(c))
+	for _, g := range c {
+		g.roundToCents()
+		totals = append(totals, *g)
+	}
+	sort.Slice(totals, func(i, j int) bool { return totals[i].Key < totals[j].Key })
+	return totals
+}
+
+// summarizeExpenses aggregates already filtered expenses in Go, for backends without GROUP BY
+// and for expenses that need converting; amounts are converted to currency with the rate
+// in effect on each expense's date
+func summarizeExpenses(expenses []Expense, q SummaryQuery, startDate int, currency string, rates []ConversionRate) (*Summary, error) {
+	groups := map[string]*SummaryGroup{}
+	addTo := func(key string, amount float64) {
+		g, ok := groups[key]
+		if !ok {
+			g = &SummaryGroup{Key: key}
+			groups[key] = g
+		}
+		g.add(amount)
+	}
+	summary := &Summary{GroupBy: q.GroupBy, Currency: currency}
+	shares := shareSplitter{}
+	originals := currencyTotals{}
+	table := NewRateTable(rates)
+	for _, e := range expenses {
+		var original SummaryGroup
+		original.add(e.Amount)
+		from := cmp.Or(e.Currency, currency)
+		originals.add(from, original.Income, original.Expense, 1)
+		amount, ok := table.Convert(e.Amount, from, currency, e.Date)
+		if !ok && !slices.Contains(summary.Unconverted, from) {
+			summary.Unconverted = append(summary.Unconverted, from)
+		}
+		summary.Totals.add(amount)
+		var single SummaryGroup
+		single.add(amount)
+		shares.add(e.Owner, e.SharedWith, single.Income, single.Expense, 1)
+		switch q.GroupBy {
+		case "category":
+			addTo(e.Category, amount)
+		case "tag":
+			if len(e.Tags) == 0 {
+				addTo(untaggedKey, amount)
+			}
+			for _, tag := range e.Tags {
+				addTo(tag, amount)
+			}
+		default:
+			addTo(periodKey(q.GroupBy, e.Date.In(q.Location), startDate), amount)
+		}
+	}
+	rows := make([]SummaryGroup, 0, len(groups))
+	for _, g := range groups {
+		rows = append(rows, *g)
+	}
+	summary.Shares = shares.groups()
+	summary.Currencies = originals.groups()
+	sort.Strings(summary.Unconverted)
+	return finishSummary(summary, rows, q, startDate)
+}
+
+// finishSummary orders groups, fills period bounds and rounds totals to cents
+func finishSummary(summary *Summary, groups []SummaryGroup, q SummaryQuery, startDate int) (*Summary, error) {
+	isPeriod := q.GroupBy != "category" && q.GroupBy != "tag"
+	for i := range groups {
+		if isPeriod {
+			start, end, err := periodBounds(q.GroupBy, groups[i].Key, startDate, q.Location)
+			if err != nil {
+				return nil, fmt.Errorf("invalid period key %s: %v", groups[i].Key, err)
+			}
+			groups[i].Start, groups[i].End = &start, &end
+		}
+		groups[i].roundToCents()
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if !isPeriod && groups[i].Expense != groups[j].Expense {
+			return groups[i].Expense > groups[j].Expense
+		}
+		return groups[i].Key < groups[j].Key
+	})
+	summary.Groups = groups
+	summary.Totals.Key = "total"
+	summary.Totals.roundToCents()
+	return summary, nil
+}
+
+func roundCents(v float64) float64 {
+	f, _ := strconv.ParseFloat(strconv.FormatFloat(v, 'f', 2, 64), 64)
+	return f
+}
+
+func (g *SummaryGroup) roundToCents() {
+	g.Income = roundCents(g.Income)
+	g.Expense = roundCents(g.Expense)
+	g.Net = roundCents(g.Net)
+}
+
+const sumIncomeSQL = `COALESCE(SUM(CASE WHEN amount > 0 THEN amount ELSE 0 END), 0)`
+const sumExpenseSQL = `COALESCE(SUM(CASE WHEN amount < 0 THEN -amount ELSE 0 END), 0)`
+
+// sqlGrouping renders the group key expression and FROM clause for a summary; args are
+// appended after the filter's so placeholders keep counting. Period keys need time zone
+// rules, which only Postgres has, so SQLite supports category and tag here.
+func (q *SummaryQuery) sqlGrouping(dialect sqlDialect, startDate int, args []any) (string, string, []any, bool) {
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	switch {
+	case q.GroupBy == "category":
+		return "category", "expenses", args, true
+	case q.GroupBy == "tag" && dialect == dialectPostgres:
+		from := `expenses LEFT JOIN LATERAL jsonb_array_elements_text(CASE WHEN jsonb_typeof(COALESCE(NULLIF(tags, ''), 'null')::jsonb) = 'array' THEN tags::jsonb ELSE '[]'::jsonb END) AS t(tag) ON TRUE`
+		return fmt.Sprintf("COALESCE(t.tag, '%s')", untaggedKey), from, args, true
+	case q.GroupBy == "tag":
+		from := `expenses LEFT JOIN json_each(CASE WHEN json_valid(tags) AND json_type(tags) = 'array' THEN tags ELSE '[]' END) AS t`
+		return fmt.Sprintf("COALESCE(t.value, '%s')", untaggedKey), from, args, true
+	case dialect != dialectPostgres:
+		return "", "", args, false
+	}
+	local := fmt.Sprintf("(date AT TIME ZONE %s)", arg(q.Location.String()))
+	if q.GroupBy == "week" {
+		return fmt.Sprintf(`to_char(%s, 'IYYY-"W"IW')`, local), "expenses", args, true
+	}
+	// mirrors monthPeriodOf: days before this month's start belong to the previous period
+	month := fmt.Sprintf(`date_trunc('month', %s)`, local)
+	period := fmt.Sprintf(`CASE WHEN EXTRACT(DAY FROM %s) >= LEAST(%s, EXTRACT(DAY FROM %s + INTERVAL '1 month - 1 day')) THEN %s ELSE %s - INTERVAL '1 month' END`,
+		local, arg(startDate), month, month, month)
+	layout := "YYYY-MM"
+	if q.GroupBy == "year" {
+		layout = "YYYY"
+	}
+	return fmt.Sprintf("to_char(%s, '%s')", period, layout), "expenses", args, true
+}
+
+// querySummary aggregates with GROUP BY in the database, falling back to Go for
+// groupings the dialect cannot express and for expenses in other currencies
+func querySummary(db *sql.DB, dialect sqlDialect, q SummaryQuery, startDate int, currency string, rates func() ([]ConversionRate, error), fallback func(ExpenseQuery) (*ExpenseQueryResult, error)) (*Summary, error) {
+	where, args := q.Filter.sqlFilter(dialect)
+
+	byCurrency := fmt.Sprintf(`SELECT currency, %s, %s, COUNT(*) FROM expenses WHERE %s GROUP BY currency`, sumIncomeSQL, sumExpenseSQL, where)
+	currencyRows, err := db.Query(byCurrency, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to total expenses by currency: %v", err)
+	}
+	defer currencyRows.Close()
+	originals := currencyTotals{}
+	converting := false
+	for currencyRows.Next() {
+		var from string
+		var income, expense float64
+		var count int
+		if err := currencyRows.Scan(&from, &income, &expense, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan currency totals: %v", err)
+		}
+		from = cmp.Or(from, currency)
+		converting = converting || from != currency
+		originals.add(from, income, expense, count)
+	}
+	if err := currencyRows.Err(); err != nil {
+		return nil, err
+	}
+
+	key, from, groupArgs, ok := q.sqlGrouping(dialect, startDate, args)
+	if !ok || converting {
+		result, err := fallback(q.Filter)
+		if err != nil {
+			return nil, err
+		}
+		conversionRates, err := rates()
+		if err != nil {
+			return nil, err
+		}
+		return summarizeExpenses(result.Expenses, q, startDate, currency, conversionRates)
+	}
+	summary := &Summary{GroupBy: q.GroupBy, Currency: currency, Currencies: originals.groups()}
+	// totals come from the plain table since tag groups may count an expense more than once
+	totals := fmt.Sprintf(`SELECT %s, %s, COUNT(*) FROM expenses WHERE %s`, sumIncomeSQL, sumExpenseSQL, where)
+	if err := db.QueryRow(totals, args...).Scan(&summary.Totals.Income, &summary.Totals.Expense, &summary.Totals.Count); err != nil {
+		return nil, fmt.Errorf("failed to total expenses: %v", err)
+	}
+	summary.Totals.Net = summary.Totals.Income - summary.Totals.Expense
+
+	// shares are split in Go since every owner and participant list divides differently
+	owners := fmt.Sprintf(`SELECT owner, shared_with, %s, %s, COUNT(*) FROM expenses WHERE %s GROUP BY owner, shared_with`, sumIncomeSQL, sumExpenseSQL, where)
+	shareRows, err := db.Query(owners, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to split expenses by user: %v", err)
+	}
+	defer shareRows.Close()
+	shares := shareSplitter{}
+	for shareRows.Next() {
+		var owner string
+		var sharedStr sql.NullString
+		var income, expense float64
+		var count int
+		if err := shareRows.Scan(&owner, &sharedStr, &income, &expense, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan user shares: %v", err)
+		}
+		sharedWith, err := unmarshalList(sharedStr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse participants: %v", err)
+		}
+		shares.add(owner, sharedWith, income, expense, count)
+	}
+	if err := shareRows.Err(); err != nil {
+		return nil, err
+	}
+	summary.Shares = shares.groups()
+
+	grouped := fmt.Sprintf(`SELECT %s, %s, %s, COUNT(*) FROM %s WHERE %s GROUP BY 1`, key, sumIncomeSQL, sumExpenseSQL, from, where)
+	rows, err := db.Query(grouped, groupArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize expenses: %v", err)
+	}
+	defer rows.Close()
+	groups := []SummaryGroup{}
+	for rows.Next() {
+		var g SummaryGroup
+		if err := rows.Scan(&g.Key, &g.Income, &g.Expense, &g.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan summary: %v", err)
+		}
+		g.Net = g.Income - g.Expense
+		groups = append(groups, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return finishSummary(summary, groups, q, startDate)
+}
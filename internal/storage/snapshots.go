@@ -0,0 +1,308 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// snapshot intervals
+const (
+	SnapshotHourly = "hourly"
+	SnapshotDaily  = "daily"
+	SnapshotWeekly = "weekly"
+)
+
+// SnapshotRetention is how many snapshots are kept: the newest of each of the last Hourly
+// hours, Daily days, Weekly weeks and Monthly months; the newest snapshot is always kept
+type SnapshotRetention struct {
+	Hourly  int `json:"hourly"`
+	Daily   int `json:"daily"`
+	Weekly  int `json:"weekly"`
+	Monthly int `json:"monthly"`
+}
+
+// config for the automatic snapshots, which are off without a directory
+type SnapshotConfig struct {
+	Dir      string
+	Interval string
+	Keep     SnapshotRetention
+}
+
+func (c *SnapshotConfig) Enabled() bool {
+	return c.Dir != ""
+}
+
+func (c *SnapshotConfig) SetSnapshotConfig() error {
+	c.Dir = os.Getenv("BACKUP_DIR")
+	switch interval := os.Getenv("BACKUP_INTERVAL"); interval {
+	case "":
+		c.Interval = SnapshotDaily
+	case SnapshotHourly, SnapshotDaily, SnapshotWeekly:
+		c.Interval = interval
+	default:
+		return fmt.Errorf("invalid BACKUP_INTERVAL: %s (must be hourly, daily or weekly)", interval)
+	}
+	c.Keep = SnapshotRetention{Hourly: 24, Daily: 14, Weekly: 0, Monthly: 12}
+	for env, keep := range map[string]*int{
+		"BACKUP_KEEP_HOURLY":  &c.Keep.Hourly,
+		"BACKUP_KEEP_DAILY":   &c.Keep.Daily,
+		"BACKUP_KEEP_WEEKLY":  &c.Keep.Weekly,
+		"BACKUP_KEEP_MONTHLY": &c.Keep.Monthly,
+	} {
+		if value := os.Getenv(env); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid %s: %s", env, value)
+			}
+			*keep = n
+		}
+	}
+	return nil
+}
+
+func (c *SnapshotConfig) every() time.Duration {
+	switch c.Interval {
+	case SnapshotHourly:
+		return time.Hour
+	case SnapshotWeekly:
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// Snapshot is a backup file written by the Snapshotter
+type Snapshot struct {
+	Name      string    `json:"name"`
+	Ledger    string    `json:"ledger"`
+	CreatedAt time.Time `json:"createdAt"`
+	Size      int64     `json:"size"`
+}
+
+const snapshotTimeLayout = "20060102T150405Z"
+
+// snapshots are named <ledger>-<UTC time>.json.gz and kept in a directory per ledger
+var reSnapshotName = regexp.MustCompile(`^([a-z0-9][a-z0-9_-]{0,63})-(\d{8}T\d{6}Z)\.json\.gz$`)
+
+// Snapshotter periodically writes a gzipped backup of every ledger and prunes old ones
+type Snapshotter struct {
+	store  Storage
+	config SnapshotConfig
+}
+
+func NewSnapshotter(store Storage, config SnapshotConfig) (*Snapshotter, error) {
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %v", err)
+	}
+	return &Snapshotter{store: store, config: config}, nil
+}
+
+func (s *Snapshotter) Interval() string {
+	return s.config.Interval
+}
+
+// Run takes a snapshot whenever the interval has passed since the newest one, including
+// right away when it is overdue; it runs until the process exits
+func (s *Snapshotter) Run() {
+	log.Printf("Writing %s backups to %s\n", s.config.Interval, s.config.Dir)
+	for {
+		wait := time.Duration(0)
+		if latest, err := s.latest(); err != nil {
+			log.Printf("BACKUP ERROR: Failed to list snapshots: %v\n", err)
+		} else if !latest.IsZero() {
+			wait = time.Until(latest.Add(s.config.every()))
+		}
+		if wait > 0 {
+			time.Sleep(wait)
+		}
+		// the failed ledgers are logged by Snapshot
+		if err := s.Snapshot(); err != nil {
+			// a failing snapshot (e.g., a full disk) is retried after a while instead of in a loop
+			time.Sleep(min(s.config.every(), time.Hour))
+		}
+	}
+}
+
+// Snapshot backs up every ledger, archived ones included, then prunes the snapshots that
+// the retention policy no longer keeps; a ledger that fails is logged and the others are still
+// backed up, and the errors of all failed ledgers are returned together
+func (s *Snapshotter) Snapshot() error {
+	ledgers, err := s.store.GetLedgers()
+	if err != nil {
+		return fmt.Errorf("failed to list ledgers: %v", err)
+	}
+	now := time.Now().UTC()
+	var errs []error
+	fail := func(err error) {
+		log.Printf("BACKUP ERROR: %v\n", err)
+		errs = append(errs, err)
+	}
+	written := 0
+	for _, ledger := range ledgers {
+		if err := s.snapshotLedger(ledger.ID, now); err != nil {
+			fail(fmt.Errorf("failed to back up ledger %s: %v", ledger.ID, err))
+			continue
+		}
+		written++
+		if err := s.prune(ledger.ID); err != nil {
+			fail(fmt.Errorf("failed to prune backups of ledger %s: %v", ledger.ID, err))
+		}
+	}
+	log.Printf("BACKUP: Wrote snapshot of %d of %d ledgers\n", written, len(ledgers))
+	return errors.Join(errs...)
+}
+
+func (s *Snapshotter) snapshotLedger(id string, now time.Time) error {
+	store, err := s.store.ForLedger(id)
+	if err != nil {
+		return err
+	}
+	backup, err := NewBackup(store, "")
+	if err != nil {
+		return err
+	}
+	backup.CreatedAt = now
+	backup.Ledger = id
+	var buf bytes.Buffer
+	if err := WriteBackup(&buf, backup, true); err != nil {
+		return err
+	}
+	dir := filepath.Join(s.config.Dir, id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.json.gz", id, now.Format(snapshotTimeLayout))
+	return atomicWriteFile(filepath.Join(dir, name), buf.Bytes(), 0600)
+}
+
+// latest is the time of the newest snapshot of any ledger, zero without snapshots
+func (s *Snapshotter) latest() (time.Time, error) {
+	entries, err := os.ReadDir(s.config.Dir)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var latest time.Time
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		snapshots, err := s.List(entry.Name())
+		if err != nil {
+			return time.Time{}, err
+		}
+		if len(snapshots) > 0 && snapshots[0].CreatedAt.After(latest) {
+			latest = snapshots[0].CreatedAt
+		}
+	}
+	return latest, nil
+}
+
+// List returns the ledger's snapshots, newest first
+func (s *Snapshotter) List(ledger string) ([]Snapshot, error) {
+	if ledger == "" {
+		ledger = DefaultLedgerID
+	}
+	entries, err := os.ReadDir(filepath.Join(s.config.Dir, ledger))
+	if os.IsNotExist(err) {
+		return []Snapshot{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	snapshots := []Snapshot{}
+	for _, entry := range entries {
+		match := reSnapshotName.FindStringSubmatch(entry.Name())
+		if match == nil || match[1] != ledger || !entry.Type().IsRegular() {
+			continue
+		}
+		createdAt, err := time.Parse(snapshotTimeLayout, match[2])
+		if err != nil {
+			continue
+		}
+		snapshot := Snapshot{Name: entry.Name(), Ledger: ledger, CreatedAt: createdAt}
+		if info, err := entry.Info(); err == nil {
+			snapshot.Size = info.Size()
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].CreatedAt.After(snapshots[j].CreatedAt) })
+	return snapshots, nil
+}
+
+// Open opens one of the ledger's snapshots by name
+func (s *Snapshotter) Open(ledger, name string) (*os.File, error) {
+	if ledger == "" {
+		ledger = DefaultLedgerID
+	}
+	if match := reSnapshotName.FindStringSubmatch(name); match == nil || match[1] != ledger {
+		return nil, fmt.Errorf("snapshot %s not found", name)
+	}
+	file, err := os.Open(filepath.Join(s.config.Dir, ledger, name))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("snapshot %s not found", name)
+	}
+	return file, err
+}
+
+func (s *Snapshotter) prune(ledger string) error {
+	snapshots, err := s.List(ledger)
+	if err != nil {
+		return err
+	}
+	_, remove := RetainSnapshots(snapshots, s.config.Keep)
+	for _, snapshot := range remove {
+		if err := os.Remove(filepath.Join(s.config.Dir, ledger, snapshot.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RetainSnapshots splits snapshots (newest first) into the ones the retention policy keeps
+// and the ones it removes; periods are counted in local time
+func RetainSnapshots(snapshots []Snapshot, keep SnapshotRetention) (kept, removed []Snapshot) {
+	periods := []struct {
+		count  int
+		period func(t time.Time) string
+	}{
+		{keep.Hourly, func(t time.Time) string { return t.Format("2006-01-02T15") }},
+		{keep.Daily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{keep.Weekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+		{keep.Monthly, func(t time.Time) string { return t.Format("2006-01") }},
+	}
+	retain := make([]bool, len(snapshots))
+	if len(snapshots) > 0 {
+		retain[0] = true
+	}
+	for _, p := range periods {
+		seen := make(map[string]bool)
+		for i, snapshot := range snapshots {
+			if len(seen) >= p.count {
+				break
+			}
+			period := p.period(snapshot.CreatedAt.Local())
+			if !seen[period] {
+				seen[period] = true
+				retain[i] = true
+			}
+		}
+	}
+	for i, snapshot := range snapshots {
+		if retain[i] {
+			kept = append(kept, snapshot)
+		} else {
+			removed = append(removed, snapshot)
+		}
+	}
+	return kept, removed
+}
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRetainSnapshots(t *testing.T) {
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2025, month, day, hour, minute, 0, 0, time.Local)
+	}
+	// newest first, like Snapshotter.List
+	snapshots := []Snapshot{
+		{Name: "a", CreatedAt: at(3, 10, 12, 30)},
+		{Name: "b", CreatedAt: at(3, 10, 12, 0)},
+		{Name: "c", CreatedAt: at(3, 10, 11, 0)},
+		{Name: "d", CreatedAt: at(3, 9, 18, 0)},
+		{Name: "e", CreatedAt: at(3, 9, 8, 0)},
+		{Name: "f", CreatedAt: at(3, 3, 8, 0)},
+		{Name: "g", CreatedAt: at(2, 20, 8, 0)},
+		{Name: "h", CreatedAt: at(1, 5, 8, 0)},
+	}
+	tests := []struct {
+		name string
+		keep SnapshotRetention
+		kept []string
+	}{
+		{"nothing kept but the newest", SnapshotRetention{}, []string{"a"}},
+		{"hourly", SnapshotRetention{Hourly: 3}, []string{"a", "c", "d"}},
+		{"daily", SnapshotRetention{Daily: 2}, []string{"a", "d"}},
+		{"weekly", SnapshotRetention{Weekly: 3}, []string{"a", "d", "g"}}, // March 9 is a Sunday
+		{"monthly", SnapshotRetention{Monthly: 12}, []string{"a", "g", "h"}},
+		{"periods combined", SnapshotRetention{Hourly: 2, Daily: 3, Monthly: 2}, []string{"a", "c", "d", "f", "g"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, removed := RetainSnapshots(snapshots, tt.keep)
+			var names []string
+			for _, s := range kept {
+				names = append(names, s.Name)
+			}
+			if !slices.Equal(names, tt.kept) {
+				t.Errorf("kept %v, want %v", names, tt.kept)
+			}
+			if len(kept)+len(removed) != len(snapshots) {
+				t.Errorf("kept %d and removed %d of %d snapshots", len(kept), len(removed), len(snapshots))
+			}
+		})
+	}
+	if kept, removed := RetainSnapshots(nil, SnapshotRetention{Daily: 1}); len(kept) != 0 || len(removed) != 0 {
+		t.Errorf("no snapshots: kept %v, removed %v", kept, removed)
+	}
+}
+
+func TestSnapshotContinuesPastFailingLedger(t *testing.T) {
+	store, err := InitializeJsonStore(SystemConfig{StorageType: BackendTypeJSON, StorageURL: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"biz", "home"} {
+		if err := store.AddLedger(Ledger{ID: id, Name: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dir := t.TempDir()
+	// a file where the backups of biz go makes that ledger fail
+	if err := os.WriteFile(filepath.Join(dir, "biz"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	snapshots, err := NewSnapshotter(store, SnapshotConfig{Dir: dir, Interval: SnapshotDaily, Keep: SnapshotRetention{Daily: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := snapshots.Snapshot(); err == nil {
+		t.Fatal("expected the failure of ledger biz")
+	}
+	for _, id := range []string{DefaultLedgerID, "home"} {
+		list, err := snapshots.List(id)
+		if err != nil {
+			t.Fatalf("%s: %v", id, err)
+		}
+		if len(list) != 1 {
+			t.Errorf("ledger %s has %d snapshots, want 1", id, len(list))
+		}
+	}
+}
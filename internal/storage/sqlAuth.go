@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// sqlAuthStore implements the authentication part of the Storage interface for both
+// database backends; it is embedded in databaseStore and sqliteStore
+type sqlAuthStore struct {
+	authDB  *sql.DB
+	dialect sqlDialect
+}
+
+// rebind turns ? placeholders into $n for Postgres
+func (d sqlDialect) rebind(query string) string {
+	if d != dialectPostgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// timeArg converts a time into what the dialect stores; zero times become NULL
+func (d sqlDialect) timeArg(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	if d == dialectSQLite {
+		return formatSQLiteTime(t)
+	}
+	return t
+}
+
+// sqlTime scans both native timestamps (Postgres) and text timestamps (SQLite)
+type sqlTime struct {
+	Time time.Time
+}
+
+func (t *sqlTime) Scan(value any) error {
+	switch v := value.(type) {
+	case nil:
+		t.Time = time.Time{}
+	case time.Time:
+		t.Time = v
+	case string:
+		parsed, err := parseSQLiteTime(v)
+		if err != nil {
+			return err
+		}
+		t.Time = parsed
+	case []byte:
+		return t.Scan(string(v))
+	default:
+		return fmt.Errorf("cannot scan %T into time", value)
+	}
+	return nil
+}
+
+func (s *sqlAuthStore) exec(query string, args ...any) (sql.Result, error) {
+	return s.authDB.Exec(s.dialect.rebind(query), args...)
+}
+
+func scanUser(scanner interface{ Scan(...any) error }) (User, error) {
+	var user User
+	var createdAt sqlTime
+	if err := scanner.Scan(&user.Username, &user.PasswordHash, &createdAt); err != nil {
+		return User{}, err
+	}
+	user.CreatedAt = createdAt.Time
+	return user, nil
+}
+
+func (s *sqlAuthStore) GetUsers() ([]User, error) {
+	rows, err := s.authDB.Query(`SELECT username, password_hash, created_at FROM users ORDER BY username`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users: %v", err)
+	}
+	defer rows.Close()
+	users := []User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %v", err)
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (s *sqlAuthStore) GetUser(username string) (User, error) {
+	query := s.dialect.rebind(`SELECT username, password_hash, created_at FROM users WHERE username = ?`)
+	user, err := scanUser(s.authDB.QueryRow(query, username))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return User{}, fmt.Errorf("user %s not found", username)
+		}
+		return User{}, fmt.Errorf("failed to get user: %v", err)
+	}
+	return user, nil
+}
+
+func (s *sqlAuthStore) SaveUser(user User) error {
+	if err := ValidateUsername(user.Username); err != nil {
+		return err
+	}
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now().UTC()
+	}
+	query := `
+		INSERT INTO users (username, password_hash, created_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT (username) DO UPDATE SET password_hash = EXCLUDED.password_hash
+	`
+	if _, err := s.exec(query, user.Username, user.PasswordHash, s.dialect.timeArg(user.CreatedAt)); err != nil {
+		return fmt.Errorf("failed to save user: %v", err)
+	}
+	return nil
+}
+
+func (s *sqlAuthStore) RemoveUser(username string) error {
+	tx, err := s.authDB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(s.dialect.rebind(`DELETE FROM auth_tokens WHERE username = ?`), username); err != nil {
+		return fmt.Errorf("failed to delete user tokens: %v", err)
+	}
+	result, err := tx.Exec(s.dialect.rebind(`DELETE FROM users WHERE username = ?`), username)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %v", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("user %s not found", username)
+	}
+	return tx.Commit()
+}
+
+const authTokenColumns = `id, username, kind, name, token_hash, created_at, expires_at`
+
+func scanAuthToken(scanner interface{ Scan(...any) error }) (AuthToken, error) {
+	var token AuthToken
+	var createdAt, expiresAt sqlTime
+	if err := scanner.Scan(&token.ID, &token.Username, &token.Kind, &token.Name, &token.Hash, &createdAt, &expiresAt); err != nil {
+		return AuthToken{}, err
+	}
+	token.CreatedAt = createdAt.Time
+	token.ExpiresAt = expiresAt.Time
+	return token, nil
+}
+
+func (s *sqlAuthStore) GetAuthTokens(username string) ([]AuthToken, error) {
+	query := s.dialect.rebind(`SELECT ` + authTokenColumns + ` FROM auth_tokens WHERE username = ? ORDER BY created_at`)
+	rows, err := s.authDB.Query(query, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tokens: %v", err)
+	}
+	defer rows.Close()
+	tokens := []AuthToken{}
+	for rows.Next() {
+		token, err := scanAuthToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan token: %v", err)
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+func (s *sqlAuthStore) GetAuthTokenByHash(hash string) (AuthToken, error) {
+	query := s.dialect.rebind(`SELECT ` + authTokenColumns + ` FROM auth_tokens WHERE token_hash = ?`)
+	token, err := scanAuthToken(s.authDB.QueryRow(query, hash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return AuthToken{}, fmt.Errorf("token not found")
+		}
+		return AuthToken{}, fmt.Errorf("failed to get token: %v", err)
+	}
+	return token, nil
+}
+
+func (s *sqlAuthStore) AddAuthToken(token AuthToken) error {
+	query := `INSERT INTO auth_tokens (` + authTokenColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err := s.exec(query, token.ID, token.Username, token.Kind, token.Name, token.Hash,
+		s.dialect.timeArg(token.CreatedAt), s.dialect.timeArg(token.ExpiresAt))
+	if err != nil {
+		return fmt.Errorf("failed to add token: %v", err)
+	}
+	return nil
+}
+
+func (s *sqlAuthStore) RemoveAuthToken(id string) error {
+	result, err := s.exec(`DELETE FROM auth_tokens WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete token: %v", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("token with ID %s not found", id)
+	}
+	return nil
+}
+
+func (s *sqlAuthStore) RemoveExpiredAuthTokens() error {
+	if _, err := s.exec(`DELETE FROM auth_tokens WHERE expires_at IS NOT NULL AND expires_at < ?`, s.dialect.timeArg(time.Now().UTC())); err != nil {
+		return fmt.Errorf("failed to delete expired tokens: %v", err)
+	}
+	return nil
+}
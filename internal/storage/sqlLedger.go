@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// sqlLedgerStore implements ledger management for both database backends; ledger data
+// itself is scoped by the ledger_id column (and the config id) in each store
+type sqlLedgerStore struct {
+	ledgerDB *sql.DB
+	dialect  sqlDialect
+}
+
+// ledgerDefaults caches the config values filled into expenses that leave them out, so adds
+// don't query the config; the handlers of a store share it, so it has its own lock
+type ledgerDefaults struct {
+	mu       sync.RWMutex
+	currency string
+}
+
+func (d *ledgerDefaults) set(config *Config) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.currency = config.Currency
+}
+
+func (d *ledgerDefaults) defaultCurrency() string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.currency
+}
+
+func scanLedger(scanner interface{ Scan(...any) error }) (Ledger, error) {
+	var ledger Ledger
+	var createdAt sqlTime
+	if err := scanner.Scan(&ledger.ID, &ledger.Name, &ledger.Archived, &createdAt); err != nil {
+		return Ledger{}, err
+	}
+	ledger.CreatedAt = createdAt.Time
+	return ledger, nil
+}
+
+func (s *sqlLedgerStore) GetLedgers() ([]Ledger, error) {
+	rows, err := s.ledgerDB.Query(`SELECT id, name, archived, created_at FROM ledgers`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query ledgers: %v", err)
+	}
+	defer rows.Close()
+	ledgers := []Ledger{}
+	for rows.Next() {
+		ledger, err := scanLedger(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan ledger: %v", err)
+		}
+		ledgers = append(ledgers, ledger)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return withDefaultLedger(ledgers), nil
+}
+
+func (s *sqlLedgerStore) GetLedger(id string) (Ledger, error) {
+	ledgers, err := s.GetLedgers()
+	if err != nil {
+		return Ledger{}, err
+	}
+	return findLedger(ledgers, id)
+}
+
+func (s *sqlLedgerStore) AddLedger(ledger Ledger) error {
+	if err := ledger.Validate(); err != nil {
+		return err
+	}
+	if _, err := s.GetLedger(ledger.ID); err == nil {
+		return fmt.Errorf("ledger %s already exists", ledger.ID)
+	}
+	if ledger.CreatedAt.IsZero() {
+		ledger.CreatedAt = time.Now().UTC()
+	}
+	query := s.dialect.rebind(`INSERT INTO ledgers (id, name, archived, created_at) VALUES (?, ?, ?, ?)`)
+	if _, err := s.ledgerDB.Exec(query, ledger.ID, ledger.Name, ledger.Archived, s.dialect.timeArg(ledger.CreatedAt)); err != nil {
+		return fmt.Errorf("failed to add ledger: %v", err)
+	}
+	return nil
+}
+
+func (s *sqlLedgerStore) UpdateLedger(ledger Ledger) error {
+	if err := ledger.Validate(); err != nil {
+		return err
+	}
+	existing, err := s.GetLedger(ledger.ID)
+	if err != nil {
+		return err
+	}
+	if existing.CreatedAt.IsZero() {
+		existing.CreatedAt = time.Now().UTC()
+	}
+	// the default ledger has no row until it is first renamed
+	query := s.dialect.rebind(`
+		INSERT INTO ledgers (id, name, archived, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, archived = EXCLUDED.archived
+	`)
+	if _, err := s.ledgerDB.Exec(query, ledger.ID, ledger.Name, ledger.Archived, s.dialect.timeArg(existing.CreatedAt)); err != nil {
+		return fmt.Errorf("failed to update ledger: %v", err)
+	}
+	return nil
+}
+
+func (s *sqlLedgerStore) RemoveLedger(id string) error {
+	if id == DefaultLedgerID {
+		return fmt.Errorf("the default ledger cannot be deleted")
+	}
+	if _, err := s.GetLedger(id); err != nil {
+		return err
+	}
+	tx, err := s.ledgerDB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	for _, query := range []string{
+		`DELETE FROM expenses WHERE ledger_id = ?`,
+		`DELETE FROM recurring_expenses WHERE ledger_id = ?`,
+		`DELETE FROM config WHERE id = ?`,
+		`DELETE FROM ledgers WHERE id = ?`,
+	} {
+		if _, err := tx.Exec(s.dialect.rebind(query), id); err != nil {
+			return fmt.Errorf("failed to delete ledger: %v", err)
+		}
+	}
+	return tx.Commit()
+}
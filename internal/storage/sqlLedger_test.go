@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLedgerDefaultCurrency(t *testing.T) {
+	for name, open := range testBackends {
+		t.Run(name, func(t *testing.T) {
+			store := open(t)
+			if err := store.AddLedger(Ledger{ID: "travel", Name: "Travel"}); err != nil {
+				t.Fatal(err)
+			}
+			travel, err := store.ForLedger("travel")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := travel.UpdateCurrency("eur"); err != nil {
+				t.Fatal(err)
+			}
+
+			// a fresh view of the ledger reads its defaults from the stored config
+			travel, err = store.ForLedger("travel")
+			if err != nil {
+				t.Fatal(err)
+			}
+			date := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+			if err := travel.AddExpense(Expense{ID: "e1", Name: "Train", Category: "Travel", Amount: -40, Date: date}); err != nil {
+				t.Fatal(err)
+			}
+			expense, err := travel.GetExpense("e1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expense.Currency != "eur" {
+				t.Errorf("expense currency %q, want the ledger default eur", expense.Currency)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// sqlRateStore implements conversion rates for both database backends; the table has no
+// ledger_id since rates are shared by all ledgers
+type sqlRateStore struct {
+	rateDB  *sql.DB
+	dialect sqlDialect
+}
+
+func (s *sqlRateStore) GetConversionRates() ([]ConversionRate, error) {
+	rows, err := s.rateDB.Query(`SELECT from_currency, to_currency, effective_date, rate FROM conversion_rates`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query conversion rates: %v", err)
+	}
+	defer rows.Close()
+	rates := []ConversionRate{}
+	for rows.Next() {
+		var rate ConversionRate
+		var effective sqlTime
+		if err := rows.Scan(&rate.From, &rate.To, &effective, &rate.Rate); err != nil {
+			return nil, fmt.Errorf("failed to scan conversion rate: %v", err)
+		}
+		rate.EffectiveDate = effective.Time.UTC()
+		rates = append(rates, rate)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sortRates(rates)
+	return rates, nil
+}
+
+func (s *sqlRateStore) SaveConversionRate(rate ConversionRate) error {
+	return s.SaveConversionRates([]ConversionRate{rate})
+}
+
+func (s *sqlRateStore) SaveConversionRates(rates []ConversionRate) error {
+	rates = slices.Clone(rates)
+	for i := range rates {
+		if err := rates[i].Validate(); err != nil {
+			return err
+		}
+	}
+	tx, err := s.rateDB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(s.dialect.rebind(`
+		INSERT INTO conversion_rates (from_currency, to_currency, effective_date, rate)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (from_currency, to_currency, effective_date) DO UPDATE SET rate = EXCLUDED.rate
+	`))
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %v", err)
+	}
+	defer stmt.Close()
+	for _, rate := range rates {
+		if _, err := stmt.Exec(rate.From, rate.To, s.dialect.timeArg(rate.EffectiveDate), rate.Rate); err != nil {
+			return fmt.Errorf("failed to save conversion rate: %v", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlRateStore) RemoveConversionRate(from, to string, date time.Time) error {
+	query := s.dialect.rebind(`DELETE FROM conversion_rates WHERE from_currency = ? AND to_currency = ? AND effective_date = ?`)
+	result, err := s.rateDB.Exec(query, from, to, s.dialect.timeArg(rateDay(date)))
+	if err != nil {
+		return fmt.Errorf("failed to delete conversion rate: %v", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("conversion rate %s/%s on %s not found", from, to, rateDay(date).Format(time.DateOnly))
+	}
+	return nil
+}
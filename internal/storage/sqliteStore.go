@@ -0,0 +1,773 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	_ "modernc.org/sqlite"
+)
+
+// sqliteStore implements the Storage interface for a single-file SQLite database.
+type sqliteStore struct {
+	sqlAuthStore
+	sqlLedgerStore
+	sqlRateStore
+	db       *sql.DB
+	defaults *ledgerDefaults // allows reusing defaults without querying for config
+	ledger   string          // every query is scoped to this ledger
+	scoped   bool            // ledger views share the connection of the store they came from
+}
+
+// dates are stored as fixed-width UTC text so that lexical order matches chronological order
+const sqliteTimeLayout = "2006-01-02T15:04:05.000000Z07:00"
+
+func InitializeSQLiteStore(baseConfig SystemConfig) (Storage, error) {
+	dbPath := makeSQLitePath(baseConfig)
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %v", err)
+	}
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_txlock=immediate", dbPath)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database: %v", err)
+	}
+	// SQLite allows a single writer, so serialize access through one connection
+	db.SetMaxOpenConns(1)
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to ping SQLite database: %v", err)
+	}
+	log.Printf("Connected to SQLite database at %s\n", dbPath)
+
+	if err := applyMigrations(db, dialectSQLite); err != nil {
+		return nil, fmt.Errorf("failed to migrate database schema: %v", err)
+	}
+	store := &sqliteStore{
+		sqlAuthStore:   sqlAuthStore{db, dialectSQLite},
+		sqlLedgerStore: sqlLedgerStore{db, dialectSQLite},
+		sqlRateStore:   sqlRateStore{db, dialectSQLite},
+		db:             db,
+		ledger:         DefaultLedgerID,
+	}
+	if err := store.loadDefaults(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func (s *sqliteStore) loadDefaults() error {
+	s.defaults = &ledgerDefaults{}
+	config, err := s.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %v", err)
+	}
+	s.defaults.set(config)
+	return nil
+}
+
+func (s *sqliteStore) ForLedger(id string) (Storage, error) {
+	if id == "" {
+		id = DefaultLedgerID
+	}
+	if _, err := s.GetLedger(id); err != nil {
+		return nil, err
+	}
+	scoped := *s
+	scoped.ledger = id
+	scoped.scoped = true
+	if err := scoped.loadDefaults(); err != nil {
+		return nil, err
+	}
+	return &scoped, nil
+}
+
+// STORAGE_URL may point at the database file or at a directory to hold it
+func makeSQLitePath(baseConfig SystemConfig) string {
+	path := baseConfig.StorageURL
+	if info, err := os.Stat(path); (err == nil && info.IsDir()) || filepath.Ext(path) == "" {
+		return filepath.Join(path, "expenseowl.db")
+	}
+	return path
+}
+
+func formatSQLiteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeLayout)
+}
+
+func parseSQLiteTime(s string) (time.Time, error) {
+	t, err := time.Parse(sqliteTimeLayout, s)
+	if err != nil {
+		return time.Parse(time.RFC3339Nano, s)
+	}
+	return t, nil
+}
+
+func (s *sqliteStore) Close() error {
+	if s.scoped {
+		return nil
+	}
+	return s.db.Close()
+}
+
+func (s *sqliteStore) saveConfig(config *Config) error {
+	categoriesJSON, err := json.Marshal(config.Categories)
+	if err != nil {
+		return fmt.Errorf("failed to marshal categories: %v", err)
+	}
+	rulesJSON, err := json.Marshal(config.CategoryRules)
+	if err != nil {
+		return fmt.Errorf("failed to marshal category rules: %v", err)
+	}
+	profilesJSON, err := json.Marshal(config.CSVProfiles)
+	if err != nil {
+		return fmt.Errorf("failed to marshal CSV profiles: %v", err)
+	}
+	dismissedJSON, err := json.Marshal(config.DismissedDuplicates)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dismissed duplicates: %v", err)
+	}
+	query := `
+		INSERT INTO config (id, categories, currency, start_date, category_rules, csv_profiles, dismissed_duplicates)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			categories = excluded.categories,
+			currency = excluded.currency,
+			start_date = excluded.start_date,
+			category_rules = excluded.category_rules,
+			csv_profiles = excluded.csv_profiles,
+			dismissed_duplicates = excluded.dismissed_duplicates;
+	`
+	if _, err := s.db.Exec(query, s.ledger, string(categoriesJSON), config.Currency, config.StartDate, string(rulesJSON), string(profilesJSON), string(dismissedJSON)); err != nil {
+		return err
+	}
+	s.defaults.set(config)
+	return nil
+}
+
+func (s *sqliteStore) updateConfig(updater func(c *Config) error) error {
+	config, err := s.GetConfig()
+	if err != nil {
+		return err
+	}
+	if err := updater(config); err != nil {
+		return err
+	}
+	return s.saveConfig(config)
+}
+
+func (s *sqliteStore) GetConfig() (*Config, error) {
+	query := `SELECT categories, currency, start_date, category_rules, csv_profiles, dismissed_duplicates FROM config WHERE id = ?`
+	var categoriesStr, currency string
+	var rulesStr, profilesStr, dismissedStr sql.NullString
+	var startDate int
+	err := s.db.QueryRow(query, s.ledger).Scan(&categoriesStr, &currency, &startDate, &rulesStr, &profilesStr, &dismissedStr)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			config := &Config{}
+			config.SetBaseConfig()
+			if err := s.saveConfig(config); err != nil {
+				return nil, fmt.Errorf("failed to save initial default config: %v", err)
+			}
+			return config, nil
+		}
+		return nil, fmt.Errorf("failed to get config from db: %v", err)
+	}
+
+	var config Config
+	config.Currency = currency
+	config.StartDate = startDate
+	if err := json.Unmarshal([]byte(categoriesStr), &config.Categories); err != nil {
+		return nil, fmt.Errorf("failed to parse categories from db: %v", err)
+	}
+	config.CategoryRules = []CategoryRule{}
+	if rulesStr.Valid && rulesStr.String != "" {
+		if err := json.Unmarshal([]byte(rulesStr.String), &config.CategoryRules); err != nil {
+			return nil, fmt.Errorf("failed to parse category rules from db: %v", err)
+		}
+	}
+	config.CSVProfiles = []CSVProfile{}
+	if profilesStr.Valid && profilesStr.String != "" {
+		if err := json.Unmarshal([]byte(profilesStr.String), &config.CSVProfiles); err != nil {
+			return nil, fmt.Errorf("failed to parse CSV profiles from db: %v", err)
+		}
+	}
+	config.DismissedDuplicates = []string{}
+	if dismissedStr.Valid && dismissedStr.String != "" {
+		if err := json.Unmarshal([]byte(dismissedStr.String), &config.DismissedDuplicates); err != nil {
+			return nil, fmt.Errorf("failed to parse dismissed duplicates from db: %v", err)
+		}
+	}
+
+	recurring, err := s.GetRecurringExpenses()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recurring expenses for config: %v", err)
+	}
+	config.RecurringExpenses = recurring
+
+	return &config, nil
+}
+
+func (s *sqliteStore) GetCategories() ([]string, error) {
+	config, err := s.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	return config.Categories, nil
+}
+
+func (s *sqliteStore) UpdateCategories(categories []string) error {
+	return s.updateConfig(func(c *Config) error {
+		c.Categories = categories
+		return nil
+	})
+}
+
+func (s *sqliteStore) GetCurrency() (string, error) {
+	config, err := s.GetConfig()
+	if err != nil {
+		return "", err
+	}
+	return config.Currency, nil
+}
+
+func (s *sqliteStore) UpdateCurrency(currency string) error {
+	if !slices.Contains(SupportedCurrencies, currency) {
+		return fmt.Errorf("invalid currency: %s", currency)
+	}
+	return s.updateConfig(func(c *Config) error {
+		c.Currency = currency
+		return nil
+	})
+}
+
+func (s *sqliteStore) GetStartDate() (int, error) {
+	config, err := s.GetConfig()
+	if err != nil {
+		return 0, err
+	}
+	return config.StartDate, nil
+}
+
+func (s *sqliteStore) UpdateStartDate(startDate int) error {
+	if startDate < 1 || startDate > 31 {
+		return fmt.Errorf("invalid start date: %d", startDate)
+	}
+	return s.updateConfig(func(c *Config) error {
+		c.StartDate = startDate
+		return nil
+	})
+}
+
+func (s *sqliteStore) GetCategoryRules() ([]CategoryRule, error) {
+	config, err := s.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	return config.CategoryRules, nil
+}
+
+func (s *sqliteStore) UpdateCategoryRules(rules []CategoryRule) error {
+	rules, err := ValidateCategoryRules(rules)
+	if err != nil {
+		return err
+	}
+	return s.updateConfig(func(c *Config) error {
+		c.CategoryRules = rules
+		return nil
+	})
+}
+
+func (s *sqliteStore) GetCSVProfiles() ([]CSVProfile, error) {
+	config, err := s.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config.CSVProfiles == nil {
+		return []CSVProfile{}, nil
+	}
+	return config.CSVProfiles, nil
+}
+
+func (s *sqliteStore) SaveCSVProfile(profile CSVProfile) error {
+	if err := profile.Validate(); err != nil {
+		return err
+	}
+	return s.updateConfig(func(c *Config) error {
+		c.setCSVProfile(profile)
+		return nil
+	})
+}
+
+func (s *sqliteStore) RemoveCSVProfile(name string) error {
+	return s.updateConfig(func(c *Config) error {
+		return c.removeCSVProfile(name)
+	})
+}
+
+func (s *sqliteStore) GetDismissedDuplicates() ([]string, error) {
+	config, err := s.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config.DismissedDuplicates == nil {
+		return []string{}, nil
+	}
+	return config.DismissedDuplicates, nil
+}
+
+func (s *sqliteStore) DismissDuplicates(ids []string) error {
+	return s.updateConfig(func(c *Config) error {
+		return c.dismissDuplicates(ids)
+	})
+}
+
+func scanSQLiteExpense(scanner interface{ Scan(...any) error }) (Expense, error) {
+	var expense Expense
+	var tagsStr, sharedStr sql.NullString
+	var recurringID sql.NullString
+	var dateStr string
+	err := scanner.Scan(&expense.ID, &recurringID, &expense.Name, &expense.Category, &expense.Amount, &expense.Currency, &dateStr, &tagsStr, &expense.Owner, &sharedStr, &expense.ExternalID)
+	if err != nil {
+		return Expense{}, err
+	}
+	if recurringID.Valid {
+		expense.RecurringID = recurringID.String
+	}
+	if expense.Date, err = parseSQLiteTime(dateStr); err != nil {
+		return Expense{}, fmt.Errorf("failed to parse date for expense %s: %v", expense.ID, err)
+	}
+	if tagsStr.Valid && tagsStr.String != "" {
+		if err := json.Unmarshal([]byte(tagsStr.String), &expense.Tags); err != nil {
+			return Expense{}, fmt.Errorf("failed to parse tags for expense %s: %v", expense.ID, err)
+		}
+	}
+	if expense.SharedWith, err = unmarshalList(sharedStr); err != nil {
+		return Expense{}, fmt.Errorf("failed to parse participants for expense %s: %v", expense.ID, err)
+	}
+	return expense, nil
+}
+
+func (s *sqliteStore) GetAllExpenses() ([]Expense, error) {
+	query := `SELECT ` + expenseColumns + ` FROM expenses WHERE ledger_id = ? ORDER BY date DESC`
+	rows, err := s.db.Query(query, s.ledger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expenses: %v", err)
+	}
+	defer rows.Close()
+
+	var expenses []Expense
+	for rows.Next() {
+		expense, err := scanSQLiteExpense(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan expense: %v", err)
+		}
+		expenses = append(expenses, expense)
+	}
+	return expenses, rows.Err()
+}
+
+func (s *sqliteStore) QueryExpenses(query ExpenseQuery) (*ExpenseQueryResult, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	query.ledgerID = s.ledger
+	where, args := query.sqlFilter(dialectSQLite)
+	result := &ExpenseQueryResult{Expenses: []Expense{}, Limit: query.Limit, Offset: query.Offset}
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM expenses WHERE `+where, args...).Scan(&result.Total); err != nil {
+		return nil, fmt.Errorf("failed to count expenses: %v", err)
+	}
+	rows, err := s.db.Query(`SELECT `+expenseColumns+` FROM expenses WHERE `+where+query.sqlOrder(dialectSQLite), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expenses: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		expense, err := scanSQLiteExpense(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan expense: %v", err)
+		}
+		result.Expenses = append(result.Expenses, expense)
+	}
+	return result, rows.Err()
+}
+
+func (s *sqliteStore) SummarizeExpenses(query SummaryQuery) (*Summary, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	config, err := s.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	query.Filter.ledgerID = s.ledger
+	return querySummary(s.db, dialectSQLite, query, config.StartDate, config.Currency, s.GetConversionRates, s.QueryExpenses)
+}
+
+func (s *sqliteStore) GetExpense(id string) (Expense, error) {
+	query := `SELECT ` + expenseColumns + ` FROM expenses WHERE id = ? AND ledger_id = ?`
+	expense, err := scanSQLiteExpense(s.db.QueryRow(query, id, s.ledger))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Expense{}, fmt.Errorf("expense with ID %s not found", id)
+		}
+		return Expense{}, fmt.Errorf("failed to get expense: %v", err)
+	}
+	return expense, nil
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func (s *sqliteStore) insertExpense(ex execer, expense Expense) error {
+	tagsJSON, err := json.Marshal(expense.Tags)
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO expenses (` + expenseColumns + `, ledger_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err = ex.Exec(query, expense.ID, expense.RecurringID, expense.Name, expense.Category, expense.Amount, expense.Currency, formatSQLiteTime(expense.Date), string(tagsJSON), expense.Owner, marshalList(expense.SharedWith), expense.ExternalID, s.ledger)
+	return err
+}
+
+func (s *sqliteStore) AddExpense(expense Expense) error {
+	if expense.ID == "" {
+		expense.ID = uuid.New().String()
+	}
+	if expense.Currency == "" {
+		expense.Currency = s.defaults.defaultCurrency()
+	}
+	if expense.Date.IsZero() {
+		expense.Date = time.Now()
+	}
+	return s.insertExpense(s.db, expense)
+}
+
+func (s *sqliteStore) UpdateExpense(id string, expense Expense) error {
+	return s.updateExpense(s.db, id, expense)
+}
+
+func (s *sqliteStore) UpdateMultipleExpenses(expenses []Expense) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	for _, exp := range expenses {
+		if err := s.updateExpense(tx, exp.ID, exp); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+func (s *sqliteStore) MergeExpenses(kept Expense, remove []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	if err := s.updateExpense(tx, kept.ID, kept); err != nil {
+		return err
+	}
+	if err := s.removeExpenses(tx, remove); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+func (s *sqliteStore) updateExpense(ex execer, id string, expense Expense) error {
+	tagsJSON, err := json.Marshal(expense.Tags)
+	if err != nil {
+		return err
+	}
+	if expense.Currency == "" {
+		expense.Currency = s.defaults.defaultCurrency()
+	}
+	query := `
+		UPDATE expenses
+		SET name = ?, category = ?, amount = ?, currency = ?, date = ?, tags = ?, recurring_id = ?, owner = ?, shared_with = ?, external_id = ?
+		WHERE id = ? AND ledger_id = ?
+	`
+	result, err := ex.Exec(query, expense.Name, expense.Category, expense.Amount, expense.Currency, formatSQLiteTime(expense.Date), string(tagsJSON), expense.RecurringID, expense.Owner, marshalList(expense.SharedWith), expense.ExternalID, id, s.ledger)
+	if err != nil {
+		return fmt.Errorf("failed to update expense: %v", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("expense with ID %s not found", id)
+	}
+	return nil
+}
+
+func (s *sqliteStore) RemoveExpense(id string) error {
+	query := `DELETE FROM expenses WHERE id = ? AND ledger_id = ?`
+	result, err := s.db.Exec(query, id, s.ledger)
+	if err != nil {
+		return fmt.Errorf("failed to delete expense: %v", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %v", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("expense with ID %s not found", id)
+	}
+	return nil
+}
+
+func (s *sqliteStore) AddMultipleExpenses(expenses []Expense) error {
+	if len(expenses) == 0 {
+		return nil
+	}
+	_, err := s.ImportExpenses(singleBatch(expenses))
+	return err
+}
+
+func (s *sqliteStore) ImportExpenses(next func() ([]Expense, error)) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	count := 0
+	for {
+		batch, err := next()
+		if err != nil {
+			return 0, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		for _, exp := range batch {
+			if exp.ID == "" {
+				exp.ID = uuid.New().String()
+			}
+			if exp.Currency == "" {
+				exp.Currency = s.defaults.defaultCurrency()
+			}
+			if exp.Date.IsZero() {
+				exp.Date = time.Now()
+			}
+			if err := s.insertExpense(tx, exp); err != nil {
+				return 0, fmt.Errorf("failed to insert expense: %v", err)
+			}
+		}
+		count += len(batch)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return count, nil
+}
+
+func (s *sqliteStore) RemoveMultipleExpenses(ids []string) error {
+	return s.removeExpenses(s.db, ids)
+}
+
+func (s *sqliteStore) removeExpenses(ex execer, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	args = append(args, s.ledger)
+	query := fmt.Sprintf(`DELETE FROM expenses WHERE id IN (%s) AND ledger_id = ?`, placeholders)
+	if _, err := ex.Exec(query, args...); err != nil {
+		return fmt.Errorf("failed to delete multiple expenses: %v", err)
+	}
+	return nil
+}
+
+func scanSQLiteRecurringExpense(scanner interface{ Scan(...any) error }) (RecurringExpense, error) {
+	var re RecurringExpense
+	var tagsStr, sharedStr sql.NullString
+	var startDateStr string
+	err := scanner.Scan(&re.ID, &re.Name, &re.Amount, &re.Currency, &re.Category, &startDateStr, &re.Interval, &re.Occurrences, &tagsStr, &re.Owner, &sharedStr)
+	if err != nil {
+		return RecurringExpense{}, err
+	}
+	if re.StartDate, err = parseSQLiteTime(startDateStr); err != nil {
+		return RecurringExpense{}, fmt.Errorf("failed to parse start date for recurring expense %s: %v", re.ID, err)
+	}
+	if tagsStr.Valid && tagsStr.String != "" {
+		if err := json.Unmarshal([]byte(tagsStr.String), &re.Tags); err != nil {
+			return RecurringExpense{}, fmt.Errorf("failed to parse tags for recurring expense %s: %v", re.ID, err)
+		}
+	}
+	if re.SharedWith, err = unmarshalList(sharedStr); err != nil {
+		return RecurringExpense{}, fmt.Errorf("failed to parse participants for recurring expense %s: %v", re.ID, err)
+	}
+	return re, nil
+}
+
+func (s *sqliteStore) GetRecurringExpenses() ([]RecurringExpense, error) {
+	query := `SELECT ` + recurringColumns + ` FROM recurring_expenses WHERE ledger_id = ?`
+	rows, err := s.db.Query(query, s.ledger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query recurring expenses: %v", err)
+	}
+	defer rows.Close()
+	var recurringExpenses []RecurringExpense
+	for rows.Next() {
+		re, err := scanSQLiteRecurringExpense(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan recurring expense: %v", err)
+		}
+		recurringExpenses = append(recurringExpenses, re)
+	}
+	return recurringExpenses, rows.Err()
+}
+
+func (s *sqliteStore) GetRecurringExpense(id string) (RecurringExpense, error) {
+	query := `SELECT ` + recurringColumns + ` FROM recurring_expenses WHERE id = ? AND ledger_id = ?`
+	re, err := scanSQLiteRecurringExpense(s.db.QueryRow(query, id, s.ledger))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return RecurringExpense{}, fmt.Errorf("recurring expense with ID %s not found", id)
+		}
+		return RecurringExpense{}, fmt.Errorf("failed to get recurring expense: %v", err)
+	}
+	return re, nil
+}
+
+func (s *sqliteStore) AddRecurringExpense(recurringExpense RecurringExpense) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback() // Rollback on error
+
+	if recurringExpense.ID == "" {
+		recurringExpense.ID = uuid.New().String()
+	}
+	if recurringExpense.Currency == "" {
+		recurringExpense.Currency = s.defaults.defaultCurrency()
+	}
+	tagsJSON, _ := json.Marshal(recurringExpense.Tags)
+	ruleQuery := `
+		INSERT INTO recurring_expenses (` + recurringColumns + `, ledger_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err = tx.Exec(ruleQuery, recurringExpense.ID, recurringExpense.Name, recurringExpense.Amount, recurringExpense.Currency, recurringExpense.Category, formatSQLiteTime(recurringExpense.StartDate), recurringExpense.Interval, recurringExpense.Occurrences, string(tagsJSON), recurringExpense.Owner, marshalList(recurringExpense.SharedWith), s.ledger)
+	if err != nil {
+		return fmt.Errorf("failed to insert recurring expense rule: %v", err)
+	}
+
+	for _, exp := range generateExpensesFromRecurring(recurringExpense, false) {
+		if err := s.insertExpense(tx, exp); err != nil {
+			return fmt.Errorf("failed to insert recurring expense instance: %v", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) AddRecurringExpenseRule(recurringExpense RecurringExpense) error {
+	if recurringExpense.ID == "" {
+		recurringExpense.ID = uuid.New().String()
+	}
+	if recurringExpense.Currency == "" {
+		recurringExpense.Currency = s.defaults.defaultCurrency()
+	}
+	tagsJSON, _ := json.Marshal(recurringExpense.Tags)
+	ruleQuery := `
+		INSERT INTO recurring_expenses (` + recurringColumns + `, ledger_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := s.db.Exec(ruleQuery, recurringExpense.ID, recurringExpense.Name, recurringExpense.Amount, recurringExpense.Currency, recurringExpense.Category, formatSQLiteTime(recurringExpense.StartDate), recurringExpense.Interval, recurringExpense.Occurrences, string(tagsJSON), recurringExpense.Owner, marshalList(recurringExpense.SharedWith), s.ledger)
+	if err != nil {
+		return fmt.Errorf("failed to insert recurring expense rule: %v", err)
+	}
+	return nil
+}
+
+func (s *sqliteStore) UpdateRecurringExpense(id string, recurringExpense RecurringExpense, updateAll bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	recurringExpense.ID = id // Ensure ID is preserved
+	if recurringExpense.Currency == "" {
+		recurringExpense.Currency = s.defaults.defaultCurrency()
+	}
+	tagsJSON, _ := json.Marshal(recurringExpense.Tags)
+	ruleQuery := `
+		UPDATE recurring_expenses
+		SET name = ?, amount = ?, category = ?, start_date = ?, interval = ?, occurrences = ?, tags = ?, currency = ?, owner = ?, shared_with = ?
+		WHERE id = ? AND ledger_id = ?
+	`
+	res, err := tx.Exec(ruleQuery, recurringExpense.Name, recurringExpense.Amount, recurringExpense.Category, formatSQLiteTime(recurringExpense.StartDate), recurringExpense.Interval, recurringExpense.Occurrences, string(tagsJSON), recurringExpense.Currency, recurringExpense.Owner, marshalList(recurringExpense.SharedWith), id, s.ledger)
+	if err != nil {
+		return fmt.Errorf("failed to update recurring expense rule: %v", err)
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("recurring expense with ID %s not found to update", id)
+	}
+
+	if updateAll {
+		_, err = tx.Exec(`DELETE FROM expenses WHERE recurring_id = ? AND ledger_id = ?`, id, s.ledger)
+	} else {
+		_, err = tx.Exec(`DELETE FROM expenses WHERE recurring_id = ? AND ledger_id = ? AND date > ?`, id, s.ledger, formatSQLiteTime(time.Now()))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete old expense instances for update: %v", err)
+	}
+
+	for _, exp := range generateExpensesFromRecurring(recurringExpense, !updateAll) {
+		if err := s.insertExpense(tx, exp); err != nil {
+			return fmt.Errorf("failed to insert recurring expense instance for update: %v", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) RemoveRecurringExpense(id string, removeAll bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`DELETE FROM recurring_expenses WHERE id = ? AND ledger_id = ?`, id, s.ledger)
+	if err != nil {
+		return fmt.Errorf("failed to delete recurring expense rule: %v", err)
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return fmt.Errorf("recurring expense with ID %s not found", id)
+	}
+
+	if removeAll {
+		_, err = tx.Exec(`DELETE FROM expenses WHERE recurring_id = ? AND ledger_id = ?`, id, s.ledger)
+	} else {
+		_, err = tx.Exec(`DELETE FROM expenses WHERE recurring_id = ? AND ledger_id = ? AND date > ?`, id, s.ledger, formatSQLiteTime(time.Now()))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete expense instances: %v", err)
+	}
+	return tx.Commit()
+}
@@ -22,34 +22,74 @@ type Storage interface {
 	UpdateCurrency(currency string) error
 	GetStartDate() (int, error)
 	UpdateStartDate(startDate int) error
+	GetCategoryRules() ([]CategoryRule, error)
+	UpdateCategoryRules(rules []CategoryRule) error
+	GetCSVProfiles() ([]CSVProfile, error)
+	SaveCSVProfile(profile CSVProfile) error // adds the profile or replaces the one of the same name
+	RemoveCSVProfile(name string) error
+	GetDismissedDuplicates() ([]string, error) // pairs of expenses that are not duplicates, see DuplicatePairKey
+	DismissDuplicates(ids []string) error      // marks the expenses as not duplicates of each other
 
 	// Recurring Expenses
 	GetRecurringExpenses() ([]RecurringExpense, error)
 	GetRecurringExpense(id string) (RecurringExpense, error)
 	AddRecurringExpense(recurringExpense RecurringExpense) error
+	AddRecurringExpenseRule(recurringExpense RecurringExpense) error // stores the rule only, without generating expenses
 	RemoveRecurringExpense(id string, removeAll bool) error
 	UpdateRecurringExpense(id string, recurringExpense RecurringExpense, updateAll bool) error
 
 	// Expenses
 	GetAllExpenses() ([]Expense, error)
+	QueryExpenses(query ExpenseQuery) (*ExpenseQueryResult, error)
+	SummarizeExpenses(query SummaryQuery) (*Summary, error)
 	GetExpense(id string) (Expense, error)
 	AddExpense(expense Expense) error
 	RemoveExpense(id string) error
 	AddMultipleExpenses(expenses []Expense) error
+	// ImportExpenses stores the batches returned by next until it returns an empty batch, in one
+	// transaction; when next or a write fails, none of the expenses are stored. next must not
+	// use the store.
+	ImportExpenses(next func() ([]Expense, error)) (int, error)
 	RemoveMultipleExpenses(ids []string) error
 	UpdateExpense(id string, expense Expense) error
+	UpdateMultipleExpenses(expenses []Expense) error   // replaces the expenses of the same IDs, all or none
+	MergeExpenses(kept Expense, remove []string) error // replaces kept and removes the others, all or none
 
-	// Potential Future Feature: Multi-currency
-	// GetConversions() (map[string]float64, error)
-	// UpdateConversions(conversions map[string]float64) error
+	// Authentication
+	GetUsers() ([]User, error)
+	GetUser(username string) (User, error)
+	SaveUser(user User) error         // adds the user or updates its password
+	RemoveUser(username string) error // also revokes all of the user's tokens
+	GetAuthTokens(username string) ([]AuthToken, error)
+	GetAuthTokenByHash(hash string) (AuthToken, error)
+	AddAuthToken(token AuthToken) error
+	RemoveAuthToken(id string) error
+	RemoveExpiredAuthTokens() error
+
+	// Ledgers; users and tokens are shared by all ledgers of an instance
+	GetLedgers() ([]Ledger, error)
+	GetLedger(id string) (Ledger, error)
+	AddLedger(ledger Ledger) error
+	UpdateLedger(ledger Ledger) error     // renames or (un)archives the ledger
+	RemoveLedger(id string) error         // also deletes all of the ledger's data
+	ForLedger(id string) (Storage, error) // storage scoped to one ledger, "" for the default
+
+	// Conversion rates; shared by all ledgers of an instance
+	GetConversionRates() ([]ConversionRate, error)
+	SaveConversionRate(rate ConversionRate) error     // adds the rate or replaces the one of the same pair and day
+	SaveConversionRates(rates []ConversionRate) error // saves many rates at once, e.g., from a rate file
+	RemoveConversionRate(from, to string, date time.Time) error
 }
 
 // config for expense data
 type Config struct {
-	Categories        []string           `json:"categories"`
-	Currency          string             `json:"currency"`
-	StartDate         int                `json:"startDate"`
-	RecurringExpenses []RecurringExpense `json:"recurringExpenses"`
+	Categories          []string           `json:"categories"`
+	Currency            string             `json:"currency"`
+	StartDate           int                `json:"startDate"`
+	RecurringExpenses   []RecurringExpense `json:"recurringExpenses"`
+	CategoryRules       []CategoryRule     `json:"categoryRules"`
+	CSVProfiles         []CSVProfile       `json:"csvProfiles"`
+	DismissedDuplicates []string           `json:"dismissedDuplicates"`
 	// Tags              []string           `json:"tags"`
 }
 
@@ -63,6 +103,8 @@ type RecurringExpense struct {
 	StartDate   time.Time `json:"startDate"`   // date of the first occurrence
 	Interval    string    `json:"interval"`    // daily, weekly, monthly, yearly
 	Occurrences int       `json:"occurrences"` // 0 for 3000 occurrences (heuristic)
+	Owner       string    `json:"owner,omitempty"`
+	SharedWith  []string  `json:"sharedWith,omitempty"`
 }
 
 type BackendType string
@@ -70,6 +112,7 @@ type BackendType string
 const (
 	BackendTypeJSON     BackendType = "json"
 	BackendTypePostgres BackendType = "postgres"
+	BackendTypeSQLite   BackendType = "sqlite"
 )
 
 // config for the storage backend
@@ -91,6 +134,9 @@ type Expense struct {
 	Amount      float64   `json:"amount"`
 	Currency    string    `json:"currency"`
 	Date        time.Time `json:"date"`
+	Owner       string    `json:"owner,omitempty"`
+	SharedWith  []string  `json:"sharedWith,omitempty"`
+	ExternalID  string    `json:"externalID,omitempty"` // bank reference of imported expenses, to skip re-imports
 }
 
 func (c *Config) SetBaseConfig() {
@@ -99,6 +145,9 @@ func (c *Config) SetBaseConfig() {
 	c.StartDate = 1
 	// c.Tags = []string{}
 	c.RecurringExpenses = []RecurringExpense{}
+	c.CategoryRules = []CategoryRule{}
+	c.CSVProfiles = []CSVProfile{}
+	c.DismissedDuplicates = []string{}
 }
 
 func (c *SystemConfig) SetStorageConfig() {
@@ -115,6 +164,8 @@ func backendTypeFromEnv(env string) BackendType {
 		return BackendTypeJSON
 	case "postgres":
 		return BackendTypePostgres
+	case "sqlite":
+		return BackendTypeSQLite
 	default:
 		return BackendTypeJSON
 	}
@@ -140,11 +191,18 @@ func backendSSLFromEnv(env string) string {
 func InitializeStorage() (Storage, error) {
 	baseConfig := SystemConfig{}
 	baseConfig.SetStorageConfig()
+	return InitializeStorageFromConfig(baseConfig)
+}
+
+// initializes a storage backend from an explicit config instead of the environment
+func InitializeStorageFromConfig(baseConfig SystemConfig) (Storage, error) {
 	switch baseConfig.StorageType {
 	case BackendTypeJSON:
 		return InitializeJsonStore(baseConfig)
 	case BackendTypePostgres:
 		return InitializePostgresStore(baseConfig)
+	case BackendTypeSQLite:
+		return InitializeSQLiteStore(baseConfig)
 	}
 	return nil, fmt.Errorf("invalid data store: %s", baseConfig.StorageType)
 }
@@ -159,6 +217,15 @@ func SanitizeString(s string) string {
 	return strings.TrimSpace(sanitized)
 }
 
+// singleBatch hands the expenses to ImportExpenses as one batch
+func singleBatch(expenses []Expense) func() ([]Expense, error) {
+	return func() ([]Expense, error) {
+		batch := expenses
+		expenses = nil
+		return batch, nil
+	}
+}
+
 func ValidateCategory(category string) (string, error) {
 	sanitized := SanitizeString(category)
 	if sanitized == "" {
@@ -178,9 +245,14 @@ func (e *Expense) Validate() error {
 	if e.Amount == 0 {
 		return fmt.Errorf("expense 'amount' cannot be 0")
 	}
-	// if e.Currency == "" {
-	// 	return fmt.Errorf("expense 'currency' cannot be empty")
-	// }
+	// an empty currency is filled in with the ledger's currency when the expense is stored
+	if e.Currency != "" {
+		currency, err := ValidateCurrency(e.Currency)
+		if err != nil {
+			return err
+		}
+		e.Currency = currency
+	}
 	if len(e.Tags) > 0 {
 		var cleanedTags []string
 		for _, tag := range e.Tags {
@@ -205,6 +277,13 @@ func (e *RecurringExpense) Validate() error {
 	if e.Category == "" {
 		return fmt.Errorf("recurring expense 'category' cannot be empty")
 	}
+	if e.Currency != "" {
+		currency, err := ValidateCurrency(e.Currency)
+		if err != nil {
+			return err
+		}
+		e.Currency = currency
+	}
 	if len(e.Tags) > 0 {
 		var cleanedTags []string
 		for _, tag := range e.Tags {
@@ -36,8 +36,8 @@ const currencyBehaviors = {
     mad: {symbol: "DH", useComma: false, useDecimals: true, useSpace: true, right: true},
 };
 
-function formatCurrency(amount) {
-    const behavior = currencyBehaviors[currentCurrency] || {
+function formatCurrency(amount, currency = currentCurrency) {
+    const behavior = currencyBehaviors[currency || currentCurrency] || {
         symbol: "$",
         useComma: false,
         useDecimals: true,
@@ -57,6 +57,30 @@ function formatCurrency(amount) {
     return isNegative ? `-${result}` : result;
 }
 
+// convertExpenses returns copies of expenses in the base currency, keeping the original
+// amount and currency; the server converts them with the rate in effect on each date,
+// and amounts without a rate are left as they are
+async function convertExpenses(expenses, baseCurrency) {
+    const foreign = expenses.filter(e => e.currency && e.currency !== baseCurrency);
+    if (foreign.length === 0) return expenses;
+    const response = await fetch('/rates/convert', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({
+            to: baseCurrency,
+            amounts: foreign.map(e => ({ amount: e.amount, currency: e.currency, date: e.date }))
+        })
+    });
+    if (!response.ok) return expenses;
+    const converted = new Map();
+    (await response.json()).amounts.forEach((result, i) => {
+        if (result.converted) converted.set(foreign[i], result.amount);
+    });
+    return expenses.map(e => converted.has(e)
+        ? { ...e, amount: converted.get(e), originalAmount: e.amount, originalCurrency: e.currency }
+        : e);
+}
+
 function getUserTimeZone() {
     return Intl.DateTimeFormat().resolvedOptions().timeZone;
 }
@@ -152,3 +176,26 @@ function escapeHTML(str) {
         }[tag] || tag)
     );
 }
+
+// the ledger (book) picked in settings applies to every request made by the page
+function currentLedger() {
+    return localStorage.getItem('ledger') || 'default';
+}
+
+function withLedger(url) {
+    const ledger = currentLedger();
+    if (ledger === 'default' || typeof url !== 'string' || !url.startsWith('/') || url.startsWith('/ledgers')) return url;
+    return url + (url.includes('?') ? '&' : '?') + 'ledger=' + encodeURIComponent(ledger);
+}
+
+// with authentication enabled, an expired session sends the user back to the login page
+const nativeFetch = window.fetch.bind(window);
+window.fetch = async (...args) => {
+    args[0] = withLedger(args[0]);
+    const response = await nativeFetch(...args);
+
+    if (response.status === 401 && !response.url.endsWith('/login')) {
+        window.location.href = '/login?next=' + encodeURIComponent(window.location.pathname + window.location.search);
+    }
+    return response;
+};